@@ -68,7 +68,6 @@ if $experiment; then
         * ) echo "Exiting" 1>&2
             exit 1 ;;
     esac
-    # json='-X main.rewriteJSON=1'
     echo "build.sh: experimental code will be included" 1>&2
 fi
 
@@ -2,6 +2,7 @@ package status
 
 import (
 	"sync/atomic"
+	"time"
 )
 
 type Status int32
@@ -12,6 +13,7 @@ const (
 	StartingStatus
 	ActiveStatus
 	ErrorStatus
+	PausedStatus
 )
 
 //func (st *Status) GetString() string {
@@ -43,6 +45,8 @@ func (st *Status) GetString() string {
 		return "active"
 	case ErrorStatus:
 		return "error"
+	case PausedStatus:
+		return "paused"
 	default:
 		return "unknown"
 	}
@@ -68,6 +72,26 @@ func (st *Status) Error() {
 	st.set(ErrorStatus)
 }
 
+func (st *Status) Paused() {
+	st.set(PausedStatus)
+}
+
 func (st *Status) set(s Status) {
 	atomic.StoreInt32((*int32)(st), int32(s))
 }
+
+// Timestamp is a time that can be read and set concurrently.
+type Timestamp int64
+
+// Get returns the time, or the zero time if it has not been set.
+func (t *Timestamp) Get() time.Time {
+	ns := atomic.LoadInt64((*int64)(t))
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+func (t *Timestamp) Set(tm time.Time) {
+	atomic.StoreInt64((*int64)(t), tm.UnixNano())
+}
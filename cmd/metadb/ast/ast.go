@@ -52,14 +52,29 @@ type DropDataSourceStmt struct {
 func (*DropDataSourceStmt) node()     {}
 func (*DropDataSourceStmt) stmtNode() {}
 
+// AuthorizeStmt grants access to all tables in a data source, or to tables
+// specified by a table name or a regular expression.
 type AuthorizeStmt struct {
 	DataSourceName string
+	TableName      string
+	TablePattern   string
 	RoleName       string
 }
 
 func (*AuthorizeStmt) node()     {}
 func (*AuthorizeStmt) stmtNode() {}
 
+// DeauthorizeStmt revokes access granted by AuthorizeStmt.
+type DeauthorizeStmt struct {
+	DataSourceName string
+	TableName      string
+	TablePattern   string
+	RoleName       string
+}
+
+func (*DeauthorizeStmt) node()     {}
+func (*DeauthorizeStmt) stmtNode() {}
+
 type CreateUserStmt struct {
 	UserName string
 	Options  []Option
@@ -68,6 +83,21 @@ type CreateUserStmt struct {
 func (*CreateUserStmt) node()     {}
 func (*CreateUserStmt) stmtNode() {}
 
+type AlterUserStmt struct {
+	UserName string
+	Options  []Option
+}
+
+func (*AlterUserStmt) node()     {}
+func (*AlterUserStmt) stmtNode() {}
+
+type DropUserStmt struct {
+	UserName string
+}
+
+func (*DropUserStmt) node()     {}
+func (*DropUserStmt) stmtNode() {}
+
 type ListStmt struct {
 	Name string
 }
@@ -101,3 +131,85 @@ type VerifyConsistencyStmt struct {
 
 func (*VerifyConsistencyStmt) node()     {}
 func (*VerifyConsistencyStmt) stmtNode() {}
+
+// CreateMaskingPolicyStmt defines a policy for masking the data in a column as
+// it is written to the database.
+type CreateMaskingPolicyStmt struct {
+	PolicyName string
+	TableName  string
+	ColumnName string
+	Method     string
+	Options    []Option
+}
+
+func (*CreateMaskingPolicyStmt) node()     {}
+func (*CreateMaskingPolicyStmt) stmtNode() {}
+
+type DropMaskingPolicyStmt struct {
+	PolicyName string
+}
+
+func (*DropMaskingPolicyStmt) node()     {}
+func (*DropMaskingPolicyStmt) stmtNode() {}
+
+type CreateJSONTransformStmt struct {
+	TransformName string
+	TableName     string
+	ColumnName    string
+	Method        string
+	Options       []Option
+}
+
+func (*CreateJSONTransformStmt) node()     {}
+func (*CreateJSONTransformStmt) stmtNode() {}
+
+type DropJSONTransformStmt struct {
+	TransformName string
+}
+
+func (*DropJSONTransformStmt) node()     {}
+func (*DropJSONTransformStmt) stmtNode() {}
+
+// ReplayDeadLettersStmt requests that dead letters be applied again.  If ID is
+// set, only that dead letter is replayed; otherwise all dead letters are
+// replayed, or those of DataSourceName if it is set.
+type ReplayDeadLettersStmt struct {
+	DataSourceName string
+	ID             string
+}
+
+func (*ReplayDeadLettersStmt) node()     {}
+func (*ReplayDeadLettersStmt) stmtNode() {}
+
+// PurgeDeadLettersStmt removes dead letters, selected in the same way as for
+// ReplayDeadLettersStmt.
+type PurgeDeadLettersStmt struct {
+	DataSourceName string
+	ID             string
+}
+
+func (*PurgeDeadLettersStmt) node()     {}
+func (*PurgeDeadLettersStmt) stmtNode() {}
+
+// ResetOffsetsStmt requests that a running Kafka data source seek to a new
+// position.  Position is "earliest", "latest", or "timestamp", in which case
+// Timestamp is set.  If Topic is set, only partitions of that topic are reset.
+type ResetOffsetsStmt struct {
+	DataSourceName string
+	Topic          string
+	Position       string
+	Timestamp      string
+}
+
+func (*ResetOffsetsStmt) node()     {}
+func (*ResetOffsetsStmt) stmtNode() {}
+
+// PauseDataSourceStmt requests that a running data source stop reading change
+// events, if Pause is true, or continue reading them, if Pause is false.
+type PauseDataSourceStmt struct {
+	DataSourceName string
+	Pause          bool
+}
+
+func (*PauseDataSourceStmt) node()     {}
+func (*PauseDataSourceStmt) stmtNode() {}
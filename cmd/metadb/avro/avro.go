@@ -0,0 +1,333 @@
+// Package avro decodes data in the Apache Avro binary encoding.
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Schema is a parsed Avro schema.
+type Schema struct {
+	// Type is a primitive type name, or one of "record", "enum", "array",
+	// "map", "union", or "fixed".
+	Type string
+	// Name is the full name of a named type.
+	Name string
+	// Fields are the fields of a record.
+	Fields []*Field
+	// Items is the schema of array items.
+	Items *Schema
+	// Values is the schema of map values.
+	Values *Schema
+	// Branches are the schemas of a union.
+	Branches []*Schema
+	// Symbols are the symbols of an enum.
+	Symbols []string
+	// Size is the size of a fixed type.
+	Size int
+	// Props holds other attributes of the schema, such as "logicalType",
+	// "connect.name", and "connect.parameters".
+	Props map[string]interface{}
+}
+
+// Field is a field of a record.
+type Field struct {
+	Name string
+	Type *Schema
+}
+
+var primitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true,
+	"bytes": true, "string": true,
+}
+
+// Parse parses a schema in JSON form.
+func Parse(s string) (*Schema, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("parsing schema: %v", err)
+	}
+	p := &parser{names: make(map[string]*Schema)}
+	return p.parse(v, "")
+}
+
+type parser struct {
+	names map[string]*Schema
+}
+
+func (p *parser) parse(v interface{}, namespace string) (*Schema, error) {
+	switch t := v.(type) {
+	case string:
+		if primitives[t] {
+			return &Schema{Type: t}, nil
+		}
+		return p.lookup(t, namespace)
+	case []interface{}:
+		s := &Schema{Type: "union"}
+		for _, b := range t {
+			bs, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, bs)
+		}
+		return s, nil
+	case map[string]interface{}:
+		return p.parseObject(t, namespace)
+	default:
+		return nil, fmt.Errorf("parsing schema: unexpected %T", v)
+	}
+}
+
+func (p *parser) lookup(name, namespace string) (*Schema, error) {
+	if !strings.Contains(name, ".") && namespace != "" {
+		if s, ok := p.names[namespace+"."+name]; ok {
+			return s, nil
+		}
+	}
+	if s, ok := p.names[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("parsing schema: unknown type %q", name)
+}
+
+func (p *parser) parseObject(m map[string]interface{}, namespace string) (*Schema, error) {
+	typ, ok := m["type"].(string)
+	if !ok {
+		// The type may itself be a schema, e.g. {"type": {"type": "int"}}.
+		if m["type"] == nil {
+			return nil, fmt.Errorf("parsing schema: missing type")
+		}
+		return p.parse(m["type"], namespace)
+	}
+	s := &Schema{Type: typ, Props: make(map[string]interface{})}
+	for k, v := range m {
+		switch k {
+		case "type", "name", "namespace", "fields", "items", "values", "symbols", "size", "aliases", "doc", "default":
+		default:
+			s.Props[k] = v
+		}
+	}
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		name, _ := m["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("parsing schema: %s has no name", typ)
+		}
+		if ns, ok := m["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		if strings.Contains(name, ".") {
+			namespace = name[:strings.LastIndex(name, ".")]
+			s.Name = name
+		} else if namespace != "" {
+			s.Name = namespace + "." + name
+		} else {
+			s.Name = name
+		}
+		// Register the name before parsing fields, to allow recursive
+		// types.
+		p.names[s.Name] = s
+	}
+	switch typ {
+	case "record", "error":
+		s.Type = "record"
+		fields, _ := m["fields"].([]interface{})
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("parsing schema: %s: invalid field", s.Name)
+			}
+			name, _ := fm["name"].(string)
+			ft, err := p.parse(fm["type"], namespace)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", s.Name, name, err)
+			}
+			s.Fields = append(s.Fields, &Field{Name: name, Type: ft})
+		}
+	case "enum":
+		symbols, _ := m["symbols"].([]interface{})
+		for _, sym := range symbols {
+			str, _ := sym.(string)
+			s.Symbols = append(s.Symbols, str)
+		}
+	case "fixed":
+		size, _ := m["size"].(float64)
+		s.Size = int(size)
+	case "array":
+		items, err := p.parse(m["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	case "map":
+		values, err := p.parse(m["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.Values = values
+	default:
+		if !primitives[typ] {
+			// A reference to a named type, with attributes.
+			return p.lookup(typ, namespace)
+		}
+	}
+	return s, nil
+}
+
+// Decode decodes a value in the binary encoding.  Values are returned as nil
+// (null), bool, int32 (int), int64 (long), float32, float64, []byte (bytes
+// and fixed), string (string and enum), []interface{} (array),
+// map[string]interface{} (map and record), or the value of the selected
+// branch of a union.  Any remaining data after the value is returned.
+func Decode(s *Schema, data []byte) (interface{}, []byte, error) {
+	d := &decoder{buf: data}
+	v := d.decode(s)
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return v, d.buf, nil
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("avro: "+format, args...)
+	}
+}
+
+func (d *decoder) long() int64 {
+	if d.err != nil {
+		return 0
+	}
+	u, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("invalid integer")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	// Zig-zag decoding
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (d *decoder) next(n int64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || int64(len(d.buf)) < n {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) decode(s *Schema) interface{} {
+	if d.err != nil {
+		return nil
+	}
+	switch s.Type {
+	case "null":
+		return nil
+	case "boolean":
+		b := d.next(1)
+		if d.err != nil {
+			return nil
+		}
+		return b[0] != 0
+	case "int":
+		return int32(d.long())
+	case "long":
+		return d.long()
+	case "float":
+		b := d.next(4)
+		if d.err != nil {
+			return nil
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case "double":
+		b := d.next(8)
+		if d.err != nil {
+			return nil
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case "bytes":
+		b := d.next(d.long())
+		if d.err != nil {
+			return nil
+		}
+		return append([]byte{}, b...)
+	case "string":
+		b := d.next(d.long())
+		if d.err != nil {
+			return nil
+		}
+		return string(b)
+	case "fixed":
+		b := d.next(int64(s.Size))
+		if d.err != nil {
+			return nil
+		}
+		return append([]byte{}, b...)
+	case "enum":
+		i := d.long()
+		if i < 0 || i >= int64(len(s.Symbols)) {
+			d.fail("%s: invalid enum index %d", s.Name, i)
+			return nil
+		}
+		return s.Symbols[i]
+	case "union":
+		i := d.long()
+		if i < 0 || i >= int64(len(s.Branches)) {
+			d.fail("invalid union index %d", i)
+			return nil
+		}
+		return d.decode(s.Branches[i])
+	case "record":
+		m := make(map[string]interface{}, len(s.Fields))
+		for _, f := range s.Fields {
+			m[f.Name] = d.decode(f.Type)
+		}
+		return m
+	case "array":
+		a := make([]interface{}, 0)
+		for n := d.blockCount(); n > 0 && d.err == nil; n = d.blockCount() {
+			for i := int64(0); i < n && d.err == nil; i++ {
+				a = append(a, d.decode(s.Items))
+			}
+		}
+		return a
+	case "map":
+		m := make(map[string]interface{})
+		for n := d.blockCount(); n > 0 && d.err == nil; n = d.blockCount() {
+			for i := int64(0); i < n && d.err == nil; i++ {
+				k := d.decode(&Schema{Type: "string"})
+				ks, _ := k.(string)
+				m[ks] = d.decode(s.Values)
+			}
+		}
+		return m
+	default:
+		d.fail("unknown type %q", s.Type)
+		return nil
+	}
+}
+
+// blockCount reads the item count of an array or map block.  A negative count
+// is followed by the block size in bytes, which is not needed.
+func (d *decoder) blockCount() int64 {
+	n := d.long()
+	if n < 0 {
+		_ = d.long()
+		n = -n
+	}
+	return n
+}
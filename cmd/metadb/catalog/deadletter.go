@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// DeadLetter is a change event that could not be parsed or written to the
+// database.
+type DeadLetter struct {
+	ID     int64
+	Source string
+	// Offset is the position of the event, if it was read from Kafka.
+	Offset *change.Offset
+	// Key and Value are the key and value of the event in JSON format.
+	Key   string
+	Value string
+	Error string
+}
+
+// WriteDeadLetter records a dead letter, adding the number of attempts made to
+// process the event.  If the same event has already been recorded, the error
+// is replaced.  An event is identified by its offset, or by its key and value
+// if it has no offset, so that an event read again after a restart is not
+// recorded twice.
+func WriteDeadLetter(dq dbx.Queryable, d *DeadLetter, attempts int) error {
+	if d.Offset == nil {
+		q := "UPDATE " + catalogSchema + ".dead_letter " +
+			"SET error=$4, attempts=attempts+$5, replay=FALSE " +
+			"WHERE source_name=$1 AND topic IS NULL AND message_key=$2 AND message_value=$3"
+		tag, err := dq.Exec(context.TODO(), q, d.Source, d.Key, d.Value, d.Error, attempts)
+		if err != nil {
+			return fmt.Errorf("writing dead letter for source %q: %v", d.Source, err)
+		}
+		if tag.RowsAffected() > 0 {
+			return nil
+		}
+	}
+	var topic *string
+	var partition *int32
+	var offset *int64
+	if d.Offset != nil {
+		topic = &d.Offset.Topic
+		partition = &d.Offset.Partition
+		offset = &d.Offset.Offset
+	}
+	q := "INSERT INTO " + catalogSchema + ".dead_letter " +
+		"(source_name, topic, partition, message_offset, message_key, message_value, error, attempts) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8) " +
+		"ON CONFLICT (source_name, topic, partition, message_offset) DO UPDATE " +
+		"SET error=EXCLUDED.error, attempts=dead_letter.attempts+EXCLUDED.attempts, replay=FALSE"
+	if _, err := dq.Exec(context.TODO(), q, d.Source, topic, partition, offset, d.Key, d.Value, d.Error,
+		attempts); err != nil {
+		return fmt.Errorf("writing dead letter for source %q: %v", d.Source, err)
+	}
+	return nil
+}
+
+// ReadReplayDeadLetters returns the dead letters of a source that have been
+// marked to be replayed, in the order they were recorded.
+func ReadReplayDeadLetters(dq dbx.Queryable, source string) ([]*DeadLetter, error) {
+	q := "SELECT id, topic, partition, message_offset, message_key, message_value, error " +
+		"FROM " + catalogSchema + ".dead_letter WHERE source_name=$1 AND replay ORDER BY id"
+	rows, err := dq.Query(context.TODO(), q, source)
+	if err != nil {
+		return nil, fmt.Errorf("reading dead letters for source %q: %v", source, err)
+	}
+	defer rows.Close()
+	var letters []*DeadLetter
+	for rows.Next() {
+		d := &DeadLetter{Source: source}
+		var topic *string
+		var partition *int32
+		var offset *int64
+		if err := rows.Scan(&d.ID, &topic, &partition, &offset, &d.Key, &d.Value, &d.Error); err != nil {
+			return nil, fmt.Errorf("reading dead letters for source %q: %v", source, err)
+		}
+		if topic != nil && partition != nil && offset != nil {
+			d.Offset = &change.Offset{
+				TopicPartition: change.TopicPartition{Topic: *topic, Partition: *partition},
+				Offset:         *offset,
+			}
+		}
+		letters = append(letters, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading dead letters for source %q: %v", source, err)
+	}
+	return letters, nil
+}
+
+// DeleteDeadLetter removes a dead letter that has been replayed successfully.
+func DeleteDeadLetter(dq dbx.Queryable, id int64) error {
+	q := "DELETE FROM " + catalogSchema + ".dead_letter WHERE id=$1"
+	if _, err := dq.Exec(context.TODO(), q, id); err != nil {
+		return fmt.Errorf("deleting dead letter %d: %v", id, err)
+	}
+	return nil
+}
+
+// FailDeadLetter records that replaying a dead letter has failed.
+func FailDeadLetter(dq dbx.Queryable, id int64, errstr string) error {
+	q := "UPDATE " + catalogSchema + ".dead_letter SET error=$2, attempts=attempts+1, replay=FALSE WHERE id=$1"
+	if _, err := dq.Exec(context.TODO(), q, id, errstr); err != nil {
+		return fmt.Errorf("updating dead letter %d: %v", id, err)
+	}
+	return nil
+}
@@ -25,7 +25,7 @@ type Catalog struct {
 	users              map[string]*util.RegexList
 	columns            map[dbx.Column]string
 	indexes            map[dbx.Column]struct{}
-	lastSnapshotRecord time.Time
+	lastSnapshotRecord map[string]time.Time
 	dp                 *pgxpool.Pool
 	lz4                bool
 }
@@ -133,11 +133,22 @@ var systemTables = []systemTableDef{
 	{table: dbx.Table{Schema: catalogSchema, Table: "auth"}, create: createTableAuth},
 	{table: dbx.Table{Schema: catalogSchema, Table: "init"}, create: createTableInit},
 	{table: dbx.Table{Schema: catalogSchema, Table: "log"}, create: createTableLog},
-	{table: dbx.Table{Schema: catalogSchema, Table: "maintenance"}, create: createTableMaintenance},
 	{table: dbx.Table{Schema: catalogSchema, Table: "origin"}, create: createTableOrigin},
 	{table: dbx.Table{Schema: catalogSchema, Table: "source"}, create: createTableSource},
 	{table: dbx.Table{Schema: catalogSchema, Table: "table_update"}, create: createTableUpdate},
 	{table: dbx.Table{Schema: catalogSchema, Table: "base_table"}, create: createTableBaseTable},
+	{table: dbx.Table{Schema: catalogSchema, Table: "user_role"}, create: createTableUserRole},
+	{table: dbx.Table{Schema: catalogSchema, Table: "file_offset"}, create: createTableFileOffset},
+	{table: dbx.Table{Schema: catalogSchema, Table: "masking_policy"}, create: createTableMaskingPolicy},
+	{table: dbx.Table{Schema: catalogSchema, Table: "masking_key"}, create: createTableMaskingKey},
+	{table: dbx.Table{Schema: catalogSchema, Table: "json_transform"}, create: createTableJSONTransform},
+	{table: dbx.Table{Schema: catalogSchema, Table: "kafka_offset"}, create: createTableKafkaOffset},
+	{table: dbx.Table{Schema: catalogSchema, Table: "dead_letter"}, create: createTableDeadLetter},
+	{table: dbx.Table{Schema: catalogSchema, Table: "kafka_option"}, create: createTableKafkaOption},
+	{table: dbx.Table{Schema: catalogSchema, Table: "source_status"}, create: createTableSourceStatus},
+	{table: dbx.Table{Schema: catalogSchema, Table: "kafka_partition_status"}, create: createTableKafkaPartitionStatus},
+	{table: dbx.Table{Schema: catalogSchema, Table: "source_lag"}, create: createViewSourceLag},
+	{table: dbx.Table{Schema: catalogSchema, Table: "kafka_offset_reset"}, create: createTableKafkaOffsetReset},
 }
 
 //func SystemTables() []dbx.Table {
@@ -212,21 +223,6 @@ func createTableLog(tx pgx.Tx) error {
 	return nil
 }
 
-func createTableMaintenance(tx pgx.Tx) error {
-	q := "CREATE TABLE " + catalogSchema + ".maintenance (" +
-		"next_maintenance_time timestamptz)"
-	if _, err := tx.Exec(context.TODO(), q); err != nil {
-		return err
-	}
-	q = "INSERT INTO " + catalogSchema + ".maintenance " +
-		"(next_maintenance_time) VALUES " +
-		"(CURRENT_DATE::timestamptz + INTERVAL '1 day' + INTERVAL '3 hours')"
-	if _, err := tx.Exec(context.TODO(), q); err != nil {
-		return err
-	}
-	return nil
-}
-
 func createTableOrigin(tx pgx.Tx) error {
 	q := "CREATE TABLE " + catalogSchema + ".origin (" +
 		"name text PRIMARY KEY)"
@@ -250,7 +246,22 @@ func createTableSource(tx pgx.Tx) error {
 		"trimschemaprefix text, " +
 		"addschemaprefix text, " +
 		"module text, " +
-		"sync smallint NOT NULL DEFAULT 1)"
+		"sync smallint NOT NULL DEFAULT 1, " +
+		"type text NOT NULL DEFAULT 'kafka', " +
+		"connection text, " +
+		"publication text, " +
+		"slot text, " +
+		"path text, " +
+		"schemaregistry text, " +
+		"schemarewrite text, " +
+		"tablerewrite text, " +
+		"tablepassfilter text, " +
+		"columnpassfilter text, " +
+		"columnstopfilter text, " +
+		"deadletter text, " +
+		"paused boolean NOT NULL DEFAULT FALSE, " +
+		"next_maintenance_time timestamptz NOT NULL " +
+		"DEFAULT CURRENT_DATE::timestamptz + INTERVAL '1 day' + INTERVAL '3 hours')"
 	if _, err := tx.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating table "+catalogSchema+".source: %v", err)
 	}
@@ -285,6 +296,190 @@ func createTableBaseTable(tx pgx.Tx) error {
 	return nil
 }
 
+// createTableUserRole creates the table of Metadb roles, which determine the
+// statements that users may run on the Metadb server.
+func createTableUserRole(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".user_role (" +
+		"username text PRIMARY KEY, " +
+		"role text NOT NULL CHECK (role IN ('admin', 'operator', 'readonly')))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".user_role: %v", err)
+	}
+	return nil
+}
+
+func createTableFileOffset(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".file_offset (" +
+		"source_name text PRIMARY KEY, " +
+		"file_name text NOT NULL, " +
+		"file_offset bigint NOT NULL)"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".file_offset: %v", err)
+	}
+	return nil
+}
+
+func createTableKafkaOffset(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".kafka_offset (" +
+		"source_name text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"partition integer NOT NULL, " +
+		"next_offset bigint NOT NULL, " +
+		"PRIMARY KEY (source_name, topic, partition))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".kafka_offset: %v", err)
+	}
+	return nil
+}
+
+// createTableKafkaOption creates a table of Kafka consumer properties set by
+// data source options.
+func createTableKafkaOption(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".kafka_option (" +
+		"source_name text NOT NULL, " +
+		"name text NOT NULL, " +
+		"value text NOT NULL, " +
+		"secret boolean NOT NULL, " +
+		"PRIMARY KEY (source_name, name))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".kafka_option: %v", err)
+	}
+	return nil
+}
+
+func createTableSourceStatus(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".source_status (" +
+		"source_name text PRIMARY KEY, " +
+		"status text NOT NULL, " +
+		"events_per_second real, " +
+		"last_event_time timestamptz, " +
+		"last_error text, " +
+		"updated timestamptz NOT NULL)"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".source_status: %v", err)
+	}
+	return nil
+}
+
+func createTableKafkaPartitionStatus(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".kafka_partition_status (" +
+		"source_name text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"partition integer NOT NULL, " +
+		"committed_offset bigint NOT NULL, " +
+		"high_watermark bigint, " +
+		"updated timestamptz NOT NULL, " +
+		"PRIMARY KEY (source_name, topic, partition))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".kafka_partition_status: %v", err)
+	}
+	return nil
+}
+
+// createViewSourceLag creates a view of the status and lag of data sources,
+// for use in monitoring.
+func createViewSourceLag(tx pgx.Tx) error {
+	q := "CREATE VIEW " + catalogSchema + ".source_lag AS " +
+		"SELECT s.source_name, " +
+		"p.topic, " +
+		"p.partition, " +
+		"p.committed_offset, " +
+		"p.high_watermark, " +
+		"CASE WHEN p.high_watermark IS NOT NULL " +
+		"THEN greatest(p.high_watermark - p.committed_offset, 0) END AS lag, " +
+		"s.status, " +
+		"s.events_per_second, " +
+		"s.last_event_time, " +
+		"s.last_error, " +
+		"greatest(s.updated, p.updated) AS updated " +
+		"FROM " + catalogSchema + ".source_status AS s " +
+		"LEFT JOIN " + catalogSchema + ".kafka_partition_status AS p ON s.source_name = p.source_name"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating view "+catalogSchema+".source_lag: %v", err)
+	}
+	return nil
+}
+
+func createTableKafkaOffsetReset(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".kafka_offset_reset (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"topic text, " +
+		"position text NOT NULL, " +
+		"reset_time timestamptz, " +
+		"requested timestamptz NOT NULL DEFAULT now())"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".kafka_offset_reset: %v", err)
+	}
+	return nil
+}
+
+func createTableDeadLetter(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".dead_letter (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"topic text, " +
+		"partition integer, " +
+		"message_offset bigint, " +
+		"message_key text, " +
+		"message_value text, " +
+		"error text NOT NULL, " +
+		"attempts integer NOT NULL, " +
+		"created timestamptz NOT NULL DEFAULT now(), " +
+		"replay boolean NOT NULL DEFAULT FALSE, " +
+		"UNIQUE (source_name, topic, partition, message_offset))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".dead_letter: %v", err)
+	}
+	return nil
+}
+
+func createTableMaskingPolicy(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".masking_policy (" +
+		"name text PRIMARY KEY, " +
+		"schema_name text NOT NULL, " +
+		"table_name text NOT NULL, " +
+		"column_name text NOT NULL, " +
+		"method text NOT NULL, " +
+		"length integer, " +
+		"UNIQUE (schema_name, table_name, column_name))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".masking_policy: %v", err)
+	}
+	return nil
+}
+
+func createTableMaskingKey(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".masking_key (key bytea NOT NULL)"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".masking_key: %v", err)
+	}
+	if err := InitMaskingKey(tx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func createTableJSONTransform(tx pgx.Tx) error {
+	q := "CREATE TABLE " + catalogSchema + ".json_transform (" +
+		"name text PRIMARY KEY, " +
+		"schema_name text NOT NULL, " +
+		"table_name text NOT NULL, " +
+		"column_name text NOT NULL, " +
+		"method text NOT NULL, " +
+		"target_table text, " +
+		"depth integer, " +
+		"paths text, " +
+		"UNIQUE (schema_name, table_name, column_name))"
+	if _, err := tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("creating table "+catalogSchema+".json_transform: %v", err)
+	}
+	if err := InitJSONTransforms(tx); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (c *Catalog) TableUpdatedNow(table dbx.Table, elapsedTime time.Duration) error {
 	realtime := float32(math.Round(elapsedTime.Seconds()*10000) / 10000)
 	u := catalogSchema + ".table_update"
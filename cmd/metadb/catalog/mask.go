@@ -0,0 +1,62 @@
+package catalog
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/mask"
+)
+
+// InitMaskingKey generates a random key for the hmac masking method and
+// stores it in the catalog.  The same key is used for all policies so that
+// masked values can be joined across tables.
+func InitMaskingKey(dq dbx.Queryable) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("generating masking key: %v", err)
+	}
+	q := "INSERT INTO " + catalogSchema + ".masking_key (key) VALUES ($1)"
+	if _, err := dq.Exec(context.TODO(), q, key); err != nil {
+		return fmt.Errorf("writing masking key: %v", err)
+	}
+	return nil
+}
+
+// ReadMaskingPolicies returns all masking policies and the masking key.
+func ReadMaskingPolicies(dq dbx.Queryable) ([]*mask.Policy, []byte, error) {
+	q := "SELECT name, schema_name, table_name, column_name, method, coalesce(length, 0) FROM " +
+		catalogSchema + ".masking_policy"
+	rows, err := dq.Query(context.TODO(), q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading masking policies: %v", err)
+	}
+	defer rows.Close()
+	var policies []*mask.Policy
+	for rows.Next() {
+		var p mask.Policy
+		if err = rows.Scan(&p.Name, &p.Table.Schema, &p.Table.Table, &p.Column, &p.Method, &p.Length); err != nil {
+			return nil, nil, fmt.Errorf("reading masking policies: %v", err)
+		}
+		policies = append(policies, &p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("reading masking policies: %v", err)
+	}
+	if len(policies) == 0 {
+		return nil, nil, nil
+	}
+	var key []byte
+	q = "SELECT key FROM " + catalogSchema + ".masking_key LIMIT 1"
+	err = dq.QueryRow(context.TODO(), q).Scan(&key)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil, fmt.Errorf("reading masking key: key not found")
+	case err != nil:
+		return nil, nil, fmt.Errorf("reading masking key: %v", err)
+	}
+	return policies, key, nil
+}
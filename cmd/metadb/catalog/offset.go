@@ -0,0 +1,149 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// ReadFileOffset returns the position of a file data source:  the name of the
+// file being read and the offset within the file (after decompression).  The
+// file name is "" if no position has been recorded.
+func ReadFileOffset(dq dbx.Queryable, source string) (string, int64, error) {
+	q := "SELECT file_name, file_offset FROM " + catalogSchema + ".file_offset WHERE source_name=$1"
+	var fileName string
+	var offset int64
+	err := dq.QueryRow(context.TODO(), q, source).Scan(&fileName, &offset)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "", 0, nil
+	case err != nil:
+		return "", 0, fmt.Errorf("reading file offset for source %q: %v", source, err)
+	default:
+		return fileName, offset, nil
+	}
+}
+
+// WriteFileOffset records the position of a file data source.  Nothing is
+// written if the data source no longer exists.
+func WriteFileOffset(dq dbx.Queryable, source, fileName string, offset int64) error {
+	q := "INSERT INTO " + catalogSchema + ".file_offset (source_name, file_name, file_offset) " +
+		"SELECT $1, $2::text, $3::bigint WHERE " + sourceExistsCondition() + " " +
+		"ON CONFLICT (source_name) DO UPDATE SET file_name=EXCLUDED.file_name, file_offset=EXCLUDED.file_offset"
+	if _, err := dq.Exec(context.TODO(), q, source, fileName, offset); err != nil {
+		return fmt.Errorf("writing file offset for source %q: %v", source, err)
+	}
+	return nil
+}
+
+// ReadKafkaOffsets returns the positions of a Kafka data source:  the offset of
+// the next event to be read in each topic partition.  Topic partitions for
+// which no position has been recorded are not included.
+func ReadKafkaOffsets(dq dbx.Queryable, source string) (map[change.TopicPartition]int64, error) {
+	q := "SELECT topic, partition, next_offset FROM " + catalogSchema + ".kafka_offset WHERE source_name=$1"
+	rows, err := dq.Query(context.TODO(), q, source)
+	if err != nil {
+		return nil, fmt.Errorf("reading Kafka offsets for source %q: %v", source, err)
+	}
+	defer rows.Close()
+	offsets := make(map[change.TopicPartition]int64)
+	for rows.Next() {
+		var tp change.TopicPartition
+		var offset int64
+		if err := rows.Scan(&tp.Topic, &tp.Partition, &offset); err != nil {
+			return nil, fmt.Errorf("reading Kafka offsets for source %q: %v", source, err)
+		}
+		offsets[tp] = offset
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading Kafka offsets for source %q: %v", source, err)
+	}
+	return offsets, nil
+}
+
+// WriteKafkaOffsets records the positions of a Kafka data source, given as the
+// offset of the next event to be read in each topic partition.  It is called
+// within the transaction that writes the data read from the source, so that
+// the positions are committed together with the data.  Nothing is written if
+// the data source no longer exists.
+func WriteKafkaOffsets(dq dbx.Queryable, source string, offsets map[change.TopicPartition]int64) error {
+	if len(offsets) == 0 {
+		return nil
+	}
+	topics := make([]string, 0, len(offsets))
+	partitions := make([]int32, 0, len(offsets))
+	nextOffsets := make([]int64, 0, len(offsets))
+	for tp, offset := range offsets {
+		topics = append(topics, tp.Topic)
+		partitions = append(partitions, tp.Partition)
+		nextOffsets = append(nextOffsets, offset)
+	}
+	q := "INSERT INTO " + catalogSchema + ".kafka_offset (source_name, topic, partition, next_offset) " +
+		"SELECT $1, unnest($2::text[]), unnest($3::integer[]), unnest($4::bigint[]) " +
+		"WHERE " + sourceExistsCondition() + " " +
+		"ON CONFLICT (source_name, topic, partition) DO UPDATE SET next_offset=EXCLUDED.next_offset"
+	if _, err := dq.Exec(context.TODO(), q, source, topics, partitions, nextOffsets); err != nil {
+		return fmt.Errorf("writing Kafka offsets for source %q: %v", source, err)
+	}
+	return nil
+}
+
+// KafkaOffsetReset is a request to move a Kafka data source to a new position.
+type KafkaOffsetReset struct {
+	ID int64
+	// Topic is the topic to be reset, or "" for all topics.
+	Topic string
+	// Position is "earliest", "latest", or "timestamp".
+	Position string
+	// Time is the timestamp to reset to, if Position is "timestamp".
+	Time time.Time
+	// Requested is the time when the request was made.
+	Requested time.Time
+}
+
+// ReadKafkaOffsetResets returns the pending requests to reset the offsets of
+// a Kafka data source, in the order they were made.
+func ReadKafkaOffsetResets(dq dbx.Queryable, source string) ([]*KafkaOffsetReset, error) {
+	q := "SELECT id, topic, position, reset_time, requested FROM " + catalogSchema + ".kafka_offset_reset " +
+		"WHERE source_name=$1 ORDER BY id"
+	rows, err := dq.Query(context.TODO(), q, source)
+	if err != nil {
+		return nil, fmt.Errorf("reading offset resets for source %q: %v", source, err)
+	}
+	defer rows.Close()
+	var resets []*KafkaOffsetReset
+	for rows.Next() {
+		r := &KafkaOffsetReset{}
+		var topic *string
+		var t *time.Time
+		if err := rows.Scan(&r.ID, &topic, &r.Position, &t, &r.Requested); err != nil {
+			return nil, fmt.Errorf("reading offset resets for source %q: %v", source, err)
+		}
+		if topic != nil {
+			r.Topic = *topic
+		}
+		if t != nil {
+			r.Time = *t
+		}
+		resets = append(resets, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading offset resets for source %q: %v", source, err)
+	}
+	return resets, nil
+}
+
+// DeleteKafkaOffsetReset removes a request to reset offsets after it has been
+// carried out.
+func DeleteKafkaOffsetReset(dq dbx.Queryable, id int64) error {
+	q := "DELETE FROM " + catalogSchema + ".kafka_offset_reset WHERE id=$1"
+	if _, err := dq.Exec(context.TODO(), q, id); err != nil {
+		return fmt.Errorf("deleting offset reset %d: %v", id, err)
+	}
+	return nil
+}
@@ -5,21 +5,27 @@ import (
 )
 
 func (c *Catalog) initSnapshot() {
-	c.reset()
+	c.lastSnapshotRecord = make(map[string]time.Time)
 }
 
-func (c *Catalog) ResetLastSnapshotRecord() {
+// ResetLastSnapshotRecord records that a snapshot record has been received
+// from a data source.
+func (c *Catalog) ResetLastSnapshotRecord(source string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.reset()
+	c.lastSnapshotRecord[source] = time.Now()
 }
 
-func (c *Catalog) reset() {
-	c.lastSnapshotRecord = time.Now()
-}
-
-func (c *Catalog) HoursSinceLastSnapshotRecord() float64 {
+// HoursSinceLastSnapshotRecord returns the time elapsed since a snapshot record
+// was last received from a data source.  The time is measured from the first
+// call if no snapshot record has been received.
+func (c *Catalog) HoursSinceLastSnapshotRecord(source string) float64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return time.Since(c.lastSnapshotRecord).Hours()
+	t, ok := c.lastSnapshotRecord[source]
+	if !ok {
+		t = time.Now()
+		c.lastSnapshotRecord[source] = t
+	}
+	return time.Since(t).Hours()
 }
@@ -0,0 +1,34 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// SourcePaused returns true if a data source has been paused using ALTER DATA
+// SOURCE ... PAUSE.
+func SourcePaused(dq dbx.Queryable, source string) (bool, error) {
+	q := "SELECT paused FROM " + catalogSchema + ".source WHERE name=$1"
+	var paused bool
+	err := dq.QueryRow(context.TODO(), q, source).Scan(&paused)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("reading paused state of source %q: %v", source, err)
+	default:
+		return paused, nil
+	}
+}
+
+// sourceExistsCondition is an SQL condition that is true if the data source
+// named by parameter $1 exists.  It locks the configuration of the data
+// source, so that state written by a running data source is not kept if the
+// data source is concurrently dropped.
+func sourceExistsCondition() string {
+	return "EXISTS (SELECT 1 FROM " + catalogSchema + ".source WHERE name=$1 FOR KEY SHARE)"
+}
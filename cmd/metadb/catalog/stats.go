@@ -0,0 +1,62 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// WriteSourceStats records the status and statistics of a data source, which
+// are shown by the view metadb.source_lag.  Nothing is written if the data
+// source no longer exists.
+func WriteSourceStats(dq dbx.Queryable, source, status string, st sysdb.Stats) error {
+	q := "INSERT INTO " + catalogSchema + ".source_status " +
+		"(source_name, status, events_per_second, last_event_time, last_error, updated) " +
+		"SELECT $1, $2::text, $3::real, $4::timestamptz, $5::text, CURRENT_TIMESTAMP " +
+		"WHERE " + sourceExistsCondition() + " " +
+		"ON CONFLICT (source_name) DO UPDATE SET status=EXCLUDED.status, " +
+		"events_per_second=EXCLUDED.events_per_second, last_event_time=EXCLUDED.last_event_time, " +
+		"last_error=EXCLUDED.last_error, updated=EXCLUDED.updated"
+	if _, err := dq.Exec(context.TODO(), q, source, status, st.EventsPerSecond, nullString(st.LastEventTime),
+		nullString(st.LastError)); err != nil {
+		return fmt.Errorf("writing status for source %q: %v", source, err)
+	}
+	if len(st.Partitions) == 0 {
+		return nil
+	}
+	topics := make([]string, 0, len(st.Partitions))
+	partitions := make([]int32, 0, len(st.Partitions))
+	committed := make([]int64, 0, len(st.Partitions))
+	high := make([]*int64, 0, len(st.Partitions))
+	for _, p := range st.Partitions {
+		topics = append(topics, p.Topic)
+		partitions = append(partitions, p.Partition)
+		committed = append(committed, p.Committed)
+		if p.HighWatermark < 0 {
+			high = append(high, nil)
+		} else {
+			h := p.HighWatermark
+			high = append(high, &h)
+		}
+	}
+	q = "INSERT INTO " + catalogSchema + ".kafka_partition_status " +
+		"(source_name, topic, partition, committed_offset, high_watermark, updated) " +
+		"SELECT $1, unnest($2::text[]), unnest($3::integer[]), unnest($4::bigint[]), unnest($5::bigint[]), " +
+		"CURRENT_TIMESTAMP WHERE " + sourceExistsCondition() + " " +
+		"ON CONFLICT (source_name, topic, partition) DO UPDATE SET committed_offset=EXCLUDED.committed_offset, " +
+		"high_watermark=EXCLUDED.high_watermark, updated=EXCLUDED.updated"
+	if _, err := dq.Exec(context.TODO(), q, source, topics, partitions, committed, high); err != nil {
+		return fmt.Errorf("writing partition status for source %q: %v", source, err)
+	}
+	return nil
+}
+
+// nullString returns nil for an empty string, so that it is written as NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
-	"github.com/metadb-project/metadb/cmd/metadb/log"
 )
 
 type tableEntry struct {
@@ -126,6 +125,17 @@ func (c *Catalog) AllTables(source string) []dbx.Table {
 	return all
 }
 
+// TrackedTables returns the tables of all data sources.
+func (c *Catalog) TrackedTables() []dbx.Table {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	all := make([]dbx.Table, 0, len(c.tableDir))
+	for t := range c.tableDir {
+		all = append(all, t)
+	}
+	return all
+}
+
 func (c *Catalog) TraverseDescendantTables(table dbx.Table, process func(table dbx.Table)) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -143,6 +153,21 @@ func (c *Catalog) traverseDescendantTables(table dbx.Table, process func(table d
 	}
 }
 
+// ChildTables returns the tables that have table as their parent table.
+func (c *Catalog) ChildTables(table dbx.Table) []dbx.Table {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.tableDir[table]
+	if !ok {
+		return nil
+	}
+	children := make([]dbx.Table, 0, len(e.children))
+	for t := range e.children {
+		children = append(children, t)
+	}
+	return children
+}
+
 /*func (c *Catalog) DescendantTables(table dbx.Table) []dbx.Table {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -186,7 +211,10 @@ func createSchemaIfNotExists(c *Catalog, table *dbx.Table) error {
 	for _, u := range usersWithPerm(c, table) {
 		q = "GRANT USAGE ON SCHEMA \"" + table.Schema + "\" TO " + u
 		if _, err := c.dp.Exec(context.TODO(), q); err != nil {
-			log.Warning("granting privileges on schema %q to %q: %v", table.Schema, u, err)
+			if !isUndefinedObject(err) {
+				return fmt.Errorf("granting privileges on schema %q to %q: %v", table.Schema, u, err)
+			}
+			removeDroppedUser(c, u)
 		}
 	}
 	return nil
@@ -217,7 +245,11 @@ func createMainTableIfNotExists(c *Catalog, table *dbx.Table) error {
 	// Grant permissions on new tables.
 	for _, u := range usersWithPerm(c, table) {
 		if _, err := c.dp.Exec(context.TODO(), "GRANT SELECT ON "+table.MainSQL()+" TO "+u+""); err != nil {
-			return fmt.Errorf("granting select privilege on %q to %q: %v", table.Main(), u, err)
+			if !isUndefinedObject(err) {
+				return fmt.Errorf("granting select privilege on %q to %q: %v", table.Main(), u, err)
+			}
+			removeDroppedUser(c, u)
+			continue
 		}
 		if _, err := c.dp.Exec(context.TODO(), "GRANT SELECT ON "+table.SQL()+" TO "+u+""); err != nil {
 			return fmt.Errorf("granting select privilege on %q to %q: %v", table, u, err)
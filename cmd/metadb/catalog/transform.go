@@ -0,0 +1,52 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/jsonx"
+)
+
+// InitJSONTransforms defines the initial JSON transforms, which disable
+// transformation of FOLIO tables containing large records that are not useful
+// to flatten.
+func InitJSONTransforms(dq dbx.Queryable) error {
+	q := "INSERT INTO " + catalogSchema + ".json_transform (name, schema_name, table_name, column_name, method) VALUES " +
+		"('folio_marc_records_lb', 'folio_source_record', 'marc_records_lb', '', 'none'), " +
+		"('folio_edifact_records_lb', 'folio_source_record', 'edifact_records_lb', '', 'none')"
+	if _, err := dq.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("writing initial json transforms: %v", err)
+	}
+	return nil
+}
+
+// ReadJSONTransforms returns all JSON transforms.
+func ReadJSONTransforms(dq dbx.Queryable) ([]*jsonx.Transform, error) {
+	q := "SELECT name, schema_name, table_name, column_name, method, coalesce(target_table, ''), " +
+		"coalesce(depth, 0), coalesce(paths, '') FROM " + catalogSchema + ".json_transform"
+	rows, err := dq.Query(context.TODO(), q)
+	if err != nil {
+		return nil, fmt.Errorf("reading json transforms: %v", err)
+	}
+	defer rows.Close()
+	var transforms []*jsonx.Transform
+	var t jsonx.Transform
+	var paths string
+	_, err = pgx.ForEachRow(rows, []any{&t.Name, &t.Table.Schema, &t.Table.Table, &t.Column, &t.Method, &t.TargetTable,
+		&t.Depth, &paths}, func() error {
+		tr := t
+		p, err := jsonx.ParsePaths(paths)
+		if err != nil {
+			return fmt.Errorf("json transform %q: %v", tr.Name, err)
+		}
+		tr.Paths = p
+		transforms = append(transforms, &tr)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading json transforms: %v", err)
+	}
+	return transforms, nil
+}
@@ -2,10 +2,13 @@ package catalog
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
@@ -59,6 +62,21 @@ func usersWithPerm(cat *Catalog, table *dbx.Table) []string {
 	return users
 }
 
+// removeDroppedUser removes a user from the cache after a GRANT has failed
+// because the user has been dropped from the database.  The caller must hold
+// the catalog lock.
+func removeDroppedUser(cat *Catalog, user string) {
+	log.Warning("user %q no longer exists", user)
+	delete(cat.users, user)
+}
+
+// isUndefinedObject returns true if err is a database error indicating that an
+// object, such as a role, does not exist.
+func isUndefinedObject(err error) bool {
+	var e *pgconn.PgError
+	return errors.As(err, &e) && e.Code == "42704"
+}
+
 //func (u *Users) Perm(username string, schema, table string) bool {
 //        reList := u.Get(username)
 //        if reList == nil {
@@ -0,0 +1,286 @@
+package change
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/confluentinc/confluent-kafka-go/schemaregistry"
+	"github.com/metadb-project/metadb/cmd/metadb/avro"
+)
+
+// SchemaRegistry retrieves Avro schemas by ID from a Confluent-compatible
+// schema registry.
+type SchemaRegistry interface {
+	Schema(id int) (string, error)
+}
+
+type confluentRegistry struct {
+	client schemaregistry.Client
+}
+
+// NewSchemaRegistry returns a client for the schema registry at a URL.  User
+// credentials in the URL are sent using basic authentication.
+func NewSchemaRegistry(registryURL string) (SchemaRegistry, error) {
+	u, err := url.Parse(registryURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schema registry URL: %v", err)
+	}
+	var config *schemaregistry.Config
+	if u.User != nil {
+		password, _ := u.User.Password()
+		user := u.User.Username()
+		u.User = nil
+		config = schemaregistry.NewConfigWithAuthentication(u.String(), user, password)
+	} else {
+		config = schemaregistry.NewConfig(registryURL)
+	}
+	client, err := schemaregistry.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema registry client: %v", err)
+	}
+	return &confluentRegistry{client: client}, nil
+}
+
+func (r *confluentRegistry) Schema(id int) (string, error) {
+	info, err := r.client.GetBySubjectAndID("", id)
+	if err != nil {
+		return "", err
+	}
+	if info.SchemaType != "" && info.SchemaType != "AVRO" {
+		return "", fmt.Errorf("schema %d has unsupported type %q", id, info.SchemaType)
+	}
+	return info.Schema, nil
+}
+
+// AvroDecoder decodes change events in which the key and value are serialized
+// using Avro and the Confluent wire format:  a zero byte, a 4-byte schema ID,
+// and the Avro binary encoding of the data.  Parsed schemas are cached by ID.
+type AvroDecoder struct {
+	registry SchemaRegistry
+	mu       sync.Mutex
+	schemas  map[int]*avro.Schema
+}
+
+func NewAvroDecoder(registry SchemaRegistry) *AvroDecoder {
+	return &AvroDecoder{
+		registry: registry,
+		schemas:  make(map[int]*avro.Schema),
+	}
+}
+
+// IsAvro returns true if data appear to be in the Confluent wire format rather
+// than JSON.
+func IsAvro(data []byte) bool {
+	return len(data) >= 5 && data[0] == 0
+}
+
+// NewEvent creates a change event from a Kafka message.  Avro-serialized keys
+// and values are converted to JSON with an embedded schema, as written by the
+// Kafka Connect JSON converter, before the event is parsed.
+func (d *AvroDecoder) NewEvent(msg *kafka.Message) (*Event, error) {
+	if msg == nil {
+		return nil, fmt.Errorf("creating change event: message is nil")
+	}
+	m := *msg
+	var err error
+	if IsAvro(m.Key) {
+		if m.Key, err = d.toJSON(m.Key); err != nil {
+			return nil, fmt.Errorf("change event key: %v", err)
+		}
+	}
+	if IsAvro(m.Value) {
+		if m.Value, err = d.toJSON(m.Value); err != nil {
+			return nil, fmt.Errorf("change event value: %v", err)
+		}
+	}
+	return NewEvent(&m)
+}
+
+func (d *AvroDecoder) schema(id int) (*avro.Schema, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.schemas[id]; ok {
+		return s, nil
+	}
+	text, err := d.registry.Schema(id)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema %d from registry: %v", id, err)
+	}
+	s, err := avro.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+	d.schemas[id] = s
+	return s, nil
+}
+
+// toJSON converts data in the Confluent wire format to a JSON object with
+// "schema" and "payload" fields.
+func (d *AvroDecoder) toJSON(data []byte) ([]byte, error) {
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	s, err := d.schema(id)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := avro.Decode(s, data[5:])
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+	cs, err := connectSchema(s)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+	payload, err := connectData(s, v)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+	return json.Marshal(map[string]interface{}{"schema": cs, "payload": payload})
+}
+
+// optionalType returns the non-null branch of a union with null, which is how
+// Kafka Connect writes optional fields.
+func optionalType(s *avro.Schema) (*avro.Schema, bool, error) {
+	if s.Type != "union" {
+		return s, false, nil
+	}
+	var t *avro.Schema
+	for _, b := range s.Branches {
+		if b.Type == "null" {
+			continue
+		}
+		if t != nil {
+			return nil, false, fmt.Errorf("unsupported union type")
+		}
+		t = b
+	}
+	if t == nil {
+		return nil, false, fmt.Errorf("unsupported union type")
+	}
+	return t, true, nil
+}
+
+// connectSchema converts an Avro schema to a Kafka Connect schema in JSON
+// form, using the "connect.*" attributes that are written by the Kafka
+// Connect Avro converter.
+func connectSchema(s *avro.Schema) (map[string]interface{}, error) {
+	t, optional, err := optionalType(s)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{"optional": optional}
+	if name, ok := t.Props["connect.name"].(string); ok {
+		m["name"] = name
+	}
+	if params, ok := t.Props["connect.parameters"].(map[string]interface{}); ok {
+		m["parameters"] = params
+	}
+	switch t.Type {
+	case "boolean", "string", "bytes", "float", "double":
+		m["type"] = t.Type
+	case "int":
+		m["type"] = "int32"
+		if ct, ok := t.Props["connect.type"].(string); ok {
+			m["type"] = ct
+		}
+	case "long":
+		m["type"] = "int64"
+	case "fixed":
+		m["type"] = "bytes"
+	case "enum":
+		m["type"] = "string"
+	case "array":
+		items, err := connectSchema(t.Items)
+		if err != nil {
+			return nil, err
+		}
+		m["type"] = "array"
+		m["items"] = items
+	case "map":
+		values, err := connectSchema(t.Values)
+		if err != nil {
+			return nil, err
+		}
+		m["type"] = "map"
+		m["keys"] = map[string]interface{}{"type": "string", "optional": false}
+		m["values"] = values
+	case "record":
+		m["type"] = "struct"
+		if m["name"] == nil {
+			m["name"] = t.Name
+		}
+		fields := make([]interface{}, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			fs, err := connectSchema(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			fs["field"] = f.Name
+			fields = append(fields, fs)
+		}
+		m["fields"] = fields
+	default:
+		return nil, fmt.Errorf("unsupported type %q", t.Type)
+	}
+	// A decimal logical type without Kafka Connect parameters is given
+	// the scale parameter expected for org.apache.kafka.connect.data.Decimal.
+	if lt, _ := t.Props["logicalType"].(string); lt == "decimal" && m["parameters"] == nil {
+		scale, _ := t.Props["scale"].(float64)
+		m["name"] = "org.apache.kafka.connect.data.Decimal"
+		m["parameters"] = map[string]interface{}{"scale": strconv.Itoa(int(scale))}
+	}
+	return m, nil
+}
+
+// connectData converts a decoded Avro value to the form written by the Kafka
+// Connect JSON converter.
+func connectData(s *avro.Schema, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	t, _, err := optionalType(s)
+	if err != nil {
+		return nil, err
+	}
+	switch x := v.(type) {
+	case int32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case float32:
+		return float64(x), nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x), nil
+	case []interface{}:
+		a := make([]interface{}, len(x))
+		for i := range x {
+			if a[i], err = connectData(t.Items, x[i]); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		if t.Type == "record" {
+			for _, f := range t.Fields {
+				if m[f.Name], err = connectData(f.Type, x[f.Name]); err != nil {
+					return nil, fmt.Errorf("%s: %v", f.Name, err)
+				}
+			}
+			return m, nil
+		}
+		for k := range x {
+			if m[k], err = connectData(t.Values, x[k]); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	default:
+		return v, nil
+	}
+}
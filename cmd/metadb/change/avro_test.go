@@ -0,0 +1,169 @@
+package change
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// stubRegistry is a schema registry that holds schemas in memory.
+type stubRegistry map[int]string
+
+func (r stubRegistry) Schema(id int) (string, error) {
+	s, ok := r[id]
+	if !ok {
+		return "", fmt.Errorf("schema %d not found", id)
+	}
+	return s, nil
+}
+
+type avroWriter struct {
+	bytes.Buffer
+}
+
+// header writes the Confluent wire format header.
+func (w *avroWriter) header(id int) {
+	w.WriteByte(0)
+	_ = binary.Write(w, binary.BigEndian, uint32(id))
+}
+
+func (w *avroWriter) long(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64((v<<1)^(v>>63)))
+	w.Write(b[:n])
+}
+
+func (w *avroWriter) bytes(b []byte) {
+	w.long(int64(len(b)))
+	w.Write(b)
+}
+
+func (w *avroWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+const testKeySchema = `{"type":"record","name":"Key","namespace":"dbz.library.loan",
+"fields":[{"name":"id","type":"int"}],"connect.name":"dbz.library.loan.Key"}`
+
+const testValueSchema = `{"type":"record","name":"Envelope","namespace":"dbz.library.loan","fields":[
+{"name":"before","type":["null",{"type":"record","name":"Value","fields":[
+  {"name":"id","type":"int"},
+  {"name":"amount","type":{"type":"bytes","scale":2,"precision":10,
+    "connect.version":1,"connect.parameters":{"scale":"2","connect.decimal.precision":"10"},
+    "connect.name":"org.apache.kafka.connect.data.Decimal","logicalType":"decimal"}},
+  {"name":"n","type":["null",{"type":"record","name":"VariableScaleDecimal",
+    "namespace":"io.debezium.data","fields":[{"name":"scale","type":"int"},{"name":"value","type":"bytes"}],
+    "connect.doc":"Variable scaled decimal","connect.version":1,
+    "connect.name":"io.debezium.data.VariableScaleDecimal"}],"default":null},
+  {"name":"note","type":["null","string"],"default":null}],
+  "connect.name":"dbz.library.loan.Value"}],"default":null},
+{"name":"after","type":["null","Value"],"default":null},
+{"name":"op","type":"string"},
+{"name":"ts_ms","type":["null","long"],"default":null}],
+"connect.name":"dbz.library.loan.Envelope"}`
+
+func testAvroMessage() *kafka.Message {
+	topic := "dbz.library.loan"
+	key := &avroWriter{}
+	key.header(1)
+	key.long(7)
+	value := &avroWriter{}
+	value.header(2)
+	value.long(0) // before: null
+	value.long(1) // after: Value
+	value.long(7)
+	value.bytes([]byte{0xfe, 0x0c}) // -500
+	value.long(1)                   // n: VariableScaleDecimal
+	value.long(3)
+	value.bytes([]byte{0x30, 0x39}) // 12345
+	value.long(0)                   // note: null
+	value.string("c")
+	value.long(1)
+	value.long(1700000000000)
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 41},
+		Key:            key.Bytes(),
+		Value:          value.Bytes(),
+	}
+}
+
+func TestAvroDecoder(t *testing.T) {
+	d := NewAvroDecoder(stubRegistry{1: testKeySchema, 2: testValueSchema})
+	ce, err := d.NewEvent(testAvroMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOffset := Offset{TopicPartition: TopicPartition{Topic: "dbz.library.loan", Partition: 2}, Offset: 41}
+	if ce.Offset == nil || *ce.Offset != wantOffset {
+		t.Errorf("offset: got %v; want %v", ce.Offset, wantOffset)
+	}
+	if id := ce.Key.Payload["id"]; id != float64(7) {
+		t.Errorf("key id: got %v; want 7", id)
+	}
+	if ce.Value.Payload.Op == nil || *ce.Value.Payload.Op != "c" {
+		t.Errorf("op: got %v; want c", ce.Value.Payload.Op)
+	}
+	after := ce.Value.Payload.After
+	if after["amount"] != "/gw=" {
+		t.Errorf("amount: got %v; want /gw=", after["amount"])
+	}
+	n, ok := after["n"].(map[string]interface{})
+	if !ok || n["scale"] != float64(3) || n["value"] != "MDk=" {
+		t.Errorf("n: got %v", after["n"])
+	}
+	if after["note"] != nil {
+		t.Errorf("note: got %v; want nil", after["note"])
+	}
+	// Find the schema of the "after" field.
+	var fields []interface{}
+	for _, f := range ce.Value.Schema.Fields {
+		if f["field"] == "after" {
+			fields, _ = f["fields"].([]interface{})
+		}
+	}
+	want := map[string]string{
+		"id":     "int32",
+		"amount": "bytes",
+		"n":      "struct",
+		"note":   "string",
+	}
+	wantName := map[string]string{
+		"amount": "org.apache.kafka.connect.data.Decimal",
+		"n":      "io.debezium.data.VariableScaleDecimal",
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("after schema: got %d fields; want %d", len(fields), len(want))
+	}
+	for _, fi := range fields {
+		f := fi.(map[string]interface{})
+		name := f["field"].(string)
+		if f["type"] != want[name] {
+			t.Errorf("%s: got type %v; want %s", name, f["type"], want[name])
+		}
+		if wantName[name] != "" && f["name"] != wantName[name] {
+			t.Errorf("%s: got name %v; want %s", name, f["name"], wantName[name])
+		}
+	}
+}
+
+func TestAvroDecoderCachesSchemas(t *testing.T) {
+	r := stubRegistry{1: testKeySchema, 2: testValueSchema}
+	d := NewAvroDecoder(r)
+	if _, err := d.NewEvent(testAvroMessage()); err != nil {
+		t.Fatal(err)
+	}
+	delete(r, 1)
+	delete(r, 2)
+	if _, err := d.NewEvent(testAvroMessage()); err != nil {
+		t.Errorf("schemas not cached: %v", err)
+	}
+}
+
+func TestNewEventAvroWithoutRegistry(t *testing.T) {
+	if _, err := NewEvent(testAvroMessage()); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -12,12 +12,30 @@ type Event struct {
 	Key   *EventKey
 	Value *EventValue
 	Topic *string
+	// Offset is the position of the event, if it was read from Kafka.
+	Offset *Offset
+}
+
+// TopicPartition identifies a Kafka topic partition.
+type TopicPartition struct {
+	Topic     string
+	Partition int32
+}
+
+// Offset is the position of an event in a Kafka topic partition.
+type Offset struct {
+	TopicPartition
+	Offset int64
 }
 
 func NewEvent(msg *kafka.Message) (*Event, error) {
 	if msg == nil {
 		return nil, fmt.Errorf("creating change event: message is nil")
 	}
+	if IsAvro(msg.Key) || IsAvro(msg.Value) {
+		return nil, fmt.Errorf("creating change event: message is serialized using Avro, but no schema registry is configured: topic partition = %s",
+			msg.TopicPartition)
+	}
 	var ce = new(Event)
 	var err error
 	if msg.Key != nil && len(msg.Key) > 0 {
@@ -31,6 +49,15 @@ func NewEvent(msg *kafka.Message) (*Event, error) {
 		}
 	}
 	ce.Topic = msg.TopicPartition.Topic
+	if msg.TopicPartition.Topic != nil {
+		ce.Offset = &Offset{
+			TopicPartition: TopicPartition{
+				Topic:     *msg.TopicPartition.Topic,
+				Partition: msg.TopicPartition.Partition,
+			},
+			Offset: int64(msg.TopicPartition.Offset),
+		}
+	}
 	return ce, nil
 }
 
@@ -110,6 +137,30 @@ type EventValuePayload struct {
 	Op          *string                `json:"op"`
 	TsMs        *int64                 `json:"ts_ms"`
 	Transaction *json.RawMessage       `json:"transaction"`
+	// The following fields are defined in schema change events.
+	DatabaseName *string       `json:"databaseName"`
+	SchemaName   *string       `json:"schemaName"`
+	DDL          *string       `json:"ddl"`
+	TableChanges []TableChange `json:"tableChanges"`
+}
+
+// TableChange describes a change to a table in a schema change event.
+type TableChange struct {
+	// Type is "CREATE", "ALTER", or "DROP".
+	Type string `json:"type"`
+	// ID is the quoted, dot-separated name of the table.
+	ID    string            `json:"id"`
+	Table *TableChangeTable `json:"table"`
+}
+
+type TableChangeTable struct {
+	PrimaryKeyColumnNames []string            `json:"primaryKeyColumnNames"`
+	Columns               []TableChangeColumn `json:"columns"`
+}
+
+type TableChangeColumn struct {
+	Name     string `json:"name"`
+	TypeName string `json:"typeName"`
 }
 
 type EventValue struct {
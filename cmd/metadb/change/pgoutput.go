@@ -0,0 +1,450 @@
+package change
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Relation describes a table in a PostgreSQL logical replication stream.
+type Relation struct {
+	ID        uint32
+	Namespace string
+	Name      string
+	Columns   []RelationColumn
+}
+
+type RelationColumn struct {
+	Name string
+	// Key is true if the column is part of the replica identity, which is
+	// normally the primary key.
+	Key     bool
+	TypeOID uint32
+}
+
+// Value is a column value in PostgreSQL text format.  A nil Text is NULL.
+type Value struct {
+	Text *string
+	// Unchanged indicates an unchanged TOAST value which is not included in
+	// the stream.
+	Unchanged bool
+}
+
+// unavailableValue is the placeholder that Debezium uses for unchanged TOAST
+// values.
+const unavailableValue = "__debezium_unavailable_value"
+
+// PgoutputDecoder decodes messages written by the PostgreSQL "pgoutput"
+// logical decoding plugin (protocol version 1), and converts row changes into
+// change events of the same form as those written by Debezium.
+type PgoutputDecoder struct {
+	// DBName is the source database name reported in change events.
+	DBName    string
+	relations map[uint32]*Relation
+	// commitTime is the commit time of the current transaction.
+	commitTime time.Time
+	// CommitLSN is the end LSN of the last transaction commit that has
+	// been decoded.
+	CommitLSN uint64
+}
+
+func NewPgoutputDecoder(dbname string) *PgoutputDecoder {
+	return &PgoutputDecoder{
+		DBName:    dbname,
+		relations: make(map[uint32]*Relation),
+	}
+}
+
+// postgresEpoch is the origin of timestamps in the replication protocol.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Decode decodes one pgoutput message and returns the change events that it
+// contains, if any.
+func (d *PgoutputDecoder) Decode(data []byte) ([]*Event, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("pgoutput: empty message")
+	}
+	r := &msgReader{buf: data[1:]}
+	switch data[0] {
+	case 'B': // Begin
+		_ = r.uint64() // final LSN
+		d.commitTime = postgresEpoch.Add(time.Duration(r.uint64()) * time.Microsecond)
+		_ = r.uint32() // xid
+		return nil, r.err
+	case 'C': // Commit
+		_ = r.uint8()  // flags
+		_ = r.uint64() // commit LSN
+		lsn := r.uint64()
+		if r.err != nil {
+			return nil, r.err
+		}
+		d.CommitLSN = lsn
+		return nil, nil
+	case 'R': // Relation
+		rel := &Relation{ID: r.uint32(), Namespace: r.string(), Name: r.string()}
+		_ = r.uint8() // replica identity setting
+		n := int(r.uint16())
+		for i := 0; i < n && r.err == nil; i++ {
+			flags := r.uint8()
+			col := RelationColumn{Key: flags&1 != 0, Name: r.string(), TypeOID: r.uint32()}
+			_ = r.uint32() // type modifier
+			rel.Columns = append(rel.Columns, col)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		d.relations[rel.ID] = rel
+		return nil, nil
+	case 'I': // Insert
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		if t := r.uint8(); t != 'N' {
+			return nil, fmt.Errorf("pgoutput: insert: unexpected tuple type %q", t)
+		}
+		values := r.tuple()
+		if r.err != nil {
+			return nil, r.err
+		}
+		ce, err := NewRowEvent(rel, "c", values, d.DBName, d.commitTime, false)
+		if err != nil {
+			return nil, err
+		}
+		return []*Event{ce}, nil
+	case 'U': // Update
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		t := r.uint8()
+		if t == 'K' || t == 'O' {
+			_ = r.tuple() // old key or row
+			t = r.uint8()
+		}
+		if t != 'N' {
+			return nil, fmt.Errorf("pgoutput: update: unexpected tuple type %q", t)
+		}
+		values := r.tuple()
+		if r.err != nil {
+			return nil, r.err
+		}
+		ce, err := NewRowEvent(rel, "u", values, d.DBName, d.commitTime, false)
+		if err != nil {
+			return nil, err
+		}
+		return []*Event{ce}, nil
+	case 'D': // Delete
+		rel, err := d.relation(r.uint32())
+		if err != nil {
+			return nil, err
+		}
+		if t := r.uint8(); t != 'K' && t != 'O' {
+			return nil, fmt.Errorf("pgoutput: delete: unexpected tuple type %q", t)
+		}
+		values := r.tuple()
+		if r.err != nil {
+			return nil, r.err
+		}
+		ce, err := NewRowEvent(rel, "d", values, d.DBName, d.commitTime, false)
+		if err != nil {
+			return nil, err
+		}
+		return []*Event{ce}, nil
+	case 'T': // Truncate
+		n := int(r.uint32())
+		_ = r.uint8() // options
+		var events []*Event
+		for i := 0; i < n && r.err == nil; i++ {
+			rel, err := d.relation(r.uint32())
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, newTruncateEvent(rel, d.DBName, d.commitTime))
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		return events, nil
+	case 'O', 'Y', 'M':
+		// Origin, type, and logical decoding messages are ignored.
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("pgoutput: unknown message type %q", data[0])
+	}
+}
+
+func (d *PgoutputDecoder) relation(id uint32) (*Relation, error) {
+	rel, ok := d.relations[id]
+	if !ok {
+		return nil, fmt.Errorf("pgoutput: unknown relation %d", id)
+	}
+	return rel, nil
+}
+
+// NewRowEvent returns a change event for a row of a relation.  The op is a
+// Debezium operation code:  "c", "r", "u", or "d".  For a delete operation,
+// only the key values are used.
+func NewRowEvent(rel *Relation, op string, values []Value, dbname string, ts time.Time,
+	snapshot bool) (*Event, error) {
+	if len(values) != len(rel.Columns) {
+		return nil, fmt.Errorf("%s.%s: row has %d values but relation has %d columns",
+			rel.Namespace, rel.Name, len(values), len(rel.Columns))
+	}
+	var keyFields []map[string]interface{}
+	var afterFields []interface{}
+	keyPayload := make(map[string]interface{})
+	after := make(map[string]interface{})
+	for i, col := range rel.Columns {
+		field := fieldSchema(col)
+		var data interface{}
+		switch {
+		case values[i].Unchanged:
+			data = unavailableValue
+		case values[i].Text != nil:
+			var err error
+			if data, err = fieldData(col.TypeOID, *values[i].Text); err != nil {
+				return nil, fmt.Errorf("%s.%s: column %q: %v", rel.Namespace, rel.Name, col.Name, err)
+			}
+		}
+		if col.Key {
+			keyFields = append(keyFields, field)
+			keyPayload[col.Name] = data
+		}
+		afterFields = append(afterFields, field)
+		after[col.Name] = data
+	}
+	ce := newEvent(rel, op, dbname, ts, snapshot)
+	if keyFields != nil {
+		keyType := "struct"
+		keyName := rel.Namespace + "." + rel.Name + ".Key"
+		ce.Key = &EventKey{
+			Schema:  &EventKeySchema{Type: &keyType, Fields: keyFields, Name: &keyName},
+			Payload: keyPayload,
+		}
+	}
+	if op != "d" {
+		ce.Value.Schema.Fields = []map[string]interface{}{
+			{"field": "after", "type": "struct", "optional": true, "fields": afterFields},
+		}
+		ce.Value.Payload.After = after
+	}
+	return ce, nil
+}
+
+func newTruncateEvent(rel *Relation, dbname string, ts time.Time) *Event {
+	return newEvent(rel, "t", dbname, ts, false)
+}
+
+func newEvent(rel *Relation, op, dbname string, ts time.Time, snapshot bool) *Event {
+	connector := "postgresql"
+	snap := strconv.FormatBool(snapshot)
+	tsMs := float64(ts.UnixMicro()) / 1000
+	now := time.Now().UnixMilli()
+	schema := rel.Namespace
+	table := rel.Name
+	topic := schema + "." + table
+	valueType := "struct"
+	return &Event{
+		Value: &EventValue{
+			Schema: &EventValueSchema{Type: &valueType},
+			Payload: &EventValuePayload{
+				Source: &EventPayloadSource{
+					Connector: &connector,
+					TsMs:      &tsMs,
+					Snapshot:  &snap,
+					DB:        &dbname,
+					Schema:    &schema,
+					Table:     &table,
+				},
+				Op:   &op,
+				TsMs: &now,
+			},
+		},
+		Topic: &topic,
+	}
+}
+
+// fieldSchema returns the schema of a column, using the types and semantic
+// types that Debezium would report.
+func fieldSchema(col RelationColumn) map[string]interface{} {
+	m := map[string]interface{}{"field": col.Name, "optional": !col.Key}
+	switch col.TypeOID {
+	case pgtype.BoolOID:
+		m["type"] = "boolean"
+	case pgtype.Int2OID:
+		m["type"] = "int16"
+	case pgtype.Int4OID:
+		m["type"] = "int32"
+	case pgtype.Int8OID:
+		m["type"] = "int64"
+	case pgtype.Float4OID:
+		m["type"] = "float"
+	case pgtype.Float8OID:
+		m["type"] = "double"
+	case pgtype.DateOID:
+		m["type"] = "int32"
+		m["name"] = "io.debezium.time.Date"
+	case pgtype.TimeOID:
+		m["type"] = "int64"
+		m["name"] = "io.debezium.time.MicroTime"
+	case pgtype.TimestampOID:
+		m["type"] = "int64"
+		m["name"] = "io.debezium.time.MicroTimestamp"
+	case pgtype.TimestamptzOID:
+		m["type"] = "string"
+		m["name"] = "io.debezium.time.ZonedTimestamp"
+	case pgtype.TimetzOID:
+		m["type"] = "string"
+		m["name"] = "io.debezium.time.ZonedTime"
+	case pgtype.UUIDOID:
+		m["type"] = "string"
+		m["name"] = "io.debezium.data.Uuid"
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		m["type"] = "string"
+		m["name"] = "io.debezium.data.Json"
+	default:
+		// Other types, including numeric, are passed as strings in the
+		// same way as Debezium's "string" decimal handling mode.
+		m["type"] = "string"
+	}
+	return m
+}
+
+// fieldData converts a value in PostgreSQL text format to the representation
+// used in a Debezium change event.  The session generating the text is
+// expected to use the ISO date style and UTC time zone.
+func fieldData(oid uint32, s string) (interface{}, error) {
+	switch oid {
+	case pgtype.BoolOID:
+		return s == "t", nil
+	case pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return float64(i), nil
+	case pgtype.Float4OID, pgtype.Float8OID:
+		return strconv.ParseFloat(s, 64)
+	case pgtype.DateOID:
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, err
+		}
+		return float64(t.Unix() / 86400), nil
+	case pgtype.TimeOID:
+		t, err := time.Parse("15:04:05.999999", s)
+		if err != nil {
+			return nil, err
+		}
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return float64(t.Sub(midnight).Microseconds()), nil
+	case pgtype.TimestampOID:
+		t, err := time.Parse("2006-01-02 15:04:05.999999", s)
+		if err != nil {
+			return nil, err
+		}
+		return float64(t.UnixMicro()), nil
+	case pgtype.TimestamptzOID:
+		t, err := time.Parse("2006-01-02 15:04:05.999999-07", s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02 15:04:05.999999-07:00", s); err != nil {
+				return nil, err
+			}
+		}
+		return t.UTC().Format("2006-01-02T15:04:05.999999Z"), nil
+	default:
+		return s, nil
+	}
+}
+
+// msgReader reads fields from a pgoutput message.  After an error, further
+// reads return zero values and the error is retained in err.
+type msgReader struct {
+	buf []byte
+	err error
+}
+
+func (r *msgReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf) < n {
+		r.err = fmt.Errorf("pgoutput: message too short")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *msgReader) uint8() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *msgReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *msgReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *msgReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// string reads a null-terminated string.
+func (r *msgReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = fmt.Errorf("pgoutput: unterminated string")
+	return ""
+}
+
+func (r *msgReader) tuple() []Value {
+	n := int(r.uint16())
+	values := make([]Value, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		switch k := r.uint8(); k {
+		case 'n':
+			values = append(values, Value{})
+		case 'u':
+			values = append(values, Value{Unchanged: true})
+		case 't':
+			l := int(r.uint32())
+			if b := r.next(l); r.err == nil {
+				s := string(b)
+				values = append(values, Value{Text: &s})
+			}
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("pgoutput: unknown tuple data type %q", k)
+			}
+		}
+	}
+	return values
+}
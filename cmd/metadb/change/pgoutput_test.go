@@ -0,0 +1,178 @@
+package change
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type msgWriter struct {
+	bytes.Buffer
+}
+
+func (w *msgWriter) uint8(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *msgWriter) uint16(v uint16) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *msgWriter) uint32(v uint32) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *msgWriter) uint64(v uint64) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *msgWriter) string(s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
+
+// tuple writes tuple data; a nil value is written as NULL.
+func (w *msgWriter) tuple(values []*string) {
+	w.uint16(uint16(len(values)))
+	for _, v := range values {
+		if v == nil {
+			w.uint8('n')
+			continue
+		}
+		w.uint8('t')
+		w.uint32(uint32(len(*v)))
+		w.WriteString(*v)
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func relationMessage() []byte {
+	w := &msgWriter{}
+	w.uint8('R')
+	w.uint32(16385)
+	w.string("library")
+	w.string("loan")
+	w.uint8('d')
+	w.uint16(4)
+	for _, c := range []struct {
+		flags byte
+		name  string
+		oid   uint32
+	}{
+		{1, "id", pgtype.UUIDOID},
+		{0, "count", pgtype.Int4OID},
+		{0, "due", pgtype.TimestamptzOID},
+		{0, "jsonb", pgtype.JSONBOID},
+	} {
+		w.uint8(c.flags)
+		w.string(c.name)
+		w.uint32(c.oid)
+		w.uint32(0xffffffff)
+	}
+	return w.Bytes()
+}
+
+func TestPgoutputInsert(t *testing.T) {
+	d := NewPgoutputDecoder("folio")
+	if _, err := d.Decode(relationMessage()); err != nil {
+		t.Fatal(err)
+	}
+	w := &msgWriter{}
+	w.uint8('I')
+	w.uint32(16385)
+	w.uint8('N')
+	w.tuple([]*string{str("9e5b0e0c-3f5d-4d0b-9a8f-55d3b1f8a6a1"), str("3"), str("2024-03-01 10:15:30.25+00"), nil})
+	events, err := d.Decode(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events; want 1", len(events))
+	}
+	ce := events[0]
+	p := ce.Value.Payload
+	if *p.Op != "c" || *p.Source.Schema != "library" || *p.Source.Table != "loan" || *p.Source.Snapshot != "false" {
+		t.Errorf("got op=%s schema=%s table=%s snapshot=%s", *p.Op, *p.Source.Schema, *p.Source.Table,
+			*p.Source.Snapshot)
+	}
+	if got := p.After["count"]; got != float64(3) {
+		t.Errorf("count: got %v; want 3", got)
+	}
+	if got := p.After["due"]; got != "2024-03-01T10:15:30.25Z" {
+		t.Errorf("due: got %v", got)
+	}
+	if got, ok := p.After["jsonb"]; !ok || got != nil {
+		t.Errorf("jsonb: got %v; want nil", got)
+	}
+	if len(ce.Key.Schema.Fields) != 1 || ce.Key.Schema.Fields[0]["field"] != "id" {
+		t.Errorf("key fields: got %v", ce.Key.Schema.Fields)
+	}
+	after := ce.Value.Schema.Fields[0]
+	if after["field"] != "after" || len(after["fields"].([]interface{})) != 4 {
+		t.Errorf("value schema: got %v", ce.Value.Schema.Fields)
+	}
+}
+
+func TestPgoutputDelete(t *testing.T) {
+	d := NewPgoutputDecoder("folio")
+	if _, err := d.Decode(relationMessage()); err != nil {
+		t.Fatal(err)
+	}
+	w := &msgWriter{}
+	w.uint8('D')
+	w.uint32(16385)
+	w.uint8('K')
+	w.tuple([]*string{str("9e5b0e0c-3f5d-4d0b-9a8f-55d3b1f8a6a1"), nil, nil, nil})
+	events, err := d.Decode(w.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce := events[0]
+	if *ce.Value.Payload.Op != "d" || ce.Value.Payload.After != nil {
+		t.Errorf("got op=%s after=%v", *ce.Value.Payload.Op, ce.Value.Payload.After)
+	}
+	if got := ce.Key.Payload["id"]; got != "9e5b0e0c-3f5d-4d0b-9a8f-55d3b1f8a6a1" {
+		t.Errorf("key: got %v", got)
+	}
+}
+
+func TestPgoutputCommit(t *testing.T) {
+	d := NewPgoutputDecoder("folio")
+	w := &msgWriter{}
+	w.uint8('C')
+	w.uint8(0)
+	w.uint64(0x16B3748)
+	w.uint64(0x16B3778)
+	w.uint64(0)
+	if _, err := d.Decode(w.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if d.CommitLSN != 0x16B3778 {
+		t.Errorf("got LSN %X; want 16B3778", d.CommitLSN)
+	}
+}
+
+func TestPgoutputUnknownRelation(t *testing.T) {
+	d := NewPgoutputDecoder("folio")
+	w := &msgWriter{}
+	w.uint8('I')
+	w.uint32(1)
+	w.uint8('N')
+	w.tuple(nil)
+	if _, err := d.Decode(w.Bytes()); err == nil {
+		t.Errorf("expected error for unknown relation")
+	}
+}
+
+func TestPgoutputShortMessage(t *testing.T) {
+	d := NewPgoutputDecoder("folio")
+	msg := relationMessage()
+	if _, err := d.Decode(msg[:len(msg)-3]); err == nil {
+		t.Errorf("expected error for truncated message")
+	}
+}
@@ -3,6 +3,7 @@ package command
 import (
 	"container/list"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
@@ -25,6 +26,12 @@ const (
 	MergeOp Operation = iota
 	DeleteOp
 	TruncateOp
+	// HeartbeatOp indicates a Debezium heartbeat message, which carries
+	// no data.
+	HeartbeatOp
+	// SchemaChangeOp indicates a Debezium schema change event, which
+	// describes DDL executed in the source database.
+	SchemaChangeOp
 )
 
 func (o Operation) String() string {
@@ -35,6 +42,10 @@ func (o Operation) String() string {
 		return "delete"
 	case TruncateOp:
 		return "truncate"
+	case HeartbeatOp:
+		return "heartbeat"
+	case SchemaChangeOp:
+		return "schema change"
 	default:
 		return "(unknown)"
 	}
@@ -194,6 +205,31 @@ type Command struct {
 	Column          []CommandColumn
 	SourceTimestamp string
 	Subcommands     *list.List
+	// ArrayLengths is defined for transformed commands and records the
+	// number of elements in each array that was extracted from the JSON
+	// data, by the name of the child table containing the elements.
+	ArrayLengths map[string]int
+	// DDL and TableChanges are defined for SchemaChangeOp.
+	DDL          string
+	TableChanges []TableChange
+	// Offset is the position of the change event from which the command
+	// was created, if the event was read from Kafka.
+	Offset *change.Offset
+	// Event is the change event from which the command was created.  It
+	// is retained so that it can be recorded as a dead letter if the
+	// command cannot be written to the database.
+	Event *change.Event
+}
+
+// TableChange is a change to the definition of a source table, read from a
+// schema change event.
+type TableChange struct {
+	// Type is "CREATE", "ALTER", or "DROP".
+	Type       string
+	SchemaName string
+	TableName  string
+	// Columns lists the names of the table's columns after the change.
+	Columns []string
 }
 
 func (c *Command) AddChild(child *Command) {
@@ -457,8 +493,12 @@ func decodeNumericBytes(fieldMap map[string]any, data any, semtype string) (stri
 	if bytes, err = base64.StdEncoding.DecodeString(valuestr); err != nil {
 		return "", fmt.Errorf("unable to decode numeric bytes: %q", valuestr)
 	}
+	// The bytes are a two's complement, big-endian integer.
 	var bigInt = new(big.Int)
 	bigInt.SetBytes(bytes)
+	if len(bytes) > 0 && bytes[0]&0x80 != 0 {
+		bigInt.Sub(bigInt, new(big.Int).Lsh(big.NewInt(1), uint(len(bytes)*8)))
+	}
 	// go get github.com/shopspring/decimal
 	// func NewFromBigInt(value *big.Int, exp int32) Decimal
 	// var scale int32 = 2
@@ -574,8 +614,26 @@ func structScale(data any) (int32, string, error) {
 // var FolioTenant string
 var ReshareTenants []string
 
-func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schemaStopFilter,
-	tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix string) (*Command, bool, error) {
+// SourceOptions are settings of a data source that determine which change
+// events are accepted and how schema and table names are rewritten.
+type SourceOptions struct {
+	SchemaPassFilter []*regexp.Regexp
+	SchemaStopFilter []*regexp.Regexp
+	TablePassFilter  []*regexp.Regexp
+	TableStopFilter  []*regexp.Regexp
+	// ColumnPassFilter and ColumnStopFilter select the columns of a table
+	// that are accepted.  Primary key columns are always accepted.
+	ColumnPassFilter []*util.ColumnFilter
+	ColumnStopFilter []*util.ColumnFilter
+	// SchemaRewrite and TableRewrite are applied in order to schema and
+	// table names respectively.
+	SchemaRewrite    []*util.RewriteRule
+	TableRewrite     []*util.RewriteRule
+	TrimSchemaPrefix string
+	AddSchemaPrefix  string
+}
+
+func NewCommand(dedup *log.MessageSet, ce *change.Event, opts *SourceOptions) (*Command, bool, error) {
 	snapshot := false
 	// Note: this function returns nil, nil in some cases.
 	if ce == nil {
@@ -583,16 +641,25 @@ func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schem
 	}
 	var err error
 	var c = new(Command)
+	if isHeartbeat(ce) {
+		return newHeartbeatCommand(ce), false, nil
+	}
 	if ce.Value == nil || ce.Value.Payload == nil {
 		var name string
 		var key interface{}
-		if ce != nil && ce.Key != nil {
-			name = *ce.Key.Schema.Name
+		if ce.Key != nil {
+			if ce.Key.Schema != nil && ce.Key.Schema.Name != nil {
+				name = *ce.Key.Schema.Name
+			}
 			key = ce.Key.Payload
 		}
 		log.Trace("possible tombstone event: missing value payload in change event: schema=%q, key=%v", name, key)
 		return nil, false, nil
 	}
+	if isSchemaChange(ce) {
+		c, err = newSchemaChangeCommand(ce, opts)
+		return c, false, err
+	}
 	if ce.Value.Payload.Op == nil {
 		return nil, false, fmt.Errorf("missing value payload op")
 	}
@@ -616,44 +683,24 @@ func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schem
 	if ce.Value.Payload.Source.TsMs == nil {
 		return nil, false, fmt.Errorf("missing value payload source timestamp: %v", ce.Value.Payload.Source)
 	}
-	// convert ts_ms to string
-	i, f := math.Modf(*ce.Value.Payload.Source.TsMs / 1000)
-	c.SourceTimestamp = time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
+	c.SourceTimestamp = formatTimestampMs(*ce.Value.Payload.Source.TsMs)
 	if ce.Value.Payload.Source.Schema != nil {
 		schema := *ce.Value.Payload.Source.Schema
-		if len(schemaPassFilter) > 0 && !util.MatchRegexps(schemaPassFilter, schema) {
-			log.Trace("filter: reject: %s", schema)
-			return nil, false, nil
-		}
-		if len(schemaStopFilter) > 0 && util.MatchRegexps(schemaStopFilter, schema) {
+		if !acceptSchema(schema, opts) {
 			log.Trace("filter: reject: %s", schema)
 			return nil, false, nil
 		}
-		// Rewrite schema name
-		if trimSchemaPrefix != "" {
-			schema = strings.TrimPrefix(schema, trimSchemaPrefix)
-		}
-		schema = strings.TrimPrefix(schema, "uchicago_")
-		schema = strings.TrimPrefix(schema, "lu_")
-		schema = strings.TrimPrefix(schema, "dbz_")
-		schema = strings.TrimPrefix(schema, "reports_dev_")
-		schema = strings.TrimPrefix(schema, "mod_")
-		schema = strings.TrimSuffix(schema, "_storage")
-		schema = strings.Replace(schema, "_mod_", "_", 1)
-		var origin string
-		origin, schema = extractOrigin(ReshareTenants, schema)
-		c.Origin = origin
-		schema = addSchemaPrefix + schema
-		c.SchemaName = schema
+		c.Origin, c.SchemaName = rewriteSchema(schema, opts)
 	}
+	var schemaTable string
 	if ce.Value.Payload.Source.Table != nil {
 		table := *ce.Value.Payload.Source.Table
-		schemaTable := *ce.Value.Payload.Source.Schema + "." + table
-		if len(tableStopFilter) > 0 && util.MatchRegexps(tableStopFilter, schemaTable) {
+		schemaTable = *ce.Value.Payload.Source.Schema + "." + table
+		if !acceptTable(schemaTable, opts) {
 			log.Trace("filter: reject: %s", table)
 			return nil, false, nil
 		}
-		c.TableName = table
+		c.TableName = util.Rewrite(opts.TableRewrite, table)
 	}
 	if *ce.Value.Payload.Source.Snapshot == "true" {
 		snapshot = true
@@ -738,9 +785,236 @@ func NewCommand(dedup *log.MessageSet, ce *change.Event, schemaPassFilter, schem
 	if c.Column == nil {
 		return nil, false, nil
 	}
+	if c.Column, err = filterColumns(schemaTable, c.Column, opts); err != nil {
+		return nil, false, err
+	}
 	return c, snapshot, nil
 }
 
+// acceptTable returns true if a source table name, qualified by its schema,
+// passes the table filters.
+func acceptTable(schemaTable string, opts *SourceOptions) bool {
+	if len(opts.TablePassFilter) > 0 && !util.MatchRegexps(opts.TablePassFilter, schemaTable) {
+		return false
+	}
+	if len(opts.TableStopFilter) > 0 && util.MatchRegexps(opts.TableStopFilter, schemaTable) {
+		return false
+	}
+	return true
+}
+
+// filterColumns removes columns that do not pass the column filters for a
+// table.  Primary key columns are not removed.  Stop filters that specify a
+// path within a JSON column remove the key from the JSON object, before it
+// can be extracted by a transform.
+func filterColumns(schemaTable string, columns []CommandColumn, opts *SourceOptions) ([]CommandColumn, error) {
+	pass := util.TableColumnFilters(opts.ColumnPassFilter, schemaTable)
+	stop := util.TableColumnFilters(opts.ColumnStopFilter, schemaTable)
+	if len(pass) == 0 && len(stop) == 0 {
+		return columns, nil
+	}
+	var cols []CommandColumn
+	for _, col := range columns {
+		if col.PrimaryKey == 0 {
+			if len(pass) > 0 && !util.MatchColumnFilters(pass, col.Name) {
+				continue
+			}
+			if util.MatchColumnFilters(stop, col.Name) {
+				continue
+			}
+		}
+		if col.DType == JSONType {
+			if err := removeJSONPaths(&col, stop); err != nil {
+				return nil, fmt.Errorf("filtering column %q: %v", col.Name, err)
+			}
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// removeJSONPaths removes the keys matched by the filters from the JSON object
+// in a column.
+func removeJSONPaths(col *CommandColumn, filters []*util.ColumnFilter) error {
+	if col.SQLData == nil {
+		return nil
+	}
+	var obj map[string]interface{}
+	var changed bool
+	for _, f := range filters {
+		if f.Path == nil || !f.Column.MatchString(col.Name) {
+			continue
+		}
+		if obj == nil {
+			if err := json.Unmarshal([]byte(*col.SQLData), &obj); err != nil || obj == nil {
+				return nil
+			}
+		}
+		if removeJSONPath(obj, f.Path) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	s := string(b)
+	col.Data = s
+	col.SQLData = &s
+	return nil
+}
+
+// removeJSONPath removes the key at path from a JSON object.  If a value along
+// the path is an array, the rest of the path is removed from each object in
+// the array.  It returns true if any key was removed.
+func removeJSONPath(obj map[string]interface{}, path []string) bool {
+	value, ok := obj[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		delete(obj, path[0])
+		return true
+	}
+	var removed bool
+	switch v := value.(type) {
+	case map[string]interface{}:
+		removed = removeJSONPath(v, path[1:])
+	case []interface{}:
+		for _, e := range v {
+			if o, ok := e.(map[string]interface{}); ok && removeJSONPath(o, path[1:]) {
+				removed = true
+			}
+		}
+	}
+	return removed
+}
+
+// formatTimestampMs converts a time in milliseconds since the epoch to a
+// string in UTC.
+func formatTimestampMs(ms float64) string {
+	i, f := math.Modf(ms / 1000)
+	return time.Unix(int64(i), int64(f*1000000000)).UTC().Format("2006-01-02 15:04:05.000000000") + "Z"
+}
+
+// acceptSchema returns true if a source schema name passes the schema filters.
+func acceptSchema(schema string, opts *SourceOptions) bool {
+	if len(opts.SchemaPassFilter) > 0 && !util.MatchRegexps(opts.SchemaPassFilter, schema) {
+		return false
+	}
+	if len(opts.SchemaStopFilter) > 0 && util.MatchRegexps(opts.SchemaStopFilter, schema) {
+		return false
+	}
+	return true
+}
+
+// rewriteSchema returns the origin and the rewritten name of a source schema.
+func rewriteSchema(schema string, opts *SourceOptions) (string, string) {
+	if opts.TrimSchemaPrefix != "" {
+		schema = strings.TrimPrefix(schema, opts.TrimSchemaPrefix)
+	}
+	schema = util.Rewrite(opts.SchemaRewrite, schema)
+	var origin string
+	origin, schema = extractOrigin(ReshareTenants, schema)
+	return origin, opts.AddSchemaPrefix + schema
+}
+
+// isHeartbeat returns true if a change event is a Debezium heartbeat message.
+// Heartbeats are written to topics named "__debezium-heartbeat.<prefix>".
+func isHeartbeat(ce *change.Event) bool {
+	if ce.Topic != nil && strings.HasPrefix(*ce.Topic, "__debezium-heartbeat") {
+		return true
+	}
+	return ce.Value != nil && ce.Value.Schema != nil && ce.Value.Schema.Name != nil &&
+		*ce.Value.Schema.Name == "io.debezium.connector.common.Heartbeat"
+}
+
+func newHeartbeatCommand(ce *change.Event) *Command {
+	c := &Command{Op: HeartbeatOp}
+	if ce.Value != nil && ce.Value.Payload != nil && ce.Value.Payload.TsMs != nil {
+		c.SourceTimestamp = formatTimestampMs(float64(*ce.Value.Payload.TsMs))
+	}
+	return c
+}
+
+// isSchemaChange returns true if a change event is a Debezium schema change
+// event.  These have no op field and contain the DDL statement and/or a list
+// of table changes.
+func isSchemaChange(ce *change.Event) bool {
+	p := ce.Value.Payload
+	return p.Op == nil && (p.DDL != nil || p.TableChanges != nil)
+}
+
+func newSchemaChangeCommand(ce *change.Event, opts *SourceOptions) (*Command, error) {
+	p := ce.Value.Payload
+	c := &Command{Op: SchemaChangeOp}
+	if p.DDL != nil {
+		c.DDL = *p.DDL
+	}
+	if p.Source != nil && p.Source.TsMs != nil {
+		c.SourceTimestamp = formatTimestampMs(*p.Source.TsMs)
+	}
+	for _, tc := range p.TableChanges {
+		schema, table, err := parseTableChangeID(tc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("schema change: %v", err)
+		}
+		if !acceptSchema(schema, opts) {
+			log.Trace("filter: reject: %s", schema)
+			continue
+		}
+		if !acceptTable(schema+"."+table, opts) {
+			log.Trace("filter: reject: %s", table)
+			continue
+		}
+		t := TableChange{Type: tc.Type, TableName: util.Rewrite(opts.TableRewrite, table)}
+		_, t.SchemaName = rewriteSchema(schema, opts)
+		if tc.Table != nil {
+			for _, col := range tc.Table.Columns {
+				t.Columns = append(t.Columns, col.Name)
+			}
+		}
+		c.TableChanges = append(c.TableChanges, t)
+	}
+	if len(c.TableChanges) == 0 {
+		log.Trace("schema change: no table changes: %s", c.DDL)
+		return nil, nil
+	}
+	return c, nil
+}
+
+// parseTableChangeID returns the schema and table names in a table ID such as
+// "db"."schema"."table".  If only two names are present, as with MySQL, the
+// first is taken to be the schema.
+func parseTableChangeID(id string) (string, string, error) {
+	var names []string
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		switch {
+		case ch == '"' && quoted && i+1 < len(id) && id[i+1] == '"':
+			b.WriteByte('"')
+			i++
+		case ch == '"':
+			quoted = !quoted
+		case ch == '.' && !quoted:
+			names = append(names, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	names = append(names, b.String())
+	if quoted || len(names) < 2 {
+		return "", "", fmt.Errorf("invalid table ID %q", id)
+	}
+	return names[len(names)-2], names[len(names)-1], nil
+}
+
 func primaryKeyNotDefined(dedup *log.MessageSet, topicPtr *string) {
 	topic := ""
 	if topicPtr != nil {
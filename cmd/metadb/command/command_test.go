@@ -2,6 +2,11 @@ package command
 
 import (
 	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
 func TestTrimFractionalZerosInFraction(t *testing.T) {
@@ -117,3 +122,210 @@ func TestExtractOriginEmpty(t *testing.T) {
 		t.Errorf("got %v, %v; want %v, %v", gotOrigin, gotNewSchema, wantOrigin, wantNewSchema)
 	}
 }
+
+func TestDecodeNumericBytesNegative(t *testing.T) {
+	fieldMap := map[string]any{"parameters": map[string]any{"scale": "2"}}
+	got, err := decodeNumericBytes(fieldMap, "/gw=", "org.apache.kafka.connect.data.Decimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-5.00"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestDecodeNumericBytesVariableScale(t *testing.T) {
+	data := map[string]any{"scale": float64(3), "value": "MDk="}
+	got, err := decodeNumericBytes(nil, data, "io.debezium.data.VariableScaleDecimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "12.345"; got != want {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func testEvent(t *testing.T, topic, key, value string) *change.Event {
+	ce, err := change.NewEvent(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Key:            []byte(key),
+		Value:          []byte(value),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ce
+}
+
+func TestNewCommandHeartbeat(t *testing.T) {
+	ce := testEvent(t, "__debezium-heartbeat.folio",
+		`{"schema":{"type":"struct","name":"io.debezium.connector.common.ServerNameKey"},"payload":{"serverName":"folio"}}`,
+		`{"schema":{"type":"struct","name":"io.debezium.connector.common.Heartbeat"},"payload":{"ts_ms":1700000000000}}`)
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Op != HeartbeatOp {
+		t.Fatalf("got %v; want heartbeat", c)
+	}
+	if want := "2023-11-14 22:13:20.000000000Z"; c.SourceTimestamp != want {
+		t.Errorf("got %v; want %v", c.SourceTimestamp, want)
+	}
+}
+
+func TestNewCommandSchemaChange(t *testing.T) {
+	ce := testEvent(t, "folio",
+		`{"payload":{"databaseName":"folio"}}`,
+		`{"payload":{"source":{"ts_ms":1700000000000,"snapshot":"false"},"databaseName":"folio",`+
+			`"ddl":"ALTER TABLE loan DROP COLUMN due","tableChanges":[`+
+			`{"type":"ALTER","id":"\"folio\".\"library\".\"loan\"","table":{"columns":[{"name":"id"},{"name":"item"}]}},`+
+			`{"type":"ALTER","id":"\"folio\".\"other\".\"t\"","table":{"columns":[{"name":"id"}]}}]}}`)
+	stop, err := util.CompileRegexps([]string{"^other$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{SchemaStopFilter: stop, AddSchemaPrefix: "x_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.Op != SchemaChangeOp {
+		t.Fatalf("got %v; want schema change", c)
+	}
+	if c.DDL != "ALTER TABLE loan DROP COLUMN due" {
+		t.Errorf("got DDL %q", c.DDL)
+	}
+	if len(c.TableChanges) != 1 {
+		t.Fatalf("got %d table changes; want 1", len(c.TableChanges))
+	}
+	tc := c.TableChanges[0]
+	if tc.Type != "ALTER" || tc.SchemaName != "x_library" || tc.TableName != "loan" ||
+		len(tc.Columns) != 2 || tc.Columns[1] != "item" {
+		t.Errorf("got %+v", tc)
+	}
+}
+
+func TestNewCommandTombstone(t *testing.T) {
+	ce := testEvent(t, "folio.library.loan", `{"payload":{"id":1}}`, "")
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{})
+	if c != nil || err != nil {
+		t.Errorf("got %v, %v; want nil, nil", c, err)
+	}
+}
+
+func TestParseTableChangeID(t *testing.T) {
+	tests := []struct{ id, schema, table string }{
+		{`"folio"."library"."loan"`, "library", "loan"},
+		{`"inventory"."customers"`, "inventory", "customers"},
+		{`"a.b"."c""d"`, "a.b", `c"d`},
+		{`db.t`, "db", "t"},
+	}
+	for _, tt := range tests {
+		schema, table, err := parseTableChangeID(tt.id)
+		if err != nil {
+			t.Errorf("%s: %v", tt.id, err)
+			continue
+		}
+		if schema != tt.schema || table != tt.table {
+			t.Errorf("%s: got %q, %q; want %q, %q", tt.id, schema, table, tt.schema, tt.table)
+		}
+	}
+	if _, _, err := parseTableChangeID("loan"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestNewCommandRewrite(t *testing.T) {
+	ce := testEvent(t, "folio.diku_mod_users.users",
+		`{"schema":{"type":"struct","fields":[{"type":"int32","field":"id"}]},"payload":{"id":1}}`,
+		`{"schema":{"type":"struct","fields":[{"type":"struct","field":"after","fields":[{"type":"int32","field":"id"}]}]},`+
+			`"payload":{"op":"c","after":{"id":1},"source":{"ts_ms":1700000000000,"snapshot":"false",`+
+			`"schema":"diku_mod_users","table":"users_v2"}}}`)
+	schemaRewrite, err := util.CompileRewriteRules([]string{"s/^mod_//", "s/_storage$//"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableRewrite, err := util.CompileRewriteRules([]string{"s/_v[0-9]+$//"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{
+		SchemaRewrite:    schemaRewrite,
+		TableRewrite:     tableRewrite,
+		TrimSchemaPrefix: "diku_",
+		AddSchemaPrefix:  "folio_",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || c.SchemaName != "folio_users" || c.TableName != "users" {
+		t.Errorf("got %v", c)
+	}
+}
+
+func TestNewCommandColumnFilter(t *testing.T) {
+	ce := testEvent(t, "folio.diku_mod_users.users",
+		`{"schema":{"type":"struct","fields":[{"type":"int32","field":"id"}]},"payload":{"id":1}}`,
+		`{"schema":{"type":"struct","fields":[{"type":"struct","field":"after","fields":[`+
+			`{"type":"int32","field":"id"},{"type":"string","field":"barcode"},`+
+			`{"type":"string","field":"personal"},{"type":"string","field":"hash"}]}]},`+
+			`"payload":{"op":"c","after":{"id":1,"barcode":"a","personal":"b","hash":"c"},`+
+			`"source":{"ts_ms":1700000000000,"snapshot":"false","schema":"diku_mod_users","table":"users"}}}`)
+	pass, err := util.CompileColumnFilters([]string{`^diku_mod_users\.users$=^(barcode|personal)$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop, err := util.CompileColumnFilters([]string{`\.users$=^personal$`, `^other\.t$=^barcode$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{ColumnPassFilter: pass, ColumnStopFilter: stop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, col := range c.Column {
+		names = append(names, col.Name)
+	}
+	if len(names) != 2 || names[0] != "id" || names[1] != "barcode" {
+		t.Errorf("got columns %v; want [id barcode]", names)
+	}
+
+	tablePass, err := util.CompileRegexps([]string{`^diku_mod_inventory_storage\.`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err = NewCommand(log.NewMessageSet(), ce, &SourceOptions{TablePassFilter: tablePass})
+	if c != nil || err != nil {
+		t.Errorf("got %v, %v; want nil, nil", c, err)
+	}
+}
+
+func TestNewCommandColumnFilterJSONPath(t *testing.T) {
+	ce := testEvent(t, "folio.diku_mod_users.users",
+		`{"schema":{"type":"struct","fields":[{"type":"int32","field":"id"}]},"payload":{"id":1}}`,
+		`{"schema":{"type":"struct","fields":[{"type":"struct","field":"after","fields":[`+
+			`{"type":"int32","field":"id"},`+
+			`{"type":"string","name":"io.debezium.data.Json","field":"jsonb"}]}]},`+
+			`"payload":{"op":"c","after":{"id":1,"jsonb":"{\"username\":\"a\",\"personal\":{\"email\":\"b\",\"lastName\":\"c\"},`+
+			`\"addresses\":[{\"city\":\"d\",\"postalCode\":\"e\"}]}"},`+
+			`"source":{"ts_ms":1700000000000,"snapshot":"false","schema":"diku_mod_users","table":"users"}}}`)
+	stop, err := util.CompileColumnFilters([]string{`\.users$=jsonb.personal.email`, `\.users$=jsonb.addresses.postalCode`,
+		`\.users$=jsonb.missing.key`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := NewCommand(log.NewMessageSet(), ce, &SourceOptions{ColumnStopFilter: stop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Column) != 2 || c.Column[1].Name != "jsonb" {
+		t.Fatalf("got columns %v; want [id jsonb]", c.Column)
+	}
+	want := `{"addresses":[{"city":"d"}],"personal":{"lastName":"c"},"username":"a"}`
+	if got := *c.Column[1].SQLData; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	if got := c.Column[1].Data; got != want {
+		t.Errorf("got data %v; want %s", got, want)
+	}
+}
@@ -79,6 +79,11 @@ type DB struct {
 	SSLMode               string
 	CheckpointSegmentSize int
 	MaxPollInterval       int
+	JSONDepth             int
+	ApplyWorkers          int
+	// SecretKey is used to encrypt secret configuration values that are
+	// stored in the database.
+	SecretKey []byte
 }
 
 //func NewDB(databaseURI string) (*DB, error) {
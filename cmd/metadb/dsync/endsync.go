@@ -202,8 +202,8 @@ func EndSync(opt *option.EndSync) error {
 	// Sync marctab for full update and schedule maintenance.
 	q := "UPDATE marctab.metadata SET version = 0"
 	_, _ = dp.Exec(context.TODO(), q)
-	q = "UPDATE metadb.maintenance SET next_maintenance_time = next_maintenance_time - interval '1 day'"
-	if _, err = dp.Exec(context.TODO(), q); err != nil {
+	q = "UPDATE metadb.source SET next_maintenance_time = next_maintenance_time - interval '1 day' WHERE name=$1"
+	if _, err = dp.Exec(context.TODO(), q, opt.Source); err != nil {
 		return err
 	}
 	//log.Init(ioutil.Discard, false, false)
@@ -0,0 +1,255 @@
+package jsonx
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/internal/uuid"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// TypeDetector recognizes JSON values that can be stored using a data type
+// narrower than the default for their JSON type, which is text for strings and
+// numeric for numbers.
+type TypeDetector interface {
+	// Type returns the data type and size of the detected values.
+	Type() (command.DataType, int64)
+	// Detect returns true if a JSON value can be stored using the data type.
+	Detect(value any) bool
+}
+
+// DefaultDetectors lists the detectors used by default.  When more than one
+// detector matches all values in a column, the first one in the list is
+// preferred.
+var DefaultDetectors = []TypeDetector{
+	UUIDDetector{},
+	DateDetector{},
+	TimestampDetector{},
+	TimestamptzDetector{},
+	IntegerDetector{},
+}
+
+// DefaultInferenceThreshold is the number of values in a column that must agree
+// on a data type before the type is used.
+const DefaultInferenceThreshold = 10
+
+// UUIDDetector detects strings that are UUIDs.
+type UUIDDetector struct{}
+
+func (UUIDDetector) Type() (command.DataType, int64) {
+	return command.UUIDType, 0
+}
+
+func (UUIDDetector) Detect(value any) bool {
+	s, ok := value.(string)
+	return ok && uuid.IsUUID(s)
+}
+
+// DateDetector detects strings that are dates in the form YYYY-MM-DD.
+type DateDetector struct{}
+
+func (DateDetector) Type() (command.DataType, int64) {
+	return command.DateType, 0
+}
+
+func (DateDetector) Detect(value any) bool {
+	s, ok := value.(string)
+	if !ok || !dateRegexp.MatchString(s) {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// TimestamptzDetector detects strings that are ISO 8601 timestamps, with or
+// without a time zone offset.  A timestamp without an offset is interpreted in
+// the database's time zone.
+type TimestamptzDetector struct{}
+
+func (TimestamptzDetector) Type() (command.DataType, int64) {
+	return command.TimestamptzType, 0
+}
+
+func (TimestamptzDetector) Detect(value any) bool {
+	s, ok := value.(string)
+	return ok && timestamptzRegexp.MatchString(s)
+}
+
+// TimestampDetector detects strings that are ISO 8601 timestamps without a
+// time zone.
+type TimestampDetector struct{}
+
+func (TimestampDetector) Type() (command.DataType, int64) {
+	return command.TimestampType, 0
+}
+
+func (TimestampDetector) Detect(value any) bool {
+	s, ok := value.(string)
+	return ok && timestampRegexp.MatchString(s)
+}
+
+// IntegerDetector detects numbers that are integers within the range of the
+// bigint type.
+type IntegerDetector struct{}
+
+func (IntegerDetector) Type() (command.DataType, int64) {
+	return command.IntegerType, 8
+}
+
+func (IntegerDetector) Detect(value any) bool {
+	f, ok := value.(float64)
+	return ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+}
+
+var timestamptzRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}(:?\d{2})?)?$`)
+var timestampRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+
+// TypeInference chooses data types for columns extracted from JSON data.  It
+// keeps statistics on the values observed in each column, and a column is
+// given a narrower type only after enough values have been observed that all
+// agree on the type.  Once a value disagrees, the column keeps its default type
+// unless the type in the database already matches.  Type changes that still
+// occur, for example if a later value disagrees with a narrowed type, are
+// handled by the executor which widens the column type as needed.
+//
+// TypeInference is not safe for concurrent use.
+type TypeInference struct {
+	detectors []TypeDetector
+	threshold int64
+	stats     map[dbx.Column]*ColumnStats
+	pending   []pendingColumn
+}
+
+// ColumnStats records the values observed in a column.
+type ColumnStats struct {
+	// Count is the number of values observed.
+	Count int64
+	// Agree[i] is true if all values observed have matched detector i.
+	Agree []bool
+}
+
+type pendingColumn struct {
+	cmd   *command.Command
+	index int
+}
+
+// NewTypeInference returns a TypeInference that uses the specified detectors,
+// and narrows a column type once threshold values agree.
+func NewTypeInference(detectors []TypeDetector, threshold int64) *TypeInference {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &TypeInference{
+		detectors: detectors,
+		threshold: threshold,
+		stats:     make(map[dbx.Column]*ColumnStats),
+	}
+}
+
+// Stats returns the statistics for a column, or nil if no values have been
+// observed.
+func (ti *TypeInference) Stats(column dbx.Column) *ColumnStats {
+	return ti.stats[column]
+}
+
+// observe records the value of column index in cmd.  The column's data type is
+// set later by ResolveTypes.
+func (ti *TypeInference) observe(cmd *command.Command, index int) {
+	col := &cmd.Column[index]
+	if col.Data == nil {
+		return
+	}
+	key := dbx.Column{Schema: cmd.SchemaName, Table: cmd.TableName, Column: col.Name}
+	s := ti.stats[key]
+	if s == nil {
+		s = &ColumnStats{Agree: make([]bool, len(ti.detectors))}
+		for i := range s.Agree {
+			s.Agree[i] = true
+		}
+		ti.stats[key] = s
+	}
+	s.Count++
+	for i, d := range ti.detectors {
+		if s.Agree[i] && !d.Detect(col.Data) {
+			s.Agree[i] = false
+		}
+	}
+	ti.pending = append(ti.pending, pendingColumn{cmd: cmd, index: index})
+}
+
+// ResolveTypes sets the data types of the columns observed since the last call.
+// Statistics for all of the columns are updated before any type is chosen, so
+// that values written together in a batch are given the same type.
+// columnType returns the current data type of a column in the database, or nil
+// if the column does not exist.
+func (ti *TypeInference) ResolveTypes(columnType func(*dbx.Column) *string) error {
+	pending := ti.pending
+	ti.pending = nil
+	for _, p := range pending {
+		col := &p.cmd.Column[p.index]
+		key := dbx.Column{Schema: p.cmd.SchemaName, Table: p.cmd.TableName, Column: col.Name}
+		dtype, size := ti.inferType(key, col.Data, columnType)
+		if dtype == col.DType {
+			continue
+		}
+		sqldata, err := inferredSQLData(col.Data, dtype)
+		if err != nil {
+			return err
+		}
+		col.DType = dtype
+		col.DTypeSize = size
+		col.SQLData = sqldata
+	}
+	return nil
+}
+
+func (ti *TypeInference) inferType(key dbx.Column, value any, columnType func(*dbx.Column) *string) (command.DataType, int64) {
+	// If the column already has a type that matches the value, keep it,
+	// so that narrowed types are retained regardless of the statistics.
+	var current command.DataType
+	if columnType != nil {
+		if t := columnType(&key); t != nil {
+			current, _ = command.MakeDataType(*t)
+		}
+	}
+	for _, d := range ti.detectors {
+		if dtype, size := d.Type(); dtype == current && d.Detect(value) {
+			return dtype, size
+		}
+	}
+	if s := ti.stats[key]; s != nil && s.Count >= ti.threshold {
+		for i, d := range ti.detectors {
+			if s.Agree[i] {
+				return d.Type()
+			}
+		}
+	}
+	return defaultType(value), 0
+}
+
+func defaultType(value any) command.DataType {
+	switch value.(type) {
+	case bool:
+		return command.BooleanType
+	case float64:
+		return command.NumericType
+	default:
+		return command.TextType
+	}
+}
+
+func inferredSQLData(value any, dtype command.DataType) (*string, error) {
+	switch v := value.(type) {
+	case float64:
+		if dtype == command.IntegerType {
+			return command.DataToSQLData(v, command.IntegerType, "")
+		}
+		s := strconv.FormatFloat(v, 'E', -1, 64)
+		return command.DataToSQLData(s, command.NumericType, "")
+	default:
+		return command.DataToSQLData(v, command.TextType, "")
+	}
+}
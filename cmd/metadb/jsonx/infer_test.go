@@ -0,0 +1,110 @@
+package jsonx
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func TestDetectors(t *testing.T) {
+	tests := []struct {
+		detector TypeDetector
+		value    any
+		want     bool
+	}{
+		{UUIDDetector{}, "a8fcd6b1-0c73-4b5a-9c4e-1f8e0a7b6c5d", true},
+		{UUIDDetector{}, "a8fcd6b1", false},
+		{DateDetector{}, "2023-02-28", true},
+		{DateDetector{}, "2023-02-30", false},
+		{DateDetector{}, "2023-02-28T00:00:00Z", false},
+		{TimestampDetector{}, "2023-02-28T10:11:12.345", true},
+		{TimestampDetector{}, "2023-02-28T10:11:12Z", false},
+		{TimestamptzDetector{}, "2023-02-28T10:11:12.345+00:00", true},
+		{TimestamptzDetector{}, "2023-02-28T10:11:12-0500", true},
+		{TimestamptzDetector{}, "2023-02-28T10:11:12", true},
+		{TimestamptzDetector{}, "2023-02-28", false},
+		{IntegerDetector{}, float64(42), true},
+		{IntegerDetector{}, 4.2, false},
+		{IntegerDetector{}, "42", false},
+	}
+	for _, tt := range tests {
+		if got := tt.detector.Detect(tt.value); got != tt.want {
+			t.Errorf("%T.Detect(%v) = %v; want %v", tt.detector, tt.value, got, tt.want)
+		}
+	}
+}
+
+func rewriteInferBatch(t *testing.T, infer *TypeInference, columnType func(*dbx.Column) *string, data ...string) []*command.Command {
+	l := list.New()
+	for i, d := range data {
+		id := fmt.Sprint(i + 1)
+		d := d
+		cmd := &command.Command{
+			Op:         command.MergeOp,
+			SchemaName: "s",
+			TableName:  "t",
+			Column: []command.CommandColumn{
+				{Name: "id", DType: command.TextType, Data: id, SQLData: &id, PrimaryKey: 1},
+				{Name: "jsonb", DType: command.JSONType, Data: d, SQLData: &d},
+			},
+		}
+		if err := RewriteJSON(l.PushBack(cmd), &cmd.Column[1], nil, 3, infer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := infer.ResolveTypes(columnType); err != nil {
+		t.Fatal(err)
+	}
+	var subs []*command.Command
+	for e := l.Front(); e != nil; e = e.Next() {
+		subs = append(subs, e.Value.(*command.Command).Subcommands.Front().Value.(*command.Command))
+	}
+	return subs
+}
+
+func TestTypeInference(t *testing.T) {
+	infer := NewTypeInference(DefaultDetectors, 3)
+
+	// Too few values to narrow the types.
+	subs := rewriteInferBatch(t, infer, nil,
+		`{"u": "a8fcd6b1-0c73-4b5a-9c4e-1f8e0a7b6c5d", "n": 1, "d": "2023-01-01"}`,
+		`{"u": "b8fcd6b1-0c73-4b5a-9c4e-1f8e0a7b6c5d", "n": 2, "d": "2023-01-02"}`)
+	cols := columns(subs[1])
+	if cols["u"].DType != command.TextType || cols["n"].DType != command.NumericType || cols["d"].DType != command.TextType {
+		t.Errorf("got columns %v; want default types", subs[1].Column)
+	}
+
+	// The threshold is reached, and "d" has a value that disagrees.
+	subs = rewriteInferBatch(t, infer, nil,
+		`{"u": "c8fcd6b1-0c73-4b5a-9c4e-1f8e0a7b6c5d", "n": 3, "d": "2023-01-03", "ts": "2023-01-03T10:00:00Z"}`,
+		`{"u": "d8fcd6b1-0c73-4b5a-9c4e-1f8e0a7b6c5d", "n": 4, "d": "unknown"}`)
+	cols = columns(subs[0])
+	if cols["u"].DType != command.UUIDType || cols["n"].DType != command.IntegerType || *cols["n"].SQLData != "3" {
+		t.Errorf("got columns %v; want uuid and integer types", subs[0].Column)
+	}
+	if cols["d"].DType != command.TextType || cols["ts"].DType != command.TextType {
+		t.Errorf("got columns %v; want text type", subs[0].Column)
+	}
+	if s := infer.Stats(dbx.Column{Schema: "s", Table: "t__t", Column: "n"}); s == nil || s.Count != 4 {
+		t.Errorf("got stats %v; want count 4", s)
+	}
+
+	// A value that disagrees is given the default type, unless it matches
+	// the type in the database.
+	date := "date"
+	columnType := func(column *dbx.Column) *string {
+		if column.Column == "d" {
+			return &date
+		}
+		return nil
+	}
+	subs = rewriteInferBatch(t, infer, columnType,
+		`{"n": 5.5, "d": "2023-01-05"}`)
+	cols = columns(subs[0])
+	if cols["n"].DType != command.NumericType || cols["d"].DType != command.DateType {
+		t.Errorf("got columns %v; want numeric and date types", subs[0].Column)
+	}
+}
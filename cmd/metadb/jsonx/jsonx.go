@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/metadb-project/metadb/cmd/metadb/command"
@@ -11,11 +12,25 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
-func RewriteJSON(cmde *list.Element, column *command.CommandColumn) error {
+// RewriteJSON transforms a JSON object in a column into a transformed table
+// according to t, or using the flatten method if t is nil.  The transformed
+// table has the name of the source table with the suffix "__t", unless a
+// target table is specified.
+//
+// The flatten method extracts fields of nested objects into columns named by
+// joining the field names with "__", and the elements of each array into a
+// child table named by appending "__" and the array name to the table name.
+// Each row of a child table contains the primary key of the parent row and an
+// ordinal column holding the position of the element in the array, beginning
+// with 1.  Objects and arrays nested more than maxDepth levels are skipped,
+// unless the transform specifies a depth.
+//
+// Strings and numbers extracted by the flatten method are given the types text
+// and numeric.  If infer is not nil, the values are observed by infer, which
+// may choose narrower types when its ResolveTypes method is called.
+func RewriteJSON(cmde *list.Element, column *command.CommandColumn, t *Transform, maxDepth int, infer *TypeInference) error {
 	cmd := cmde.Value.(*command.Command)
-	// folio module filter
-	if cmd.SchemaName == "folio_source_record" &&
-		(cmd.TableName == "marc_records_lb" || cmd.TableName == "edifact_records_lb") {
+	if t != nil && t.Method == None {
 		return nil
 	}
 
@@ -33,155 +48,247 @@ func RewriteJSON(cmde *list.Element, column *command.CommandColumn) error {
 	if !ok {
 		return nil
 	}
-	if err := rewriteObject(cmde, 1, obj, cmd.TableName+"__t"); err != nil {
+	table := cmd.TableName + "__t"
+	if t != nil {
+		if t.TargetTable != "" {
+			table = t.TargetTable
+		}
+		if t.Depth != 0 {
+			maxDepth = t.Depth
+		}
+	}
+	r := &rewriter{cmd: cmd, maxDepth: maxDepth, infer: infer}
+	if t != nil && t.Method == Extract {
+		if err := r.extractPaths(obj, table, t.Paths); err != nil {
+			return fmt.Errorf("rewrite json: %s", err)
+		}
+		return nil
+	}
+	parentTable := dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
+	if _, err := r.rewriteObject(1, obj, table, command.PrimaryKeyColumns(cmd.Column), parentTable); err != nil {
 		return fmt.Errorf("rewrite json: %s", err)
 	}
 	return nil
 }
 
-func rewriteObject(cmde *list.Element, level int, obj map[string]interface{}, table string) error {
-	cmd := cmde.Value.(*command.Command)
-	if level > 2 {
-		return nil
-	}
+// OrdinalColumn returns the name of the ordinal column in a child table
+// containing array elements, given the names of the child table and its parent
+// table.
+func OrdinalColumn(parentTable, childTable string) string {
+	return childTable[len(parentTable)+2:] + "_ord"
+}
+
+type rewriter struct {
+	cmd      *command.Command
+	maxDepth int
+	infer    *TypeInference
+}
+
+type array struct {
+	name  string
+	value []interface{}
+}
+
+// rewriteObject adds a subcommand that writes the fields of obj together with
+// the key columns to a transformed table, followed by subcommands for arrays
+// in obj.
+func (r *rewriter) rewriteObject(level int, obj map[string]interface{}, table string, key []command.CommandColumn, parentTable dbx.Table) (*command.Command, error) {
 	cols := make([]command.CommandColumn, 0)
-	pkcols := command.PrimaryKeyColumns(cmd.Column)
-	pkcolsmap := make(map[string]bool)
-	for _, col := range pkcols {
+	colsmap := make(map[string]bool)
+	for _, col := range key {
 		cols = append(cols, col)
-		pkcolsmap[col.Name] = true
+		colsmap[col.Name] = true
+	}
+	var arrays []array
+	if err := r.flattenObject(level, obj, "", colsmap, &cols, &arrays); err != nil {
+		return nil, err
+	}
+	newcmd := &command.Command{
+		Op:              command.MergeOp,
+		SchemaName:      r.cmd.SchemaName,
+		TableName:       table,
+		Transformed:     true,
+		ParentTable:     parentTable,
+		Origin:          r.cmd.Origin,
+		Column:          cols,
+		SourceTimestamp: r.cmd.SourceTimestamp,
+		ArrayLengths:    make(map[string]int),
+	}
+	r.cmd.AddChild(newcmd)
+	for i := len(key); i < len(cols); i++ {
+		r.observe(newcmd, i)
+	}
+	pkcols := command.PrimaryKeyColumns(cols)
+	t := dbx.Table{Schema: r.cmd.SchemaName, Table: table}
+	for _, a := range arrays {
+		if err := r.rewriteArray(level+1, a, table+"__"+a.name, pkcols, t); err != nil {
+			return nil, err
+		}
+		newcmd.ArrayLengths[table+"__"+a.name] = len(a.value)
 	}
-	for name, value := range obj {
+	return newcmd, nil
+}
+
+// flattenObject adds the scalar fields of obj and of nested objects to cols,
+// and collects the arrays.
+func (r *rewriter) flattenObject(level int, obj map[string]interface{}, prefix string, colsmap map[string]bool, cols *[]command.CommandColumn, arrays *[]array) error {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := obj[name]
+		if value == nil {
+			// For nil values, do not add the column to this record.
+			continue
+		}
 		n, err := util.DecodeCamelCase(name)
 		if err != nil {
 			return fmt.Errorf("converting from camel case: %s: %v", err, obj)
 		}
-		if pkcolsmap[name] {
-			//n = "j_" + n
-			continue
+		if prefix != "" {
+			n = prefix + "__" + n
 		}
-		if value == nil {
-			// For nil values, do not add the column to this record.
+		if colsmap[name] || colsmap[n] {
 			continue
 		}
 		switch v := value.(type) {
 		case []interface{}:
-			//if err := rewriteArray(cl, cmd, column, db, level+1, n, v, table+"_"+n); err != nil {
-			//        return err
-			//}
-		case bool:
-			sqldata, err := command.DataToSQLData(v, command.BooleanType, "")
-			if err != nil {
-				return err
+			if level < r.maxDepth {
+				*arrays = append(*arrays, array{name: n, value: v})
 			}
-			cols = append(cols, command.CommandColumn{
-				Name:       n,
-				DType:      command.BooleanType,
-				DTypeSize:  0,
-				Data:       v,
-				SQLData:    sqldata,
-				PrimaryKey: 0,
-			})
-		case float64:
-			s := strconv.FormatFloat(v, 'E', -1, 64)
-			sqldata, err := command.DataToSQLData(s, command.NumericType, "")
-			if err != nil {
-				return err
-			}
-			cols = append(cols, command.CommandColumn{
-				Name:       n,
-				DType:      command.NumericType,
-				DTypeSize:  0,
-				Data:       v,
-				SQLData:    sqldata,
-				PrimaryKey: 0,
-			})
 		case map[string]interface{}:
-			//if err := rewriteObject(cl, cmd, column, db, level+1, v, table+"_"+n); err != nil {
-			//        return err
-			//}
-		case string:
-			sqldata, err := command.DataToSQLData(v, command.TextType, "")
+			if level < r.maxDepth {
+				if err := r.flattenObject(level+1, v, n, colsmap, cols, arrays); err != nil {
+					return err
+				}
+			}
+		default:
+			col, err := scalarColumn(n, v)
 			if err != nil {
 				return err
 			}
-			dtype := command.InferTypeFromString(v)
-			cols = append(cols, command.CommandColumn{
-				Name:       n,
-				DType:      dtype,
-				DTypeSize:  0,
-				Data:       v,
-				SQLData:    sqldata,
-				PrimaryKey: 0,
-			})
+			if col != nil {
+				*cols = append(*cols, *col)
+				colsmap[n] = true
+			}
 		}
-
 	}
-	newcmd := &command.Command{
-		Op:              command.MergeOp,
-		SchemaName:      cmd.SchemaName,
-		TableName:       table,
-		Transformed:     true,
-		ParentTable:     dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
-		Origin:          cmd.Origin,
-		Column:          cols,
-		SourceTimestamp: cmd.SourceTimestamp,
-	}
-	cmd.AddChild(newcmd)
 	return nil
 }
 
-/*func rewriteArray(cl *command.CommandList, cmd *command.Command, column *command.CommandColumn, db *sql.DB, level int, aname string, adata []interface{}, table string) error {
-	if level > 2 {
-		return nil
-	}
-	pkcols := command.PrimaryKeyColumns(cmd.Column)
-	for i, value := range adata {
-		if value == nil {
-			// TODO store null value
-			continue
+// rewriteArray adds subcommands that write the elements of an array to a
+// child table.  Elements that are objects are flattened into columns, and
+// other elements are written to a column having the name of the array.
+func (r *rewriter) rewriteArray(level int, a array, table string, key []command.CommandColumn, parentTable dbx.Table) error {
+	ordinal := a.name + "_ord"
+	for i, value := range a.value {
+		cols := make([]command.CommandColumn, 0, len(key)+2)
+		cols = append(cols, key...)
+		ord := float64(i + 1)
+		sqldata, err := command.DataToSQLData(ord, command.IntegerType, "")
+		if err != nil {
+			return err
 		}
-		_ = i
+		cols = append(cols, command.CommandColumn{
+			Name:       ordinal,
+			DType:      command.IntegerType,
+			DTypeSize:  4,
+			Data:       ord,
+			SQLData:    sqldata,
+			PrimaryKey: len(key) + 1,
+		})
 		switch v := value.(type) {
 		case map[string]interface{}:
-			// TODO
-		case string:
-			var cols []command.CommandColumn
-			for _, col := range pkcols {
-				cols = append(cols, col)
+			if _, err := r.rewriteObject(level, v, table, cols, parentTable); err != nil {
+				return err
 			}
-			cols = append(cols, command.CommandColumn{
-				Name:         "ord",
-				DType:        command.IntegerType,
-				DTypeSize:    4,
-				SemanticType: "",
-				Data:         i + 1,
-				EncodedData:  command.SQLEncodeData(i+1, command.IntegerType, ""),
-				PrimaryKey:   len(pkcols) + 1,
-			})
-			cols = append(cols, command.CommandColumn{
-				Name:         aname,
-				DType:        command.TextType,
-				DTypeSize:    int64(len(v)),
-				SemanticType: "",
-				Data:         v,
-				EncodedData:  command.SQLEncodeData(v, command.TextType, ""),
-				PrimaryKey:   0,
-			})
-			ncmd := command.Command{
-				Op:              command.MergeOp,
-				SchemaName:      cmd.SchemaName,
-				TableName:       table,
-				ParentTable:     sqlx.Table{cmd.SchemaName, cmd.TableName},
-				Origin:          cmd.Origin,
-				Column:          cols,
-				ChangeEvent:     cmd.ChangeEvent,
-				SourceTimestamp: cmd.SourceTimestamp,
+			continue
+		case []interface{}:
+			// Arrays of arrays are not supported; only the
+			// position is recorded.
+		default:
+			col, err := scalarColumn(a.name, v)
+			if err != nil {
+				return err
+			}
+			if col != nil {
+				cols = append(cols, *col)
 			}
-			cl.Cmd = append(cl.Cmd, ncmd)
 		}
-
+		newcmd := &command.Command{
+			Op:              command.MergeOp,
+			SchemaName:      r.cmd.SchemaName,
+			TableName:       table,
+			Transformed:     true,
+			ParentTable:     parentTable,
+			Origin:          r.cmd.Origin,
+			Column:          cols,
+			SourceTimestamp: r.cmd.SourceTimestamp,
+		}
+		r.cmd.AddChild(newcmd)
+		if len(cols) > len(key)+1 {
+			r.observe(newcmd, len(cols)-1)
+		}
 	}
 	return nil
 }
-*/
+
+// observe passes a column extracted from a JSON value to the type inference
+// engine, if any.
+func (r *rewriter) observe(cmd *command.Command, index int) {
+	if r.infer != nil {
+		r.infer.observe(cmd, index)
+	}
+}
+
+// scalarColumn returns a column for a JSON boolean, number, or string, or nil
+// for any other value.  Numbers and strings are given the types numeric and
+// text, which may later be narrowed by type inference.
+func scalarColumn(name string, value interface{}) (*command.CommandColumn, error) {
+	switch v := value.(type) {
+	case bool:
+		sqldata, err := command.DataToSQLData(v, command.BooleanType, "")
+		if err != nil {
+			return nil, err
+		}
+		return &command.CommandColumn{
+			Name:       name,
+			DType:      command.BooleanType,
+			DTypeSize:  0,
+			Data:       v,
+			SQLData:    sqldata,
+			PrimaryKey: 0,
+		}, nil
+	case float64:
+		s := strconv.FormatFloat(v, 'E', -1, 64)
+		sqldata, err := command.DataToSQLData(s, command.NumericType, "")
+		if err != nil {
+			return nil, err
+		}
+		return &command.CommandColumn{
+			Name:       name,
+			DType:      command.NumericType,
+			DTypeSize:  0,
+			Data:       v,
+			SQLData:    sqldata,
+			PrimaryKey: 0,
+		}, nil
+	case string:
+		sqldata, err := command.DataToSQLData(v, command.TextType, "")
+		if err != nil {
+			return nil, err
+		}
+		return &command.CommandColumn{
+			Name:       name,
+			DType:      command.TextType,
+			DTypeSize:  0,
+			Data:       v,
+			SQLData:    sqldata,
+			PrimaryKey: 0,
+		}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,131 @@
+package jsonx
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+const testInstance = `{
+    "id": "a",
+    "title": "Bleak House",
+    "metadata": {"createdDate": "2023-01-01", "tags": ["x"]},
+    "identifiers": [
+        {"value": "0141439726", "identifierTypeId": "isbn", "notes": ["first", "second"]},
+        {"value": "ocm1234"}
+    ],
+    "subjects": ["Novels", null]
+}`
+
+func rewriteTestCommand(t *testing.T, data string, maxDepth int) map[string][]*command.Command {
+	id := "1"
+	cmd := &command.Command{
+		Op:         command.MergeOp,
+		SchemaName: "inventory",
+		TableName:  "instance",
+		Column: []command.CommandColumn{
+			{Name: "id", DType: command.TextType, Data: id, SQLData: &id, PrimaryKey: 1},
+			{Name: "jsonb", DType: command.JSONType, Data: data, SQLData: &data},
+		},
+	}
+	l := list.New()
+	e := l.PushBack(cmd)
+	if err := RewriteJSON(e, &cmd.Column[1], nil, maxDepth, nil); err != nil {
+		t.Fatal(err)
+	}
+	tables := make(map[string][]*command.Command)
+	if cmd.Subcommands == nil {
+		return tables
+	}
+	for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
+		c := f.Value.(*command.Command)
+		if !c.Transformed || c.SchemaName != "inventory" {
+			t.Errorf("%s: unexpected command %v", c.TableName, c)
+		}
+		tables[c.TableName] = append(tables[c.TableName], c)
+	}
+	return tables
+}
+
+func columns(c *command.Command) map[string]command.CommandColumn {
+	m := make(map[string]command.CommandColumn)
+	for _, col := range c.Column {
+		m[col.Name] = col
+	}
+	return m
+}
+
+func TestRewriteJSON(t *testing.T) {
+	tables := rewriteTestCommand(t, testInstance, 3)
+	want := map[string]int{
+		"instance__t":                     1,
+		"instance__t__metadata__tags":     1,
+		"instance__t__identifiers":        2,
+		"instance__t__identifiers__notes": 2,
+		"instance__t__subjects":           2,
+	}
+	for table, n := range want {
+		if len(tables[table]) != n {
+			t.Errorf("%s: got %d commands; want %d", table, len(tables[table]), n)
+		}
+	}
+	if len(tables) != len(want) {
+		t.Errorf("got %d tables; want %d", len(tables), len(want))
+	}
+
+	root := tables["instance__t"][0]
+	cols := columns(root)
+	if *cols["metadata__created_date"].SQLData != "2023-01-01" || *cols["title"].SQLData != "Bleak House" {
+		t.Errorf("instance__t: got columns %v", root.Column)
+	}
+	if cols["id"].PrimaryKey != 1 || *cols["id"].SQLData != "1" {
+		t.Errorf("instance__t: primary key column \"id\" not copied from parent")
+	}
+	if root.ArrayLengths["instance__t__identifiers"] != 2 || root.ArrayLengths["instance__t__subjects"] != 2 {
+		t.Errorf("instance__t: got array lengths %v", root.ArrayLengths)
+	}
+
+	ident := tables["instance__t__identifiers"][1]
+	cols = columns(ident)
+	if ident.ParentTable != (dbx.Table{Schema: "inventory", Table: "instance__t"}) {
+		t.Errorf("identifiers: got parent table %v", ident.ParentTable)
+	}
+	if *cols["identifiers_ord"].SQLData != "2" || cols["identifiers_ord"].PrimaryKey != 2 {
+		t.Errorf("identifiers: got ordinal column %v", cols["identifiers_ord"])
+	}
+	if *cols["value"].SQLData != "ocm1234" {
+		t.Errorf("identifiers: got value %v", cols["value"])
+	}
+
+	note := tables["instance__t__identifiers__notes"][1]
+	cols = columns(note)
+	if note.ParentTable.Table != "instance__t__identifiers" {
+		t.Errorf("notes: got parent table %v", note.ParentTable)
+	}
+	if *cols["id"].SQLData != "1" || *cols["identifiers_ord"].SQLData != "1" || *cols["notes_ord"].SQLData != "2" ||
+		cols["notes_ord"].PrimaryKey != 3 || *cols["notes"].SQLData != "second" {
+		t.Errorf("notes: got columns %v", note.Column)
+	}
+
+	subject := tables["instance__t__subjects"][1]
+	if _, ok := columns(subject)["subjects"]; ok {
+		t.Errorf("subjects: null element should have no value column")
+	}
+
+	if c := OrdinalColumn("instance__t", "instance__t__metadata__tags"); c != "metadata__tags_ord" {
+		t.Errorf("got ordinal column %q; want metadata__tags_ord", c)
+	}
+}
+
+func TestRewriteJSONMaxDepth(t *testing.T) {
+	tables := rewriteTestCommand(t, testInstance, 1)
+	if len(tables) != 1 {
+		t.Errorf("got %d tables; want 1", len(tables))
+	}
+	cols := columns(tables["instance__t"][0])
+	if _, ok := cols["metadata__created_date"]; ok {
+		t.Errorf("nested object should not be flattened")
+	}
+}
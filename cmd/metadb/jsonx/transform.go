@@ -0,0 +1,307 @@
+package jsonx
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/metadb-project/metadb/cmd/internal/uuid"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// Transform methods
+const (
+	// Flatten extracts all fields of JSON objects, as well as arrays, into
+	// transformed tables.
+	Flatten = "flatten"
+	// Extract extracts only specified fields into a transformed table.
+	Extract = "extract"
+	// None disables transformation of JSON data.
+	None = "none"
+)
+
+// Transform is a mapping that defines how JSON data in a column are
+// transformed.
+type Transform struct {
+	Name  string
+	Table dbx.Table
+	// Column is the JSON column, or "" for all JSON columns in the table.
+	Column string
+	Method string
+	// TargetTable is the name of the transformed table, or "" for the
+	// default name.
+	TargetTable string
+	// Depth is the nesting depth for the flatten method, or 0 for the
+	// default depth.
+	Depth int
+	// Paths lists the fields to extract for the extract method.
+	Paths []Path
+}
+
+// Path is a JSON field extracted into a column of a specified type.
+type Path struct {
+	// Keys is the sequence of object field names leading to the field.
+	Keys   []string
+	Column string
+	Type   command.DataType
+}
+
+var pathTypes = map[string]command.DataType{
+	"text":        command.TextType,
+	"integer":     command.IntegerType,
+	"numeric":     command.NumericType,
+	"boolean":     command.BooleanType,
+	"uuid":        command.UUIDType,
+	"date":        command.DateType,
+	"timestamptz": command.TimestamptzType,
+	"jsonb":       command.JSONType,
+}
+
+// ParsePaths parses a comma-separated list of paths, each written as a
+// dot-separated sequence of field names followed by a data type and
+// optionally a column name, e.g. "metadata.createdDate timestamptz created".
+// If the column name is omitted, it is formed by converting the field names
+// from camel case and joining them with "__".
+func ParsePaths(s string) ([]Path, error) {
+	var paths []Path
+	for _, e := range util.SplitList(s) {
+		f := strings.Fields(e)
+		if len(f) < 2 || len(f) > 3 {
+			return nil, fmt.Errorf("invalid path %q: expected path, type, and optional column name", e)
+		}
+		keys := strings.Split(f[0], ".")
+		for _, k := range keys {
+			if k == "" {
+				return nil, fmt.Errorf("invalid path %q", f[0])
+			}
+		}
+		dtype, ok := pathTypes[strings.ToLower(f[1])]
+		if !ok {
+			return nil, fmt.Errorf("invalid path %q: unsupported type %q", e, f[1])
+		}
+		var column string
+		if len(f) == 3 {
+			column = f[2]
+		} else {
+			names := make([]string, len(keys))
+			for i, k := range keys {
+				n, err := util.DecodeCamelCase(k)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: %v", e, err)
+				}
+				names[i] = n
+			}
+			column = strings.Join(names, "__")
+		}
+		paths = append(paths, Path{Keys: keys, Column: column, Type: dtype})
+	}
+	return paths, nil
+}
+
+// CheckTransform returns an error if a transform is not valid.
+func CheckTransform(t *Transform) error {
+	switch t.Method {
+	case Flatten:
+		if len(t.Paths) != 0 {
+			return fmt.Errorf("option \"paths\" is only valid for method %q", Extract)
+		}
+		if t.Depth < 0 {
+			return fmt.Errorf("option \"depth\" must be greater than 0")
+		}
+	case Extract:
+		if len(t.Paths) == 0 {
+			return fmt.Errorf("option \"paths\" is required for method %q", Extract)
+		}
+		if t.Depth != 0 {
+			return fmt.Errorf("option \"depth\" is only valid for method %q", Flatten)
+		}
+		columns := make(map[string]bool)
+		for _, p := range t.Paths {
+			if columns[p.Column] {
+				return fmt.Errorf("column %q is defined more than once in \"paths\"", p.Column)
+			}
+			columns[p.Column] = true
+		}
+	case None:
+		if t.TargetTable != "" || t.Depth != 0 || len(t.Paths) != 0 {
+			return fmt.Errorf("method %q does not accept options", None)
+		}
+	default:
+		return fmt.Errorf("invalid transform method %q", t.Method)
+	}
+	if t.TargetTable != "" {
+		if strings.HasSuffix(t.TargetTable, "__") || strings.Contains(t.TargetTable, ".") {
+			return fmt.Errorf("%q is not a valid target table name", t.TargetTable)
+		}
+		if t.TargetTable == t.Table.Table {
+			return fmt.Errorf("target table cannot be the same as table %q", t.Table.Table)
+		}
+	}
+	return nil
+}
+
+// TransformSet is a collection of transforms indexed by table and column.
+type TransformSet struct {
+	transforms map[dbx.Table]map[string]*Transform
+}
+
+func NewTransformSet(transforms []*Transform) *TransformSet {
+	s := &TransformSet{transforms: make(map[dbx.Table]map[string]*Transform)}
+	for _, t := range transforms {
+		if s.transforms[t.Table] == nil {
+			s.transforms[t.Table] = make(map[string]*Transform)
+		}
+		s.transforms[t.Table][t.Column] = t
+	}
+	return s
+}
+
+// Lookup returns the transform for a JSON column, or nil if no transform is
+// defined.  A transform defined for the column takes precedence over one
+// defined for all columns in the table.
+func (s *TransformSet) Lookup(table dbx.Table, column string) *Transform {
+	if s == nil {
+		return nil
+	}
+	m := s.transforms[table]
+	if t := m[column]; t != nil {
+		return t
+	}
+	return m[""]
+}
+
+// extractPaths adds a subcommand that writes the specified fields of obj
+// together with the primary key columns to a transformed table.
+func (r *rewriter) extractPaths(obj map[string]interface{}, table string, paths []Path) error {
+	cols := make([]command.CommandColumn, 0)
+	colsmap := make(map[string]bool)
+	for _, col := range command.PrimaryKeyColumns(r.cmd.Column) {
+		cols = append(cols, col)
+		colsmap[col.Name] = true
+	}
+	for _, p := range paths {
+		if colsmap[p.Column] {
+			continue
+		}
+		value, ok := lookupPath(obj, p.Keys)
+		if !ok || value == nil {
+			continue
+		}
+		sqldata, ok := convertValue(value, p.Type)
+		if !ok {
+			continue
+		}
+		col := command.CommandColumn{
+			Name:    p.Column,
+			DType:   p.Type,
+			Data:    *sqldata,
+			SQLData: sqldata,
+		}
+		if p.Type == command.IntegerType {
+			col.DTypeSize = 8
+		}
+		cols = append(cols, col)
+	}
+	r.cmd.AddChild(&command.Command{
+		Op:              command.MergeOp,
+		SchemaName:      r.cmd.SchemaName,
+		TableName:       table,
+		Transformed:     true,
+		ParentTable:     dbx.Table{Schema: r.cmd.SchemaName, Table: r.cmd.TableName},
+		Origin:          r.cmd.Origin,
+		Column:          cols,
+		SourceTimestamp: r.cmd.SourceTimestamp,
+	})
+	return nil
+}
+
+func lookupPath(obj map[string]interface{}, keys []string) (interface{}, bool) {
+	var value interface{} = obj
+	for _, k := range keys {
+		o, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = o[k]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+var dateRegexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// convertValue returns a JSON value as SQL data of the specified type, or
+// false if the value cannot be converted.
+func convertValue(value interface{}, dtype command.DataType) (*string, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		if dtype != command.TextType && dtype != command.JSONType {
+			return nil, false
+		}
+	}
+	switch dtype {
+	case command.TextType:
+		if _, ok := value.(string); ok {
+			return &s, true
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, false
+		}
+		s = string(b)
+	case command.JSONType:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, false
+		}
+		s = string(b)
+	case command.IntegerType:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+				return nil, false
+			}
+			i = int64(f)
+		}
+		s = strconv.FormatInt(i, 10)
+	case command.NumericType:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, false
+		}
+	case command.BooleanType:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, false
+		}
+		s = strconv.FormatBool(b)
+	case command.UUIDType:
+		if !uuid.IsUUID(s) {
+			return nil, false
+		}
+	case command.DateType:
+		if !dateRegexp.MatchString(s) && command.InferTypeFromString(s) == command.TextType {
+			return nil, false
+		}
+	case command.TimestamptzType:
+		if command.InferTypeFromString(s) == command.TextType {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	return &s, true
+}
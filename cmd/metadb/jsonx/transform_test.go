@@ -0,0 +1,122 @@
+package jsonx
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func TestParsePaths(t *testing.T) {
+	paths, err := ParsePaths("title text, metadata.createdDate timestamptz, statisticalCodeIds jsonb codes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Path{
+		{Keys: []string{"title"}, Column: "title", Type: command.TextType},
+		{Keys: []string{"metadata", "createdDate"}, Column: "metadata__created_date", Type: command.TimestamptzType},
+		{Keys: []string{"statisticalCodeIds"}, Column: "codes", Type: command.JSONType},
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("got %d paths; want %d", len(paths), len(want))
+	}
+	for i := range want {
+		p := paths[i]
+		if len(p.Keys) != len(want[i].Keys) || p.Keys[0] != want[i].Keys[0] || p.Column != want[i].Column || p.Type != want[i].Type {
+			t.Errorf("path %d: got %v; want %v", i, p, want[i])
+		}
+	}
+	for _, s := range []string{"title", "title varchar", "a..b text", "a text b c"} {
+		if _, err = ParsePaths(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestCheckTransform(t *testing.T) {
+	paths, _ := ParsePaths("title text")
+	table := dbx.Table{Schema: "inventory", Table: "instance"}
+	for _, tr := range []*Transform{
+		{Table: table, Method: "unnest"},
+		{Table: table, Method: Extract},
+		{Table: table, Method: Flatten, Paths: paths},
+		{Table: table, Method: None, TargetTable: "x"},
+		{Table: table, Method: Flatten, TargetTable: "instance"},
+		{Table: table, Method: Flatten, TargetTable: "x__"},
+		{Table: table, Method: Extract, Paths: append(paths, paths...)},
+	} {
+		if err := CheckTransform(tr); err == nil {
+			t.Errorf("%v: expected error", tr)
+		}
+	}
+}
+
+func TestTransformSetLookup(t *testing.T) {
+	table := dbx.Table{Schema: "inventory", Table: "instance"}
+	all := &Transform{Table: table, Method: None}
+	col := &Transform{Table: table, Column: "jsonb", Method: Flatten}
+	s := NewTransformSet([]*Transform{all, col})
+	if s.Lookup(table, "jsonb") != col || s.Lookup(table, "other") != all {
+		t.Errorf("lookup returned wrong transform")
+	}
+	if s.Lookup(dbx.Table{Schema: "inventory", Table: "item"}, "jsonb") != nil {
+		t.Errorf("expected nil transform")
+	}
+}
+
+func TestRewriteJSONExtract(t *testing.T) {
+	paths, err := ParsePaths("title text, metadata.createdDate timestamptz, previouslyHeld integer, " +
+		"missing text, identifiers jsonb, id uuid instance_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &Transform{Method: Extract, TargetTable: "instance_summary", Paths: paths}
+	id := "1"
+	data := `{"id": "x", "title": "Bleak House", "metadata": {"createdDate": "2023-01-01T00:00:00Z"},
+		"previouslyHeld": 2.0, "identifiers": [{"value": "a"}]}`
+	cmd := &command.Command{
+		Op:         command.MergeOp,
+		SchemaName: "inventory",
+		TableName:  "instance",
+		Column: []command.CommandColumn{
+			{Name: "id", DType: command.TextType, Data: id, SQLData: &id, PrimaryKey: 1},
+			{Name: "jsonb", DType: command.JSONType, Data: data, SQLData: &data},
+		},
+	}
+	l := list.New()
+	if err = RewriteJSON(l.PushBack(cmd), &cmd.Column[1], tr, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Subcommands == nil || cmd.Subcommands.Len() != 1 {
+		t.Fatalf("expected one subcommand")
+	}
+	sub := cmd.Subcommands.Front().Value.(*command.Command)
+	if sub.TableName != "instance_summary" || sub.ParentTable != (dbx.Table{Schema: "inventory", Table: "instance"}) {
+		t.Errorf("got table %s with parent %v", sub.TableName, sub.ParentTable)
+	}
+	cols := columns(sub)
+	want := map[string]string{
+		"id":                     "1",
+		"title":                  "Bleak House",
+		"metadata__created_date": "2023-01-01T00:00:00Z",
+		"previously_held":        "2",
+		"identifiers":            `[{"value":"a"}]`,
+	}
+	if len(cols) != len(want) {
+		t.Errorf("got columns %v", sub.Column)
+	}
+	for name, v := range want {
+		if c, ok := cols[name]; !ok || *c.SQLData != v {
+			t.Errorf("%s: got %v; want %s", name, c.SQLData, v)
+		}
+	}
+
+	cmd.Subcommands = nil
+	if err = RewriteJSON(l.Front(), &cmd.Column[1], &Transform{Method: None}, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Subcommands != nil {
+		t.Errorf("expected no subcommands")
+	}
+}
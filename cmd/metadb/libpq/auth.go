@@ -0,0 +1,342 @@
+package libpq
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// errAuthFailed is returned to the client for any authentication failure, so
+// that the response does not reveal whether the user exists.
+type errAuthFailed struct {
+	user string
+}
+
+func (e errAuthFailed) Error() string {
+	return fmt.Sprintf("password authentication failed for user %q", e.user)
+}
+
+// authenticate checks the password of a client connecting as user.  The user
+// must be the Metadb system user or a user listed in metadb.auth.  Passwords
+// are verified against the role's password verifier in pg_authid, using
+// SCRAM-SHA-256 or, for roles having an MD5 password, MD5 authentication.
+// Other users are sent through a SCRAM-SHA-256 exchange that always fails.
+func authenticate(conn net.Conn, backend *pgproto3.Backend, user string, db *dbx.DB, dc *pgx.Conn) error {
+	if user == "" {
+		return fmt.Errorf("no user name specified")
+	}
+	allowed, err := isMetadbUser(dc, db, user)
+	if err != nil {
+		return fmt.Errorf("authenticating user %q: %v", user, err)
+	}
+	verifier, err := readPasswordVerifier(db, user)
+	if err != nil {
+		return fmt.Errorf("authenticating user %q: %v", user, err)
+	}
+	if !allowed {
+		verifier = ""
+	}
+	switch {
+	case strings.HasPrefix(verifier, "SCRAM-SHA-256$"):
+		v, err := parseSCRAMVerifier(verifier)
+		if err != nil {
+			return err
+		}
+		return authenticateSCRAM(conn, backend, user, v)
+	case strings.HasPrefix(verifier, "md5"):
+		return authenticateMD5(conn, backend, user, verifier)
+	default:
+		// Carry out a mock exchange, as PostgreSQL does, so that the
+		// client cannot tell unknown users from wrong passwords.
+		return authenticateSCRAM(conn, backend, user, mockSCRAMVerifier(db.SecretKey, user))
+	}
+}
+
+// isMetadbUser returns true if user is the Metadb system user or is listed in
+// metadb.auth or metadb.user_role.
+func isMetadbUser(dc dbx.Queryable, db *dbx.DB, user string) (bool, error) {
+	if user == db.User {
+		return true, nil
+	}
+	q := "SELECT 1 FROM metadb.auth WHERE username=$1 " +
+		"UNION SELECT 1 FROM metadb.user_role WHERE username=$1"
+	var i int64
+	err := dc.QueryRow(context.TODO(), q, user).Scan(&i)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
+// readPasswordVerifier returns the stored password verifier of a database role,
+// or "" if the role does not exist or has no password.
+func readPasswordVerifier(db *dbx.DB, user string) (string, error) {
+	dcsuper, err := db.ConnectSuper()
+	if err != nil {
+		return "", err
+	}
+	defer dbx.Close(dcsuper)
+	q := "SELECT rolpassword FROM pg_catalog.pg_authid WHERE rolname=$1 AND rolcanlogin"
+	var verifier *string
+	err = dcsuper.QueryRow(context.TODO(), q, user).Scan(&verifier)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("reading password: %v", err)
+	case verifier == nil:
+		return "", nil
+	default:
+		return *verifier, nil
+	}
+}
+
+func authenticateMD5(conn net.Conn, backend *pgproto3.Backend, user string, verifier string) error {
+	var salt [4]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return fmt.Errorf("generating salt: %v", err)
+	}
+	if err := writeEncoded(conn, []pgproto3.Message{&pgproto3.AuthenticationMD5Password{Salt: salt}}); err != nil {
+		return err
+	}
+	if err := backend.SetAuthType(pgproto3.AuthTypeMD5Password); err != nil {
+		return err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return fmt.Errorf("receiving password: %v", err)
+	}
+	pw, ok := msg.(*pgproto3.PasswordMessage)
+	if !ok {
+		return fmt.Errorf("expected password response, got %T", msg)
+	}
+	if verifier == "" || !verifyMD5(verifier, salt, pw.Password) {
+		return errAuthFailed{user: user}
+	}
+	return nil
+}
+
+// verifyMD5 checks an MD5 password response against a verifier of the form
+// "md5" + md5(password + user).
+func verifyMD5(verifier string, salt [4]byte, response string) bool {
+	h := md5.Sum(append([]byte(strings.TrimPrefix(verifier, "md5")), salt[:]...))
+	want := "md5" + hex.EncodeToString(h[:])
+	return subtle.ConstantTimeCompare([]byte(want), []byte(response)) == 1
+}
+
+// scramVerifier is a parsed SCRAM-SHA-256 password verifier in the form stored
+// by PostgreSQL:  SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+type scramVerifier struct {
+	iterations int
+	salt       string
+	storedKey  []byte
+	serverKey  []byte
+}
+
+func parseSCRAMVerifier(s string) (*scramVerifier, error) {
+	f := strings.Split(strings.TrimPrefix(s, "SCRAM-SHA-256$"), "$")
+	if len(f) != 2 {
+		return nil, fmt.Errorf("invalid SCRAM verifier")
+	}
+	is := strings.Split(f[0], ":")
+	ks := strings.Split(f[1], ":")
+	if len(is) != 2 || len(ks) != 2 {
+		return nil, fmt.Errorf("invalid SCRAM verifier")
+	}
+	iterations, err := strconv.Atoi(is[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCRAM verifier: iteration count: %v", err)
+	}
+	storedKey, err := base64.StdEncoding.DecodeString(ks[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCRAM verifier: stored key: %v", err)
+	}
+	serverKey, err := base64.StdEncoding.DecodeString(ks[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCRAM verifier: server key: %v", err)
+	}
+	return &scramVerifier{iterations: iterations, salt: is[1], storedKey: storedKey, serverKey: serverKey}, nil
+}
+
+// scramIterations is the iteration count of mock SCRAM-SHA-256 verifiers, which
+// is the default used by PostgreSQL.
+const scramIterations = 4096
+
+// mockSCRAMVerifier returns a SCRAM-SHA-256 verifier for a user that does not
+// exist or is not allowed to connect.  As in PostgreSQL, the salt is derived
+// from the user name and a server secret, so that it is the same in every
+// attempt.  No password matches the verifier.
+func mockSCRAMVerifier(secret []byte, user string) *scramVerifier {
+	salt := computeHMAC(secret, []byte("mock SCRAM salt:"+user))[:16]
+	return &scramVerifier{iterations: scramIterations, salt: base64.StdEncoding.EncodeToString(salt)}
+}
+
+func authenticateSCRAM(conn net.Conn, backend *pgproto3.Backend, user string, verifier *scramVerifier) error {
+	err := writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}},
+	})
+	if err != nil {
+		return err
+	}
+	if err = backend.SetAuthType(pgproto3.AuthTypeSASL); err != nil {
+		return err
+	}
+	msg, err := backend.Receive()
+	if err != nil {
+		return fmt.Errorf("receiving SASL initial response: %v", err)
+	}
+	initial, ok := msg.(*pgproto3.SASLInitialResponse)
+	if !ok {
+		return fmt.Errorf("expected SASL initial response, got %T", msg)
+	}
+	if initial.AuthMechanism != "SCRAM-SHA-256" {
+		return fmt.Errorf("unsupported SASL mechanism %q", initial.AuthMechanism)
+	}
+	sc, err := newSCRAMConversation(string(initial.Data), verifier)
+	if err != nil {
+		return err
+	}
+	err = writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.AuthenticationSASLContinue{Data: []byte(sc.serverFirst)},
+	})
+	if err != nil {
+		return err
+	}
+	if err = backend.SetAuthType(pgproto3.AuthTypeSASLContinue); err != nil {
+		return err
+	}
+	if msg, err = backend.Receive(); err != nil {
+		return fmt.Errorf("receiving SASL response: %v", err)
+	}
+	resp, ok := msg.(*pgproto3.SASLResponse)
+	if !ok {
+		return fmt.Errorf("expected SASL response, got %T", msg)
+	}
+	serverFinal, err := sc.verifyClientFinal(string(resp.Data))
+	if err != nil {
+		if _, ok := err.(errAuthFailed); ok {
+			return errAuthFailed{user: user}
+		}
+		return err
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.AuthenticationSASLFinal{Data: []byte(serverFinal)},
+	})
+}
+
+// scramConversation holds the server state of a SCRAM-SHA-256 exchange, as
+// defined in RFC 5802 and RFC 7677.  Channel binding is not supported.
+type scramConversation struct {
+	verifier        *scramVerifier
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+}
+
+func newSCRAMConversation(clientFirst string, verifier *scramVerifier) (*scramConversation, error) {
+	// The GS2 header is "n,," or "y,," followed by the client-first-message-bare.
+	f := strings.SplitN(clientFirst, ",", 3)
+	if len(f) != 3 {
+		return nil, fmt.Errorf("invalid SCRAM client-first-message")
+	}
+	switch {
+	case f[0] == "n", f[0] == "y":
+	case strings.HasPrefix(f[0], "p="):
+		return nil, fmt.Errorf("SCRAM channel binding not supported")
+	default:
+		return nil, fmt.Errorf("invalid SCRAM GS2 header")
+	}
+	if f[1] != "" {
+		return nil, fmt.Errorf("SCRAM authorization identity not supported")
+	}
+	sc := &scramConversation{
+		verifier:        verifier,
+		gs2Header:       f[0] + "," + f[1] + ",",
+		clientFirstBare: f[2],
+	}
+	var clientNonce string
+	for _, a := range strings.Split(sc.clientFirstBare, ",") {
+		if strings.HasPrefix(a, "r=") {
+			clientNonce = strings.TrimPrefix(a, "r=")
+		}
+	}
+	if clientNonce == "" {
+		return nil, fmt.Errorf("invalid SCRAM client-first-message: missing nonce")
+	}
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generating nonce: %v", err)
+	}
+	sc.nonce = clientNonce + base64.StdEncoding.EncodeToString(b)
+	sc.serverFirst = "r=" + sc.nonce + ",s=" + verifier.salt + ",i=" + strconv.Itoa(verifier.iterations)
+	return sc, nil
+}
+
+// verifyClientFinal checks the client proof in the client-final-message and
+// returns the server-final-message.
+func (sc *scramConversation) verifyClientFinal(clientFinal string) (string, error) {
+	i := strings.LastIndex(clientFinal, ",p=")
+	if i < 0 {
+		return "", fmt.Errorf("invalid SCRAM client-final-message: missing proof")
+	}
+	withoutProof := clientFinal[:i]
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[i+3:])
+	if err != nil {
+		return "", fmt.Errorf("invalid SCRAM client proof: %v", err)
+	}
+	var binding, nonce string
+	for _, a := range strings.Split(withoutProof, ",") {
+		switch {
+		case strings.HasPrefix(a, "c="):
+			binding = strings.TrimPrefix(a, "c=")
+		case strings.HasPrefix(a, "r="):
+			nonce = strings.TrimPrefix(a, "r=")
+		}
+	}
+	if binding != base64.StdEncoding.EncodeToString([]byte(sc.gs2Header)) {
+		return "", fmt.Errorf("invalid SCRAM channel binding")
+	}
+	if nonce != sc.nonce {
+		return "", fmt.Errorf("invalid SCRAM nonce")
+	}
+	authMessage := []byte(sc.clientFirstBare + "," + sc.serverFirst + "," + withoutProof)
+	clientSignature := computeHMAC(sc.verifier.storedKey, authMessage)
+	if len(proof) != len(clientSignature) {
+		return "", errAuthFailed{}
+	}
+	clientKey := make([]byte, len(proof))
+	for j := range proof {
+		clientKey[j] = proof[j] ^ clientSignature[j]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if !hmac.Equal(storedKey[:], sc.verifier.storedKey) {
+		return "", errAuthFailed{}
+	}
+	serverSignature := computeHMAC(sc.verifier.serverKey, authMessage)
+	return "v=" + base64.StdEncoding.EncodeToString(serverSignature), nil
+}
+
+func computeHMAC(key, msg []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(msg)
+	return mac.Sum(nil)
+}
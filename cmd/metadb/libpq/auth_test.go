@@ -0,0 +1,185 @@
+package libpq
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// scramHi is the Hi() function defined in RFC 5802.
+func scramHi(password, salt []byte, iterations int) []byte {
+	u := computeHMAC(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+	h := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		u = computeHMAC(password, u)
+		for j := range h {
+			h[j] ^= u[j]
+		}
+	}
+	return h
+}
+
+func scramTestVerifier(password string, salt []byte, iterations int) string {
+	saltedPassword := scramHi([]byte(password), salt, iterations)
+	clientKey := computeHMAC(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := computeHMAC(saltedPassword, []byte("Server Key"))
+	return "SCRAM-SHA-256$" + strconv.Itoa(iterations) + ":" + base64.StdEncoding.EncodeToString(salt) + "$" +
+		base64.StdEncoding.EncodeToString(storedKey[:]) + ":" + base64.StdEncoding.EncodeToString(serverKey)
+}
+
+// scramTestClientFinal computes the client-final-message for a conversation.
+func scramTestClientFinal(password string, clientFirstBare, serverFirst string) (string, []byte) {
+	var nonce, salt string
+	var iterations int
+	for _, a := range strings.Split(serverFirst, ",") {
+		switch {
+		case strings.HasPrefix(a, "r="):
+			nonce = a[2:]
+		case strings.HasPrefix(a, "s="):
+			salt = a[2:]
+		case strings.HasPrefix(a, "i="):
+			iterations, _ = strconv.Atoi(a[2:])
+		}
+	}
+	s, _ := base64.StdEncoding.DecodeString(salt)
+	saltedPassword := scramHi([]byte(password), s, iterations)
+	clientKey := computeHMAC(saltedPassword, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := []byte(clientFirstBare + "," + serverFirst + "," + withoutProof)
+	clientSignature := computeHMAC(storedKey[:], authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	serverKey := computeHMAC(saltedPassword, []byte("Server Key"))
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), computeHMAC(serverKey, authMessage)
+}
+
+func TestSCRAM(t *testing.T) {
+	verifier, err := parseSCRAMVerifier(scramTestVerifier("secret", []byte("0123456789abcdef"), 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		password string
+		ok       bool
+	}{
+		{"secret", true},
+		{"Secret", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		clientFirstBare := "n=,r=rOprNGfwEbeRWgbNEkqO"
+		sc, err := newSCRAMConversation("n,,"+clientFirstBare, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientFinal, serverSignature := scramTestClientFinal(c.password, clientFirstBare, sc.serverFirst)
+		serverFinal, err := sc.verifyClientFinal(clientFinal)
+		if c.ok {
+			if err != nil {
+				t.Errorf("password %q: got error %v; want success", c.password, err)
+				continue
+			}
+			if serverFinal != "v="+base64.StdEncoding.EncodeToString(serverSignature) {
+				t.Errorf("password %q: got server-final-message %q", c.password, serverFinal)
+			}
+		} else if _, ok := err.(errAuthFailed); !ok {
+			t.Errorf("password %q: got error %v; want authentication failure", c.password, err)
+		}
+	}
+}
+
+func TestSCRAMChannelBinding(t *testing.T) {
+	verifier, err := parseSCRAMVerifier(scramTestVerifier("secret", []byte("0123456789abcdef"), 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = newSCRAMConversation("p=tls-server-end-point,,n=,r=abc", verifier); err == nil {
+		t.Errorf("channel binding accepted; want error")
+	}
+}
+
+func TestVerifyMD5(t *testing.T) {
+	inner := md5.Sum([]byte("secret" + "wegg"))
+	verifier := "md5" + hex.EncodeToString(inner[:])
+	salt := [4]byte{1, 2, 3, 4}
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt[:]...))
+	response := "md5" + hex.EncodeToString(outer[:])
+	if !verifyMD5(verifier, salt, response) {
+		t.Errorf("valid MD5 response rejected")
+	}
+	if verifyMD5(verifier, [4]byte{4, 3, 2, 1}, response) {
+		t.Errorf("MD5 response with wrong salt accepted")
+	}
+}
+
+// scramTestExchange starts authenticating a client using verifier, and returns
+// the first authentication message sent to the client and the
+// server-first-message without the nonce.
+func scramTestExchange(t *testing.T, verifier *scramVerifier) (pgproto3.BackendMessage, string) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		_ = authenticateSCRAM(server, pgproto3.NewBackend(server, server), "wegg", verifier)
+	}()
+	frontend := pgproto3.NewFrontend(client, client)
+	msg, err := frontend.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &pgproto3.AuthenticationSASL{AuthMechanisms: append([]string{}, msg.(*pgproto3.AuthenticationSASL).AuthMechanisms...)}
+	frontend.Send(&pgproto3.SASLInitialResponse{AuthMechanism: "SCRAM-SHA-256", Data: []byte("n,,n=,r=rOprNGfwEbeRWgbNEkqO")})
+	if err = frontend.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = frontend.Receive(); err != nil {
+		t.Fatal(err)
+	}
+	serverFirst := string(msg.(*pgproto3.AuthenticationSASLContinue).Data)
+	return first, serverFirst[strings.Index(serverFirst, ",s="):]
+}
+
+func TestAuthUnknownUser(t *testing.T) {
+	verifier, err := parseSCRAMVerifier(scramTestVerifier("secret", []byte("0123456789abcdef"), scramIterations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	mock := mockSCRAMVerifier(secret, "wegg")
+	first, _ := scramTestExchange(t, verifier)
+	mockFirst, mockServerFirst := scramTestExchange(t, mock)
+	if !reflect.DeepEqual(mockFirst, first) {
+		t.Errorf("first message for unknown user = %#v; want %#v", mockFirst, first)
+	}
+	if _, again := scramTestExchange(t, mockSCRAMVerifier(secret, "wegg")); again != mockServerFirst {
+		t.Errorf("mock salt and iterations changed from %q to %q", mockServerFirst, again)
+	}
+	if !strings.HasSuffix(mockServerFirst, ",i="+strconv.Itoa(scramIterations)) {
+		t.Errorf("mock server-first-message ends with %q", mockServerFirst)
+	}
+	if other := mockSCRAMVerifier(secret, "ada"); other.salt == mock.salt {
+		t.Errorf("mock salt is the same for different users")
+	}
+	clientFirstBare := "n=,r=rOprNGfwEbeRWgbNEkqO"
+	sc, err := newSCRAMConversation("n,,"+clientFirstBare, mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientFinal, _ := scramTestClientFinal("", clientFirstBare, sc.serverFirst)
+	_, err = sc.verifyClientFinal(clientFinal)
+	if _, ok := err.(errAuthFailed); !ok {
+		t.Errorf("mock exchange: got error %v; want authentication failure", err)
+	}
+}
@@ -0,0 +1,163 @@
+package libpq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+)
+
+// The tables that a user is authorized to access are stored in metadb.auth as
+// a comma-separated list of regular expressions, which are matched against
+// schema-qualified table names.  Changes are applied to the database by
+// sysdb.GoUpdateUserPerms when the server starts.
+
+func authorize(conn io.Writer, node *ast.AuthorizeStmt, dc *pgx.Conn) error {
+	pattern, err := authPattern(dc, node.DataSourceName, node.TableName, node.TablePattern)
+	if err != nil {
+		return err
+	}
+	exists, err := userExists(dc, node.RoleName)
+	if err != nil {
+		return fmt.Errorf("selecting role: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("role %q does not exist", node.RoleName)
+	}
+
+	patterns, err := readAuthPatterns(dc, node.RoleName)
+	if err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		if p == pattern {
+			_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
+				Message: fmt.Sprintf("role %q is already authorized for %q, skipping", node.RoleName, pattern)},
+			})
+			return writeEncoded(conn, []pgproto3.Message{
+				&pgproto3.CommandComplete{CommandTag: []byte("AUTHORIZE")},
+				&pgproto3.ReadyForQuery{TxStatus: 'I'},
+			})
+		}
+	}
+	if err = writeAuthPatterns(dc, node.RoleName, append(patterns, pattern)); err != nil {
+		return err
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.NoticeResponse{Severity: "INFO", Message: "permissions will be updated within a few seconds"},
+	})
+
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("AUTHORIZE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func deauthorize(conn io.Writer, node *ast.DeauthorizeStmt, dc *pgx.Conn) error {
+	pattern, err := authPattern(dc, node.DataSourceName, node.TableName, node.TablePattern)
+	if err != nil {
+		return err
+	}
+	patterns, err := readAuthPatterns(dc, node.RoleName)
+	if err != nil {
+		return err
+	}
+	var found bool
+	var keep []string
+	for _, p := range patterns {
+		if p == pattern {
+			found = true
+			continue
+		}
+		keep = append(keep, p)
+	}
+	if !found {
+		return fmt.Errorf("role %q is not authorized for %q", node.RoleName, pattern)
+	}
+	// An empty list causes all permissions to be revoked when the server
+	// starts.
+	if err = writeAuthPatterns(dc, node.RoleName, keep); err != nil {
+		return err
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.NoticeResponse{Severity: "INFO", Message: "permissions will be updated within a few seconds"},
+	})
+
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("DEAUTHORIZE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+// authPattern returns the regular expression stored in metadb.auth for an
+// authorization of a data source, a table name, or a table pattern.
+func authPattern(dc *pgx.Conn, sourceName, tableName, tablePattern string) (string, error) {
+	switch {
+	case sourceName != "":
+		exists, err := sourceExists(dc, sourceName)
+		if err != nil {
+			return "", fmt.Errorf("selecting data source: %v", err)
+		}
+		if !exists {
+			return "", fmt.Errorf("data source %q does not exist", sourceName)
+		}
+		return ".*", nil
+	case tableName != "":
+		if !strings.ContainsRune(tableName, '.') {
+			return "", fmt.Errorf("table name %q is not schema-qualified", tableName)
+		}
+		return regexp.QuoteMeta(tableName), nil
+	default:
+		return checkAuthPattern(tablePattern)
+	}
+}
+
+// checkAuthPattern validates a table pattern specified as a regular expression.
+func checkAuthPattern(pattern string) (string, error) {
+	if pattern == "" {
+		return "", fmt.Errorf("table pattern is empty")
+	}
+	if strings.ContainsRune(pattern, ',') {
+		return "", fmt.Errorf("table pattern %q contains a comma", pattern)
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", fmt.Errorf("invalid table pattern %q: %v", pattern, err)
+	}
+	return pattern, nil
+}
+
+// readAuthPatterns returns the table patterns that a user is authorized for.
+func readAuthPatterns(dc *pgx.Conn, user string) ([]string, error) {
+	q := "SELECT tables FROM metadb.auth WHERE username=$1"
+	var tables string
+	err := dc.QueryRow(context.TODO(), q, user).Scan(&tables)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading authorization: %v", err)
+	case tables == "":
+		return nil, nil
+	default:
+		return strings.Split(tables, ","), nil
+	}
+}
+
+// writeAuthPatterns writes the table patterns that a user is authorized for,
+// marking them to be updated in the database.
+func writeAuthPatterns(dc *pgx.Conn, user string, patterns []string) error {
+	q := "INSERT INTO metadb.auth (username, tables, dbupdated) VALUES ($1, $2, FALSE) " +
+		"ON CONFLICT (username) DO UPDATE SET tables=$2, dbupdated=FALSE"
+	if _, err := dc.Exec(context.TODO(), q, user, strings.Join(patterns, ",")); err != nil {
+		return fmt.Errorf("writing authorization: %v", err)
+	}
+	return nil
+}
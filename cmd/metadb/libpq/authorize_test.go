@@ -0,0 +1,47 @@
+package libpq
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestAuthPattern(t *testing.T) {
+	cases := []struct {
+		tableName    string
+		tablePattern string
+		match        []string
+		noMatch      []string
+		ok           bool
+	}{
+		{"folio_users.users", "", []string{"folio_users.users"}, []string{"folio_users.users_x", "folio_usersxusers"}, true},
+		{"", "folio_users\\..*", []string{"folio_users.users", "folio_users.groups"}, []string{"folio_inventory.instance"}, true},
+		{"users", "", nil, nil, false},
+		{"", "a{1,2}", nil, nil, false},
+		{"", "(", nil, nil, false},
+	}
+	for _, c := range cases {
+		p, err := authPattern(nil, "", c.tableName, c.tablePattern)
+		if !c.ok {
+			if err == nil {
+				t.Errorf("authPattern(%q, %q): got success; want error", c.tableName, c.tablePattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("authPattern(%q, %q): %v", c.tableName, c.tablePattern, err)
+			continue
+		}
+		// Patterns are matched in the same way as in sysdb.
+		re := regexp.MustCompile("\\b" + p + "\\b")
+		for _, s := range c.match {
+			if !re.MatchString(s) {
+				t.Errorf("pattern %q does not match %q", p, s)
+			}
+		}
+		for _, s := range c.noMatch {
+			if re.MatchString(s) {
+				t.Errorf("pattern %q matches %q", p, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package libpq
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// session holds the state of the extended query protocol for one client
+// connection:  prepared statements and portals, which are identified by name
+// and may be unnamed ("").
+type session struct {
+	conn    io.Writer
+	user    string
+	db      *dbx.DB
+	dc      *pgx.Conn
+	sources func() []*sysdb.SourceConnector
+	stmts   map[string]*preparedStmt
+	portals map[string]*portal
+	// skip is set after an error, causing messages to be ignored until the
+	// next Sync.
+	skip bool
+}
+
+type stmtKind int
+
+const (
+	// stmtEmpty is an empty query string.
+	stmtEmpty stmtKind = iota
+	// stmtProxy is passed through to the database.
+	stmtProxy
+	// stmtMetadb is a Metadb statement or another statement handled by
+	// processQuery.
+	stmtMetadb
+)
+
+type preparedStmt struct {
+	query string
+	kind  stmtKind
+	node  ast.Node
+	// desc is the statement description returned by the database for a
+	// proxied statement.
+	desc *pgconn.StatementDescription
+}
+
+type portal struct {
+	stmt          *preparedStmt
+	params        [][]byte
+	paramFormats  []int16
+	resultFormats []int16
+	// result holds the messages written by processQuery for a Metadb
+	// statement, if the statement has been run in order to describe it.
+	result []byte
+}
+
+func (sn *session) parse(m *pgproto3.Parse) error {
+	if sn.skip {
+		return nil
+	}
+	log.Trace("prepared statement: %s", m.Query)
+	ps := &preparedStmt{query: m.Query}
+	switch {
+	case isEmptyQuery(m.Query):
+		ps.kind = stmtEmpty
+	default:
+		node, _, pass := parseStmt(m.Query)
+		ps.node = node
+		if pass && isProxied(m.Query, node) {
+			ps.kind = stmtProxy
+			if err := checkRole(sn.db, sn.dc, sn.user, node); err != nil {
+				return sn.fail(err)
+			}
+			desc, err := sn.dc.PgConn().Prepare(context.TODO(), "", m.Query, m.ParameterOIDs)
+			if err != nil {
+				return sn.fail(err)
+			}
+			ps.desc = desc
+		} else {
+			ps.kind = stmtMetadb
+		}
+	}
+	sn.stmts[m.Name] = ps
+	return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.ParseComplete{}})
+}
+
+func (sn *session) bind(m *pgproto3.Bind) error {
+	if sn.skip {
+		return nil
+	}
+	ps, ok := sn.stmts[m.PreparedStatement]
+	if !ok {
+		return sn.fail(fmt.Errorf("prepared statement %q does not exist", m.PreparedStatement))
+	}
+	var nparams int
+	if ps.kind == stmtProxy {
+		nparams = len(ps.desc.ParamOIDs)
+	}
+	if len(m.Parameters) != nparams {
+		return sn.fail(fmt.Errorf("bind message supplies %d parameters, but prepared statement %q requires %d",
+			len(m.Parameters), m.PreparedStatement, nparams))
+	}
+	// The message buffers are reused by the backend, so the parameters
+	// are copied.
+	params := make([][]byte, len(m.Parameters))
+	for i, p := range m.Parameters {
+		if p != nil {
+			params[i] = append([]byte{}, p...)
+		}
+	}
+	sn.portals[m.DestinationPortal] = &portal{
+		stmt:          ps,
+		params:        params,
+		paramFormats:  append([]int16{}, m.ParameterFormatCodes...),
+		resultFormats: append([]int16{}, m.ResultFormatCodes...),
+	}
+	return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.BindComplete{}})
+}
+
+func (sn *session) describe(m *pgproto3.Describe) error {
+	if sn.skip {
+		return nil
+	}
+	switch m.ObjectType {
+	case 'S':
+		ps, ok := sn.stmts[m.Name]
+		if !ok {
+			return sn.fail(fmt.Errorf("prepared statement %q does not exist", m.Name))
+		}
+		var oids []uint32
+		if ps.kind == stmtProxy {
+			oids = ps.desc.ParamOIDs
+		}
+		if err := writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.ParameterDescription{ParameterOIDs: oids}}); err != nil {
+			return err
+		}
+		return sn.describeResult(ps, nil, nil)
+	case 'P':
+		p, ok := sn.portals[m.Name]
+		if !ok {
+			return sn.fail(fmt.Errorf("portal %q does not exist", m.Name))
+		}
+		return sn.describeResult(p.stmt, p, p.resultFormats)
+	default:
+		return sn.fail(fmt.Errorf("invalid describe message subtype %d", m.ObjectType))
+	}
+}
+
+// describeResult writes a RowDescription, or NoData if the statement does not
+// return rows.  If p is not nil, a Metadb statement that returns rows is run
+// and its result saved in the portal for Execute.
+func (sn *session) describeResult(ps *preparedStmt, p *portal, formats []int16) error {
+	switch ps.kind {
+	case stmtProxy:
+		if len(ps.desc.Fields) == 0 {
+			return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.NoData{}})
+		}
+		rd := &pgproto3.RowDescription{Fields: make([]pgproto3.FieldDescription, len(ps.desc.Fields))}
+		for i, f := range ps.desc.Fields {
+			rd.Fields[i] = pgproto3.FieldDescription{
+				Name:                 []byte(f.Name),
+				TableOID:             f.TableOID,
+				TableAttributeNumber: f.TableAttributeNumber,
+				DataTypeOID:          f.DataTypeOID,
+				DataTypeSize:         f.DataTypeSize,
+				TypeModifier:         f.TypeModifier,
+			}
+		}
+		if err := setResultFormats(rd, formats); err != nil {
+			return sn.fail(err)
+		}
+		return writeEncoded(sn.conn, []pgproto3.Message{rd})
+	case stmtMetadb:
+		// Only LIST returns rows.
+		if _, ok := ps.node.(*ast.ListStmt); !ok {
+			return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.NoData{}})
+		}
+		result, err := sn.runMetadb(ps.query)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			p.result = result
+		}
+		var rd *pgproto3.RowDescription
+		err = forEachMessage(result, func(t byte, msg []byte) error {
+			switch t {
+			case 'T':
+				rd = &pgproto3.RowDescription{}
+				if err := rd.Decode(msg[5:]); err != nil {
+					return err
+				}
+			case 'E':
+				// The error is written by Execute, or here if the
+				// statement is being described.
+				if p == nil {
+					sn.skip = true
+					return write(sn.conn, msg)
+				}
+			}
+			return nil
+		})
+		if err != nil || sn.skip {
+			return err
+		}
+		if rd == nil {
+			return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.NoData{}})
+		}
+		// Metadb statements return only text columns, which have the
+		// same text and binary representation.
+		if err = setResultFormats(rd, formats); err != nil {
+			return sn.fail(err)
+		}
+		return writeEncoded(sn.conn, []pgproto3.Message{rd})
+	default:
+		return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.NoData{}})
+	}
+}
+
+func (sn *session) execute(m *pgproto3.Execute) error {
+	if sn.skip {
+		return nil
+	}
+	p, ok := sn.portals[m.Portal]
+	if !ok {
+		return sn.fail(fmt.Errorf("portal %q does not exist", m.Portal))
+	}
+	switch p.stmt.kind {
+	case stmtEmpty:
+		return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.EmptyQueryResponse{}})
+	case stmtProxy:
+		failed, err := proxyExec(sn.conn, p.stmt.query, p.params, p.stmt.desc.ParamOIDs, p.paramFormats,
+			p.resultFormats, false, sn.dc)
+		if failed {
+			sn.skip = true
+		}
+		return err
+	default:
+		result := p.result
+		p.result = nil
+		if result == nil {
+			var err error
+			if result, err = sn.runMetadb(p.stmt.query); err != nil {
+				return err
+			}
+		}
+		// The row description has been sent by Describe if requested,
+		// and ReadyForQuery is sent by Sync.
+		return forEachMessage(result, func(t byte, msg []byte) error {
+			switch t {
+			case 'T', 'Z':
+				return nil
+			case 'E':
+				sn.skip = true
+			}
+			return write(sn.conn, msg)
+		})
+	}
+}
+
+func (sn *session) close(m *pgproto3.Close) error {
+	if sn.skip {
+		return nil
+	}
+	switch m.ObjectType {
+	case 'S':
+		delete(sn.stmts, m.Name)
+	case 'P':
+		delete(sn.portals, m.Name)
+	default:
+		return sn.fail(fmt.Errorf("invalid close message subtype %d", m.ObjectType))
+	}
+	return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.CloseComplete{}})
+}
+
+func (sn *session) sync() error {
+	sn.skip = false
+	delete(sn.portals, "")
+	return writeEncoded(sn.conn, []pgproto3.Message{&pgproto3.ReadyForQuery{TxStatus: 'I'}})
+}
+
+// runMetadb runs a statement using processQuery and returns the messages that
+// it writes.
+func (sn *session) runMetadb(query string) ([]byte, error) {
+	var b bytes.Buffer
+	if err := processQuery(&b, query, sn.user, sn.db, sn.dc, sn.sources); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// fail writes an error response and ignores further messages until Sync.
+func (sn *session) fail(err error) error {
+	sn.skip = true
+	var e *pgconn.PgError
+	if errors.As(err, &e) {
+		return writeEncoded(sn.conn, []pgproto3.Message{pgErrorResponse(e)})
+	}
+	return writeEncoded(sn.conn, []pgproto3.Message{
+		&pgproto3.ErrorResponse{Severity: "ERROR", Message: err.Error()},
+	})
+}
+
+// setResultFormats sets the format codes in a row description, as requested
+// by a client in a Bind message.
+func setResultFormats(rd *pgproto3.RowDescription, formats []int16) error {
+	switch len(formats) {
+	case 0:
+		for i := range rd.Fields {
+			rd.Fields[i].Format = pgproto3.TextFormat
+		}
+	case 1:
+		for i := range rd.Fields {
+			rd.Fields[i].Format = formats[0]
+		}
+	case len(rd.Fields):
+		for i := range rd.Fields {
+			rd.Fields[i].Format = formats[i]
+		}
+	default:
+		return fmt.Errorf("bind message has %d result formats but query has %d columns", len(formats), len(rd.Fields))
+	}
+	return nil
+}
+
+// forEachMessage calls f for each encoded backend message in b, passing the
+// message type and the encoded message.
+func forEachMessage(b []byte, f func(t byte, msg []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 5 {
+			return fmt.Errorf("invalid message buffer")
+		}
+		n := int(binary.BigEndian.Uint32(b[1:5])) + 1
+		if n < 5 || n > len(b) {
+			return fmt.Errorf("invalid message length")
+		}
+		if err := f(b[0], b[:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
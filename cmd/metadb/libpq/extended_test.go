@@ -0,0 +1,127 @@
+package libpq
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// messageTypes returns the types of the backend messages in b.
+func messageTypes(t *testing.T, b []byte) string {
+	var s []byte
+	err := forEachMessage(b, func(mt byte, msg []byte) error {
+		s = append(s, mt)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(s)
+}
+
+func TestExtendedQuery(t *testing.T) {
+	var b bytes.Buffer
+	// The system user has the admin role without reading the catalog.
+	sn := &session{conn: &b, user: "metadb", db: &dbx.DB{User: "metadb"},
+		stmts: make(map[string]*preparedStmt), portals: make(map[string]*portal)}
+	steps := []struct {
+		msg  pgproto3.FrontendMessage
+		want string
+	}{
+		// Empty query
+		{&pgproto3.Parse{Query: "-- ping"}, "1"},
+		{&pgproto3.Bind{}, "2"},
+		{&pgproto3.Describe{ObjectType: 'P'}, "n"},
+		{&pgproto3.Execute{}, "I"},
+		{&pgproto3.Sync{}, "Z"},
+		// Invalid statement: messages are ignored after the error
+		// until Sync.
+		{&pgproto3.Parse{Name: "s1", Query: "FOO"}, "1"},
+		{&pgproto3.Bind{PreparedStatement: "s1"}, "2"},
+		{&pgproto3.Execute{}, "E"},
+		{&pgproto3.Execute{}, ""},
+		{&pgproto3.Sync{}, "Z"},
+		// Parameters are not accepted by Metadb statements.
+		{&pgproto3.Bind{PreparedStatement: "s1", Parameters: [][]byte{[]byte("x")}}, "E"},
+		{&pgproto3.Sync{}, "Z"},
+		{&pgproto3.Close{ObjectType: 'S', Name: "s1"}, "3"},
+		{&pgproto3.Bind{PreparedStatement: "s1"}, "E"},
+		{&pgproto3.Sync{}, "Z"},
+	}
+	for i, s := range steps {
+		b.Reset()
+		var err error
+		switch m := s.msg.(type) {
+		case *pgproto3.Parse:
+			err = sn.parse(m)
+		case *pgproto3.Bind:
+			err = sn.bind(m)
+		case *pgproto3.Describe:
+			err = sn.describe(m)
+		case *pgproto3.Execute:
+			err = sn.execute(m)
+		case *pgproto3.Close:
+			err = sn.close(m)
+		case *pgproto3.Sync:
+			err = sn.sync()
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := messageTypes(t, b.Bytes()); got != s.want {
+			t.Errorf("step %d (%T): got messages %q; want %q", i, s.msg, got, s.want)
+		}
+	}
+}
+
+func TestSetResultFormats(t *testing.T) {
+	cases := []struct {
+		formats []int16
+		want    []int16
+		ok      bool
+	}{
+		{nil, []int16{0, 0, 0}, true},
+		{[]int16{1}, []int16{1, 1, 1}, true},
+		{[]int16{1, 0, 1}, []int16{1, 0, 1}, true},
+		{[]int16{1, 0}, nil, false},
+	}
+	for _, c := range cases {
+		rd := &pgproto3.RowDescription{Fields: make([]pgproto3.FieldDescription, 3)}
+		err := setResultFormats(rd, c.formats)
+		if !c.ok {
+			if err == nil {
+				t.Errorf("formats %v: got success; want error", c.formats)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("formats %v: %v", c.formats, err)
+			continue
+		}
+		for i, f := range rd.Fields {
+			if f.Format != c.want[i] {
+				t.Errorf("formats %v: got format %d in column %d; want %d", c.formats, f.Format, i, c.want[i])
+			}
+		}
+	}
+}
+
+func TestEmptyQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"-- ping", true},
+		{" /* comment */ ;", true},
+		{"-- comment\nLIST status;", false},
+		{"SELECT 1", false},
+	}
+	for _, c := range cases {
+		if got := isEmptyQuery(c.query); got != c.want {
+			t.Errorf("isEmptyQuery(%q) = %v; want %v", c.query, got, c.want)
+		}
+	}
+}
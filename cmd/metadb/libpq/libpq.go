@@ -2,11 +2,17 @@ package libpq
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/metadb-project/metadb/cmd/metadb/tools"
 
@@ -20,9 +26,12 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 	"github.com/metadb-project/metadb/cmd/metadb/parser"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
-func Listen(host string, port string, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
+// Listen accepts client connections on the admin port.  If tlsConfig is not
+// nil, clients are required to use TLS.
+func Listen(host string, port string, tlsConfig *tls.Config, db *dbx.DB, sources func() []*sysdb.SourceConnector) {
 	// var h string
 	// if host == "" {
 	// 	h = "127.0.0.1"
@@ -55,11 +64,11 @@ func Listen(host string, port string, db *dbx.DB, sources *[]*sysdb.SourceConnec
 		backend = pgproto3.NewBackend(conn, conn)
 		//log.Trace("connection received: %s", conn.RemoteAddr().String())
 		log.Trace("connection received") // domain socket
-		go serve(conn, backend, db, sources)
+		go serve(conn, backend, tlsConfig, db, sources)
 	}
 }
 
-func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sysdb.SourceConnector) {
+func serve(conn net.Conn, backend *pgproto3.Backend, tlsConfig *tls.Config, db *dbx.DB, sources func() []*sysdb.SourceConnector) {
 	dbconn, err := db.Connect()
 	if err != nil {
 		// TODO handle error
@@ -70,25 +79,35 @@ func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sys
 	//log.Trace("connected to database")
 	// TODO Close
 
-	if err = startup(conn, backend); err != nil {
+	var user string
+	if conn, backend, user, err = startup(conn, backend, tlsConfig, db, dbconn); err != nil {
 		// errw := write(conn, encode(nil, []pgproto3.Message{
 		// 	&pgproto3.ErrorResponse{Message: err.Error()},
 		// 	&pgproto3.ReadyForQuery{TxStatus: 'I'},
 		// }))
 		buffer, erre := encode(nil, []pgproto3.Message{
-			&pgproto3.ErrorResponse{Message: err.Error()},
-			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+			&pgproto3.ErrorResponse{Severity: "FATAL", Message: err.Error()},
 		})
 		if erre != nil {
 			log.Info("%v", erre)
 		}
 		errw := write(conn, buffer)
+		_ = conn.Close()
 		log.Info("connection from address %q: %v", conn.RemoteAddr(), err)
 		if errw != nil {
 			log.Info("%v", errw)
 		}
 		return
 	}
+	sn := &session{
+		conn:    conn,
+		user:    user,
+		db:      db,
+		dc:      dbconn,
+		sources: sources,
+		stmts:   make(map[string]*preparedStmt),
+		portals: make(map[string]*portal),
+	}
 	for {
 		var msg pgproto3.FrontendMessage
 		if msg, err = backend.Receive(); err != nil {
@@ -99,20 +118,22 @@ func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sys
 		log.Trace("*** %#v", msg)
 
 		switch m := msg.(type) {
-		case *pgproto3.Parse:
-			// Extended query
-			if err = processParse(conn, backend, m, db, dbconn, sources); err != nil {
-				log.Info("%v", err)
-				return
-			}
-			//log.Info("*pgproto3.Parse: not yet implemented")
 		case *pgproto3.Query:
-			if err = processQuery(conn, m.String, nil, db, dbconn, sources); err != nil {
-				log.Info("%v", err)
-				return
-			}
+			err = processQuery(conn, m.String, user, db, dbconn, sources)
+		case *pgproto3.Parse:
+			err = sn.parse(m)
+		case *pgproto3.Bind:
+			err = sn.bind(m)
+		case *pgproto3.Describe:
+			err = sn.describe(m)
+		case *pgproto3.Execute:
+			err = sn.execute(m)
+		case *pgproto3.Close:
+			err = sn.close(m)
 		case *pgproto3.Sync:
-			continue
+			err = sn.sync()
+		case *pgproto3.Flush:
+			// NOP: messages are not buffered.
 		case *pgproto3.Terminate:
 			return
 		default:
@@ -121,134 +142,96 @@ func serve(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, sources *[]*sys
 			_ = err
 			return
 		}
+		if err != nil {
+			log.Info("%v", err)
+			return
+		}
 	}
 }
 
-func startup(conn net.Conn, backend *pgproto3.Backend) error {
+// startup handles the startup phase of a connection, including TLS negotiation
+// and authentication.  It returns the connection and backend to be used for
+// the remainder of the session, which differ from conn and backend if TLS has
+// been negotiated, and the name of the authenticated user.
+func startup(conn net.Conn, backend *pgproto3.Backend, tlsConfig *tls.Config, db *dbx.DB, dc *pgx.Conn) (net.Conn, *pgproto3.Backend, string, error) {
 	var msg pgproto3.FrontendMessage
 	var err error
 	if msg, err = backend.ReceiveStartupMessage(); err != nil {
 		// TODO handle error
-		return err
+		return conn, backend, "", err
 	}
 	switch m := msg.(type) {
 	case *pgproto3.SSLRequest:
-		if _, err = conn.Write([]byte("N")); err != nil {
-			return err
+		if tlsConfig == nil {
+			if _, err = conn.Write([]byte("N")); err != nil {
+				return conn, backend, "", err
+			}
+			return startup(conn, backend, tlsConfig, db, dc)
 		}
-		if err = startup(conn, backend); err != nil {
-			return err
+		if _, err = conn.Write([]byte("S")); err != nil {
+			return conn, backend, "", err
 		}
-		return nil
+		tlsConn := tls.Server(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			return conn, backend, "", fmt.Errorf("TLS handshake: %v", err)
+		}
+		return startupTLS(tlsConn, pgproto3.NewBackend(tlsConn, tlsConn), db, dc)
+	case *pgproto3.GSSEncRequest:
+		if _, err = conn.Write([]byte("N")); err != nil {
+			return conn, backend, "", err
+		}
+		return startup(conn, backend, tlsConfig, db, dc)
 	case *pgproto3.StartupMessage:
-		if err = handleStartup(conn, m); err != nil {
-			return err
+		if tlsConfig != nil {
+			return conn, backend, "", fmt.Errorf("connection requires SSL")
 		}
-		return nil
+		user, err := handleStartup(conn, backend, m, db, dc)
+		return conn, backend, user, err
 	default:
-		return fmt.Errorf("unknown message: %v", msg)
+		return conn, backend, "", fmt.Errorf("unknown message: %v", msg)
 	}
 }
 
-func processParse(conn net.Conn, backend *pgproto3.Backend, parse *pgproto3.Parse, db *dbx.DB, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
-	query := parse.Query
-	log.Trace("prepared statement: %s", query)
-
-	// Prepare the query.
-	stmt, err := dc.Prepare(context.TODO(), parse.Name, query)
+// startupTLS handles the startup message that follows a TLS handshake.
+func startupTLS(conn net.Conn, backend *pgproto3.Backend, db *dbx.DB, dc *pgx.Conn) (net.Conn, *pgproto3.Backend, string, error) {
+	msg, err := backend.ReceiveStartupMessage()
 	if err != nil {
-		return fmt.Errorf("preparing extended query: %w", err)
+		return conn, backend, "", err
 	}
-
-	//var rows pgx.Rows
-	//var cols []pgconn.FieldDescription
-	//var binds []interface{}
-	//exec := func() (err error) {
-	//	if rows != nil {
-	//		return nil
-	//	}
-	//	if rows, err = dc.Query(context.TODO(), binds...); err != nil {
-	//		return fmt.Errorf("query: %w", err)
-	//	}
-	//	cols = rows.FieldDescriptions()
-	//	return nil
-	//}
-
-	args := make([]any, 0)
-	_ = args
-	for {
-		msg, err := backend.Receive()
-		if err != nil {
-			return fmt.Errorf("unexpected message in extended query: %v", err)
-		}
-		log.Trace("*** %#v", msg)
-
-		_ = stmt
-		switch m := msg.(type) {
-		case *pgproto3.Bind:
-			args = make([]any, 0)
-			for _, p := range m.Parameters {
-				args = append(args, string(p))
-			}
-
-		case *pgproto3.Describe:
-			return fmt.Errorf("pgproto3.Describe not yet implemented")
-			//if err := exec(); err != nil {
-			//	return fmt.Errorf("exec: %w", err)
-			//}
-			//if _, err := c.Write(toRowDescription(cols).Encode(nil)); err != nil {
-			//	return err
-			//}
-
-		case *pgproto3.Execute:
-			//func processQuery(conn net.Conn, query string, db *dbx.DB, dbconn *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
-			err := processQuery(conn, query, args, db, dc, sources)
-			//err := proxySelect(conn, query, args, dc)
-			if err != nil {
-				return fmt.Errorf("executing prepared statement: %v", err)
-			}
-
-			//// TODO: Send pgproto3.ParseComplete?
-			//if err := exec(); err != nil {
-			//	return fmt.Errorf("exec: %w", err)
-			//}
-			//
-			//var buf []byte
-			//for rows.Next() {
-			//	row, err := scanRow(rows, cols)
-			//	if err != nil {
-			//		return fmt.Errorf("scan: %w", err)
-			//	}
-			//	buf = row.Encode(buf)
-			//}
-			//if err := rows.Err(); err != nil {
-			//	return fmt.Errorf("rows: %w", err)
-			//}
-			//
-			//// Mark command complete and ready for next query.
-			//buf = (&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")}).Encode(buf)
-			//buf = (&pgproto3.ReadyForQuery{TxStatus: 'I'}).Encode(buf)
-			//_, err := c.Write(buf)
-			//return err
-
-		case *pgproto3.Sync:
-			// NOP
-
-		default:
-			return fmt.Errorf("unexpected message during parse: %#v", msg)
-		}
+	m, ok := msg.(*pgproto3.StartupMessage)
+	if !ok {
+		return conn, backend, "", fmt.Errorf("unexpected message after TLS handshake: %v", msg)
 	}
+	user, err := handleStartup(conn, backend, m, db, dc)
+	return conn, backend, user, err
 }
 
-func processQuery(conn net.Conn, query string, args []any, db *dbx.DB, dbconn *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
+func processQuery(conn io.Writer, query string, user string, db *dbx.DB, dbconn *pgx.Conn, sources func() []*sysdb.SourceConnector) error {
+	if isEmptyQuery(query) {
+		return writeEncoded(conn, []pgproto3.Message{
+			&pgproto3.EmptyQueryResponse{},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+		})
+	}
+	if strings.EqualFold(firstWord(query), "set") {
+		return set(conn, query, dbconn)
+	}
 	var e string
-	node, err, pass := parser.Parse(query)
+	node, err, pass := parseStmt(query)
 	if err != nil {
 		e = err.Error()
 	}
 	log.Trace("query received: query=%q node=%#v err=%q pass=%v\n", query, node, e, pass)
+	if err == nil || pass {
+		if erra := checkRole(db, dbconn, user, node); erra != nil {
+			return writeEncoded(conn, []pgproto3.Message{
+				&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42501", Message: erra.Error()},
+				&pgproto3.ReadyForQuery{TxStatus: 'I'},
+			})
+		}
+	}
 	if pass {
-		err = proxyQuery(conn, query, args, node, dbconn)
+		err = proxyQuery(conn, query, node, dbconn)
 		if err != nil {
 			buffer, erre := encode(nil, []pgproto3.Message{
 				&pgproto3.ErrorResponse{Message: "ERROR:  " + err.Error()},
@@ -273,25 +256,47 @@ func processQuery(conn net.Conn, query string, args []any, db *dbx.DB, dbconn *p
 	}
 	switch n := node.(type) {
 	case *ast.CreateDataSourceStmt:
-		err = createDataSource(conn, n, dbconn)
+		err = createDataSource(conn, n, dbconn, db.SecretKey)
 	case *ast.AlterTableStmt:
 		err = alterTable(conn, n, dbconn)
 	case *ast.AlterDataSourceStmt:
-		err = alterDataSource(conn, n, dbconn)
+		err = alterDataSource(conn, n, dbconn, db.SecretKey)
+	case *ast.ResetOffsetsStmt:
+		err = resetOffsets(conn, n, dbconn)
+	case *ast.PauseDataSourceStmt:
+		err = pauseDataSource(conn, n, dbconn)
 	case *ast.CreateUserStmt:
 		err = createUser(conn, n, db, dbconn)
+	case *ast.AlterUserStmt:
+		err = alterUser(conn, n, db, dbconn)
+	case *ast.DropUserStmt:
+		err = dropUser(conn, n, db, dbconn)
 	case *ast.DropDataSourceStmt:
 		err = dropDataSource(conn, n, dbconn)
 	case *ast.AuthorizeStmt:
 		err = authorize(conn, n, dbconn)
+	case *ast.DeauthorizeStmt:
+		err = deauthorize(conn, n, dbconn)
 	case *ast.CreateDataOriginStmt:
 		err = createDataOrigin(conn, n, dbconn)
+	case *ast.CreateMaskingPolicyStmt:
+		err = createMaskingPolicy(conn, n, dbconn)
+	case *ast.DropMaskingPolicyStmt:
+		err = dropMaskingPolicy(conn, n, dbconn)
+	case *ast.CreateJSONTransformStmt:
+		err = createJSONTransform(conn, n, dbconn)
+	case *ast.DropJSONTransformStmt:
+		err = dropJSONTransform(conn, n, dbconn)
 	case *ast.ListStmt:
 		err = list(conn, n, dbconn, sources)
 	case *ast.RefreshInferredColumnTypesStmt:
 		err = refreshInferredColumnTypesStmt(conn, dbconn)
 	case *ast.VerifyConsistencyStmt:
 		err = verifyConsistencyStmt(conn, dbconn)
+	case *ast.ReplayDeadLettersStmt:
+		err = replayDeadLetters(conn, n, dbconn)
+	case *ast.PurgeDeadLettersStmt:
+		err = purgeDeadLetters(conn, n, dbconn)
 	//case *ast.SelectStmt:
 	//	if n.Fn == "version" {
 	//		return version(conn, query)
@@ -330,25 +335,163 @@ func processQuery(conn net.Conn, query string, args []any, db *dbx.DB, dbconn *p
 	return nil
 }
 
-func handleStartup(conn net.Conn, msg *pgproto3.StartupMessage) error {
-	if msg.ProtocolVersion != 0x30000 {
-		return fmt.Errorf("startup: unknown protocol version \"%#x\"", msg.ProtocolVersion)
+// parseStmt parses a query, adding a terminating semicolon if there is none.
+// Drivers using the extended query protocol typically omit the semicolon,
+// which is required by the grammar.
+func parseStmt(query string) (ast.Node, error, bool) {
+	if !strings.HasSuffix(strings.TrimSpace(query), ";") {
+		query = query + ";"
+	}
+	return parser.Parse(query)
+}
+
+// isEmptyQuery returns true if query contains only white space and comments,
+// such as the "-- ping" sent by pgx.
+func isEmptyQuery(query string) bool {
+	return strings.TrimRight(stripComments(query), "; \t\r\n") == ""
+}
+
+// firstWord returns the first word of a query, ignoring leading white space
+// and comments.
+func firstWord(query string) string {
+	q := strings.TrimSpace(stripComments(query))
+	i := strings.IndexFunc(q, func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if i < 0 {
+		return q
+	}
+	return q[:i]
+}
+
+// stripComments removes leading comments from a query.
+func stripComments(query string) string {
+	q := strings.TrimSpace(query)
+	for {
+		switch {
+		case strings.HasPrefix(q, "--"):
+			i := strings.IndexByte(q, '\n')
+			if i < 0 {
+				return ""
+			}
+			q = strings.TrimSpace(q[i+1:])
+		case strings.HasPrefix(q, "/*"):
+			i := strings.Index(q, "*/")
+			if i < 0 {
+				return ""
+			}
+			q = strings.TrimSpace(q[i+2:])
+		default:
+			return q
+		}
+	}
+}
+
+// reportedParameters are the run-time parameters reported to the client at
+// startup and when changed by SET.  The values are taken from the database
+// connection, except for server_version which is reported as a fixed value.
+var reportedParameters = []string{
+	"application_name",
+	"client_encoding",
+	"DateStyle",
+	"integer_datetimes",
+	"IntervalStyle",
+	"server_encoding",
+	"standard_conforming_strings",
+	"TimeZone",
+}
+
+var setRegexp = regexp.MustCompile(`(?is)^SET\s+(?:(?:SESSION|LOCAL)\s+)?(?:(TIME\s+ZONE)\s|([A-Za-z_][A-Za-z0-9_.$]*)(?:\s*=|\s+TO\s))\s*(.*?)\s*;?\s*$`)
+
+// set handles a SET statement by running it in the database, so that it
+// applies to the queries that the client passes through, and reporting the
+// new value if it is one of the reported parameters.  The client encoding
+// cannot be changed from UTF8.
+func set(conn io.Writer, query string, dc *pgx.Conn) error {
+	sm := setRegexp.FindStringSubmatch(stripComments(query))
+	if sm == nil {
+		return writeEncoded(conn, []pgproto3.Message{
+			&pgproto3.ErrorResponse{Severity: "ERROR", Message: "syntax error in SET statement"},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+		})
 	}
-	if msg.Parameters["application_name"] != "psql" {
-		return fmt.Errorf("startup: unsupported application %q", msg.Parameters["application_name"])
+	name := strings.ToLower(sm[2])
+	if sm[1] != "" {
+		name = "timezone"
+	}
+	value := strings.Trim(sm[3], "'\"")
+	switch name {
+	case "role", "session_authorization":
+		return writeEncoded(conn, []pgproto3.Message{
+			&pgproto3.ErrorResponse{Severity: "ERROR", Message: fmt.Sprintf("parameter %q cannot be set", name)},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+		})
+	case "client_encoding":
+		if !isUTF8(value) {
+			return writeEncoded(conn, []pgproto3.Message{
+				&pgproto3.ErrorResponse{Severity: "ERROR", Message: fmt.Sprintf("client encoding %q not supported (use UTF8)", value)},
+				&pgproto3.ReadyForQuery{TxStatus: 'I'},
+			})
+		}
+		return writeEncoded(conn, []pgproto3.Message{
+			&pgproto3.CommandComplete{CommandTag: []byte("SET")},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+		})
+	}
+	if _, err := dc.PgConn().Exec(context.TODO(), query).ReadAll(); err != nil {
+		var e *pgconn.PgError
+		if !errors.As(err, &e) {
+			return fmt.Errorf("set: %v", err)
+		}
+		return writeEncoded(conn, []pgproto3.Message{pgErrorResponse(e), &pgproto3.ReadyForQuery{TxStatus: 'I'}})
+	}
+	m := []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("SET")}}
+	for _, p := range reportedParameters {
+		if strings.EqualFold(p, name) {
+			m = append(m, &pgproto3.ParameterStatus{Name: p, Value: dc.PgConn().ParameterStatus(p)})
+		}
+	}
+	return writeEncoded(conn, append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'}))
+}
+
+// isUTF8 returns true if an encoding name refers to UTF8.
+func isUTF8(encoding string) bool {
+	e := strings.ToUpper(strings.NewReplacer("-", "", "_", "").Replace(encoding))
+	return e == "UTF8" || e == "UNICODE"
+}
+
+func handleStartup(conn net.Conn, backend *pgproto3.Backend, msg *pgproto3.StartupMessage, db *dbx.DB, dc *pgx.Conn) (string, error) {
+	if msg.ProtocolVersion != 0x30000 {
+		return "", fmt.Errorf("startup: unknown protocol version \"%#x\"", msg.ProtocolVersion)
 	}
 	if msg.Parameters["database"] != "metadb" {
-		return fmt.Errorf("startup: unsupported database name %q (use \"-d metadb\")", msg.Parameters["database"])
+		return "", fmt.Errorf("startup: unsupported database name %q (use \"-d metadb\")", msg.Parameters["database"])
+	}
+	if enc, ok := msg.Parameters["client_encoding"]; ok && !isUTF8(enc) {
+		return "", fmt.Errorf("startup: client encoding %q not supported (use UTF8)", enc)
+	}
+	user := msg.Parameters["user"]
+	if err := authenticate(conn, backend, user, db, dc); err != nil {
+		return "", err
+	}
+	if app := msg.Parameters["application_name"]; app != "" {
+		q := "SELECT pg_catalog.set_config('application_name', $1, false)"
+		if _, err := dc.Exec(context.TODO(), q, app); err != nil {
+			return "", fmt.Errorf("startup: setting application name: %v", err)
+		}
 	}
-	buffer, erre := encode(nil, []pgproto3.Message{
+	m := []pgproto3.Message{
 		&pgproto3.AuthenticationOk{},
 		&pgproto3.ParameterStatus{Name: "server_version", Value: "15.3.0"},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
+	}
+	for _, p := range reportedParameters {
+		m = append(m, &pgproto3.ParameterStatus{Name: p, Value: dc.PgConn().ParameterStatus(p)})
+	}
+	buffer, erre := encode(nil, append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'}))
 	if erre != nil {
-		return fmt.Errorf("startup: %v", erre)
+		return "", fmt.Errorf("startup: %v", erre)
 	}
-	return write(conn, buffer)
+	return user, write(conn, buffer)
 }
 
 func encodeFieldDesc(buffer []byte, cols []pgconn.FieldDescription) ([]byte, error) {
@@ -385,7 +528,7 @@ func encodeRow(buffer []byte, rows pgx.Rows, cols []pgconn.FieldDescription) ([]
 	var a any
 	for i, a = range vals {
 		if a == nil {
-			row.Values[i] = []byte("")
+			row.Values[i] = nil
 			continue
 		}
 		switch v := a.(type) {
@@ -398,85 +541,195 @@ func encodeRow(buffer []byte, rows pgx.Rows, cols []pgconn.FieldDescription) ([]
 	return row.Encode(buffer)
 }
 
-func list(conn net.Conn, node *ast.ListStmt, dc *pgx.Conn, sources *[]*sysdb.SourceConnector) error {
+func list(conn io.Writer, node *ast.ListStmt, dc *pgx.Conn, sources func() []*sysdb.SourceConnector) error {
 	switch strings.ToLower(node.Name) {
 	case "authorizations":
 		return proxySelect(conn, ""+
-			"SELECT username,"+
-			"       CASE WHEN (NOT dbupdated) THEN 'pending restart'"+
-			"            WHEN (tables='.*' AND dbupdated) THEN 'authorized'"+
-			"            ELSE 'not authorized'"+
+			"SELECT a.username,"+
+			"       t.pattern AS tables,"+
+			"       CASE WHEN a.dbupdated THEN 'authorized'"+
+			"            ELSE 'pending'"+
 			"       END note"+
-			"    FROM metadb.auth", nil, dc)
+			"    FROM metadb.auth AS a"+
+			"        LEFT JOIN LATERAL unnest(string_to_array(a.tables, ',')) AS t(pattern) ON TRUE"+
+			"    ORDER BY a.username, t.pattern", nil, dc)
+	case "dead_letters":
+		return proxySelect(conn, ""+
+			"SELECT id,"+
+			"       source_name,"+
+			"       topic,"+
+			"       partition,"+
+			"       message_offset,"+
+			"       error,"+
+			"       attempts,"+
+			"       to_char(created AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS') || 'Z' AS created,"+
+			"       CASE WHEN replay THEN 'pending replay' ELSE '' END AS note"+
+			"    FROM metadb.dead_letter"+
+			"    ORDER BY id", nil, dc)
 	case "data_origins":
 		return proxySelect(conn, "SELECT name FROM metadb.origin", nil, dc)
 	case "data_sources":
 		return proxySelect(conn, ""+
 			"SELECT name,"+
+			"       type,"+
 			"       brokers,"+
 			"       security,"+
 			"       topics,"+
 			"       consumergroup,"+
 			"       schemapassfilter,"+
 			"       schemastopfilter,"+
+			"       tablepassfilter,"+
 			"       tablestopfilter,"+
+			"       columnpassfilter,"+
+			"       columnstopfilter,"+
 			"       trimschemaprefix,"+
 			"       addschemaprefix,"+
-			"       module"+
-			"    FROM metadb.source", nil, dc)
+			"       schemarewrite,"+
+			"       tablerewrite,"+
+			"       module,"+
+			"       regexp_replace(regexp_replace(connection,"+
+			"                                     'password\\s*=\\s*(''[^'']*''|[^\\s&]+)', 'password=********', 'g'),"+
+			"                      '(://[^/@:]*):[^/@]*@', '\\1:********@') AS connection,"+
+			"       publication,"+
+			"       slot,"+
+			"       path,"+
+			"       regexp_replace(schemaregistry, '//[^/@]*@', '//********@') AS schemaregistry,"+
+			"       deadletter,"+
+			"       (SELECT string_agg('kafka.' || o.name || '=' ||"+
+			"                          CASE WHEN o.secret THEN '********' ELSE o.value END, ',' ORDER BY o.name)"+
+			"            FROM metadb.kafka_option AS o"+
+			"            WHERE o.source_name = s.name) AS kafkaoptions"+
+			"    FROM metadb.source AS s", nil, dc)
+	case "grants":
+		return proxySelect(conn, ""+
+			"SELECT a.username,"+
+			"       n.nspname || '.' || c.relname AS table_name"+
+			"    FROM metadb.auth AS a"+
+			"        JOIN pg_catalog.pg_roles AS r ON a.username = r.rolname"+
+			"        CROSS JOIN metadb.base_table AS b"+
+			"        JOIN pg_catalog.pg_namespace AS n ON b.schema_name = n.nspname"+
+			"        JOIN pg_catalog.pg_class AS c ON c.relnamespace = n.oid"+
+			"            AND c.relname IN (b.table_name, b.table_name || '__')"+
+			"    WHERE has_table_privilege(r.oid, c.oid, 'SELECT')"+
+			"    ORDER BY a.username, n.nspname, c.relname", nil, dc)
+	case "json_transforms":
+		return proxySelect(conn, ""+
+			"SELECT name,"+
+			"       schema_name || '.' || table_name AS table_name,"+
+			"       column_name,"+
+			"       method,"+
+			"       target_table,"+
+			"       depth,"+
+			"       paths"+
+			"    FROM metadb.json_transform"+
+			"    ORDER BY name", nil, dc)
+	case "masking_policies":
+		return proxySelect(conn, ""+
+			"SELECT name,"+
+			"       schema_name || '.' || table_name AS table_name,"+
+			"       column_name,"+
+			"       method,"+
+			"       length"+
+			"    FROM metadb.masking_policy"+
+			"    ORDER BY name", nil, dc)
 	case "status":
 		return listStatus(conn, sources)
+	case "users":
+		return proxySelect(conn, ""+
+			"SELECT r.rolname AS username,"+
+			"       coalesce(u.role, 'readonly') AS role,"+
+			"       coalesce(a.tables, '') AS tables,"+
+			"       coalesce(shobj_description(r.oid, 'pg_authid'), '') AS comment"+
+			"    FROM pg_catalog.pg_roles AS r"+
+			"        LEFT JOIN metadb.user_role AS u ON r.rolname = u.username"+
+			"        LEFT JOIN metadb.auth AS a ON r.rolname = a.username"+
+			"    WHERE u.username IS NOT NULL OR a.username IS NOT NULL"+
+			"    ORDER BY r.rolname", nil, dc)
 	default:
 		return fmt.Errorf("unrecognized parameter %q", node.Name)
 	}
 }
 
-func listStatus(conn net.Conn, sources *[]*sysdb.SourceConnector) error {
-	m := []pgproto3.Message{
-		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
-			{
-				Name:                 []byte("type"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("name"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-			{
-				Name:                 []byte("status"),
-				TableOID:             0,
-				TableAttributeNumber: 0,
-				DataTypeOID:          25,
-				DataTypeSize:         -1,
-				TypeModifier:         -1,
-				Format:               0,
-			},
-		}},
-	}
-	for _, s := range *sources {
+func listStatus(conn io.Writer, sources func() []*sysdb.SourceConnector) error {
+	columns := []string{"type", "name", "status", "last_seen", "topic", "partition", "committed_offset",
+		"high_watermark", "lag", "events_per_second", "last_event_time", "last_error"}
+	fields := make([]pgproto3.FieldDescription, len(columns))
+	for i, c := range columns {
+		fields[i] = pgproto3.FieldDescription{
+			Name:                 []byte(c),
+			TableOID:             0,
+			TableAttributeNumber: 0,
+			DataTypeOID:          25,
+			DataTypeSize:         -1,
+			TypeModifier:         -1,
+			Format:               0,
+		}
+	}
+	m := []pgproto3.Message{&pgproto3.RowDescription{Fields: fields}}
+	var count int
+	for _, s := range sources() {
+		var lastSeen []byte
+		if t := s.LastSeen.Get(); !t.IsZero() {
+			lastSeen = []byte(t.UTC().Format("2006-01-02 15:04:05Z"))
+		}
+		st := s.Stats.Get()
 		m = append(m, &pgproto3.DataRow{Values: [][]byte{
 			[]byte("data source"),
 			[]byte(s.Name),
 			[]byte(s.Status.GetString()),
+			lastSeen,
+			nil,
+			nil,
+			nil,
+			nil,
+			formatOffset(st.Lag()),
+			[]byte(strconv.FormatFloat(st.EventsPerSecond, 'f', 1, 64)),
+			nullBytes(st.LastEventTime),
+			nullBytes(st.LastError),
 		}})
+		count++
+		for _, p := range st.Partitions {
+			m = append(m, &pgproto3.DataRow{Values: [][]byte{
+				[]byte("kafka partition"),
+				[]byte(s.Name),
+				nil,
+				nil,
+				[]byte(p.Topic),
+				[]byte(strconv.FormatInt(int64(p.Partition), 10)),
+				formatOffset(p.Committed),
+				formatOffset(p.HighWatermark),
+				formatOffset(p.Lag()),
+				nil,
+				nil,
+				nil,
+			}})
+			count++
+		}
 	}
-	ctag := fmt.Sprintf("SELECT %d", len(*sources))
+	ctag := fmt.Sprintf("SELECT %d", count)
 	m = append(m, &pgproto3.CommandComplete{CommandTag: []byte(ctag)})
 	m = append(m, &pgproto3.ReadyForQuery{TxStatus: 'I'})
 	return writeEncoded(conn, m)
 }
 
-func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Conn) error {
+// formatOffset formats an offset or lag, which is NULL if it is negative
+// (unknown).
+func formatOffset(n int64) []byte {
+	if n < 0 {
+		return nil
+	}
+	return []byte(strconv.FormatInt(n, 10))
+}
+
+// nullBytes returns nil for an empty string, so that it is sent as NULL.
+func nullBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return []byte(s)
+}
+
+func createDataSource(conn io.Writer, node *ast.CreateDataSourceStmt, dc *pgx.Conn, key []byte) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %v", err)
@@ -485,46 +738,63 @@ func createDataSource(conn net.Conn, node *ast.CreateDataSourceStmt, dc *pgx.Con
 		return fmt.Errorf("data source %q already exists", node.DataSourceName)
 	}
 
-	var count int64
-	q := "SELECT count(*) FROM metadb.source"
-	err = dc.QueryRow(context.TODO(), q).Scan(&count)
-	if err != nil {
-		return fmt.Errorf("checking number of configured sources: %v", err)
-	}
-	if count > 0 {
-		return fmt.Errorf("multiple sources not currently supported")
-	}
-
 	name := node.DataSourceName
-	if node.TypeName != "kafka" {
+	srctype := strings.ToLower(node.TypeName)
+	if srctype != "kafka" && srctype != "postgresql" && srctype != "file" {
 		return fmt.Errorf("invalid data source type %q", node.TypeName)
 	}
 	if node.Options == nil {
 		// return to client
 	}
-	src, err := createSourceOptions(node.Options)
+	src, err := createSourceOptions(srctype, node.Options)
 	if err != nil {
 		return err
 	}
+	var deadletter *string
+	for _, opt := range node.Options {
+		if strings.ToLower(opt.Name) == "deadletter" {
+			deadletter = &opt.Val
+		}
+	}
 
-	q = "INSERT INTO metadb.source" +
-		"(name,brokers,security,topics,consumergroup,schemapassfilter,schemastopfilter,tablestopfilter,trimschemaprefix,addschemaprefix,module,enable)" +
-		"VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)"
-	_, err = dc.Exec(context.TODO(), q,
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return fmt.Errorf("writing source configuration: %v", err)
+	}
+	defer dbx.Rollback(tx)
+	q := "INSERT INTO metadb.source" +
+		"(name,brokers,security,topics,consumergroup,schemapassfilter,schemastopfilter,tablestopfilter,trimschemaprefix,addschemaprefix,module,enable," +
+		"type,connection,publication,slot,path,schemaregistry,schemarewrite,tablerewrite," +
+		"tablepassfilter,columnpassfilter,columnstopfilter,deadletter)" +
+		"VALUES($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24)"
+	_, err = tx.Exec(context.TODO(), q,
 		name, src.Brokers, src.Security, strings.Join(src.Topics, ","), src.Group,
 		strings.Join(src.SchemaPassFilter, ","), strings.Join(src.SchemaStopFilter, ","),
 		strings.Join(src.TableStopFilter, ","), src.TrimSchemaPrefix, src.AddSchemaPrefix, src.Module,
-		src.Enable)
+		src.Enable, src.Type, nullString(src.Connection), nullString(src.Publication), nullString(src.Slot),
+		nullString(src.Path), nullString(src.SchemaRegistry),
+		nullString(strings.Join(src.SchemaRewrite, ",")), nullString(strings.Join(src.TableRewrite, ",")),
+		nullString(strings.Join(src.TablePassFilter, ",")), nullString(strings.Join(src.ColumnPassFilter, ",")),
+		nullString(strings.Join(src.ColumnStopFilter, ",")), deadletter)
 	if err != nil {
 		return fmt.Errorf("writing source configuration: %v", err)
 	}
+	for property, value := range src.KafkaOptions {
+		_, secret, _ := sysdb.ParseKafkaOption(property)
+		if err = writeKafkaOption(tx, key, name, property, value, secret); err != nil {
+			return fmt.Errorf("writing source configuration: %v", err)
+		}
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return fmt.Errorf("writing source configuration: %v", err)
+	}
 	return writeEncoded(conn, []pgproto3.Message{
 		&pgproto3.CommandComplete{CommandTag: []byte("CREATE DATA SOURCE")},
 		&pgproto3.ReadyForQuery{TxStatus: 'I'},
 	})
 }
 
-func alterTable(conn net.Conn, node *ast.AlterTableStmt, dc *pgx.Conn) error {
+func alterTable(conn io.Writer, node *ast.AlterTableStmt, dc *pgx.Conn) error {
 	// The only type currently supported is uuid.
 	columnType := strings.ToLower(node.Cmd.ColumnType)
 	if columnType != "uuid" {
@@ -590,7 +860,7 @@ func alterTable(conn net.Conn, node *ast.AlterTableStmt, dc *pgx.Conn) error {
 	})
 }
 
-func alterDataSource(conn net.Conn, node *ast.AlterDataSourceStmt, dc *pgx.Conn) error {
+func alterDataSource(conn io.Writer, node *ast.AlterDataSourceStmt, dc *pgx.Conn, key []byte) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %v", err)
@@ -599,13 +869,55 @@ func alterDataSource(conn net.Conn, node *ast.AlterDataSourceStmt, dc *pgx.Conn)
 		return fmt.Errorf("data source %q does not exist", node.DataSourceName)
 	}
 
-	err = alterSourceOptions(dc, node)
+	err = alterSourceOptions(dc, node, key)
 	if err != nil {
 		return err
 	}
 
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER DATA SOURCE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func resetOffsets(conn io.Writer, node *ast.ResetOffsetsStmt, dc *pgx.Conn) error {
+	var srctype, topics string
+	q := "SELECT type, coalesce(topics,'') FROM metadb.source WHERE name=$1"
+	err := dc.QueryRow(context.TODO(), q, node.DataSourceName).Scan(&srctype, &topics)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return fmt.Errorf("data source %q does not exist", node.DataSourceName)
+	case err != nil:
+		return fmt.Errorf("selecting data source: %v", err)
+	}
+	if srctype != "kafka" {
+		return fmt.Errorf("data source %q is not of type kafka", node.DataSourceName)
+	}
+	if node.Topic != "" && !util.MatchTopic(util.SplitList(topics), node.Topic) {
+		return &dberr.Error{
+			Err:  fmt.Errorf("topic %q is not read by data source %q", node.Topic, node.DataSourceName),
+			Hint: "The topic must match the topics option of the data source.",
+		}
+	}
+	var resetTime *time.Time
+	if node.Position == "timestamp" {
+		var t time.Time
+		if err = dc.QueryRow(context.TODO(), "SELECT $1::timestamptz", node.Timestamp).Scan(&t); err != nil {
+			return &dberr.Error{
+				Err:  fmt.Errorf("invalid timestamp %q", node.Timestamp),
+				Hint: "Use a format such as '2024-01-31 12:00:00+00'.",
+			}
+		}
+		resetTime = &t
+	}
+	q = "INSERT INTO metadb.kafka_offset_reset (source_name, topic, position, reset_time) VALUES ($1, $2, $3, $4)"
+	if _, err = dc.Exec(context.TODO(), q, node.DataSourceName, nullString(node.Topic), node.Position,
+		resetTime); err != nil {
+		return fmt.Errorf("writing offset reset for data source %q: %v", node.DataSourceName, err)
+	}
+
 	_ = writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.NoticeResponse{Severity: "INFO", Message: "restart server for data source changes to take effect"},
+		&pgproto3.NoticeResponse{Severity: "INFO", Message: "offsets will be reset by the running data source"},
 	})
 
 	return writeEncoded(conn, []pgproto3.Message{
@@ -614,7 +926,39 @@ func alterDataSource(conn net.Conn, node *ast.AlterDataSourceStmt, dc *pgx.Conn)
 	})
 }
 
-func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) error {
+func pauseDataSource(conn io.Writer, node *ast.PauseDataSourceStmt, dc *pgx.Conn) error {
+	var paused bool
+	q := "SELECT paused FROM metadb.source WHERE name=$1"
+	err := dc.QueryRow(context.TODO(), q, node.DataSourceName).Scan(&paused)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return fmt.Errorf("data source %q does not exist", node.DataSourceName)
+	case err != nil:
+		return fmt.Errorf("selecting data source: %v", err)
+	}
+	switch {
+	case paused && node.Pause:
+		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
+			Message: fmt.Sprintf("data source %q is already paused, skipping", node.DataSourceName)},
+		})
+	case !paused && !node.Pause:
+		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "NOTICE",
+			Message: fmt.Sprintf("data source %q is not paused, skipping", node.DataSourceName)},
+		})
+	default:
+		q = "UPDATE metadb.source SET paused=$2 WHERE name=$1"
+		if _, err = dc.Exec(context.TODO(), q, node.DataSourceName, node.Pause); err != nil {
+			return fmt.Errorf("updating data source %q: %v", node.DataSourceName, err)
+		}
+	}
+
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER DATA SOURCE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func dropDataSource(conn io.Writer, node *ast.DropDataSourceStmt, dc *pgx.Conn) error {
 	exists, err := sourceExists(dc, node.DataSourceName)
 	if err != nil {
 		return fmt.Errorf("selecting data source: %v", err)
@@ -623,10 +967,37 @@ func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) e
 		return fmt.Errorf("data source %q does not exist", node.DataSourceName)
 	}
 
-	q := "DELETE FROM metadb.source WHERE name='" + node.DataSourceName + "'"
-	_, err = dc.Exec(context.TODO(), q)
+	// The state of the data source is deleted in the same transaction as
+	// its configuration.  Writes of the state by a poll loop that is still
+	// running lock the configuration and are skipped once it is deleted.
+	tx, err := dc.Begin(context.TODO())
 	if err != nil {
-		return fmt.Errorf("deleting data source %q", node.DataSourceName)
+		return fmt.Errorf("deleting data source %q: %v", node.DataSourceName, err)
+	}
+	defer dbx.Rollback(tx)
+	q := "DELETE FROM metadb.source WHERE name=$1"
+	if _, err = tx.Exec(context.TODO(), q, node.DataSourceName); err != nil {
+		return fmt.Errorf("deleting data source %q: %v", node.DataSourceName, err)
+	}
+	for _, t := range []struct {
+		table string
+		what  string
+	}{
+		{"metadb.file_offset", "file offset"},
+		{"metadb.kafka_offset", "Kafka offsets"},
+		{"metadb.source_status", "status"},
+		{"metadb.kafka_partition_status", "status"},
+		{"metadb.kafka_option", "Kafka options"},
+		{"metadb.dead_letter", "dead letters"},
+		{"metadb.kafka_offset_reset", "offset resets"},
+	} {
+		q = "DELETE FROM " + t.table + " WHERE source_name=$1"
+		if _, err = tx.Exec(context.TODO(), q, node.DataSourceName); err != nil {
+			return fmt.Errorf("deleting %s of data source %q: %v", t.what, node.DataSourceName, err)
+		}
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return fmt.Errorf("deleting data source %q: %v", node.DataSourceName, err)
 	}
 	return writeEncoded(conn, []pgproto3.Message{
 		&pgproto3.CommandComplete{CommandTag: []byte("DROP DATA SOURCE")},
@@ -634,8 +1005,14 @@ func dropDataSource(conn net.Conn, node *ast.DropDataSourceStmt, dc *pgx.Conn) e
 	})
 }
 
-func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
+func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt, key []byte) error {
 	for _, opt := range node.Options {
+		if sysdb.IsKafkaOption(opt.Name) {
+			if err := alterKafkaOption(dc, key, node.DataSourceName, opt); err != nil {
+				return err
+			}
+			continue
+		}
 		switch opt.Name {
 		case "brokers":
 			fallthrough
@@ -649,19 +1026,49 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 			fallthrough
 		case "schemastopfilter":
 			fallthrough
+		case "tablepassfilter":
+			fallthrough
 		case "tablestopfilter":
 			fallthrough
+		case "columnpassfilter":
+			fallthrough
+		case "columnstopfilter":
+			fallthrough
 		case "trimschemaprefix":
 			fallthrough
 		case "addschemaprefix":
 			fallthrough
+		case "schemarewrite":
+			fallthrough
+		case "tablerewrite":
+			fallthrough
 		case "module":
+			fallthrough
+		case "connection":
+			fallthrough
+		case "publication":
+			fallthrough
+		case "slot":
+			fallthrough
+		case "path":
+			fallthrough
+		case "schemaregistry":
+			fallthrough
+		case "deadletter":
 			// NOP
 		default:
 			return &dberr.Error{
 				Err: fmt.Errorf("invalid option %q", opt.Name),
 				Hint: "Valid options in this context are: " +
-					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablestopfilter, trimschemaprefix, addschemaprefix, module",
+					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablepassfilter, tablestopfilter, " +
+					"columnpassfilter, columnstopfilter, trimschemaprefix, addschemaprefix, " +
+					"schemarewrite, tablerewrite, module, " +
+					"connection, publication, slot, path, schemaregistry, deadletter, kafka.*",
+			}
+		}
+		if opt.Action != "DROP" {
+			if err := checkSourceOption(opt.Name, opt.Val); err != nil {
+				return err
 			}
 		}
 		isnull, err := isSourceOptionNull(dc, node.DataSourceName, opt.Name)
@@ -695,11 +1102,94 @@ func alterSourceOptions(dc *pgx.Conn, node *ast.AlterDataSourceStmt) error {
 				return fmt.Errorf("unable to add option %q", opt.Name)
 			}
 		}
+		// The recorded positions belong to the previous consumer group.
+		if opt.Name == "consumergroup" {
+			q := "DELETE FROM metadb.kafka_offset WHERE source_name=$1"
+			if _, err := dc.Exec(context.TODO(), q, node.DataSourceName); err != nil {
+				return fmt.Errorf("deleting Kafka offsets of data source %q: %v", node.DataSourceName, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// alterKafkaOption adds, sets, or drops an option that sets a Kafka consumer
+// property.
+func alterKafkaOption(dc *pgx.Conn, key []byte, sourceName string, opt ast.Option) error {
+	property, secret, err := parseKafkaOption(opt.Name)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	q := "SELECT EXISTS(SELECT 1 FROM metadb.kafka_option WHERE source_name=$1 AND name=$2)"
+	if err = dc.QueryRow(context.TODO(), q, sourceName, property).Scan(&exists); err != nil {
+		return fmt.Errorf("reading source option: %v", err)
+	}
+	switch opt.Action {
+	case "DROP":
+		if !exists {
+			return fmt.Errorf("option %q not found", opt.Name)
+		}
+		q = "DELETE FROM metadb.kafka_option WHERE source_name=$1 AND name=$2"
+		if _, err = dc.Exec(context.TODO(), q, sourceName, property); err != nil {
+			return fmt.Errorf("unable to drop option %q", opt.Name)
+		}
+	case "SET":
+		if !exists {
+			return fmt.Errorf("option %q not found", opt.Name)
+		}
+		value, err := encodeKafkaOption(key, opt.Val, secret)
+		if err != nil {
+			return err
+		}
+		q = "UPDATE metadb.kafka_option SET value=$3, secret=$4 WHERE source_name=$1 AND name=$2"
+		if _, err = dc.Exec(context.TODO(), q, sourceName, property, value, secret); err != nil {
+			return fmt.Errorf("unable to set option %q", opt.Name)
+		}
+	case "ADD":
+		if exists {
+			return fmt.Errorf("option %q provided more than once", opt.Name)
+		}
+		if err = writeKafkaOption(dc, key, sourceName, property, opt.Val, secret); err != nil {
+			return fmt.Errorf("unable to add option %q", opt.Name)
+		}
+	}
+	return nil
+}
+
+// parseKafkaOption is like sysdb.ParseKafkaOption but returns an error with a
+// hint listing the valid options.
+func parseKafkaOption(name string) (string, bool, error) {
+	property, secret, err := sysdb.ParseKafkaOption(name)
+	if err != nil {
+		return "", false, &dberr.Error{
+			Err:  err,
+			Hint: "Valid Kafka options are: " + strings.Join(sysdb.KafkaOptionNames(), ", "),
+		}
+	}
+	return property, secret, nil
+}
+
+func writeKafkaOption(dq dbx.Queryable, key []byte, sourceName, property, value string, secret bool) error {
+	value, err := encodeKafkaOption(key, value, secret)
+	if err != nil {
+		return err
+	}
+	q := "INSERT INTO metadb.kafka_option (source_name, name, value, secret) VALUES ($1, $2, $3, $4)"
+	_, err = dq.Exec(context.TODO(), q, sourceName, property, value, secret)
+	return err
+}
+
+// encodeKafkaOption returns the value of a Kafka option as it is stored in the
+// database, where secret values are encrypted with key.
+func encodeKafkaOption(key []byte, value string, secret bool) (string, error) {
+	if !secret {
+		return value, nil
+	}
+	return util.EncryptSecret(key, value)
+}
+
 func isSourceOptionNull(dc *pgx.Conn, sourceName, optionName string) (bool, error) {
 	var val *string
 	q := "SELECT " + optionName + " FROM metadb.source WHERE name='" + sourceName + "'"
@@ -720,7 +1210,7 @@ func updateSource(dc *pgx.Conn, sourceName, optionName, valueText string) error
 	return err
 }
 
-func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
+func createSourceOptions(srctype string, options []ast.Option) (*sysdb.SourceConnector, error) {
 	err := checkOptionDuplicates(options)
 	if err != nil {
 		return nil, err
@@ -728,6 +1218,7 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 	s := &sysdb.SourceConnector{
 		// Set default values
 		Enable:           true,
+		Type:             srctype,
 		Security:         "ssl",
 		Topics:           []string{},
 		SchemaPassFilter: []string{},
@@ -748,27 +1239,117 @@ func createSourceOptions(options []ast.Option) (*sysdb.SourceConnector, error) {
 			s.SchemaPassFilter = strings.Split(opt.Val, ",")
 		case "schemastopfilter":
 			s.SchemaStopFilter = strings.Split(opt.Val, ",")
+		case "tablepassfilter":
+			s.TablePassFilter = strings.Split(opt.Val, ",")
 		case "tablestopfilter":
 			s.TableStopFilter = strings.Split(opt.Val, ",")
+		case "columnpassfilter":
+			s.ColumnPassFilter = util.SplitList(opt.Val)
+		case "columnstopfilter":
+			s.ColumnStopFilter = util.SplitList(opt.Val)
 		case "trimschemaprefix":
 			s.TrimSchemaPrefix = opt.Val
 		case "addschemaprefix":
 			s.AddSchemaPrefix = opt.Val
+		case "schemarewrite":
+			s.SchemaRewrite = util.SplitRewriteRules(opt.Val)
+		case "tablerewrite":
+			s.TableRewrite = util.SplitRewriteRules(opt.Val)
 		//case "enable":
 		//	s.Enable = (strings.ToLower(opt.Val) == "true")
 		case "module":
 			s.Module = opt.Val
+		case "connection":
+			s.Connection = opt.Val
+		case "publication":
+			s.Publication = opt.Val
+		case "slot":
+			s.Slot = opt.Val
+		case "path":
+			s.Path = opt.Val
+		case "schemaregistry":
+			s.SchemaRegistry = opt.Val
+		case "deadletter":
+			if s.DeadLetter, err = sysdb.ParseDeadLetterPolicy(opt.Val); err != nil {
+				return nil, err
+			}
 		default:
+			if sysdb.IsKafkaOption(opt.Name) {
+				property, _, err := parseKafkaOption(opt.Name)
+				if err != nil {
+					return nil, err
+				}
+				if s.KafkaOptions == nil {
+					s.KafkaOptions = make(map[string]string)
+				}
+				s.KafkaOptions[property] = opt.Val
+				continue
+			}
 			return nil, &dberr.Error{
 				Err: fmt.Errorf("invalid option %q", opt.Name),
 				Hint: "Valid options in this context are: " +
-					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablestopfilter, trimschemaprefix, addschemaprefix, module",
+					"brokers, security, topics, consumergroup, schemapassfilter, schemastopfilter, tablepassfilter, tablestopfilter, " +
+					"columnpassfilter, columnstopfilter, trimschemaprefix, addschemaprefix, " +
+					"schemarewrite, tablerewrite, module, " +
+					"connection, publication, slot, path, schemaregistry, deadletter, kafka.*",
 			}
 		}
 	}
+	for _, opt := range options {
+		if err = checkSourceOption(strings.ToLower(opt.Name), opt.Val); err != nil {
+			return nil, err
+		}
+	}
+	if s.Type == "postgresql" {
+		switch {
+		case s.Connection == "":
+			return nil, fmt.Errorf("option \"connection\" is required for a postgresql data source")
+		case s.Publication == "":
+			return nil, fmt.Errorf("option \"publication\" is required for a postgresql data source")
+		case s.Slot == "":
+			s.Slot = "metadb"
+		}
+	}
+	if s.Type == "file" && s.Path == "" {
+		return nil, fmt.Errorf("option \"path\" is required for a file data source")
+	}
 	return s, nil
 }
 
+// checkSourceOption returns an error if the value of a source option that
+// contains rewrite rules or column filters cannot be compiled.
+func checkSourceOption(name, val string) error {
+	var err error
+	switch name {
+	case "schemarewrite", "tablerewrite":
+		_, err = util.CompileRewriteRules(util.SplitRewriteRules(val))
+	case "columnpassfilter":
+		var filters []*util.ColumnFilter
+		if filters, err = util.CompileColumnFilters(util.SplitList(val)); err != nil {
+			return err
+		}
+		for _, f := range filters {
+			if f.Path != nil {
+				return fmt.Errorf("option \"columnpassfilter\" does not support paths within JSON columns")
+			}
+		}
+	case "columnstopfilter":
+		_, err = util.CompileColumnFilters(util.SplitList(val))
+	case "deadletter":
+		_, err = sysdb.ParseDeadLetterPolicy(val)
+	}
+	return err
+}
+
+// nullString returns nil for an empty string, so that unused options are
+// stored as NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 func checkOptionDuplicates(options []ast.Option) error {
 	m := make(map[string]bool)
 	for _, opt := range options {
@@ -781,7 +1362,7 @@ func checkOptionDuplicates(options []ast.Option) error {
 	return nil
 }
 
-func createUser(conn net.Conn /*query string,*/, node *ast.CreateUserStmt, db *dbx.DB, dc *pgx.Conn) error {
+func createUser(conn io.Writer /*query string,*/, node *ast.CreateUserStmt, db *dbx.DB, dc *pgx.Conn) error {
 	if node.Options == nil {
 		// return to client
 	}
@@ -808,7 +1389,7 @@ func createUser(conn net.Conn /*query string,*/, node *ast.CreateUserStmt, db *d
 			Message: fmt.Sprintf("role %q already exists, skipping", node.UserName)},
 		})
 	} else {
-		q := "CREATE USER " + node.UserName + " PASSWORD '" + opt.Password + "'"
+		q := "CREATE USER " + node.UserName + " PASSWORD " + quoteLiteral(opt.Password)
 		if _, err = dcsuper.Exec(context.TODO(), q); err != nil {
 			return err
 		}
@@ -817,12 +1398,24 @@ func createUser(conn net.Conn /*query string,*/, node *ast.CreateUserStmt, db *d
 
 	// Add comment on role.
 	if opt.Comment != "" {
-		q := "COMMENT ON ROLE " + node.UserName + " IS '" + opt.Comment + "'"
+		q := "COMMENT ON ROLE " + node.UserName + " IS " + quoteLiteral(opt.Comment)
 		if _, err = dcsuper.Exec(context.TODO(), q); err != nil {
 			return fmt.Errorf("adding comment on role %s: %s", node.UserName, err)
 		}
 	}
 
+	// Record the user's Metadb role, which is readonly unless specified.
+	if opt.Role != nil {
+		if err = writeUserRole(dc, node.UserName, *opt.Role); err != nil {
+			return err
+		}
+	} else {
+		q := "INSERT INTO metadb.user_role (username, role) VALUES ($1, 'readonly') ON CONFLICT (username) DO NOTHING"
+		if _, err = dc.Exec(context.TODO(), q, node.UserName); err != nil {
+			return fmt.Errorf("writing role of user %q: %v", node.UserName, err)
+		}
+	}
+
 	q := "CREATE SCHEMA IF NOT EXISTS " + node.UserName
 	if _, err = dc.Exec(context.TODO(), q); err != nil {
 		return fmt.Errorf("creating schema %s: %s", node.UserName, err)
@@ -855,10 +1448,19 @@ func createUserOptions(options []ast.Option) (*userOptions, error) {
 			o.Password = opt.Val
 		case "comment":
 			o.Comment = opt.Val
+		case "role":
+			r, err := parseUserRole(opt.Val)
+			if err != nil {
+				return nil, &dberr.Error{
+					Err:  err,
+					Hint: "Valid roles are: admin, operator, readonly",
+				}
+			}
+			o.Role = &r
 		default:
 			return nil, &dberr.Error{
 				Err:  fmt.Errorf("invalid option %q", opt.Name),
-				Hint: "Valid options in this context are: password, comment",
+				Hint: "Valid options in this context are: password, comment, role",
 			}
 		}
 	}
@@ -868,39 +1470,7 @@ func createUserOptions(options []ast.Option) (*userOptions, error) {
 type userOptions struct {
 	Password string
 	Comment  string
-}
-
-func authorize(conn net.Conn, node *ast.AuthorizeStmt, dc *pgx.Conn) error {
-	exists, err := sourceExists(dc, node.DataSourceName)
-	if err != nil {
-		return fmt.Errorf("selecting data source: %v", err)
-	}
-	if !exists {
-		return fmt.Errorf("data source %q does not exist", node.DataSourceName)
-	}
-
-	exists, err = userExists(dc, node.RoleName)
-	if err != nil {
-		return fmt.Errorf("selecting role: %v", err)
-	}
-	if !exists {
-		return fmt.Errorf("role %q does not exist", node.RoleName)
-	}
-
-	q := "INSERT INTO metadb.auth(username,tables,dbupdated) VALUES ('" + node.RoleName + "','.*',FALSE) ON CONFLICT (username) DO UPDATE SET tables='.*',dbupdated=FALSE;"
-	_, err = dc.Exec(context.TODO(), q)
-	if err != nil {
-		return fmt.Errorf("writing authorization: %v", err)
-	}
-
-	_ = writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.NoticeResponse{Severity: "INFO", Message: "restart server to update all permissions"},
-	})
-
-	return writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.CommandComplete{CommandTag: []byte("AUTHORIZE")},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
+	Role     *userRole
 }
 
 func sourceExists(dc *pgx.Conn, sourceName string) (bool, error) {
@@ -918,7 +1488,7 @@ func sourceExists(dc *pgx.Conn, sourceName string) (bool, error) {
 }
 
 // TODO move to catalog package
-func userExists(dc *pgx.Conn, username string) (bool, error) {
+func userExists(dc dbx.Queryable, username string) (bool, error) {
 	q := "SELECT 1 FROM pg_catalog.pg_user WHERE usename=$1"
 	var i int64
 	err := dc.QueryRow(context.TODO(), q, username).Scan(&i)
@@ -932,7 +1502,7 @@ func userExists(dc *pgx.Conn, username string) (bool, error) {
 	}
 }
 
-func createDataOrigin(conn net.Conn, node *ast.CreateDataOriginStmt, dc *pgx.Conn) error {
+func createDataOrigin(conn io.Writer, node *ast.CreateDataOriginStmt, dc *pgx.Conn) error {
 	if len(node.OriginName) > 63 {
 		return fmt.Errorf("data origin name %q too long", node.OriginName)
 	}
@@ -975,7 +1545,7 @@ func originExists(dc *pgx.Conn, originName string) (bool, error) {
 	}
 }
 
-func refreshInferredColumnTypesStmt(conn net.Conn, dc *pgx.Conn) error {
+func refreshInferredColumnTypesStmt(conn io.Writer, dc *pgx.Conn) error {
 	err := tools.RefreshInferredColumnTypes(dc, func(msg string) {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
 			Message: msg},
@@ -991,7 +1561,7 @@ func refreshInferredColumnTypesStmt(conn net.Conn, dc *pgx.Conn) error {
 	})
 }
 
-func verifyConsistencyStmt(conn net.Conn, dc *pgx.Conn) error {
+func verifyConsistencyStmt(conn io.Writer, dc *pgx.Conn) error {
 	err := tools.VerifyConsistency(dc, func(msg string) {
 		_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
 			Message: msg},
@@ -1007,6 +1577,65 @@ func verifyConsistencyStmt(conn net.Conn, dc *pgx.Conn) error {
 	})
 }
 
+func replayDeadLetters(conn io.Writer, node *ast.ReplayDeadLettersStmt, dc *pgx.Conn) error {
+	where, args, err := deadLetterFilter(dc, node.DataSourceName, node.ID)
+	if err != nil {
+		return err
+	}
+	q := "UPDATE metadb.dead_letter SET replay=TRUE" + where
+	if _, err = dc.Exec(context.TODO(), q, args...); err != nil {
+		return fmt.Errorf("marking dead letters for replay: %v", err)
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("REPLAY DEAD LETTERS")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func purgeDeadLetters(conn io.Writer, node *ast.PurgeDeadLettersStmt, dc *pgx.Conn) error {
+	where, args, err := deadLetterFilter(dc, node.DataSourceName, node.ID)
+	if err != nil {
+		return err
+	}
+	q := "DELETE FROM metadb.dead_letter" + where
+	if _, err = dc.Exec(context.TODO(), q, args...); err != nil {
+		return fmt.Errorf("deleting dead letters: %v", err)
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("PURGE DEAD LETTERS")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+// deadLetterFilter returns a WHERE clause and its arguments selecting either a
+// single dead letter, the dead letters of a data source, or if neither is
+// specified, all dead letters.
+func deadLetterFilter(dc *pgx.Conn, source, id string) (string, []any, error) {
+	switch {
+	case id != "":
+		var exists bool
+		q := "SELECT EXISTS(SELECT 1 FROM metadb.dead_letter WHERE id=$1)"
+		if err := dc.QueryRow(context.TODO(), q, id).Scan(&exists); err != nil {
+			return "", nil, fmt.Errorf("selecting dead letter: %v", err)
+		}
+		if !exists {
+			return "", nil, fmt.Errorf("dead letter %s does not exist", id)
+		}
+		return " WHERE id=$1", []any{id}, nil
+	case source != "":
+		exists, err := sourceExists(dc, source)
+		if err != nil {
+			return "", nil, fmt.Errorf("selecting data source: %v", err)
+		}
+		if !exists {
+			return "", nil, fmt.Errorf("data source %q does not exist", source)
+		}
+		return " WHERE source_name=$1", []any{source}, nil
+	default:
+		return "", nil, nil
+	}
+}
+
 //func version(conn net.Conn, query *pgproto3.Query, mdbVersion string) error {
 //	var b []byte = encode(nil, []pgproto3.Message{
 //		&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
@@ -1027,7 +1656,7 @@ func verifyConsistencyStmt(conn net.Conn, dc *pgx.Conn) error {
 //	return write(conn, b)
 //}
 
-func writeEncoded(conn net.Conn, messages []pgproto3.Message) error {
+func writeEncoded(conn io.Writer, messages []pgproto3.Message) error {
 	buffer, erre := encode(nil, messages)
 	if erre != nil {
 		return erre
@@ -1054,7 +1683,7 @@ func encode(buffer []byte, messages []pgproto3.Message) ([]byte, error) {
 	return buffer, nil
 }
 
-func write(conn net.Conn, buffer []byte) error {
+func write(conn io.Writer, buffer []byte) error {
 	if buffer == nil || len(buffer) == 0 {
 		return nil
 	}
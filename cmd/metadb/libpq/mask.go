@@ -0,0 +1,95 @@
+package libpq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/mask"
+)
+
+func createMaskingPolicy(conn io.Writer, node *ast.CreateMaskingPolicyStmt, dc *pgx.Conn) error {
+	if len(node.PolicyName) > 63 {
+		return fmt.Errorf("masking policy name %q too long", node.PolicyName)
+	}
+	table, err := dbx.ParseTable(node.TableName)
+	if err != nil || table.Schema == "" {
+		return fmt.Errorf("%q is not a valid table name; a schema-qualified name is required", node.TableName)
+	}
+	p := &mask.Policy{
+		Name:   node.PolicyName,
+		Table:  table,
+		Column: node.ColumnName,
+		Method: strings.ToLower(node.Method),
+	}
+	if err = checkOptionDuplicates(node.Options); err != nil {
+		return err
+	}
+	for _, opt := range node.Options {
+		switch opt.Name {
+		case "length":
+			if p.Length, err = strconv.Atoi(opt.Val); err != nil {
+				return fmt.Errorf("invalid value for option \"length\": %q", opt.Val)
+			}
+		default:
+			return fmt.Errorf("invalid option %q", opt.Name)
+		}
+	}
+	if err = mask.CheckPolicy(p); err != nil {
+		return err
+	}
+
+	q := "SELECT name FROM metadb.masking_policy WHERE name=$1 OR (schema_name=$2 AND table_name=$3 AND column_name=$4)"
+	var name string
+	err = dc.QueryRow(context.TODO(), q, p.Name, p.Table.Schema, p.Table.Table, p.Column).Scan(&name)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("selecting masking policy: %v", err)
+	case name == p.Name:
+		return fmt.Errorf("masking policy %q already exists", p.Name)
+	default:
+		return fmt.Errorf("column %q of table %q already has masking policy %q", p.Column, p.Table, name)
+	}
+
+	var length *int
+	if p.Length != 0 {
+		length = &p.Length
+	}
+	q = "INSERT INTO metadb.masking_policy (name, schema_name, table_name, column_name, method, length) " +
+		"VALUES ($1, $2, $3, $4, $5, $6)"
+	if _, err = dc.Exec(context.TODO(), q, p.Name, p.Table.Schema, p.Table.Table, p.Column, p.Method, length); err != nil {
+		return fmt.Errorf("writing masking policy: %v", err)
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.NoticeResponse{Severity: "INFO", Message: "masking policy applies to data written after it is created"},
+	})
+
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("CREATE MASKING POLICY")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func dropMaskingPolicy(conn io.Writer, node *ast.DropMaskingPolicyStmt, dc *pgx.Conn) error {
+	q := "DELETE FROM metadb.masking_policy WHERE name=$1"
+	tag, err := dc.Exec(context.TODO(), q, node.PolicyName)
+	if err != nil {
+		return fmt.Errorf("deleting masking policy %q: %v", node.PolicyName, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("masking policy %q does not exist", node.PolicyName)
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("DROP MASKING POLICY")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
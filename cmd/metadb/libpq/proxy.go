@@ -2,8 +2,10 @@ package libpq
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
+	"io"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -12,31 +14,101 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/parser"
 )
 
-func proxyQuery(conn net.Conn, query string, args []any, node ast.Node, dc *pgx.Conn) error {
-	switch node.(type) {
-	case *ast.SelectStmt:
-		return proxySelect(conn, query, args, dc)
-		//case *ast.CreateUserStmt:
-		//	return createUser(conn, query, n, db)
+// proxyQuery passes a query through to the database using the simple query
+// protocol.
+func proxyQuery(conn io.Writer, query string, node ast.Node, dc *pgx.Conn) error {
+	if !isProxied(query, node) {
+		return writeEncoded(conn, []pgproto3.Message{
+			&pgproto3.ErrorResponse{Severity: "ERROR", Message: "syntax error"},
+			&pgproto3.ReadyForQuery{TxStatus: 'I'},
+		})
+	}
+	if _, err := proxyExec(conn, query, nil, nil, nil, nil, true, dc); err != nil {
+		return err
+	}
+	return writeEncoded(conn, []pgproto3.Message{&pgproto3.ReadyForQuery{TxStatus: 'I'}})
+}
+
+// isProxied returns true if a query that the parser has passed through may be
+// run in the database.
+func isProxied(query string, node ast.Node) bool {
+	if _, ok := node.(*ast.SelectStmt); ok {
+		return true
 	}
+	return strings.EqualFold(firstWord(query), "show")
+}
 
-	return writeEncoded(conn, []pgproto3.Message{
-		&pgproto3.ErrorResponse{Severity: "ERROR", Message: "syntax error"},
-		&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	})
+// proxyExec runs a query in the database with the given parameters and writes
+// the resulting rows and command tag, preceded by a row description if
+// describe is true.  An error reported by the database is written as an error
+// response, in which case failed is true.  Values are passed through in the
+// format requested by the client.
+func proxyExec(conn io.Writer, query string, params [][]byte, paramOIDs []uint32, paramFormats []int16,
+	resultFormats []int16, describe bool, dc *pgx.Conn) (failed bool, err error) {
+	rr := dc.PgConn().ExecParams(context.TODO(), query, params, paramOIDs, paramFormats, resultFormats)
+	var b []byte
+	if describe && len(rr.FieldDescriptions()) != 0 {
+		rd := &pgproto3.RowDescription{}
+		for _, f := range rr.FieldDescriptions() {
+			rd.Fields = append(rd.Fields, pgproto3.FieldDescription{
+				Name:                 []byte(f.Name),
+				TableOID:             f.TableOID,
+				TableAttributeNumber: f.TableAttributeNumber,
+				DataTypeOID:          f.DataTypeOID,
+				DataTypeSize:         f.DataTypeSize,
+				TypeModifier:         f.TypeModifier,
+				Format:               f.Format,
+			})
+		}
+		if b, err = rd.Encode(b); err != nil {
+			return false, fmt.Errorf("proxy: row description: %v", err)
+		}
+	}
+	for rr.NextRow() {
+		if b, err = (&pgproto3.DataRow{Values: rr.Values()}).Encode(b); err != nil {
+			return false, fmt.Errorf("proxy: data row: %v", err)
+		}
+		// Write rows in batches to limit memory use.
+		if len(b) >= 65536 {
+			if err = write(conn, b); err != nil {
+				return false, err
+			}
+			b = b[:0]
+		}
+	}
+	ctag, err := rr.Close()
+	if err != nil {
+		var e *pgconn.PgError
+		if !errors.As(err, &e) {
+			return false, fmt.Errorf("proxy: %v", err)
+		}
+		// Rows already written are followed by the error.
+		if b, err = pgErrorResponse(e).Encode(b); err != nil {
+			return false, fmt.Errorf("proxy: error response: %v", err)
+		}
+		return true, write(conn, b)
+	}
+	if b, err = (&pgproto3.CommandComplete{CommandTag: []byte(ctag.String())}).Encode(b); err != nil {
+		return false, fmt.Errorf("proxy: command complete: %v", err)
+	}
+	return false, write(conn, b)
+}
 
-	//ctag, err := dc.Exec(context.TODO(), query)
-	//if err != nil {
-	//	return errors.New(strings.TrimLeft(strings.TrimPrefix(err.Error(), "ERROR:"), " "))
-	//}
-	//b := encode(nil, []pgproto3.Message{
-	//	&pgproto3.CommandComplete{CommandTag: []byte(ctag.String())},
-	//	&pgproto3.ReadyForQuery{TxStatus: 'I'},
-	//})
-	//return write(conn, b)
+// pgErrorResponse converts an error reported by the database to an error
+// response for the client.
+func pgErrorResponse(e *pgconn.PgError) *pgproto3.ErrorResponse {
+	return &pgproto3.ErrorResponse{
+		Severity:            e.Severity,
+		SeverityUnlocalized: e.Severity,
+		Code:                e.Code,
+		Message:             e.Message,
+		Detail:              e.Detail,
+		Hint:                e.Hint,
+		Position:            e.Position,
+	}
 }
 
-func proxySelect(conn net.Conn, query string, args []any, dbconn *pgx.Conn) error {
+func proxySelect(conn io.Writer, query string, args []any, dbconn *pgx.Conn) error {
 	var err error
 	var rows pgx.Rows
 	if rows, err = dbconn.Query(context.TODO(), query, args...); err != nil {
@@ -0,0 +1,113 @@
+package libpq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+// userRole is a Metadb role, which determines the statements that a user may
+// run on the Metadb server.  Each role includes the privileges of the roles
+// that precede it.
+type userRole int
+
+const (
+	// roleReadOnly allows listing the configuration and status.
+	roleReadOnly userRole = iota
+	// roleOperator allows operating existing data sources.
+	roleOperator
+	// roleAdmin allows all statements, including changes to the
+	// configuration, user management, and queries passed through to the
+	// database.
+	roleAdmin
+)
+
+func (r userRole) String() string {
+	switch r {
+	case roleAdmin:
+		return "admin"
+	case roleOperator:
+		return "operator"
+	default:
+		return "readonly"
+	}
+}
+
+func parseUserRole(s string) (userRole, error) {
+	switch strings.ToLower(s) {
+	case "admin":
+		return roleAdmin, nil
+	case "operator":
+		return roleOperator, nil
+	case "readonly":
+		return roleReadOnly, nil
+	default:
+		return roleReadOnly, fmt.Errorf("invalid role %q", s)
+	}
+}
+
+// requiredRole returns the role needed to run a statement.  A nil node refers
+// to a query passed through to the database.
+func requiredRole(node ast.Node) userRole {
+	switch node.(type) {
+	case *ast.ListStmt:
+		return roleReadOnly
+	case *ast.PauseDataSourceStmt, *ast.ResetOffsetsStmt, *ast.ReplayDeadLettersStmt,
+		*ast.RefreshInferredColumnTypesStmt, *ast.VerifyConsistencyStmt:
+		return roleOperator
+	default:
+		return roleAdmin
+	}
+}
+
+// readUserRole returns the role of a user as recorded in metadb.user_role.  The
+// Metadb system user always has the admin role, and other users have the
+// readonly role by default.
+func readUserRole(db *dbx.DB, dc *pgx.Conn, user string) (userRole, error) {
+	if user == db.User {
+		return roleAdmin, nil
+	}
+	q := "SELECT role FROM metadb.user_role WHERE username=$1"
+	var r string
+	err := dc.QueryRow(context.TODO(), q, user).Scan(&r)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return roleReadOnly, nil
+	case err != nil:
+		return roleReadOnly, fmt.Errorf("reading role of user %q: %v", user, err)
+	default:
+		return parseUserRole(r)
+	}
+}
+
+// checkRole returns an error if user does not have the role required to run a
+// statement.
+func checkRole(db *dbx.DB, dc *pgx.Conn, user string, node ast.Node) error {
+	need := requiredRole(node)
+	if need == roleReadOnly {
+		return nil
+	}
+	r, err := readUserRole(db, dc, user)
+	if err != nil {
+		return err
+	}
+	if r < need {
+		return fmt.Errorf("permission denied: statement requires role %q", need.String())
+	}
+	return nil
+}
+
+// writeUserRole records the role of a user in metadb.user_role.
+func writeUserRole(dc *pgx.Conn, user string, r userRole) error {
+	q := "INSERT INTO metadb.user_role (username, role) VALUES ($1, $2) " +
+		"ON CONFLICT (username) DO UPDATE SET role=$2"
+	if _, err := dc.Exec(context.TODO(), q, user, r.String()); err != nil {
+		return fmt.Errorf("writing role of user %q: %v", user, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package libpq
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+)
+
+func TestRequiredRole(t *testing.T) {
+	cases := []struct {
+		node ast.Node
+		want userRole
+	}{
+		{&ast.ListStmt{Name: "status"}, roleReadOnly},
+		{&ast.VerifyConsistencyStmt{}, roleOperator},
+		{&ast.ReplayDeadLettersStmt{}, roleOperator},
+		{&ast.ResetOffsetsStmt{}, roleOperator},
+		{&ast.PauseDataSourceStmt{Pause: true}, roleOperator},
+		{&ast.RefreshInferredColumnTypesStmt{}, roleOperator},
+		{&ast.AlterDataSourceStmt{}, roleAdmin},
+		{&ast.PurgeDeadLettersStmt{}, roleAdmin},
+		{&ast.DropDataSourceStmt{}, roleAdmin},
+		{&ast.CreateUserStmt{}, roleAdmin},
+		{&ast.SelectStmt{}, roleAdmin},
+		{nil, roleAdmin},
+	}
+	for _, c := range cases {
+		if got := requiredRole(c.node); got != c.want {
+			t.Errorf("requiredRole(%T) = %s; want %s", c.node, got, c.want)
+		}
+	}
+}
+
+func TestParseUserRole(t *testing.T) {
+	for _, r := range []userRole{roleReadOnly, roleOperator, roleAdmin} {
+		got, err := parseUserRole(r.String())
+		if err != nil || got != r {
+			t.Errorf("parseUserRole(%q) = %v, %v; want %v", r.String(), got, err, r)
+		}
+	}
+	if _, err := parseUserRole("superuser"); err == nil {
+		t.Errorf("parseUserRole(\"superuser\"): got success; want error")
+	}
+}
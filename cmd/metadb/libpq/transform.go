@@ -0,0 +1,104 @@
+package libpq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/jsonx"
+)
+
+func createJSONTransform(conn io.Writer, node *ast.CreateJSONTransformStmt, dc *pgx.Conn) error {
+	if len(node.TransformName) > 63 {
+		return fmt.Errorf("json transform name %q too long", node.TransformName)
+	}
+	table, err := dbx.ParseTable(node.TableName)
+	if err != nil || table.Schema == "" {
+		return fmt.Errorf("%q is not a valid table name; a schema-qualified name is required", node.TableName)
+	}
+	t := &jsonx.Transform{
+		Name:   node.TransformName,
+		Table:  table,
+		Column: node.ColumnName,
+		Method: strings.ToLower(node.Method),
+	}
+	if err = checkOptionDuplicates(node.Options); err != nil {
+		return err
+	}
+	var paths, depth *string
+	for _, opt := range node.Options {
+		val := opt.Val
+		switch opt.Name {
+		case "table":
+			t.TargetTable = opt.Val
+		case "depth":
+			if t.Depth, err = strconv.Atoi(opt.Val); err != nil || t.Depth <= 0 {
+				return fmt.Errorf("invalid value for option \"depth\": %q", opt.Val)
+			}
+			depth = &val
+		case "paths":
+			if t.Paths, err = jsonx.ParsePaths(opt.Val); err != nil {
+				return err
+			}
+			paths = &val
+		default:
+			return fmt.Errorf("invalid option %q", opt.Name)
+		}
+	}
+	if err = jsonx.CheckTransform(t); err != nil {
+		return err
+	}
+
+	q := "SELECT name FROM metadb.json_transform WHERE name=$1 OR (schema_name=$2 AND table_name=$3 AND column_name=$4)"
+	var name string
+	err = dc.QueryRow(context.TODO(), q, t.Name, t.Table.Schema, t.Table.Table, t.Column).Scan(&name)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("selecting json transform: %v", err)
+	case name == t.Name:
+		return fmt.Errorf("json transform %q already exists", t.Name)
+	case t.Column == "":
+		return fmt.Errorf("table %q already has json transform %q", t.Table, name)
+	default:
+		return fmt.Errorf("column %q of table %q already has json transform %q", t.Column, t.Table, name)
+	}
+
+	q = "INSERT INTO metadb.json_transform (name, schema_name, table_name, column_name, method, target_table, depth, paths) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	if _, err = dc.Exec(context.TODO(), q, t.Name, t.Table.Schema, t.Table.Table, t.Column, t.Method,
+		nullString(t.TargetTable), depth, paths); err != nil {
+		return fmt.Errorf("writing json transform: %v", err)
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.NoticeResponse{Severity: "INFO", Message: "json transform applies to data written after it is created"},
+	})
+
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("CREATE JSON TRANSFORM")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+func dropJSONTransform(conn io.Writer, node *ast.DropJSONTransformStmt, dc *pgx.Conn) error {
+	q := "DELETE FROM metadb.json_transform WHERE name=$1"
+	tag, err := dc.Exec(context.TODO(), q, node.TransformName)
+	if err != nil {
+		return fmt.Errorf("deleting json transform %q: %v", node.TransformName, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("json transform %q does not exist", node.TransformName)
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("DROP JSON TRANSFORM")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
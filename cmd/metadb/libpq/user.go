@@ -0,0 +1,132 @@
+package libpq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func alterUser(conn io.Writer, node *ast.AlterUserStmt, db *dbx.DB, dc *pgx.Conn) error {
+	opt, err := createUserOptions(node.Options)
+	if err != nil {
+		return err
+	}
+	if err = checkManagedUser(db, dc, node.UserName); err != nil {
+		return err
+	}
+
+	dcsuper, err := db.ConnectSuper()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dcsuper)
+
+	if opt.Password != "" {
+		q := "ALTER USER " + node.UserName + " PASSWORD " + quoteLiteral(opt.Password)
+		if _, err = dcsuper.Exec(context.TODO(), q); err != nil {
+			return fmt.Errorf("changing password of role %s: %s", node.UserName, err)
+		}
+	}
+	if opt.Comment != "" {
+		q := "COMMENT ON ROLE " + node.UserName + " IS " + quoteLiteral(opt.Comment)
+		if _, err = dcsuper.Exec(context.TODO(), q); err != nil {
+			return fmt.Errorf("adding comment on role %s: %s", node.UserName, err)
+		}
+	}
+	if opt.Role != nil {
+		if err = writeUserRole(dc, node.UserName, *opt.Role); err != nil {
+			return err
+		}
+	}
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("ALTER ROLE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+// dropUser removes a user that is managed by Metadb.  Objects owned by the
+// user, such as tables in the user's schema, are reassigned to the Metadb
+// system user, and all privileges granted to the user are revoked.
+func dropUser(conn io.Writer, node *ast.DropUserStmt, db *dbx.DB, dc *pgx.Conn) error {
+	if err := checkManagedUser(db, dc, node.UserName); err != nil {
+		return err
+	}
+
+	dcsuper, err := db.ConnectSuper()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dcsuper)
+
+	tx, err := dcsuper.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	q := "REASSIGN OWNED BY " + node.UserName + " TO " + db.User
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("reassigning objects owned by role %s: %v", node.UserName, err)
+	}
+	// After the objects have been reassigned, this revokes all privileges
+	// granted to the user, including those on tracked tables.
+	q = "DROP OWNED BY " + node.UserName
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("revoking privileges of role %s: %v", node.UserName, err)
+	}
+	q = "DROP USER " + node.UserName
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return fmt.Errorf("dropping role %s: %v", node.UserName, err)
+	}
+	if _, err = tx.Exec(context.TODO(), "DELETE FROM metadb.auth WHERE username=$1", node.UserName); err != nil {
+		return fmt.Errorf("removing authorization: %v", err)
+	}
+	if _, err = tx.Exec(context.TODO(), "DELETE FROM metadb.user_role WHERE username=$1", node.UserName); err != nil {
+		return fmt.Errorf("removing role of user %q: %v", node.UserName, err)
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return fmt.Errorf("dropping user %q: %v", node.UserName, err)
+	}
+
+	_ = writeEncoded(conn, []pgproto3.Message{&pgproto3.NoticeResponse{Severity: "INFO",
+		Message: fmt.Sprintf("objects owned by %q have been reassigned to %q", node.UserName, db.User)},
+	})
+	return writeEncoded(conn, []pgproto3.Message{
+		&pgproto3.CommandComplete{CommandTag: []byte("DROP ROLE")},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	})
+}
+
+// checkManagedUser returns an error if a user does not exist or is not managed
+// by Metadb, i.e. has not been created by CREATE USER or authorized by
+// AUTHORIZE.  The Metadb system user cannot be altered or dropped.
+func checkManagedUser(db *dbx.DB, dc dbx.Queryable, user string) error {
+	if user == db.User || user == db.SuperUser {
+		return fmt.Errorf("role %q is reserved", user)
+	}
+	exists, err := userExists(dc, user)
+	if err != nil {
+		return fmt.Errorf("selecting role: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("role %q does not exist", user)
+	}
+	managed, err := isMetadbUser(dc, db, user)
+	if err != nil {
+		return fmt.Errorf("selecting role: %v", err)
+	}
+	if !managed {
+		return fmt.Errorf("role %q is not managed by Metadb", user)
+	}
+	return nil
+}
+
+// quoteLiteral returns s as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
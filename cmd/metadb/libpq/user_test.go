@@ -0,0 +1,97 @@
+package libpq
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+)
+
+func TestQuoteLiteral(t *testing.T) {
+	cases := []struct {
+		s    string
+		want string
+	}{
+		{"", "''"},
+		{"kJ4Fmq7ZxT2sWb9cHeUd", "'kJ4Fmq7ZxT2sWb9cHeUd'"},
+		{"it's", "'it''s'"},
+		{"''", "''''''"},
+		{"a'; DROP TABLE t; --", "'a''; DROP TABLE t; --'"},
+	}
+	for _, c := range cases {
+		if got := quoteLiteral(c.s); got != c.want {
+			t.Errorf("quoteLiteral(%q) = %s; want %s", c.s, got, c.want)
+		}
+	}
+}
+
+// fakeUsers is a dbx.Queryable that answers the queries of checkManagedUser
+// from lists of database roles and users managed by Metadb.
+type fakeUsers struct {
+	roles   []string
+	managed []string
+}
+
+func (f *fakeUsers) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	panic("unexpected Exec")
+}
+
+func (f *fakeUsers) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	panic("unexpected Query")
+}
+
+func (f *fakeUsers) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	users := f.managed
+	if strings.Contains(sql, "pg_catalog.pg_user") {
+		users = f.roles
+	}
+	for _, u := range users {
+		if u == args[0].(string) {
+			return fakeRow{found: true}
+		}
+	}
+	return fakeRow{}
+}
+
+type fakeRow struct {
+	found bool
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if !r.found {
+		return pgx.ErrNoRows
+	}
+	*dest[0].(*int64) = 1
+	return nil
+}
+
+func TestCheckManagedUser(t *testing.T) {
+	db := &dbx.DB{User: "metadb", SuperUser: "postgres"}
+	dc := &fakeUsers{
+		roles:   []string{"metadb", "postgres", "boffin", "analyst", "dba"},
+		managed: []string{"boffin", "analyst"},
+	}
+	cases := []struct {
+		user string
+		ok   bool
+	}{
+		{"boffin", true},
+		{"analyst", true},
+		{"metadb", false},
+		{"postgres", false},
+		{"dba", false},
+		{"nobody", false},
+	}
+	for _, c := range cases {
+		err := checkManagedUser(db, dc, c.user)
+		if c.ok && err != nil {
+			t.Errorf("checkManagedUser(%q): %v", c.user, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("checkManagedUser(%q): got success; want error", c.user)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	glog "log"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	fcolor "github.com/fatih/color"
@@ -38,6 +39,7 @@ var std Log
 //var csv *Log
 
 var partitionsCreated = make(map[int]struct{})
+var partitionsMu sync.Mutex
 
 func Init(out io.Writer /*csvout io.Writer,*/, logDebug bool, logTrace bool) {
 	if out != nil {
@@ -161,7 +163,9 @@ func printf(c *fcolor.Color, logToDatabase bool, level string, format string, ar
 		year := n.Year()
 		yearStr := strconv.Itoa(year)
 		nextYearStr := strconv.Itoa(year + 1)
+		partitionsMu.Lock()
 		_, ok := partitionsCreated[year]
+		partitionsMu.Unlock()
 		if !ok {
 			q := "CREATE TABLE IF NOT EXISTS metadb.zzz___log___" + strconv.Itoa(year) +
 				" PARTITION OF metadb.log " +
@@ -170,7 +174,9 @@ func printf(c *fcolor.Color, logToDatabase bool, level string, format string, ar
 				printf(c, false, "ERROR", "logging to database: creating partition: %s: %v", yearStr, err)
 				return
 			}
+			partitionsMu.Lock()
 			partitionsCreated[year] = struct{}{}
+			partitionsMu.Unlock()
 		}
 		q := "INSERT INTO metadb.log VALUES($1,$2,$3)"
 		if _, err := std.dcpool.Exec(context.TODO(), q, n, level, msg); err != nil {
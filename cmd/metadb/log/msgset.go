@@ -1,6 +1,10 @@
 package log
 
+import "sync"
+
+// MessageSet is a set of messages that is safe for concurrent use.
 type MessageSet struct {
+	mu       sync.Mutex
 	Messages map[string]struct{}
 }
 
@@ -13,6 +17,8 @@ func NewMessageSet() *MessageSet {
 // Insert adds a message to the set and returns true if the message
 // was added, false if the set already contained the message.
 func (d *MessageSet) Insert(msg string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	_, ok := d.Messages[msg]
 	if ok {
 		return false
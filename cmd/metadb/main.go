@@ -20,10 +20,6 @@ import (
 
 var program = "metadb"
 
-// // rewriteJSON is defined at build time via -ldflags.
-// var rewriteJSON string = "0"
-var rewriteJSON string = "1"
-
 var colorMode string
 var devMode bool
 
@@ -118,6 +114,9 @@ func run() error {
 			if err = validateServerOptions(&serverOpt); err != nil {
 				return err
 			}
+			if serverOpt.Listen == "" {
+				serverOpt.Listen = "127.0.0.1"
+			}
 			// if err = sysdb.Init(util.SysdbFileName(serverOpt.Datadir)); err != nil {
 			// 	return err
 			// }
@@ -128,8 +127,6 @@ func run() error {
 			//if serverOpt.Port == "" {
 			//        serverOpt.Port = metadbAdminPort
 			//}
-			serverOpt.RewriteJSON = rewriteJSON == "1"
-			serverOpt.Listen = "127.0.0.1"
 			if err = server.Start(&serverOpt); err != nil {
 				return fatal(err, logf, csvlogf)
 			}
@@ -140,16 +137,16 @@ func run() error {
 	_ = dirFlag(cmdStart, &serverOpt.Datadir)
 	_ = logFlag(cmdStart, &logfile)
 	//_ = csvlogFlag(cmdStart, &csvlogfile)
-	//_ = listenFlag(cmdStart, &serverOpt.Listen)
+	_ = listenFlag(cmdStart, &serverOpt.Listen)
 	_ = portFlag(cmdStart, &serverOpt.Port)
-	//_ = certFlag(cmdStart, &serverOpt.TLSCert)
-	//_ = keyFlag(cmdStart, &serverOpt.TLSKey)
+	_ = certFlag(cmdStart, &serverOpt.TLSCert)
+	_ = keyFlag(cmdStart, &serverOpt.TLSKey)
 	_ = debugFlag(cmdStart, &serverOpt.Debug)
 	_ = traceLogFlag(cmdStart, &serverOpt.Trace)
 	_ = noKafkaCommitFlag(cmdStart, &serverOpt.NoKafkaCommit)
 	_ = sourceFileFlag(cmdStart, &serverOpt.SourceFilename)
 	_ = logSourceFlag(cmdStart, &serverOpt.LogSource)
-	//_ = noTLSFlag(cmdStart, &serverOpt.NoTLS)
+	_ = noTLSFlag(cmdStart, &serverOpt.NoTLS)
 	_ = memoryLimitFlag(cmdStart, &serverOpt.MemoryLimit)
 
 	var cmdStop = &cobra.Command{
@@ -310,12 +307,12 @@ func help(cmd *cobra.Command, commandLine []string) {
 			dirFlag(nil, nil) +
 			logFlag(nil, nil) +
 			//csvlogFlag(nil, nil) +
-			//listenFlag(nil, nil) +
+			listenFlag(nil, nil) +
 			portFlag(nil, nil) +
-			//certFlag(nil, nil) +
-			//keyFlag(nil, nil) +
+			certFlag(nil, nil) +
+			keyFlag(nil, nil) +
 			debugFlag(nil, nil) +
-			//noTLSFlag(nil, nil) +
+			noTLSFlag(nil, nil) +
 			traceLogFlag(nil, nil) +
 			noKafkaCommitFlag(nil, nil) +
 			sourceFileFlag(nil, nil) +
@@ -483,13 +480,13 @@ func traceLogFlag(cmd *cobra.Command, trace *bool) string {
 	return ""
 }
 
-//func listenFlag(cmd *cobra.Command, listen *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(listen, "listen", "", "")
-//	}
-//	return "" +
-//		"      --listen <a>            - Address to listen on (default: 127.0.0.1)\n"
-//}
+func listenFlag(cmd *cobra.Command, listen *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(listen, "listen", "", "")
+	}
+	return "" +
+		"      --listen <a>            - Address to listen on (default: 127.0.0.1)\n"
+}
 
 func portFlag(cmd *cobra.Command, adminPort *string) string {
 	if cmd != nil {
@@ -499,22 +496,22 @@ func portFlag(cmd *cobra.Command, adminPort *string) string {
 		"  -p, --port <p>              - Port to listen on (default: " + common.DefaultPort + ")\n"
 }
 
-//func certFlag(cmd *cobra.Command, cert *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(cert, "cert", "", "")
-//	}
-//	return "" +
-//		"      --cert <f>              - File name of server certificate, including the\n" +
-//		"                                CA's certificate and intermediates\n"
-//}
+func certFlag(cmd *cobra.Command, cert *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(cert, "cert", "", "")
+	}
+	return "" +
+		"      --cert <f>              - File name of server certificate, including the\n" +
+		"                                CA's certificate and intermediates\n"
+}
 
-//func keyFlag(cmd *cobra.Command, key *string) string {
-//	if cmd != nil {
-//		cmd.Flags().StringVar(key, "key", "", "")
-//	}
-//	return "" +
-//		"      --key <f>               - File name of server private key\n"
-//}
+func keyFlag(cmd *cobra.Command, key *string) string {
+	if cmd != nil {
+		cmd.Flags().StringVar(key, "key", "", "")
+	}
+	return "" +
+		"      --key <f>               - File name of server private key\n"
+}
 
 func logFlag(cmd *cobra.Command, logfile *string) string {
 	if cmd != nil {
@@ -549,14 +546,14 @@ func dirFlag(cmd *cobra.Command, datadir *string) string {
 }
 */
 
-//func noTLSFlag(cmd *cobra.Command, noTLS *bool) string {
-//	if cmd != nil {
-//		cmd.Flags().BoolVar(noTLS, "notls", false, "")
-//	}
-//	return "" +
-//		"      --notls                 - Disable TLS in client connections [insecure,\n" +
-//		"                                use for testing only]\n"
-//}
+func noTLSFlag(cmd *cobra.Command, noTLS *bool) string {
+	if cmd != nil {
+		cmd.Flags().BoolVar(noTLS, "notls", false, "")
+	}
+	return "" +
+		"      --notls                 - Disable TLS in client connections [insecure,\n" +
+		"                                use for testing only]\n"
+}
 
 func memoryLimitFlag(cmd *cobra.Command, memoryLimit *float64) string {
 	if cmd != nil {
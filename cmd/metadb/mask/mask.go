@@ -0,0 +1,271 @@
+// Package mask applies masking policies to data before they are written to
+// the database.
+package mask
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/util"
+)
+
+// Masking methods
+const (
+	// HMAC replaces a value with a keyed hash of the value, which allows
+	// masked values to be compared and joined.
+	HMAC = "hmac"
+	// Null replaces a value with NULL.
+	Null = "null"
+	// Truncate retains only the first Length characters of a value.
+	Truncate = "truncate"
+)
+
+// Policy is a masking policy for a column.
+type Policy struct {
+	Name   string
+	Table  dbx.Table
+	Column string
+	Method string
+	Length int
+}
+
+// Masker applies masking policies to commands.
+type Masker struct {
+	key      []byte
+	policies map[dbx.Table]map[string]*Policy
+	dedup    *log.MessageSet
+}
+
+// NewMasker returns a Masker that applies the specified policies, using key
+// for the HMAC method.
+func NewMasker(key []byte, policies []*Policy, dedup *log.MessageSet) *Masker {
+	m := &Masker{
+		key:      key,
+		policies: make(map[dbx.Table]map[string]*Policy),
+		dedup:    dedup,
+	}
+	for _, p := range policies {
+		if m.policies[p.Table] == nil {
+			m.policies[p.Table] = make(map[string]*Policy)
+		}
+		m.policies[p.Table][p.Column] = p
+	}
+	return m
+}
+
+// MaskCommand applies the policies for a command's table to its columns, and
+// to the JSON data in the columns.  Subcommands that write to transformed
+// tables are also subject to the policies of the command's table, so that a
+// policy applies to data extracted from JSON as well.
+func (m *Masker) MaskCommand(cmd *command.Command) error {
+	policies := m.policies[dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}]
+	if err := m.maskColumns(cmd, policies); err != nil {
+		return err
+	}
+	if cmd.Subcommands == nil {
+		return nil
+	}
+	for e := cmd.Subcommands.Front(); e != nil; e = e.Next() {
+		sub := e.Value.(*command.Command)
+		if err := m.MaskCommand(sub); err != nil {
+			return err
+		}
+		if sub.Transformed {
+			if err := m.maskColumns(sub, policies); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Masker) maskColumns(cmd *command.Command, policies map[string]*Policy) error {
+	if len(policies) == 0 {
+		return nil
+	}
+	for i := range cmd.Column {
+		col := &cmd.Column[i]
+		if p := policies[col.Name]; p != nil {
+			if col.PrimaryKey != 0 && p.Method != HMAC {
+				msg := fmt.Sprintf("masking policy %q not applied to primary key column %q", p.Name, col.Name)
+				if m.dedup.Insert(msg) {
+					log.Warning("%s", msg)
+				}
+				continue
+			}
+			m.maskColumn(col, p)
+			continue
+		}
+		if col.DType == command.JSONType {
+			if err := m.maskJSONColumn(col, policies); err != nil {
+				return fmt.Errorf("masking column %q: %v", col.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Masker) maskColumn(col *command.CommandColumn, p *Policy) {
+	if col.SQLData == nil {
+		return
+	}
+	switch p.Method {
+	case Null:
+		col.Data = nil
+		col.SQLData = nil
+	case HMAC:
+		h := m.hmac(*col.SQLData)
+		if col.DType == command.UUIDType {
+			// Retain the uuid type.
+			h = h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+		} else {
+			col.DType = command.TextType
+			col.DTypeSize = 0
+		}
+		col.Data = h
+		col.SQLData = &h
+	case Truncate:
+		t := truncate(*col.SQLData, p.Length)
+		col.DType = command.TextType
+		col.DTypeSize = 0
+		col.Data = t
+		col.SQLData = &t
+	}
+}
+
+// maskJSONColumn applies policies to the fields of a JSON object, including
+// the fields of nested objects and of objects in arrays.  A field matches a
+// policy if the policy's column name is the name of the column that the
+// flatten transform would extract the field into.
+func (m *Masker) maskJSONColumn(col *command.CommandColumn, policies map[string]*Policy) error {
+	if col.SQLData == nil {
+		return nil
+	}
+	var j interface{}
+	if err := json.Unmarshal([]byte(*col.SQLData), &j); err != nil {
+		return nil
+	}
+	obj, ok := j.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if !m.maskJSONObject(obj, "", policies) {
+		return nil
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	s := string(b)
+	col.Data = s
+	col.SQLData = &s
+	return nil
+}
+
+// maskJSONObject applies policies to the fields of obj.  The column name of a
+// field is its name, or its name converted from camel case, joined to prefix
+// with "__" if prefix is not "".  It returns true if any field was masked.
+func (m *Masker) maskJSONObject(obj map[string]interface{}, prefix string, policies map[string]*Policy) bool {
+	var changed bool
+	for name, value := range obj {
+		full, n := name, name
+		if d, err := util.DecodeCamelCase(name); err == nil {
+			n = d
+		}
+		if prefix != "" {
+			full = prefix + "__" + full
+			n = prefix + "__" + n
+		}
+		p := policies[full]
+		if p == nil {
+			p = policies[n]
+		}
+		if p != nil {
+			obj[name] = m.maskValue(value, p)
+			changed = true
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if m.maskJSONObject(v, n, policies) {
+				changed = true
+			}
+		case []interface{}:
+			if m.maskJSONArray(v, policies) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// maskJSONArray applies policies to the objects in an array.  As in the child
+// table written by the flatten transform, their fields have no prefix.
+func (m *Masker) maskJSONArray(a []interface{}, policies map[string]*Policy) bool {
+	var changed bool
+	for _, value := range a {
+		if obj, ok := value.(map[string]interface{}); ok && m.maskJSONObject(obj, "", policies) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (m *Masker) maskValue(value interface{}, p *Policy) interface{} {
+	if value == nil || p.Method == Null {
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		s = string(b)
+	}
+	switch p.Method {
+	case HMAC:
+		return m.hmac(s)
+	case Truncate:
+		return truncate(s, p.Length)
+	default:
+		return nil
+	}
+}
+
+func (m *Masker) hmac(s string) string {
+	h := hmac.New(sha256.New, m.key)
+	_, _ = h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func truncate(s string, length int) string {
+	r := []rune(s)
+	if len(r) <= length {
+		return s
+	}
+	return string(r[:length])
+}
+
+// CheckPolicy returns an error if a policy is not valid.
+func CheckPolicy(p *Policy) error {
+	switch p.Method {
+	case HMAC, Null:
+		if p.Length != 0 {
+			return fmt.Errorf("option \"length\" is only valid for method %q", Truncate)
+		}
+	case Truncate:
+		if p.Length <= 0 {
+			return fmt.Errorf("option \"length\" is required for method %q and must be greater than 0", Truncate)
+		}
+	default:
+		return fmt.Errorf("invalid masking method %q", p.Method)
+	}
+	return nil
+}
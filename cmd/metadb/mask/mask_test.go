@@ -0,0 +1,155 @@
+package mask
+
+import (
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+func init() {
+	log.Init(io.Discard, false, false)
+}
+
+func column(name string, dtype command.DataType, data string, pk int) command.CommandColumn {
+	return command.CommandColumn{Name: name, DType: dtype, Data: data, SQLData: &data, PrimaryKey: pk}
+}
+
+func testMasker() *Masker {
+	table := dbx.Table{Schema: "library", Table: "patron"}
+	return NewMasker([]byte("key"), []*Policy{
+		{Name: "p1", Table: table, Column: "id", Method: HMAC},
+		{Name: "p2", Table: table, Column: "email", Method: Null},
+		{Name: "p3", Table: table, Column: "last_name", Method: Truncate, Length: 1},
+		{Name: "p4", Table: table, Column: "barcode", Method: Null},
+	}, log.NewMessageSet())
+}
+
+func TestMaskCommand(t *testing.T) {
+	id := "9a3f1c52-7d8e-4b6a-9c2d-1e5f7a8b9c0d"
+	cmd := &command.Command{
+		SchemaName: "library",
+		TableName:  "patron",
+		Column: []command.CommandColumn{
+			column("id", command.UUIDType, id, 1),
+			column("barcode", command.TextType, "123", 2),
+			column("email", command.TextType, "a@example.com", 0),
+			column("last_name", command.TextType, "Ångström", 0),
+			column("city", command.TextType, "Chicago", 0),
+			column("jsonb", command.JSONType, `{"email":"a@example.com","lastName":"Smith","active":true}`, 0),
+		},
+	}
+	m := testMasker()
+	if err := m.MaskCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	c := cmd.Column
+	if *c[0].SQLData == id || !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`).MatchString(*c[0].SQLData) {
+		t.Errorf("id: got %q; want uuid hash", *c[0].SQLData)
+	}
+	if c[0].DType != command.UUIDType {
+		t.Errorf("id: got type %v; want UUIDType", c[0].DType)
+	}
+	if *c[1].SQLData != "123" {
+		t.Errorf("barcode: primary key should not be masked with null; got %v", c[1].SQLData)
+	}
+	if c[2].SQLData != nil || c[2].Data != nil {
+		t.Errorf("email: got %v; want nil", c[2].Data)
+	}
+	if *c[3].SQLData != "Å" {
+		t.Errorf("last_name: got %q; want %q", *c[3].SQLData, "Å")
+	}
+	if *c[4].SQLData != "Chicago" {
+		t.Errorf("city: got %q; want Chicago", *c[4].SQLData)
+	}
+	if want := `{"active":true,"email":null,"lastName":"S"}`; *c[5].SQLData != want {
+		t.Errorf("jsonb: got %s; want %s", *c[5].SQLData, want)
+	}
+
+	// Masking is deterministic.
+	cmd2 := &command.Command{
+		SchemaName: "library",
+		TableName:  "patron",
+		Column:     []command.CommandColumn{column("id", command.UUIDType, id, 1)},
+	}
+	if err := m.MaskCommand(cmd2); err != nil {
+		t.Fatal(err)
+	}
+	if *cmd2.Column[0].SQLData != *c[0].SQLData {
+		t.Errorf("id: got %q; want %q", *cmd2.Column[0].SQLData, *c[0].SQLData)
+	}
+}
+
+func TestMaskTransformedCommand(t *testing.T) {
+	cmd := &command.Command{
+		SchemaName: "library",
+		TableName:  "patron",
+		Column:     []command.CommandColumn{column("id", command.TextType, "1", 1)},
+	}
+	cmd.AddChild(&command.Command{
+		SchemaName:  "library",
+		TableName:   "patron__t",
+		Transformed: true,
+		ParentTable: dbx.Table{Schema: "library", Table: "patron"},
+		Column: []command.CommandColumn{
+			column("id", command.TextType, "1", 1),
+			column("email", command.TextType, "a@example.com", 0),
+		},
+	})
+	if err := testMasker().MaskCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	sub := cmd.Subcommands.Front().Value.(*command.Command)
+	if *sub.Column[0].SQLData != *cmd.Column[0].SQLData || *sub.Column[0].SQLData == "1" {
+		t.Errorf("id: got %q; want %q", *sub.Column[0].SQLData, *cmd.Column[0].SQLData)
+	}
+	if sub.Column[1].SQLData != nil {
+		t.Errorf("email: got %q; want nil", *sub.Column[1].SQLData)
+	}
+}
+
+func TestMaskNestedJSON(t *testing.T) {
+	table := dbx.Table{Schema: "library", Table: "users"}
+	m := NewMasker([]byte("key"), []*Policy{
+		{Name: "p1", Table: table, Column: "personal__email", Method: Null},
+		{Name: "p2", Table: table, Column: "city", Method: Truncate, Length: 1},
+		{Name: "p3", Table: table, Column: "phones", Method: Null},
+	}, log.NewMessageSet())
+	cmd := &command.Command{
+		SchemaName: "library",
+		TableName:  "users",
+		Column: []command.CommandColumn{
+			column("id", command.TextType, "1", 1),
+			column("jsonb", command.JSONType, `{"personal":{"email":"a@example.com","lastName":"Smith",`+
+				`"city":"Boston"},"addresses":[{"city":"Chicago","zip":"60601"}],`+
+				`"phones":["555-0100","555-0101"]}`, 0),
+		},
+	}
+	if err := m.MaskCommand(cmd); err != nil {
+		t.Fatal(err)
+	}
+	// Fields of nested objects are named with a prefix, as in the
+	// transformed table, so "personal.city" is not matched by "city".
+	// Fields of objects in arrays have no prefix, as in child tables.
+	want := `{"addresses":[{"city":"C","zip":"60601"}],` +
+		`"personal":{"city":"Boston","email":null,"lastName":"Smith"},"phones":null}`
+	if got := *cmd.Column[1].SQLData; got != want {
+		t.Errorf("jsonb: got %s; want %s", got, want)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	for _, p := range []*Policy{
+		{Method: "hash"},
+		{Method: Truncate},
+		{Method: Truncate, Length: -1},
+		{Method: HMAC, Length: 5},
+	} {
+		if err := CheckPolicy(p); err == nil {
+			t.Errorf("%v: expected error", p)
+		}
+	}
+}
@@ -17,10 +17,16 @@ import (
 %type <node> top_level_stmt stmt
 %type <node> select_stmt
 %type <node> create_data_source_stmt alter_data_source_stmt drop_data_source_stmt authorize_stmt create_user_stmt
+%type <node> deauthorize_stmt alter_user_stmt drop_user_stmt
+%type <node> table_pattern
 %type <node> create_data_origin_stmt list_stmt
 %type <node> refresh_inferred_column_types_stmt
 %type <node> alter_table_stmt alter_table_cmd
 %type <node> verify_consistency_stmt
+%type <node> create_masking_policy_stmt drop_masking_policy_stmt
+%type <node> create_json_transform_stmt drop_json_transform_stmt
+%type <node> replay_dead_letters_stmt purge_dead_letters_stmt
+%type <node> reset_offsets_position
 %type <optlist> options_clause alter_options_clause option_list alter_option_list option alter_option
 %type <str> option_name option_val
 %type <str> name unreserved_keyword
@@ -31,12 +37,15 @@ import (
 %token SELECT
 %token CONSISTENCY
 %token CREATE ALTER DATA SOURCE ORIGIN OPTIONS USER
-%token AUTHORIZE ON ALL TABLE TABLES IN TO WITH MAPPING LIST
+%token AUTHORIZE DEAUTHORIZE ON ALL TABLE TABLES IN TO FROM WITH MAPPING LIST
 %token REFRESH INFERRED COLUMN TYPES
 %token TYPE
 %token TRUE FALSE
 %token VERIFY
-%token <str> VERSION
+%token <str> VERSION MASKING POLICY USING JSON TRANSFORM
+%token <str> REPLAY PURGE DEAD LETTER LETTERS
+%token <str> RESET OFFSETS EARLIEST LATEST TIMESTAMP FOR TOPIC
+%token <str> PAUSE RESUME
 %token <str> ADD SET DROP
 %token <str> IDENT NUMBER
 %token <str> SLITERAL
@@ -74,6 +83,14 @@ stmt:
 		{
 			$$ = $1
 		}
+	| create_masking_policy_stmt
+		{
+			$$ = $1
+		}
+	| create_json_transform_stmt
+		{
+			$$ = $1
+		}
 	| CREATE
 		{
 			yylex.(*lexer).pass = true
@@ -87,6 +104,10 @@ stmt:
 		{
 			$$ = $1
 		}
+	| alter_user_stmt
+		{
+			$$ = $1
+		}
 	| ALTER
 		{
 			yylex.(*lexer).pass = true
@@ -96,6 +117,18 @@ stmt:
 		{
 			$$ = $1
 		}
+	| drop_user_stmt
+		{
+			$$ = $1
+		}
+	| drop_masking_policy_stmt
+		{
+			$$ = $1
+		}
+	| drop_json_transform_stmt
+		{
+			$$ = $1
+		}
 	| DROP
 		{
 			yylex.(*lexer).pass = true
@@ -105,6 +138,10 @@ stmt:
 		{
 			$$ = $1
 		}
+	| deauthorize_stmt
+		{
+			$$ = $1
+		}
 	| list_stmt
 		{
 			$$ = $1
@@ -117,6 +154,14 @@ stmt:
 		{
 			$$ = $1
 		}
+	| replay_dead_letters_stmt
+		{
+			$$ = $1
+		}
+	| purge_dead_letters_stmt
+		{
+			$$ = $1
+		}
 	| SET
 		{
 			yylex.(*lexer).pass = true
@@ -157,6 +202,58 @@ create_user_stmt:
 			yylex.(*lexer).pass = true
 		}
 
+create_masking_policy_stmt:
+	CREATE MASKING POLICY name ON name '(' name ')' USING name ';'
+		{
+			$$ = &ast.CreateMaskingPolicyStmt{PolicyName: $4, TableName: $6, ColumnName: $8, Method: $11}
+		}
+	| CREATE MASKING POLICY name ON name '(' name ')' USING name options_clause ';'
+		{
+			$$ = &ast.CreateMaskingPolicyStmt{PolicyName: $4, TableName: $6, ColumnName: $8, Method: $11, Options: $12}
+		}
+
+drop_masking_policy_stmt:
+	DROP MASKING POLICY name ';'
+		{
+			$$ = &ast.DropMaskingPolicyStmt{PolicyName: $4}
+		}
+
+create_json_transform_stmt:
+	CREATE JSON TRANSFORM name ON name USING name ';'
+		{
+			$$ = &ast.CreateJSONTransformStmt{TransformName: $4, TableName: $6, Method: $8}
+		}
+	| CREATE JSON TRANSFORM name ON name USING name options_clause ';'
+		{
+			$$ = &ast.CreateJSONTransformStmt{TransformName: $4, TableName: $6, Method: $8, Options: $9}
+		}
+	| CREATE JSON TRANSFORM name ON name '(' name ')' USING name ';'
+		{
+			$$ = &ast.CreateJSONTransformStmt{TransformName: $4, TableName: $6, ColumnName: $8, Method: $11}
+		}
+	| CREATE JSON TRANSFORM name ON name '(' name ')' USING name options_clause ';'
+		{
+			$$ = &ast.CreateJSONTransformStmt{TransformName: $4, TableName: $6, ColumnName: $8, Method: $11, Options: $12}
+		}
+
+drop_json_transform_stmt:
+	DROP JSON TRANSFORM name ';'
+		{
+			$$ = &ast.DropJSONTransformStmt{TransformName: $4}
+		}
+
+alter_user_stmt:
+	ALTER USER name WITH option_list ';'
+		{
+			$$ = &ast.AlterUserStmt{UserName: $3, Options: $5}
+		}
+
+drop_user_stmt:
+	DROP USER name ';'
+		{
+			$$ = &ast.DropUserStmt{UserName: $3}
+		}
+
 alter_table_stmt:
 	ALTER TABLE name alter_table_cmd ';'
 		{
@@ -174,6 +271,41 @@ alter_data_source_stmt:
 		{
 			$$ = &ast.AlterDataSourceStmt{DataSourceName: $4, Options: $5}
 		}
+	| ALTER DATA SOURCE name RESET OFFSETS TO reset_offsets_position ';'
+		{
+			stmt := $8.(*ast.ResetOffsetsStmt)
+			stmt.DataSourceName = $4
+			$$ = stmt
+		}
+	| ALTER DATA SOURCE name RESET OFFSETS FOR TOPIC SLITERAL TO reset_offsets_position ';'
+		{
+			stmt := $11.(*ast.ResetOffsetsStmt)
+			stmt.DataSourceName = $4
+			stmt.Topic = $9
+			$$ = stmt
+		}
+	| ALTER DATA SOURCE name PAUSE ';'
+		{
+			$$ = &ast.PauseDataSourceStmt{DataSourceName: $4, Pause: true}
+		}
+	| ALTER DATA SOURCE name RESUME ';'
+		{
+			$$ = &ast.PauseDataSourceStmt{DataSourceName: $4, Pause: false}
+		}
+
+reset_offsets_position:
+	EARLIEST
+		{
+			$$ = &ast.ResetOffsetsStmt{Position: "earliest"}
+		}
+	| LATEST
+		{
+			$$ = &ast.ResetOffsetsStmt{Position: "latest"}
+		}
+	| TIMESTAMP SLITERAL
+		{
+			$$ = &ast.ResetOffsetsStmt{Position: "timestamp", Timestamp: $2}
+		}
 
 drop_data_source_stmt:
 	DROP DATA SOURCE name ';'
@@ -254,6 +386,32 @@ authorize_stmt:
 		{
 			$$ = &ast.AuthorizeStmt{DataSourceName: $9, RoleName: $11}
 		}
+	| AUTHORIZE SELECT ON TABLE table_pattern TO name ';'
+		{
+			t := ($5).(*ast.AuthorizeStmt)
+			$$ = &ast.AuthorizeStmt{TableName: t.TableName, TablePattern: t.TablePattern, RoleName: $7}
+		}
+
+deauthorize_stmt:
+    DEAUTHORIZE SELECT ON ALL TABLES IN DATA SOURCE name FROM name ';'
+		{
+			$$ = &ast.DeauthorizeStmt{DataSourceName: $9, RoleName: $11}
+		}
+	| DEAUTHORIZE SELECT ON TABLE table_pattern FROM name ';'
+		{
+			t := ($5).(*ast.AuthorizeStmt)
+			$$ = &ast.DeauthorizeStmt{TableName: t.TableName, TablePattern: t.TablePattern, RoleName: $7}
+		}
+
+table_pattern:
+	name
+		{
+			$$ = &ast.AuthorizeStmt{TableName: $1}
+		}
+	| SLITERAL
+		{
+			$$ = &ast.AuthorizeStmt{TablePattern: $1}
+		}
 
 list_stmt:
     LIST name ';'
@@ -273,6 +431,34 @@ verify_consistency_stmt:
 			$$ = &ast.VerifyConsistencyStmt{}
 		}
 
+replay_dead_letters_stmt:
+    REPLAY DEAD LETTERS ';'
+		{
+			$$ = &ast.ReplayDeadLettersStmt{}
+		}
+    | REPLAY DEAD LETTERS FROM DATA SOURCE name ';'
+		{
+			$$ = &ast.ReplayDeadLettersStmt{DataSourceName: $7}
+		}
+    | REPLAY DEAD LETTER NUMBER ';'
+		{
+			$$ = &ast.ReplayDeadLettersStmt{ID: $4}
+		}
+
+purge_dead_letters_stmt:
+    PURGE DEAD LETTERS ';'
+		{
+			$$ = &ast.PurgeDeadLettersStmt{}
+		}
+    | PURGE DEAD LETTERS FROM DATA SOURCE name ';'
+		{
+			$$ = &ast.PurgeDeadLettersStmt{DataSourceName: $7}
+		}
+    | PURGE DEAD LETTER NUMBER ';'
+		{
+			$$ = &ast.PurgeDeadLettersStmt{ID: $4}
+		}
+
 name:
 	IDENT
 		{
@@ -297,3 +483,22 @@ boolean:
 
 unreserved_keyword:
 	VERSION
+	| MASKING
+	| POLICY
+	| USING
+	| JSON
+	| TRANSFORM
+	| REPLAY
+	| PURGE
+	| DEAD
+	| LETTER
+	| LETTERS
+	| RESET
+	| OFFSETS
+	| EARLIEST
+	| LATEST
+	| TIMESTAMP
+	| FOR
+	| TOPIC
+	| PAUSE
+	| RESUME
@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/ast"
+)
+
+func TestParseResetOffsets(t *testing.T) {
+	cases := []struct {
+		input string
+		want  *ast.ResetOffsetsStmt
+	}{
+		{"ALTER DATA SOURCE sensor RESET OFFSETS TO EARLIEST;",
+			&ast.ResetOffsetsStmt{DataSourceName: "sensor", Position: "earliest"}},
+		{"alter data source sensor reset offsets to latest;",
+			&ast.ResetOffsetsStmt{DataSourceName: "sensor", Position: "latest"}},
+		{"ALTER DATA SOURCE sensor RESET OFFSETS TO TIMESTAMP '2024-01-31 12:00:00+00';",
+			&ast.ResetOffsetsStmt{DataSourceName: "sensor", Position: "timestamp", Timestamp: "2024-01-31 12:00:00+00"}},
+		{"ALTER DATA SOURCE sensor RESET OFFSETS FOR TOPIC 'metadb_sensor_1.public.patron' TO EARLIEST;",
+			&ast.ResetOffsetsStmt{DataSourceName: "sensor", Topic: "metadb_sensor_1.public.patron", Position: "earliest"}},
+	}
+	for _, c := range cases {
+		node, err, _ := Parse(c.input)
+		if err != nil {
+			t.Errorf("%s: %v", c.input, err)
+			continue
+		}
+		if got, ok := node.(*ast.ResetOffsetsStmt); !ok || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %#v; want %#v", c.input, node, c.want)
+		}
+	}
+	for _, s := range []string{
+		"ALTER DATA SOURCE sensor RESET OFFSETS;",
+		"ALTER DATA SOURCE sensor RESET OFFSETS TO TIMESTAMP;",
+		"ALTER DATA SOURCE sensor RESET OFFSETS TO 100;",
+		"ALTER DATA SOURCE sensor RESET OFFSETS FOR TOPIC patron TO LATEST;",
+	} {
+		if _, err, _ := Parse(s); err == nil {
+			t.Errorf("%s: got success; want error", s)
+		}
+	}
+}
@@ -60,6 +60,8 @@ func (lex *lexer) Lex(out *yySymType) int {
 			'drop'i => { tok = DROP; fbreak; };
 			'type'i => { tok = TYPE; fbreak; };
 			'authorize'i => { tok = AUTHORIZE; fbreak; };
+			'deauthorize'i => { tok = DEAUTHORIZE; fbreak; };
+			'from'i => { tok = FROM; fbreak; };
 			'on'i => { tok = ON; fbreak; };
 			'all'i => { tok = ALL; fbreak; };
 			'table'i => { tok = TABLE; fbreak; };
@@ -76,6 +78,25 @@ func (lex *lexer) Lex(out *yySymType) int {
 			'types'i => { tok = TYPES; fbreak; };
 			'version'i => { out.str = "version"; tok = VERSION; fbreak; };
 			'verify'i => { tok = VERIFY; fbreak; };
+			'masking'i => { out.str = "masking"; tok = MASKING; fbreak; };
+			'policy'i => { out.str = "policy"; tok = POLICY; fbreak; };
+			'using'i => { out.str = "using"; tok = USING; fbreak; };
+			'json'i => { out.str = "json"; tok = JSON; fbreak; };
+			'transform'i => { out.str = "transform"; tok = TRANSFORM; fbreak; };
+			'replay'i => { out.str = "replay"; tok = REPLAY; fbreak; };
+			'purge'i => { out.str = "purge"; tok = PURGE; fbreak; };
+			'dead'i => { out.str = "dead"; tok = DEAD; fbreak; };
+			'letter'i => { out.str = "letter"; tok = LETTER; fbreak; };
+			'letters'i => { out.str = "letters"; tok = LETTERS; fbreak; };
+			'reset'i => { out.str = "reset"; tok = RESET; fbreak; };
+			'offsets'i => { out.str = "offsets"; tok = OFFSETS; fbreak; };
+			'earliest'i => { out.str = "earliest"; tok = EARLIEST; fbreak; };
+			'latest'i => { out.str = "latest"; tok = LATEST; fbreak; };
+			'timestamp'i => { out.str = "timestamp"; tok = TIMESTAMP; fbreak; };
+			'for'i => { out.str = "for"; tok = FOR; fbreak; };
+			'topic'i => { out.str = "topic"; tok = TOPIC; fbreak; };
+			'pause'i => { out.str = "pause"; tok = PAUSE; fbreak; };
+			'resume'i => { out.str = "resume"; tok = RESUME; fbreak; };
 			identifier => { out.str = string(lex.data[lex.ts:lex.te]); tok = IDENT; fbreak; };
 			sliteral => { out.str = string(lex.data[lex.ts+1:lex.te-1]); tok = SLITERAL; fbreak; };
 			digit+ => { out.str = string(lex.data[lex.ts:lex.te]); tok = NUMBER; fbreak; };
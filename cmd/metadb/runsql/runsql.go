@@ -16,6 +16,7 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
@@ -25,7 +26,7 @@ func RunSQL(datadir string, cat *catalog.Catalog, db dbx.DB, url, ref, path, sch
 		return err
 	}
 	defer dbx.Close(dc)
-	users, err := catalog.AllUsers(dc)
+	users, err := sysdb.AllTablesUsers(dc)
 	if err != nil {
 		return err
 	}
@@ -7,27 +7,58 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 )
 
 type execbuffer struct {
-	ctx context.Context
-	dp  *pgxpool.Pool
+	ctx   context.Context
+	dp    *pgxpool.Pool
+	cat   *catalog.Catalog
+	dedup *log.MessageSet
 	// syncIDs is a map of buffered IDs ready for COPY to sync tables.
 	syncIDs map[dbx.Table][][]any
-	// mergeData is a slice of buffered update-insert SQL statement pairs.
-	mergeData map[dbx.Table][][]string
-	syncMode  dsync.Mode
+	// merges is a slice of buffered merge commands, in the order they were
+	// queued.
+	merges   []*mergeEntry
+	syncMode dsync.Mode
+	// source is the name of the data source, and offsets contains the
+	// positions in the source of the commands that have been queued, to
+	// be recorded in the same transaction as the data.
+	source  string
+	offsets map[change.TopicPartition]int64
+	// unflushed contains the commands whose data changes are written by
+	// the next flush, which adds them to commits.
+	unflushed []*command.Command
+	commits   *commitSet
+}
+
+// advance records that the command created from the change event at offset
+// has been queued or executed.
+func (e *execbuffer) advance(offset *change.Offset) {
+	if offset == nil {
+		return
+	}
+	e.offsets[offset.TopicPartition] = offset.Offset + 1
 }
 
 func (e *execbuffer) queueSyncID(table *dbx.Table, id int64) {
 	e.syncIDs[*table] = append(e.syncIDs[*table], []any{id})
 }
 
-func (e *execbuffer) queueMergeData(table *dbx.Table, update, insert *string) {
-	e.mergeData[*table] = append(e.mergeData[*table], []string{*update, *insert})
+// queueMerge queues a merge command.  If cmd is a subcommand, root is the entry
+// for the command it was derived from.
+func (e *execbuffer) queueMerge(cmd *command.Command, root *mergeEntry) *mergeEntry {
+	m := &mergeEntry{
+		cmd:   cmd,
+		table: dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
+		root:  root,
+	}
+	e.merges = append(e.merges, m)
+	return m
 }
 
 func (e *execbuffer) flush() error {
@@ -38,7 +69,7 @@ func (e *execbuffer) flush() error {
 	defer tx.Rollback(e.ctx)
 	// Flush merge data.
 	log.Trace("FLUSH merge data")
-	if err = e.flushMergeData(tx); err != nil {
+	if err = e.flushMerges(tx); err != nil {
 		return fmt.Errorf("flushing exec buffer: writing merge data: %v", err)
 	}
 	// Flush sync IDs.
@@ -46,72 +77,43 @@ func (e *execbuffer) flush() error {
 	if err = e.flushSyncIDs(tx); err != nil {
 		return fmt.Errorf("flushing exec buffer: writing to sync tables: %v", err)
 	}
+	// Record the positions in the source.
+	if err = catalog.WriteKafkaOffsets(tx, e.source, e.offsets); err != nil {
+		return fmt.Errorf("flushing exec buffer: %v", err)
+	}
 	log.Trace("FLUSH commit")
 	if err = tx.Commit(e.ctx); err != nil {
 		return fmt.Errorf("flushing exec buffer: commit: %v", err)
 	}
+	clear(e.offsets)
+	if e.commits != nil {
+		e.commits.add(e.unflushed)
+	}
+	e.unflushed = nil
 	return nil
 }
 
 func (e *execbuffer) flushSyncIDs(tx pgx.Tx) error {
 	for t, a := range e.syncIDs {
-		synct := catalog.SyncTable(&t)
-		copyCount, err := tx.CopyFrom(
-			e.ctx,
-			pgx.Identifier{synct.Schema, synct.Table},
-			[]string{"__id"},
-			pgx.CopyFromRows(a),
-		)
-		if err != nil {
-			return fmt.Errorf("copy to sync table: %v", err)
+		if err := copySyncIDs(e.ctx, tx, &t, a); err != nil {
+			return err
 		}
-		log.Trace("copy %d rows to table %q", copyCount, synct)
 	}
 	e.syncIDs = make(map[dbx.Table][][]any) // Clear buffers.
 	return nil
 }
 
-func (e *execbuffer) flushMergeData(tx pgx.Tx) error {
-	batchSize := 100
-	for t, a := range e.mergeData {
-		lena := len(a)
-		for i := 0; i < lena; i += batchSize {
-			batchEndIndex := min(i+batchSize, lena)
-			actualBatchSize := batchEndIndex - i
-			batch := pgx.Batch{}
-			ids := make([][]any, actualBatchSize)
-			for j := range ids {
-				ids[j] = []any{0}
-			}
-			for k := i; k < batchEndIndex; k++ {
-				// Queue UPDATE.
-				batch.Queue(a[k][0])
-				// Queue INSERT.
-				p := &(ids[k-i][0])
-				batch.Queue(a[k][1]).QueryRow(func(row pgx.Row) error {
-					return row.Scan(p)
-				})
-			}
-			if err := tx.SendBatch(e.ctx, &batch).Close(); err != nil {
-				return fmt.Errorf("update and insert: %v", err)
-			}
-			// If resync mode, flush IDs to sync table.
-			if e.syncMode == dsync.Resync {
-				//e.queueSyncID(&t, id)
-				synct := catalog.SyncTable(&t)
-				copyCount, err := tx.CopyFrom(
-					e.ctx,
-					pgx.Identifier{synct.Schema, synct.Table},
-					[]string{"__id"},
-					pgx.CopyFromRows(ids),
-				)
-				if err != nil {
-					return fmt.Errorf("copy to sync table: %v", err)
-				}
-				log.Trace("copy %d rows to table %q", copyCount, synct)
-			}
-		}
+func copySyncIDs(ctx context.Context, tx pgx.Tx, table *dbx.Table, ids [][]any) error {
+	synct := catalog.SyncTable(table)
+	copyCount, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{synct.Schema, synct.Table},
+		[]string{"__id"},
+		pgx.CopyFromRows(ids),
+	)
+	if err != nil {
+		return fmt.Errorf("copy to sync table: %v", err)
 	}
-	e.mergeData = make(map[dbx.Table][][]string) // Clear buffers.
+	log.Trace("copy %d rows to table %q", copyCount, synct)
 	return nil
 }
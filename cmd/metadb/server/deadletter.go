@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/jsonx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// deadLetterRetryDelay is the time to wait before the first retry of a batch
+// that could not be written.  The delay increases with each retry.
+const deadLetterRetryDelay = 5 * time.Second
+
+// deadLetters records change events that cannot be parsed or written to the
+// database, and applies the dead letter policy of a data source.
+type deadLetters struct {
+	dq     dbx.Queryable
+	source string
+	policy sysdb.DeadLetterPolicy
+	// stats records the error of the last dead letter.
+	stats *sysdb.SourceStats
+}
+
+// record writes a dead letter for a change event that failed after a number
+// of attempts.  It returns cause if the data source should halt.
+func (d *deadLetters) record(ce *change.Event, attempts int, cause error) error {
+	dl, err := newDeadLetter(d.source, ce, cause)
+	if err != nil {
+		return err
+	}
+	if err = catalog.WriteDeadLetter(d.dq, dl, attempts); err != nil {
+		return err
+	}
+	if d.stats != nil {
+		d.stats.SetError(cause)
+	}
+	if !d.policy.Skip {
+		return cause
+	}
+	log.Warning("source %q: change event skipped and recorded as a dead letter: %v", d.source, cause)
+	return nil
+}
+
+// exec executes cmdgraph using the function exec.  If it fails, it is retried
+// as allowed by the policy, and then the commands that cannot be written are
+// found and recorded as dead letters.  The other commands are written.  Only
+// the commands that were not committed by a failed execution are executed
+// again, so that no data change is applied twice.
+func (d *deadLetters) exec(ctx context.Context, cmdgraph *command.CommandGraph, exec func(*command.CommandGraph) error) error {
+	err := exec(cmdgraph)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	cmds := make([]*command.Command, 0, cmdgraph.Commands.Len())
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmds = append(cmds, e.Value.(*command.Command))
+	}
+	cmds = pendingCommands(cmds, err)
+	for i := 0; err != nil && i < d.policy.Retries; i++ {
+		log.Warning("source %q: executor: %v (retry %d of %d)", d.source, err, i+1, d.policy.Retries)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(i+1) * deadLetterRetryDelay):
+		}
+		if err = exec(newCommandGraph(cmds)); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			cmds = pendingCommands(cmds, err)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	return d.bisect(ctx, cmds, d.policy.Retries+1, err, exec)
+}
+
+// bisect finds the commands in cmds that cannot be written, given that
+// executing all of them failed with cause.  The commands are split in halves,
+// which are executed in order, and the commands of a half that fails which
+// were not committed are split again.
+func (d *deadLetters) bisect(ctx context.Context, cmds []*command.Command, attempts int, cause error, exec func(*command.CommandGraph) error) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	if len(cmds) == 1 {
+		return d.record(cmds[0].Event, attempts, fmt.Errorf("executor: %v", cause))
+	}
+	m := len(cmds) / 2
+	for _, half := range [][]*command.Command{cmds[:m], cmds[m:]} {
+		if err := exec(newCommandGraph(half)); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			if err = d.bisect(ctx, pendingCommands(half, err), attempts, err, exec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newCommandGraph returns a command graph containing cmds.
+func newCommandGraph(cmds []*command.Command) *command.CommandGraph {
+	cmdgraph := command.NewCommandGraph()
+	for _, cmd := range cmds {
+		cmdgraph.Commands.PushBack(cmd)
+	}
+	return cmdgraph
+}
+
+// replayDeadLetters applies the dead letters of a data source that have been
+// marked to be replayed.  A dead letter is removed if it is applied, and
+// otherwise its error is updated.
+func replayDeadLetters(ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, infer *jsonx.TypeInference) error {
+	letters, err := catalog.ReadReplayDeadLetters(spr.svr.dp, spr.source.Name)
+	if err != nil {
+		return err
+	}
+	for _, dl := range letters {
+		if err = replayDeadLetter(ctx, cat, spr, syncMode, dedup, infer, dl); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Warning("source %q: replaying dead letter %d: %v", spr.source.Name, dl.ID, err)
+			if err = catalog.FailDeadLetter(spr.svr.dp, dl.ID, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Info("source %q: replayed dead letter %d", spr.source.Name, dl.ID)
+		if err = catalog.DeleteDeadLetter(spr.svr.dp, dl.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replayDeadLetter(ctx context.Context, cat *catalog.Catalog, spr *sproc, syncMode dsync.Mode, dedup *log.MessageSet, infer *jsonx.TypeInference, dl *catalog.DeadLetter) error {
+	ce, err := deadLetterEvent(dl)
+	if err != nil {
+		return err
+	}
+	c, _, err := command.NewCommand(dedup, ce, &spr.sourceOptions)
+	if err != nil {
+		return fmt.Errorf("parsing command: %v", err)
+	}
+	if c == nil || c.Op == command.HeartbeatOp || c.Op == command.SchemaChangeOp {
+		return nil
+	}
+	cmdgraph := command.NewCommandGraph()
+	cmdgraph.Commands.PushBack(c)
+	if err = rewriteCommandGraph(cat, cmdgraph, spr.svr.dp, spr.svr.db.JSONDepth, infer); err != nil {
+		return fmt.Errorf("rewriter: %v", err)
+	}
+	if err = maskCommandGraph(cmdgraph, spr.svr.dp, dedup); err != nil {
+		return fmt.Errorf("masking: %v", err)
+	}
+	if err = execCommandGraph(ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, syncMode, dedup, 1); err != nil {
+		return fmt.Errorf("executor: %v", err)
+	}
+	return nil
+}
+
+// newDeadLetter creates a dead letter from a change event that failed with
+// cause.
+func newDeadLetter(source string, ce *change.Event, cause error) (*catalog.DeadLetter, error) {
+	key, err := json.Marshal(ce.Key)
+	if err != nil {
+		return nil, fmt.Errorf("dead letter: encoding key: %v", err)
+	}
+	value, err := json.Marshal(ce.Value)
+	if err != nil {
+		return nil, fmt.Errorf("dead letter: encoding value: %v", err)
+	}
+	return &catalog.DeadLetter{
+		Source: source,
+		Offset: ce.Offset,
+		Key:    string(key),
+		Value:  string(value),
+		Error:  cause.Error(),
+	}, nil
+}
+
+// deadLetterEvent recreates the change event recorded in a dead letter.  The
+// event has no offset, so that replaying it does not change the recorded
+// position in the source.
+func deadLetterEvent(dl *catalog.DeadLetter) (*change.Event, error) {
+	ce, err := change.NewEvent(&kafka.Message{Key: []byte(dl.Key), Value: []byte(dl.Value)})
+	if err != nil {
+		return nil, err
+	}
+	if dl.Offset != nil {
+		topic := dl.Offset.Topic
+		ce.Topic = &topic
+	}
+	return ce, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+func TestDeadLetterEvent(t *testing.T) {
+	topic := "metadb.library.public.patron"
+	ce, err := change.NewEvent(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 17},
+		Key:            []byte(`{"schema":{"type":"struct","fields":[{"type":"int32","field":"id"}]},"payload":{"id":1}}`),
+		Value:          []byte(`{"payload":{"op":"c","after":{"id":1,"name":"a"}}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl, err := newDeadLetter("sensor", ce, errors.New("failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.Source != "sensor" || dl.Error != "failed" || dl.Offset != ce.Offset {
+		t.Errorf("newDeadLetter() = %+v", dl)
+	}
+	got, err := deadLetterEvent(dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != nil {
+		t.Errorf("replayed event has offset %v; want none", *got.Offset)
+	}
+	if got.Topic == nil || *got.Topic != topic {
+		t.Errorf("replayed event topic = %v; want %q", got.Topic, topic)
+	}
+	if !reflect.DeepEqual(got.Key, ce.Key) || !reflect.DeepEqual(got.Value, ce.Value) {
+		t.Errorf("replayed event = %v; want %v", *got, *ce)
+	}
+}
+
+func TestDeadLetterRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &deadLetters{source: "sensor", policy: sysdb.DeadLetterPolicy{Retries: 3}}
+	var calls int
+	exec := func(*command.CommandGraph) error {
+		calls++
+		return errors.New("failed")
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if err := d.exec(ctx, command.NewCommandGraph(), exec); err == nil {
+		t.Errorf("exec() returned success; want error")
+	}
+	if elapsed := time.Since(start); elapsed >= deadLetterRetryDelay {
+		t.Errorf("exec() returned after %v; want return on cancel", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("exec() called %d times; want 1", calls)
+	}
+}
+
+func TestDeadLetterRetryPending(t *testing.T) {
+	a := &command.Command{Op: command.MergeOp, SchemaName: "library", TableName: "patron"}
+	b := &command.Command{Op: command.MergeOp, SchemaName: "library", TableName: "loan"}
+	c := &command.Command{Op: command.MergeOp, SchemaName: "library", TableName: "item"}
+	cmdgraph := newCommandGraph([]*command.Command{a, b, c})
+	d := &deadLetters{source: "sensor"}
+	applied := make(map[*command.Command]int)
+	var calls int
+	exec := func(g *command.CommandGraph) error {
+		calls++
+		if calls == 1 {
+			// The partition containing a is committed, and then
+			// another partition fails.
+			applied[a]++
+			commits := newCommitSet()
+			commits.add([]*command.Command{a})
+			return newExecError(errors.New("failed"), g, commits)
+		}
+		for e := g.Commands.Front(); e != nil; e = e.Next() {
+			applied[e.Value.(*command.Command)]++
+		}
+		return nil
+	}
+	if err := d.exec(context.Background(), cmdgraph, exec); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []*command.Command{a, b, c} {
+		if applied[cmd] != 1 {
+			t.Errorf("command for table %q applied %d times; want 1", cmd.TableName, applied[cmd])
+		}
+	}
+}
+
+func TestPendingCommands(t *testing.T) {
+	a := &command.Command{Op: command.MergeOp}
+	b := &command.Command{Op: command.DeleteOp}
+	cmds := []*command.Command{a, b}
+	commits := newCommitSet()
+	commits.add([]*command.Command{b})
+	err := fmt.Errorf("executor: %w", newExecError(errors.New("failed"), newCommandGraph(cmds), commits))
+	if got := pendingCommands(cmds, err); !reflect.DeepEqual(got, []*command.Command{a}) {
+		t.Errorf("pendingCommands() = %v; want [%v]", got, a)
+	}
+	if got := pendingCommands(cmds, errors.New("failed")); !reflect.DeepEqual(got, cmds) {
+		t.Errorf("pendingCommands() = %v; want %v", got, cmds)
+	}
+}
@@ -2,101 +2,279 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/internal/uuid"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
 	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 )
 
-func execCommandGraph(ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, dp *pgxpool.Pool, source string, syncMode dsync.Mode, dedup *log.MessageSet) error {
+// execCommandGraph executes the commands in cmdgraph using up to workers
+// concurrent workers.  The commands are partitioned by table, and all commands
+// for a table are executed in order by a single worker, so that changes to the
+// same record are applied in the order they were read.  Each worker writes its
+// data changes in its own transactions.  When execCommandGraph returns without
+// an error, all of the data changes have been committed, and the source can
+// safely commit its read position.  If a worker fails, the commands that other
+// workers or earlier transactions have already committed are not rolled back,
+// and the error is an *execError listing the commands that were not committed.
+func execCommandGraph(ctx context.Context, cat *catalog.Catalog, cmdgraph *command.CommandGraph, dp *pgxpool.Pool, source string, syncMode dsync.Mode, dedup *log.MessageSet, workers int) error {
 	if cmdgraph.Commands.Len() == 0 {
 		return nil
 	}
-	ebuf := &execbuffer{
-		ctx:       ctx,
-		dp:        dp,
-		syncIDs:   make(map[dbx.Table][][]any),
-		mergeData: make(map[dbx.Table][][]string),
-		syncMode:  syncMode,
-	}
 	txnTime := time.Now()
+	parts := partitionCommands(cmdgraph)
+	if workers > len(parts) {
+		workers = len(parts)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	// If a worker fails, the context is canceled to stop the others.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	partc := make(chan []*command.Command)
+	errc := make(chan error, workers)
+	commits := newCommitSet()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := execWorker(ctx, cat, partc, dp, source, syncMode, dedup, commits); err != nil {
+				errc <- err
+				cancel()
+			}
+		}()
+	}
+send:
+	for _, p := range parts {
+		select {
+		case partc <- p:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(partc)
+	wg.Wait()
+	close(errc)
+	if err := <-errc; err != nil {
+		return newExecError(err, cmdgraph, commits)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("exec command list: %v", err)
+	}
+	log.Trace("=================================================================")
+	log.Trace("exec: %d records %s", cmdgraph.Commands.Len(), fmt.Sprintf("[%.4f s]", time.Since(txnTime).Seconds()))
+	log.Trace("=================================================================")
+	return nil
+}
+
+// execError is returned by execCommandGraph if commands could not be written.
+type execError struct {
+	err error
+	// pending lists the commands that were not committed, in their
+	// original order.
+	pending []*command.Command
+}
+
+func (e *execError) Error() string {
+	return e.err.Error()
+}
+
+func (e *execError) Unwrap() error {
+	return e.err
+}
+
+// newExecError returns an *execError for err, listing the commands in cmdgraph
+// that are not in commits.
+func newExecError(err error, cmdgraph *command.CommandGraph, commits *commitSet) *execError {
+	var pending []*command.Command
 	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
 		cmd := e.Value.(*command.Command)
-		if log.IsLevelTrace() {
-			logTraceCommand(cmd)
+		if !commits.contains(cmd) {
+			pending = append(pending, cmd)
 		}
-		match, err := execCommand(ebuf, cat, cmd, source, syncMode, dedup)
-		if err != nil {
-			return fmt.Errorf("exec command: %v", err)
+	}
+	return &execError{err: err, pending: pending}
+}
+
+// pendingCommands returns the commands in cmds that were not committed by an
+// execution that failed with err.  If err does not list the pending commands,
+// all of cmds are returned.
+func pendingCommands(cmds []*command.Command, err error) []*command.Command {
+	var e *execError
+	if errors.As(err, &e) {
+		return e.pending
+	}
+	return cmds
+}
+
+// commitSet records the commands whose data changes have been committed by
+// the workers.
+type commitSet struct {
+	mu   sync.Mutex
+	cmds map[*command.Command]struct{}
+}
+
+func newCommitSet() *commitSet {
+	return &commitSet{cmds: make(map[*command.Command]struct{})}
+}
+
+func (c *commitSet) add(cmds []*command.Command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cmd := range cmds {
+		c.cmds[cmd] = struct{}{}
+	}
+}
+
+func (c *commitSet) contains(cmd *command.Command) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.cmds[cmd]
+	return ok
+}
+
+// partitionCommands groups the commands in cmdgraph by table, in the order in
+// which the tables first appear.  Subcommands write to tables derived from
+// their command's table, and they remain attached to the command.  Groups that
+// contain change events from the same Kafka topic partition are joined, so
+// that the position in each topic partition is recorded by a single worker.
+func partitionCommands(cmdgraph *command.CommandGraph) [][]*command.Command {
+	var parent []int
+	find := func(g int) int {
+		for parent[g] != g {
+			g = parent[g]
+		}
+		return g
+	}
+	tables := make(map[dbx.Table]int)
+	topicPartitions := make(map[change.TopicPartition]int)
+	var cmds []*command.Command
+	var groups []int
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		table := dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
+		g, ok := tables[table]
+		if !ok {
+			g = len(parent)
+			parent = append(parent, g)
+			tables[table] = g
+		}
+		if cmd.Offset != nil {
+			if h, ok := topicPartitions[cmd.Offset.TopicPartition]; ok {
+				g, h = find(g), find(h)
+				if g < h {
+					parent[h] = g
+				} else {
+					parent[g] = h
+				}
+			} else {
+				topicPartitions[cmd.Offset.TopicPartition] = g
+			}
 		}
-		if cmd.Subcommands == nil {
-			continue
+		cmds = append(cmds, cmd)
+		groups = append(groups, tables[table])
+	}
+	index := make(map[int]int)
+	var parts [][]*command.Command
+	for i, cmd := range cmds {
+		g := find(groups[i])
+		j, ok := index[g]
+		if !ok {
+			j = len(parts)
+			index[g] = j
+			parts = append(parts, nil)
 		}
-		if match {
-			// We match the transformed records only in order to get the IDs to write them to
-			// sync tables.
-			if syncMode == dsync.Resync {
+		parts[j] = append(parts[j], cmd)
+	}
+	return parts
+}
+
+// execWorker executes the groups of commands received from parts until the
+// channel is closed, and then flushes its buffer.  Schema changes are made
+// through the catalog, which serializes them between workers; and the buffer
+// is always flushed before a schema change, so that no transaction is open
+// while the change is made.
+func execWorker(ctx context.Context, cat *catalog.Catalog, parts <-chan []*command.Command, dp *pgxpool.Pool, source string, syncMode dsync.Mode, dedup *log.MessageSet, commits *commitSet) error {
+	ebuf := &execbuffer{
+		commits:  commits,
+		ctx:      ctx,
+		dp:       dp,
+		cat:      cat,
+		dedup:    dedup,
+		syncIDs:  make(map[dbx.Table][][]any),
+		syncMode: syncMode,
+		source:   source,
+		offsets:  make(map[change.TopicPartition]int64),
+	}
+	for cmds := range parts {
+		for _, cmd := range cmds {
+			if log.IsLevelTrace() {
+				logTraceCommand(cmd)
+			}
+			root, err := execCommand(ebuf, cat, cmd, nil, source)
+			if err != nil {
+				return fmt.Errorf("exec command: %v", err)
+			}
+			if cmd.Subcommands != nil {
+				// Subcommands are queued together with the
+				// command.  If the command turns out to match the
+				// current record, the subcommands are not written.
 				for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
 					tcmd := f.Value.(*command.Command)
-					table := &dbx.Table{Schema: tcmd.SchemaName, Table: tcmd.TableName}
-					delta, err := findDeltaSchema(cat, tcmd, table)
-					if err != nil {
-						return fmt.Errorf("finding schema delta: %v", err)
-					}
-					if err = execDeltaSchema(ebuf, cat, tcmd, delta, table); err != nil {
-						return fmt.Errorf("schema: %v", err)
-					}
-					m, id, err := isCurrentIdenticalMatch(ebuf.ctx, tcmd, ebuf.dp, table)
-					if err != nil {
-						return fmt.Errorf("matcher: %v", err)
-					}
-					if m {
-						ebuf.queueSyncID(table, id)
+					if _, err := execCommand(ebuf, cat, tcmd, root, source); err != nil {
+						return fmt.Errorf("exec command: %v", err)
 					}
 				}
 			}
-		} else {
-			for f := cmd.Subcommands.Front(); f != nil; f = f.Next() {
-				if _, err := execCommand(ebuf, cat, f.Value.(*command.Command), source, syncMode, dedup); err != nil {
-					return fmt.Errorf("exec command: %v", err)
-				}
+			ebuf.advance(cmd.Offset)
+			if cmd.Op == command.MergeOp {
+				ebuf.unflushed = append(ebuf.unflushed, cmd)
+			} else {
+				// Deletions and truncations are executed
+				// directly, after the buffer has been flushed.
+				commits.add([]*command.Command{cmd})
 			}
 		}
 	}
 	if err := ebuf.flush(); err != nil {
 		return fmt.Errorf("exec command list: %v", err)
 	}
-	log.Trace("=================================================================")
-	log.Trace("exec: %d records %s", cmdgraph.Commands.Len(), fmt.Sprintf("[%.4f s]", time.Since(txnTime).Seconds()))
-	log.Trace("=================================================================")
 	return nil
 }
 
-func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, source string, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
+// execCommand makes any schema changes needed by a command and queues or
+// executes the data changes.  For a merge command, the queued entry is
+// returned.  If cmd is a subcommand, root is the entry for its root command.
+func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, root *mergeEntry, source string) (*mergeEntry, error) {
 	// Make schema changes if needed by the command.
 	if cmd.Op == command.MergeOp {
 		table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
 		delta, err := findDeltaSchema(cat, cmd, table)
 		if err != nil {
-			return false, fmt.Errorf("finding schema delta: %v", err)
+			return nil, fmt.Errorf("finding schema delta: %v", err)
 		}
 		if err = addTable(ebuf, cmd, cat, table, source); err != nil {
-			return false, fmt.Errorf("schema: %v", err)
+			return nil, fmt.Errorf("schema: %v", err)
 		}
 		if err = addPartition(ebuf, cat, cmd); err != nil {
-			return false, fmt.Errorf("schema: %v", err)
+			return nil, fmt.Errorf("schema: %v", err)
 		}
 		// Note that execDeltaSchema() may adjust data types in cmd.
 		if err = execDeltaSchema(ebuf, cat, cmd, delta, table); err != nil {
-			return false, fmt.Errorf("schema: %v", err)
+			return nil, fmt.Errorf("schema: %v", err)
 		}
 		// Ensure indexes are created on primary key columns.
 		for _, col := range cmd.Column {
@@ -106,19 +284,19 @@ func execCommand(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, s
 					continue
 				}
 				if err = ebuf.flush(); err != nil {
-					return false, fmt.Errorf("creating indexes: %v", err)
+					return nil, fmt.Errorf("creating indexes: %v", err)
 				}
 				if err = cat.AddIndex(column); err != nil {
-					return false, err
+					return nil, err
 				}
 			}
 		}
 	}
-	match, err := execCommandData(ebuf, cat, cmd, syncMode, dedup)
+	m, err := execCommandData(ebuf, cat, cmd, root)
 	if err != nil {
-		return false, fmt.Errorf("exec data: %v", err)
+		return nil, fmt.Errorf("exec data: %v", err)
 	}
-	return match, nil
+	return m, nil
 }
 
 func findDeltaSchema(cat *catalog.Catalog, cmd *command.Command, table *dbx.Table) (*deltaSchema, error) {
@@ -288,262 +466,36 @@ func execDeltaSchema(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comman
 			if err := alterColumnType(ebuf.dp, cat, table, col.name, command.TextType, 0, false); err != nil {
 				return fmt.Errorf("delta schema: altering column %q (%q) type to %v: %v", table, col.name, command.TextType, err)
 			}
+			// Adjust the data type in the command to match.
+			for j := range cmd.Column {
+				if cmd.Column[j].Name == col.name {
+					cmd.Column[j].DType = command.TextType
+					cmd.Column[j].DTypeSize = 0
+					break
+				}
+			}
 		}
 	}
 	return nil
 }
 
-func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
+func execCommandData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command, root *mergeEntry) (*mergeEntry, error) {
 	switch cmd.Op {
 	case command.MergeOp:
-		match, err := execMergeData(ebuf, cmd, syncMode, dedup)
-		if err != nil {
-			return false, fmt.Errorf("merge: %v", err)
-		}
-		return match, nil
+		return ebuf.queueMerge(cmd, root), nil
 	case command.DeleteOp:
 		if err := execDeleteData(ebuf, cat, cmd); err != nil {
-			return false, fmt.Errorf("delete: %v", err)
+			return nil, fmt.Errorf("delete: %v", err)
 		}
-		return false, nil
+		return nil, nil
 	case command.TruncateOp:
 		if err := execTruncateData(ebuf, cat, cmd); err != nil {
-			return false, fmt.Errorf("truncate: %v", err)
+			return nil, fmt.Errorf("truncate: %v", err)
 		}
-		return false, nil
+		return nil, nil
 	default:
-		return false, fmt.Errorf("unknown command op: %v", cmd.Op)
-	}
-}
-
-// execMergeData executes a merge command in the database.
-func execMergeData(ebuf *execbuffer, cmd *command.Command, syncMode dsync.Mode, dedup *log.MessageSet) (bool, error) {
-	table := &dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
-	// Check if the current record (if any) is identical to the new one.  If so, we
-	// can avoid making any changes in the database.
-	match, id, err := isCurrentIdenticalMatch(ebuf.ctx, cmd, ebuf.dp, table)
-	if err != nil {
-		return false, fmt.Errorf("matcher: %v", err)
-	}
-	if match {
-		log.Trace("new command matches current record")
-		// If resync mode, write __id to sync table.
-		if syncMode == dsync.Resync {
-			ebuf.queueSyncID(table, id)
-		}
-		return true, nil
-	}
-	primaryKeyFilter := wherePKDataEqualSQL(cmd.Column)
-	// If any columns are "unavailable," extract the previous values from the current record.
-	unavailColumns := make([]*command.CommandColumn, 0)
-	columns := cmd.Column
-	for i := range columns {
-		if columns[i].Unavailable {
-			unavailColumns = append(unavailColumns, &(columns[i]))
-		}
+		return nil, fmt.Errorf("unknown command op: %v", cmd.Op)
 	}
-	if len(unavailColumns) != 0 {
-		var b strings.Builder
-		b.WriteString("SELECT ")
-		for i := range unavailColumns {
-			if i != 0 {
-				b.WriteByte(',')
-			}
-			b.WriteByte('"')
-			b.WriteString(unavailColumns[i].Name)
-			b.WriteString("\"::text")
-		}
-		b.WriteString(" FROM \"")
-		b.WriteString(table.Schema)
-		b.WriteString("\".\"")
-		b.WriteString(table.Table)
-		b.WriteString("\" WHERE __origin='")
-		b.WriteString(cmd.Origin)
-		b.WriteString("'")
-		b.WriteString(primaryKeyFilter)
-		b.WriteString(" LIMIT 1")
-		var rows pgx.Rows
-		rows, err = ebuf.dp.Query(context.TODO(), b.String())
-		if err != nil {
-			return false, fmt.Errorf("querying for unavailable data: %v", err)
-		}
-		defer rows.Close()
-		lenColumns := len(unavailColumns)
-		dest := make([]any, lenColumns)
-		values := make([]any, lenColumns)
-		for i := range values {
-			dest[i] = &(values[i])
-		}
-		found := false
-		for rows.Next() {
-			found = true
-			if err = rows.Scan(dest...); err != nil {
-				return false, fmt.Errorf("scanning row values: %v", err)
-			}
-		}
-		if err = rows.Err(); err != nil {
-			return false, fmt.Errorf("reading matching current row: %v", err)
-		}
-		rows.Close()
-		if !found {
-			msg := fmt.Sprintf("no current value for unavailable data in table %q", table)
-			if dedup.Insert(msg) {
-				log.Warning("%s", msg)
-			}
-		} else {
-			for i := range unavailColumns {
-				if values[i] == nil {
-					msg := fmt.Sprintf("nil value in replacing unavailable data in table %q", table)
-					if dedup.Insert(msg) {
-						log.Warning("%s", msg)
-					}
-					continue
-				}
-				s := values[i].(string)
-				unavailColumns[i].SQLData = &s
-				log.Trace("found current value for unavailable data in table %q, column %q", table, unavailColumns[i].Name)
-				break
-			}
-		}
-	}
-	// Set the current row, if any, to __current=FALSE.
-	var b strings.Builder
-	b.WriteString("UPDATE \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("__\" SET __end='")
-	b.WriteString(cmd.SourceTimestamp)
-	b.WriteString("',__current='f'")
-	b.WriteString(" WHERE __current AND __origin='")
-	b.WriteString(cmd.Origin)
-	b.WriteByte('\'')
-	b.WriteString(primaryKeyFilter)
-	update := b.String()
-	// Insert the new row.
-	b.Reset()
-	b.WriteString("INSERT INTO \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("__\"(__start,__end,__current")
-	if cmd.Origin != "" {
-		b.WriteString(",__origin")
-	}
-	for i := range columns {
-		b.WriteString(",\"")
-		b.WriteString(columns[i].Name)
-		b.WriteByte('"')
-	}
-	b.WriteString(")VALUES('")
-	b.WriteString(cmd.SourceTimestamp)
-	b.WriteString("','9999-12-31 00:00:00Z','t'")
-	if cmd.Origin != "" {
-		b.WriteString(",'")
-		b.WriteString(cmd.Origin)
-		b.WriteByte('\'')
-	}
-	for i := range columns {
-		b.WriteString(",")
-		encodeSQLData(&b, columns[i].SQLData, columns[i].DType)
-	}
-	b.WriteString(") RETURNING __id")
-	insert := b.String()
-	ebuf.queueMergeData(table, &update, &insert)
-	return false, nil
-}
-
-// isCurrentIdentical looks for an identical row in the current table.
-func isCurrentIdenticalMatch(ctx context.Context, cmd *command.Command, tx *pgxpool.Pool, table *dbx.Table) (bool, int64, error) {
-	// Match on all columns, except "unavailable" columns (which indicates a column
-	// did not change and we can assume it matches).
-	var b strings.Builder
-	b.WriteString("SELECT * FROM \"")
-	b.WriteString(table.Schema)
-	b.WriteString("\".\"")
-	b.WriteString(table.Table)
-	b.WriteString("\" WHERE __origin='")
-	b.WriteString(cmd.Origin)
-	b.WriteByte('\'')
-	columns := cmd.Column
-	for i := range columns {
-		if columns[i].Unavailable {
-			continue
-		}
-		b.WriteString(" AND \"")
-		b.WriteString(columns[i].Name)
-		if columns[i].Data == nil {
-			b.WriteString("\" IS NULL")
-		} else {
-			b.WriteString("\"=")
-			encodeSQLData(&b, columns[i].SQLData, columns[i].DType)
-		}
-	}
-	b.WriteString(" LIMIT 1")
-	rows, err := tx.Query(ctx, b.String())
-	if err != nil {
-		return false, 0, fmt.Errorf("querying for matching current row: %v", err)
-	}
-	defer rows.Close()
-	columnNames := make([]string, 0)
-	fields := rows.FieldDescriptions()
-	for i := range fields {
-		columnNames = append(columnNames, fields[i].Name)
-	}
-	lenColumns := len(columnNames)
-	found := false
-	dest := make([]any, lenColumns)
-	values := make([]any, lenColumns)
-	for i := range dest {
-		dest[i] = &(values[i])
-	}
-	for rows.Next() {
-		found = true
-		if err = rows.Scan(dest...); err != nil {
-			return false, 0, fmt.Errorf("scanning row values: %v", err)
-		}
-	}
-	if err = rows.Err(); err != nil {
-		return false, 0, fmt.Errorf("reading matching current row: %v", err)
-	}
-	rows.Close()
-	if !found {
-		return false, 0, nil
-	}
-	// If any extra column values are not NULL, there is no match.
-	columnMap := buildColumnMap(cmd.Column)
-	var id int64
-	for i := range values {
-		if columnNames[i] == "__id" {
-			var ok bool
-			id, ok = values[i].(int64)
-			if !ok {
-				return false, 0, fmt.Errorf("error in type assertion of \"__id\" to int64")
-			}
-			continue
-		}
-		if strings.HasPrefix(columnNames[i], "__") {
-			continue
-		}
-		_, ok := columnMap[columnNames[i]]
-		if ok {
-			continue
-		}
-		// This is an extra column.
-		if values[i] != nil {
-			return false, 0, nil
-		}
-	}
-	// Otherwise we have found a match.
-	return true, id, nil
-}
-
-func buildColumnMap(columns []command.CommandColumn) map[string]*command.CommandColumn {
-	m := make(map[string]*command.CommandColumn)
-	for i := range columns {
-		m[columns[i].Name] = &(columns[i])
-	}
-	return m
 }
 
 func execDeleteData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command) error {
@@ -552,14 +504,20 @@ func execDeleteData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command
 	if err := ebuf.flush(); err != nil {
 		return fmt.Errorf("exec delete data: %v", err)
 	}
-	primaryKeyFilter := wherePKDataEqualSQL(cmd.Column)
+	var p params
+	var b strings.Builder
+	b.WriteString(" SET __end=" + p.add(cmd.SourceTimestamp) + ",__current=FALSE WHERE __current AND __origin=" +
+		p.add(cmd.Origin))
+	types := cat.TableSchema(&dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName})
+	if err := wherePKDataEqual(&b, &p, cmd.Column, types); err != nil {
+		return fmt.Errorf("exec delete data: %v", err)
+	}
+	set := b.String()
 	// Find matching current records in table and descendants, and mark as not current.
 	batch := pgx.Batch{}
 	cat.TraverseDescendantTables(dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
 		func(table dbx.Table) {
-			batch.Queue("UPDATE " + table.MainSQL() +
-				" SET __end='" + cmd.SourceTimestamp + "',__current=FALSE WHERE __current AND __origin='" +
-				cmd.Origin + "'" + primaryKeyFilter)
+			batch.Queue("UPDATE "+table.MainSQL()+set, p.args...)
 		})
 	if err := ebuf.dp.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
 		return fmt.Errorf("exec delete data: %v", err)
@@ -567,46 +525,25 @@ func execDeleteData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command
 	return nil
 }
 
-func wherePKDataEqualSQL(columns []command.CommandColumn) string {
-	var b strings.Builder
+// wherePKDataEqual writes conditions that match the primary key data in
+// columns, adding the data to p.  The types of the columns in the database are
+// given by types.
+func wherePKDataEqual(b *strings.Builder, p *params, columns []command.CommandColumn, types map[string]string) error {
 	for _, c := range columns {
-		if c.PrimaryKey != 0 {
-			b.WriteString(" AND")
-			if c.DType == command.JSONType {
-				b.WriteString(" \"")
-				b.WriteString(c.Name)
-				b.WriteString("\"::text=")
-				encodeSQLData(&b, c.SQLData, c.DType)
-				b.WriteString("::text")
-			} else {
-				b.WriteString(" \"")
-				b.WriteString(c.Name)
-				b.WriteString("\"=")
-				encodeSQLData(&b, c.SQLData, c.DType)
-			}
+		if c.PrimaryKey == 0 {
+			continue
+		}
+		v, err := sqlValue(c.SQLData, c.DType, types[c.Name])
+		if err != nil {
+			return fmt.Errorf("column %q: %v", c.Name, err)
+		}
+		if c.DType == command.JSONType {
+			b.WriteString(" AND \"" + c.Name + "\"::text=" + p.add(v) + "::jsonb::text")
+		} else {
+			b.WriteString(" AND \"" + c.Name + "\"=" + p.add(v))
 		}
 	}
-	return b.String()
-}
-
-func encodeSQLData(b *strings.Builder, sqldata *string, datatype command.DataType) {
-	if sqldata == nil {
-		b.WriteString("NULL")
-		return
-	}
-	switch datatype {
-	case command.TextType, command.JSONType:
-		dbx.EncodeString(b, *sqldata)
-	case command.UUIDType, command.DateType, command.TimeType, command.TimetzType, command.TimestampType, command.TimestamptzType:
-		b.WriteByte('\'')
-		b.WriteString(*sqldata)
-		b.WriteByte('\'')
-	case command.IntegerType, command.FloatType, command.NumericType, command.BooleanType:
-		b.WriteString(*sqldata)
-	default:
-		log.Error("encoding SQL data: unknown data type: %s", datatype)
-		b.WriteString("(unknown type)")
-	}
+	return nil
 }
 
 func execTruncateData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Command) error {
@@ -619,8 +556,8 @@ func execTruncateData(ebuf *execbuffer, cat *catalog.Catalog, cmd *command.Comma
 	batch := pgx.Batch{}
 	cat.TraverseDescendantTables(dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName},
 		func(table dbx.Table) {
-			batch.Queue("UPDATE " + table.MainSQL() + " SET __end='" +
-				cmd.SourceTimestamp + "',__current=FALSE WHERE __current AND __origin='" + cmd.Origin + "'")
+			batch.Queue("UPDATE "+table.MainSQL()+" SET __end=$1,__current=FALSE WHERE __current AND __origin=$2",
+				cmd.SourceTimestamp, cmd.Origin)
 		})
 	if err := ebuf.dp.SendBatch(ebuf.ctx, &batch).Close(); err != nil {
 		return fmt.Errorf("exec truncate data: %v", err)
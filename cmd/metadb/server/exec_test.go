@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+)
+
+func TestPartitionCommands(t *testing.T) {
+	cmdgraph := command.NewCommandGraph()
+	a1 := testMergeCommand(1, "a")
+	b1 := testMergeCommand(1, "b")
+	b1.TableName = "loan"
+	a2 := testMergeCommand(2, "c")
+	b2 := &command.Command{Op: command.TruncateOp, SchemaName: "library", TableName: "loan"}
+	a3 := testMergeCommand(1, "d")
+	for _, cmd := range []*command.Command{a1, b1, a2, b2, a3} {
+		cmdgraph.Commands.PushBack(cmd)
+	}
+	checkPartitions(t, partitionCommands(cmdgraph), [][]*command.Command{{a1, a2, a3}, {b1, b2}})
+}
+
+func TestPartitionCommandsTopicPartition(t *testing.T) {
+	offset := func(topic string, partition int32, offset int64) *change.Offset {
+		return &change.Offset{TopicPartition: change.TopicPartition{Topic: topic, Partition: partition}, Offset: offset}
+	}
+	cmdgraph := command.NewCommandGraph()
+	a := testMergeCommand(1, "a")
+	a.Offset = offset("library.patron", 0, 10)
+	b := testMergeCommand(1, "b")
+	b.TableName = "loan"
+	b.Offset = offset("library.loan", 0, 20)
+	c := testMergeCommand(1, "c")
+	c.TableName = "item"
+	c.Offset = offset("library.item", 0, 30)
+	// A table written from the same topic partition as the first table.
+	d := testMergeCommand(1, "d")
+	d.TableName = "fine"
+	d.Offset = offset("library.patron", 0, 11)
+	for _, cmd := range []*command.Command{a, b, c, d} {
+		cmdgraph.Commands.PushBack(cmd)
+	}
+	checkPartitions(t, partitionCommands(cmdgraph), [][]*command.Command{{a, d}, {b}, {c}})
+}
+
+func checkPartitions(t *testing.T, parts, want [][]*command.Command) {
+	t.Helper()
+	if len(parts) != len(want) {
+		t.Fatalf("got %d partitions; want %d", len(parts), len(want))
+	}
+	for i := range want {
+		if len(parts[i]) != len(want[i]) {
+			t.Fatalf("partition %d: got %d commands; want %d", i, len(parts[i]), len(want[i]))
+		}
+		for j := range want[i] {
+			if parts[i][j] != want[i][j] {
+				t.Errorf("partition %d: command %d is %v; want %v", i, j, parts[i][j], want[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// fileSource reads change events from files.  The path may refer to a single
+// file or to a directory, in which case the files in the directory are read in
+// lexical order of their names.  Names beginning with "." are ignored, and
+// files having names ending in ".gz" are decompressed.
+//
+// Each line of a file contains a change event as a JSON object with "key" and
+// "value" fields, which hold the Debezium key and value.  The format written
+// by --logsource, in which a line containing "#" is followed by a key line
+// and a value line, is also accepted.  Empty lines are ignored.
+type fileSource struct {
+	// dir is the directory containing the files, and name is set if only
+	// a single file is to be read.
+	dir  string
+	name string
+	// follow causes the source to wait for new files in the directory at
+	// the end of the last file, rather than returning io.EOF.
+	follow bool
+	// sourceName and dq are used to record the read position in the
+	// catalog.  If dq is nil, the position is not recorded.
+	sourceName string
+	dq         dbx.Queryable
+	sourceLog  *log.SourceLog
+	// fileName is the name of the current file, and offset is the
+	// position after the last event read from it.
+	fileName string
+	offset   int64
+	// resume is set if fileName and offset refer to a recorded position
+	// from which reading should continue.
+	resume bool
+	file   *os.File
+	gz     *gzip.Reader
+	reader *bufio.Reader
+}
+
+func newFileSource(path string, follow bool, sourceName string, dq dbx.Queryable,
+	sourceLog *log.SourceLog) (*fileSource, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSource{
+		follow:     follow,
+		sourceName: sourceName,
+		dq:         dq,
+		sourceLog:  sourceLog,
+	}
+	if fi.IsDir() {
+		s.dir = path
+	} else {
+		s.dir = filepath.Dir(path)
+		s.name = filepath.Base(path)
+	}
+	if dq != nil {
+		if s.fileName, s.offset, err = catalog.ReadFileOffset(dq, sourceName); err != nil {
+			return nil, err
+		}
+		if s.fileName != "" {
+			s.resume = true
+			log.Debug("source %q: resuming at file %q, offset %d", sourceName, s.fileName, s.offset)
+		}
+	}
+	return s, nil
+}
+
+func (s *fileSource) Read(timeout time.Duration) (*change.Event, error) {
+	for {
+		if s.reader == nil {
+			ok, err := s.openNext()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				if !s.follow {
+					return nil, io.EOF
+				}
+				// Wait for new files.
+				time.Sleep(timeout)
+				return nil, nil
+			}
+		}
+		ce, err := s.readEvent()
+		if err == io.EOF {
+			s.closeFile()
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading change event from file %q: %v", s.fileName, err)
+		}
+		return ce, nil
+	}
+}
+
+// openNext opens the next file to be read, and returns false if there is none.
+func (s *fileSource) openNext() (bool, error) {
+	names, err := s.listFiles()
+	if err != nil {
+		return false, err
+	}
+	var next string
+	for _, n := range names {
+		if n > s.fileName || (s.resume && n == s.fileName) {
+			next = n
+			break
+		}
+	}
+	if next == "" {
+		return false, nil
+	}
+	var skip int64
+	if s.resume && next == s.fileName {
+		skip = s.offset
+	}
+	s.resume = false
+	f, err := os.Open(filepath.Join(s.dir, next))
+	if err != nil {
+		return false, err
+	}
+	var r io.Reader = f
+	if strings.HasSuffix(next, ".gz") {
+		if s.gz, err = gzip.NewReader(f); err != nil {
+			_ = f.Close()
+			return false, fmt.Errorf("reading file %q: %v", next, err)
+		}
+		r = s.gz
+	}
+	s.file = f
+	s.reader = bufio.NewReaderSize(r, 1<<20)
+	s.fileName = next
+	s.offset = 0
+	log.Debug("reading file %q", next)
+	if skip > 0 {
+		n, err := io.CopyN(io.Discard, s.reader, skip)
+		s.offset = n
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("reading file %q: %v", next, err)
+		}
+	}
+	return true, nil
+}
+
+func (s *fileSource) listFiles() ([]string, error) {
+	if s.name != "" {
+		return []string{s.name}, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readLine returns the next line without the line terminator, or io.EOF at
+// the end of the file.  A final line need not be terminated.
+func (s *fileSource) readLine() ([]byte, error) {
+	line, err := s.reader.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.offset += int64(len(line))
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// readEvent reads the next change event, or returns io.EOF at the end of the
+// file.
+func (s *fileSource) readEvent() (*change.Event, error) {
+	var line []byte
+	var err error
+	for len(line) == 0 {
+		if line, err = s.readLine(); err != nil {
+			return nil, err
+		}
+	}
+	var key, value []byte
+	if string(line) == "#" {
+		if key, err = s.readLine(); err != nil {
+			return nil, incompleteRead(err)
+		}
+		if value, err = s.readLine(); err != nil {
+			return nil, incompleteRead(err)
+		}
+	} else {
+		var m struct {
+			Key   json.RawMessage `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err = json.Unmarshal(line, &m); err != nil {
+			return nil, fmt.Errorf("offset %d: %v", s.offset-int64(len(line)), err)
+		}
+		key = m.Key
+		value = m.Value
+	}
+	if s.sourceLog != nil {
+		s.sourceLog.Log("#")
+		s.sourceLog.Log(string(key))
+		s.sourceLog.Log(string(value))
+	}
+	return change.NewEvent(&kafka.Message{Key: key, Value: value})
+}
+
+func incompleteRead(err error) error {
+	if err == io.EOF {
+		return fmt.Errorf("incomplete read")
+	}
+	return err
+}
+
+func (s *fileSource) closeFile() {
+	if s.gz != nil {
+		_ = s.gz.Close()
+		s.gz = nil
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+	s.reader = nil
+}
+
+// Commit records the position after the last event read.
+func (s *fileSource) Commit() error {
+	if s.dq == nil || s.fileName == "" {
+		return nil
+	}
+	return catalog.WriteFileOffset(s.dq, s.sourceName, s.fileName, s.offset)
+}
+
+// Idle waits for the timeout to expire.
+func (s *fileSource) Idle(timeout time.Duration) error {
+	time.Sleep(timeout)
+	return nil
+}
+
+func (s *fileSource) Close() error {
+	s.closeFile()
+	return nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testLine(id string) string {
+	return `{"key":{"schema":{"type":"struct","fields":[{"type":"int32","field":"id"}]},"payload":{"id":` + id + `}},` +
+		`"value":{"payload":{"op":"c","after":{"id":` + id + `}}}}` + "\n"
+}
+
+func writeTestFiles(t *testing.T) string {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte(testLine("1")+"\n"+testLine("2")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "b.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	_, _ = gz.Write([]byte("#\n{\"payload\":{\"id\":3}}\n{\"payload\":{\"op\":\"c\",\"after\":{\"id\":3}}}\n" + testLine("4")))
+	_ = gz.Close()
+	_ = f.Close()
+	// Ignored because of the leading ".".
+	if err = os.WriteFile(filepath.Join(dir, ".c.json"), []byte("invalid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readIDs(t *testing.T, s *fileSource, n int) []float64 {
+	var ids []float64
+	for i := 0; i < n; i++ {
+		ce, err := s.Read(time.Millisecond)
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		ids = append(ids, ce.Key.Payload["id"].(float64))
+	}
+	return ids
+}
+
+func TestFileSourceDirectory(t *testing.T) {
+	dir := writeTestFiles(t)
+	s, err := newFileSource(dir, false, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ids := readIDs(t, s, 4)
+	for i, id := range ids {
+		if id != float64(i+1) {
+			t.Errorf("event %d: got id %v; want %d", i, id, i+1)
+		}
+	}
+	if _, err = s.Read(time.Millisecond); err != io.EOF {
+		t.Errorf("got %v; want io.EOF", err)
+	}
+}
+
+func TestFileSourceResume(t *testing.T) {
+	dir := writeTestFiles(t)
+	s, err := newFileSource(dir, false, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = readIDs(t, s, 3)
+	fileName, offset := s.fileName, s.offset
+	_ = s.Close()
+
+	s, err = newFileSource(dir, true, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.fileName, s.offset, s.resume = fileName, offset, true
+	ids := readIDs(t, s, 1)
+	if ids[0] != 4 {
+		t.Errorf("got id %v; want 4", ids[0])
+	}
+	// With follow set, the end of the files is reported as a timeout.
+	ce, err := s.Read(time.Millisecond)
+	if ce != nil || err != nil {
+		t.Errorf("got %v, %v; want nil, nil", ce, err)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/mask"
+)
+
+// maskCommandGraph applies masking policies to the commands before they are
+// executed.  The policies are read for each batch so that changes made with
+// CREATE/DROP MASKING POLICY take effect without restarting the server.
+func maskCommandGraph(cmdgraph *command.CommandGraph, dq dbx.Queryable, dedup *log.MessageSet) error {
+	if cmdgraph.Commands.Len() == 0 {
+		return nil
+	}
+	policies, key, err := catalog.ReadMaskingPolicies(dq)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+	m := mask.NewMasker(key, policies, dedup)
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		if err = m.MaskCommand(e.Value.(*command.Command)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,530 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/jsonx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// mergeBatchSize is the maximum number of rows looked up or written by a
+// single statement.
+const mergeBatchSize = 500
+
+// mergeEntry is a merge command waiting in the exec buffer to be written.
+type mergeEntry struct {
+	cmd   *command.Command
+	table dbx.Table
+	// root is the entry for the command that cmd was derived from, or nil
+	// if cmd is not a subcommand.
+	root *mergeEntry
+	// match is true if the current row in the table is identical to the
+	// command, in which case id is the row's __id.  These are set when the
+	// entry is flushed.
+	match bool
+	id    int64
+}
+
+// flushMerges writes the queued merge commands.  Commands are processed in
+// generations, where each generation contains at most one command for any
+// primary key, so that repeated changes to a record are applied in order.
+// Within a generation, the current rows are looked up and the changes are
+// written using one statement per table for each batch of rows.
+func (e *execbuffer) flushMerges(tx pgx.Tx) error {
+	merges := e.merges
+	e.merges = nil
+	for _, gen := range mergeGenerations(merges) {
+		if err := e.flushMergeGeneration(tx, gen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeGenerations splits merges into generations.  The n-th command for a
+// primary key is placed in generation n, and a subcommand is placed in the same
+// generation as its root command.
+func mergeGenerations(merges []*mergeEntry) [][]*mergeEntry {
+	var gens [][]*mergeEntry
+	count := make(map[string]int)
+	genOf := make(map[*mergeEntry]int)
+	for _, m := range merges {
+		var g int
+		if m.root == nil {
+			key := primaryKeyString(m)
+			g = count[key]
+			count[key] = g + 1
+			genOf[m] = g
+		} else {
+			// If the root command was flushed earlier, this is the
+			// first generation.
+			g = genOf[m.root]
+		}
+		for len(gens) <= g {
+			gens = append(gens, nil)
+		}
+		gens[g] = append(gens[g], m)
+	}
+	return gens
+}
+
+func primaryKeyString(m *mergeEntry) string {
+	var b strings.Builder
+	b.WriteString(m.table.String())
+	b.WriteByte(0)
+	b.WriteString(m.cmd.Origin)
+	for _, c := range command.PrimaryKeyColumns(m.cmd.Column) {
+		b.WriteByte(0)
+		if c.SQLData != nil {
+			b.WriteString(*c.SQLData)
+		}
+	}
+	return b.String()
+}
+
+func (e *execbuffer) flushMergeGeneration(tx pgx.Tx, gen []*mergeEntry) error {
+	// Look up root commands first, because subcommands are skipped if their
+	// root command matches the current row.
+	var roots, subs []*mergeEntry
+	for _, m := range gen {
+		if m.root == nil {
+			roots = append(roots, m)
+		} else if !m.root.match || e.syncMode == dsync.Resync {
+			// If the root command matches, subcommands are only
+			// matched in order to write their IDs to sync tables.
+			subs = append(subs, m)
+		}
+	}
+	if err := e.lookupCurrentRows(tx, roots); err != nil {
+		return err
+	}
+	if err := e.lookupCurrentRows(tx, subs); err != nil {
+		return err
+	}
+	var writes, trims []*mergeEntry
+	for _, m := range append(roots, subs...) {
+		if m.root != nil && m.root.match {
+			if m.match {
+				e.queueSyncID(&m.table, m.id)
+			}
+			continue
+		}
+		if m.match {
+			log.Trace("new command matches current record")
+			if e.syncMode == dsync.Resync {
+				e.queueSyncID(&m.table, m.id)
+			}
+		} else {
+			writes = append(writes, m)
+		}
+		if m.root != nil && m.cmd.Transformed {
+			trims = append(trims, m)
+		}
+	}
+	if err := e.writeMerges(tx, writes); err != nil {
+		return err
+	}
+	if err := e.trimArrayTables(tx, trims); err != nil {
+		return err
+	}
+	return nil
+}
+
+// groupMerges groups entries that have the same table and columns,
+// preserving their order.  If pkOnly is true, only primary key columns are
+// considered.
+func groupMerges(merges []*mergeEntry, pkOnly bool) [][]*mergeEntry {
+	var groups [][]*mergeEntry
+	index := make(map[string]int)
+	var b strings.Builder
+	for _, m := range merges {
+		b.Reset()
+		b.WriteString(m.table.String())
+		for _, c := range m.cmd.Column {
+			if pkOnly && c.PrimaryKey == 0 {
+				continue
+			}
+			b.WriteByte(0)
+			b.WriteString(c.Name)
+			if c.Unavailable {
+				b.WriteByte(1)
+			}
+		}
+		key := b.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], m)
+	}
+	return groups
+}
+
+// batches calls f for successive slices of merges.  Each slice has at most
+// mergeBatchSize entries, and fewer if needed to stay within the limit on the
+// number of parameters in a statement, given the number of parameters required
+// for each entry.
+func batches(merges []*mergeEntry, paramsPerEntry int, f func([]*mergeEntry) error) error {
+	size := min(mergeBatchSize, max(maxParams/max(paramsPerEntry, 1), 1))
+	for i := 0; i < len(merges); i += size {
+		if err := f(merges[i:min(i+size, len(merges))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupCurrentRows finds the current row for each entry and checks whether it
+// is identical to the command, ignoring "unavailable" columns.  Values of
+// unavailable columns are copied from the current row into the command.
+func (e *execbuffer) lookupCurrentRows(tx pgx.Tx, merges []*mergeEntry) error {
+	for _, group := range groupMerges(merges, false) {
+		if err := batches(group, len(group[0].cmd.Column)+1, func(batch []*mergeEntry) error {
+			return e.lookupBatch(tx, batch)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *execbuffer) lookupBatch(tx pgx.Tx, batch []*mergeEntry) error {
+	table := batch[0].table
+	types := e.cat.TableSchema(&table)
+	q, args, err := lookupSQL(table, types, batch)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(e.ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("querying for matching current rows: %v", err)
+	}
+	defer rows.Close()
+	var unavail []int
+	for i, c := range batch[0].cmd.Column {
+		if c.Unavailable {
+			unavail = append(unavail, i)
+		}
+	}
+	found := make([]bool, len(batch))
+	var i int
+	var id int64
+	var match bool
+	values := make([]*string, len(unavail))
+	dest := []any{&i, &id, &match}
+	for j := range values {
+		dest = append(dest, &values[j])
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scanning row values: %v", err)
+		}
+		m := batch[i]
+		found[i] = true
+		m.match = match
+		m.id = id
+		for j, k := range unavail {
+			if values[j] == nil {
+				msg := fmt.Sprintf("nil value in replacing unavailable data in table %q", table)
+				if e.dedup.Insert(msg) {
+					log.Warning("%s", msg)
+				}
+				continue
+			}
+			m.cmd.Column[k].SQLData = values[j]
+			log.Trace("found current value for unavailable data in table %q, column %q", table, m.cmd.Column[k].Name)
+		}
+		values = make([]*string, len(unavail))
+		dest = dest[:3]
+		for j := range values {
+			dest = append(dest, &values[j])
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("reading matching current rows: %v", err)
+	}
+	if len(unavail) != 0 {
+		for i := range batch {
+			if !found[i] {
+				msg := fmt.Sprintf("no current value for unavailable data in table %q", table)
+				if e.dedup.Insert(msg) {
+					log.Warning("%s", msg)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lookupSQL returns a query that joins the commands in batch, which must have
+// the same columns, with the current table on the primary key.  For each
+// current row found, the query returns the position of the command in batch,
+// the row's __id, whether the row is identical to the command, and the values
+// of unavailable columns as text.  A row is identical if all available columns
+// are equal and any other columns in the table are NULL.
+func lookupSQL(table dbx.Table, types map[string]string, batch []*mergeEntry) (string, []any, error) {
+	columns := batch[0].cmd.Column
+	var b strings.Builder
+	b.WriteString("SELECT v.__i,t.__id,")
+	names := make(map[string]bool)
+	var n int
+	for _, c := range columns {
+		names[c.Name] = true
+		if c.Unavailable {
+			continue
+		}
+		if n != 0 {
+			b.WriteString(" AND ")
+		}
+		b.WriteString("t.\"" + c.Name + "\" IS NOT DISTINCT FROM v.\"" + c.Name + "\"")
+		n++
+	}
+	extra := make([]string, 0)
+	for name := range types {
+		if !names[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		if n != 0 {
+			b.WriteString(" AND ")
+		}
+		b.WriteString("t.\"" + name + "\" IS NULL")
+		n++
+	}
+	if n == 0 {
+		b.WriteString("TRUE")
+	}
+	for _, c := range columns {
+		if c.Unavailable {
+			b.WriteString(",t.\"" + c.Name + "\"::text")
+		}
+	}
+	b.WriteString(" FROM (VALUES ")
+	var p params
+	for i, m := range batch {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("(" + strconv.Itoa(i) + "," + p.add(m.cmd.Origin) + "::text")
+		for _, c := range m.cmd.Column {
+			if c.Unavailable {
+				continue
+			}
+			v, err := p.addColumn(&c, types)
+			if err != nil {
+				return "", nil, err
+			}
+			b.WriteString("," + v)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(")AS v(__i,__origin")
+	for _, c := range columns {
+		if !c.Unavailable {
+			b.WriteString(",\"" + c.Name + "\"")
+		}
+	}
+	b.WriteString(")JOIN " + table.SQL() + " AS t ON t.__origin=v.__origin")
+	writePKJoinSQL(&b, columns)
+	return b.String(), p.args, nil
+}
+
+// writeMerges marks the current rows for the entries as no longer current,
+// and inserts the new rows.
+func (e *execbuffer) writeMerges(tx pgx.Tx, merges []*mergeEntry) error {
+	for _, group := range groupMerges(merges, false) {
+		table := group[0].table
+		types := e.cat.TableSchema(&table)
+		if err := batches(group, len(group[0].cmd.Column)+2, func(batch []*mergeEntry) error {
+			q, args, err := updateSQL(table, types, batch)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(e.ctx, q, args...); err != nil {
+				return fmt.Errorf("update: %v", err)
+			}
+			q, args, err = insertSQL(table, types, batch)
+			if err != nil {
+				return err
+			}
+			rows, err := tx.Query(e.ctx, q, args...)
+			if err != nil {
+				return fmt.Errorf("insert: %v", err)
+			}
+			ids := make([][]any, 0, len(batch))
+			for rows.Next() {
+				var id int64
+				if err = rows.Scan(&id); err != nil {
+					rows.Close()
+					return fmt.Errorf("insert: %v", err)
+				}
+				ids = append(ids, []any{id})
+			}
+			rows.Close()
+			if err = rows.Err(); err != nil {
+				return fmt.Errorf("insert: %v", err)
+			}
+			// If resync mode, flush IDs to sync table.
+			if e.syncMode == dsync.Resync && len(ids) != 0 {
+				if err = copySyncIDs(e.ctx, tx, &table, ids); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateSQL returns a statement that sets the current rows matching the
+// primary keys of the commands in batch to __current=FALSE.
+func updateSQL(table dbx.Table, types map[string]string, batch []*mergeEntry) (string, []any, error) {
+	pkey := command.PrimaryKeyColumns(batch[0].cmd.Column)
+	var b strings.Builder
+	b.WriteString("UPDATE " + table.MainSQL() + " AS t SET __end=v.__end,__current=FALSE FROM (VALUES ")
+	var p params
+	for i, m := range batch {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("(" + p.add(m.cmd.Origin) + "::text," + p.add(m.cmd.SourceTimestamp) + "::timestamptz")
+		for _, c := range command.PrimaryKeyColumns(m.cmd.Column) {
+			v, err := p.addColumn(&c, types)
+			if err != nil {
+				return "", nil, err
+			}
+			b.WriteString("," + v)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(")AS v(__origin,__end")
+	for _, c := range pkey {
+		b.WriteString(",\"" + c.Name + "\"")
+	}
+	b.WriteString(")WHERE t.__current AND t.__origin=v.__origin")
+	writePKJoinSQL(&b, pkey)
+	return b.String(), p.args, nil
+}
+
+// insertSQL returns a statement that inserts the commands in batch as current
+// rows, returning their __id values.
+func insertSQL(table dbx.Table, types map[string]string, batch []*mergeEntry) (string, []any, error) {
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + table.MainSQL() + "(__start,__end,__current,__origin")
+	for _, c := range batch[0].cmd.Column {
+		b.WriteString(",\"" + c.Name + "\"")
+	}
+	b.WriteString(")VALUES")
+	var p params
+	for i, m := range batch {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("(" + p.add(m.cmd.SourceTimestamp) + ",'9999-12-31 00:00:00Z',TRUE," + p.add(m.cmd.Origin))
+		for _, c := range m.cmd.Column {
+			v, err := sqlValue(c.SQLData, c.DType, types[c.Name])
+			if err != nil {
+				return "", nil, fmt.Errorf("column %q: %v", c.Name, err)
+			}
+			b.WriteString("," + p.add(v))
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(" RETURNING __id")
+	return b.String(), p.args, nil
+}
+
+// trimArrayTables marks as not current the rows in child tables of transformed
+// tables that contain array elements beyond the end of the arrays in the
+// commands, including rows for arrays that are no longer present.  Rows derived
+// from those elements in descendant tables are also marked as not current.
+func (e *execbuffer) trimArrayTables(tx pgx.Tx, merges []*mergeEntry) error {
+	for _, group := range groupMerges(merges, true) {
+		parent := group[0].table
+		paramsPerEntry := len(command.PrimaryKeyColumns(group[0].cmd.Column)) + 3
+		for _, child := range e.cat.ChildTables(parent) {
+			ordinal := jsonx.OrdinalColumn(parent.Table, child.Table)
+			var tables []dbx.Table
+			e.cat.TraverseDescendantTables(child, func(table dbx.Table) {
+				tables = append(tables, table)
+			})
+			for _, table := range tables {
+				types := e.cat.TableSchema(&table)
+				if err := batches(group, paramsPerEntry, func(batch []*mergeEntry) error {
+					q, args, err := trimSQL(table, types, child.Table, ordinal, batch)
+					if err != nil {
+						return err
+					}
+					if _, err = tx.Exec(e.ctx, q, args...); err != nil {
+						return fmt.Errorf("trimming array table %q: %v", table, err)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// trimSQL returns a statement that sets to __current=FALSE the current rows in
+// table that match the primary key of a command in batch and have an ordinal
+// value greater than the length of the array stored in childTable.
+func trimSQL(table dbx.Table, types map[string]string, childTable, ordinal string, batch []*mergeEntry) (string, []any, error) {
+	pkey := command.PrimaryKeyColumns(batch[0].cmd.Column)
+	var b strings.Builder
+	b.WriteString("UPDATE " + table.MainSQL() + " AS t SET __end=v.__end,__current=FALSE FROM (VALUES ")
+	var p params
+	for i, m := range batch {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("(" + p.add(m.cmd.Origin) + "::text," + p.add(m.cmd.SourceTimestamp) + "::timestamptz," +
+			p.add(int64(m.cmd.ArrayLengths[childTable])) + "::bigint")
+		for _, c := range command.PrimaryKeyColumns(m.cmd.Column) {
+			v, err := p.addColumn(&c, types)
+			if err != nil {
+				return "", nil, err
+			}
+			b.WriteString("," + v)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(")AS v(__origin,__end,__len")
+	for _, c := range pkey {
+		b.WriteString(",\"" + c.Name + "\"")
+	}
+	b.WriteString(")WHERE t.__current AND t.__origin=v.__origin")
+	writePKJoinSQL(&b, pkey)
+	b.WriteString(" AND t.\"" + ordinal + "\">v.__len")
+	return b.String(), p.args, nil
+}
+
+// writePKJoinSQL writes conditions that join the primary key columns of t and
+// v.
+func writePKJoinSQL(b *strings.Builder, columns []command.CommandColumn) {
+	for _, c := range columns {
+		if c.PrimaryKey == 0 {
+			continue
+		}
+		if c.DType == command.JSONType {
+			b.WriteString(" AND t.\"" + c.Name + "\"::text=v.\"" + c.Name + "\"::text")
+		} else {
+			b.WriteString(" AND t.\"" + c.Name + "\"=v.\"" + c.Name + "\"")
+		}
+	}
+}
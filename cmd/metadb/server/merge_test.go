@@ -0,0 +1,362 @@
+package server
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+func init() {
+	log.Init(io.Discard, false, false)
+}
+
+func testMergeCommand(id int, name string) *command.Command {
+	sid := strconv.Itoa(id)
+	return &command.Command{
+		Op:              command.MergeOp,
+		SchemaName:      "library",
+		TableName:       "patron",
+		SourceTimestamp: "2024-01-01 00:00:00Z",
+		Column: []command.CommandColumn{
+			{Name: "id", DType: command.IntegerType, DTypeSize: 4, Data: float64(id), SQLData: &sid, PrimaryKey: 1},
+			{Name: "name", DType: command.TextType, Data: name, SQLData: &name},
+		},
+	}
+}
+
+func TestMergeGenerations(t *testing.T) {
+	var ebuf execbuffer
+	a1 := ebuf.queueMerge(testMergeCommand(1, "a"), nil)
+	a1sub := ebuf.queueMerge(testMergeCommand(1, "a"), a1)
+	b1 := ebuf.queueMerge(testMergeCommand(2, "b"), nil)
+	a2 := ebuf.queueMerge(testMergeCommand(1, "c"), nil)
+	a2sub := ebuf.queueMerge(testMergeCommand(1, "c"), a2)
+	a3 := ebuf.queueMerge(testMergeCommand(1, "d"), nil)
+	gens := mergeGenerations(ebuf.merges)
+	want := [][]*mergeEntry{{a1, a1sub, b1}, {a2, a2sub}, {a3}}
+	if len(gens) != len(want) {
+		t.Fatalf("got %d generations; want %d", len(gens), len(want))
+	}
+	for i := range want {
+		if len(gens[i]) != len(want[i]) {
+			t.Fatalf("generation %d: got %d entries; want %d", i, len(gens[i]), len(want[i]))
+		}
+		for j := range want[i] {
+			if gens[i][j] != want[i][j] {
+				t.Errorf("generation %d: entry %d is %v; want %v", i, j, gens[i][j].cmd, want[i][j].cmd)
+			}
+		}
+	}
+}
+
+// hostileText contains characters that require quoting or escaping in SQL
+// literals.
+const hostileText = "it's a \\ back'slash\\' \"quoted\" E'\\x00' $1 -- ; DROP TABLE x;\n\t\u00e9"
+
+func TestMergeSQL(t *testing.T) {
+	var ebuf execbuffer
+	ebuf.queueMerge(testMergeCommand(1, hostileText), nil)
+	ebuf.queueMerge(testMergeCommand(2, "b"), nil)
+	ebuf.merges[1].cmd.Origin = "we'st"
+	table := dbx.Table{Schema: "library", Table: "patron"}
+	types := map[string]string{"id": "integer", "name": "text", "note": "text"}
+
+	q, args, err := lookupSQL(table, types, ebuf.merges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`SELECT v.__i,t.__id,t."id" IS NOT DISTINCT FROM v."id" AND t."name" IS NOT DISTINCT FROM v."name" AND t."note" IS NULL FROM`,
+		`(VALUES (0,$1::text,$2::integer,$3::text),(1,$4::text,$5::integer,$6::text))`,
+		`JOIN "library"."patron" AS t ON t.__origin=v.__origin AND t."id"=v."id"`,
+	} {
+		if !strings.Contains(q, s) {
+			t.Errorf("lookup query %q does not contain %q", q, s)
+		}
+	}
+	checkArgs(t, args, []any{"", int64(1), hostileText, "we'st", int64(2), "b"})
+
+	q, args, err = updateSQL(table, types, ebuf.merges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != `UPDATE "library"."patron__" AS t SET __end=v.__end,__current=FALSE FROM `+
+		`(VALUES ($1::text,$2::timestamptz,$3::integer),($4::text,$5::timestamptz,$6::integer))`+
+		`AS v(__origin,__end,"id")WHERE t.__current AND t.__origin=v.__origin AND t."id"=v."id"` {
+		t.Errorf("got update statement %q", q)
+	}
+	checkArgs(t, args, []any{"", "2024-01-01 00:00:00Z", int64(1), "we'st", "2024-01-01 00:00:00Z", int64(2)})
+
+	q, args, err = insertSQL(table, types, ebuf.merges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != `INSERT INTO "library"."patron__"(__start,__end,__current,__origin,"id","name")VALUES`+
+		`($1,'9999-12-31 00:00:00Z',TRUE,$2,$3,$4),($5,'9999-12-31 00:00:00Z',TRUE,$6,$7,$8) RETURNING __id` {
+		t.Errorf("got insert statement %q", q)
+	}
+	checkArgs(t, args, []any{"2024-01-01 00:00:00Z", "", int64(1), hostileText, "2024-01-01 00:00:00Z", "we'st", int64(2), "b"})
+}
+
+func TestMergeSQLColumnChangedToText(t *testing.T) {
+	var ebuf execbuffer
+	ebuf.queueMerge(testMergeCommand(1, "a"), nil)
+	table := dbx.Table{Schema: "library", Table: "patron"}
+	// The integer column "id" has been changed to text in the database.
+	types := map[string]string{"id": "text", "name": "text"}
+	q, args, err := insertSQL(table, types, ebuf.merges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArgs(t, args, []any{"2024-01-01 00:00:00Z", "", "1", "a"})
+	q, args, err = updateSQL(table, types, ebuf.merges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(q, "$3::text") {
+		t.Errorf("got update statement %q", q)
+	}
+	checkArgs(t, args, []any{"", "2024-01-01 00:00:00Z", "1"})
+}
+
+func checkArgs(t *testing.T, args, want []any) {
+	t.Helper()
+	if len(args) != len(want) {
+		t.Fatalf("got %d arguments; want %d", len(args), len(want))
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("argument %d: got %#v; want %#v", i+1, args[i], want[i])
+		}
+	}
+}
+
+func TestSQLValue(t *testing.T) {
+	s := func(s string) *string { return &s }
+	tests := []struct {
+		data    *string
+		dtype   command.DataType
+		coltype string
+		want    any
+	}{
+		{nil, command.TextType, "", nil},
+		{s(hostileText), command.TextType, "", hostileText},
+		{s(`{"a": "b\\\"c'"}`), command.JSONType, "", `{"a": "b\\\"c'"}`},
+		{s("-42"), command.IntegerType, "", int64(-42)},
+		{s("-42"), command.IntegerType, "bigint", int64(-42)},
+		{s("42.0"), command.IntegerType, "", "42.0"},
+		{s("1.5"), command.FloatType, "", 1.5},
+		{s("t"), command.BooleanType, "", true},
+		{s("1.5E+00"), command.NumericType, "", "1.5E+00"},
+		// Columns that have been changed to text.
+		{s("42"), command.IntegerType, "text", "42"},
+		{s("1.5"), command.FloatType, "text", "1.5"},
+		{s("true"), command.BooleanType, "text", "true"},
+	}
+	for _, tt := range tests {
+		got, err := sqlValue(tt.data, tt.dtype, tt.coltype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("sqlValue(%v, %s, %q) = %#v; want %#v", tt.data, tt.dtype, tt.coltype, got, tt.want)
+		}
+	}
+	if _, err := sqlValue(s("x"), command.UnknownType, ""); err == nil {
+		t.Errorf("sqlValue() with unknown type: expected error")
+	}
+}
+
+func TestBatches(t *testing.T) {
+	merges := make([]*mergeEntry, 1200)
+	var sizes []int
+	_ = batches(merges, 200, func(batch []*mergeEntry) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	// 65535 parameters allow 327 entries of 200 parameters.
+	if len(sizes) != 4 || sizes[0] != 327 || sizes[3] != 1200-3*327 {
+		t.Errorf("got batch sizes %v", sizes)
+	}
+}
+
+// TestExecRoundTrip writes hostile data to a test database and checks that
+// they are read back unchanged.
+func TestExecRoundTrip(t *testing.T) {
+	cat, dp := testCatalog(t)
+	ctx := context.Background()
+	cmdgraph := command.NewCommandGraph()
+	for i, name := range []string{hostileText, "\\", "'", "\\'", "E'\\''"} {
+		cmd := testMergeCommand(i+1, name)
+		cmd.SchemaName = "metadb_test"
+		if i != 0 {
+			cmd.Origin = name
+		}
+		cmdgraph.Commands.PushBack(cmd)
+	}
+	if err := execCommandGraph(ctx, cat, cmdgraph, dp, "test", dsync.NoSync, log.NewMessageSet(), 4); err != nil {
+		t.Fatal(err)
+	}
+	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
+		cmd := e.Value.(*command.Command)
+		var name, origin string
+		q := "SELECT name, __origin FROM metadb_test.patron WHERE id=$1"
+		if err := dp.QueryRow(ctx, q, cmd.Column[0].Data).Scan(&name, &origin); err != nil {
+			t.Fatal(err)
+		}
+		if name != *cmd.Column[1].SQLData || origin != cmd.Origin {
+			t.Errorf("got %q, %q; want %q, %q", name, origin, *cmd.Column[1].SQLData, cmd.Origin)
+		}
+	}
+}
+
+// TestExecColumnChangedToText writes integer and boolean data to a column
+// after it has been changed to text because of an incompatible type change.
+func TestExecColumnChangedToText(t *testing.T) {
+	cat, dp := testCatalog(t)
+	ctx := context.Background()
+	value := func(id int, dtype command.DataType, v string) *command.Command {
+		cmd := testMergeCommand(id, "a")
+		cmd.SchemaName = "metadb_test"
+		cmd.TableName = "reading"
+		cmd.Column = append(cmd.Column, command.CommandColumn{Name: "value", DType: dtype, DTypeSize: 4, SQLData: &v})
+		return cmd
+	}
+	// The column is created as integer, changed to text by the boolean
+	// data, and then written with integer data again.
+	cmds := []*command.Command{
+		value(1, command.IntegerType, "1"),
+		value(2, command.BooleanType, "true"),
+		value(3, command.IntegerType, "42"),
+		value(1, command.IntegerType, "7"),
+	}
+	for _, cmd := range cmds {
+		cmdgraph := command.NewCommandGraph()
+		cmdgraph.Commands.PushBack(cmd)
+		if err := execCommandGraph(ctx, cat, cmdgraph, dp, "test", dsync.NoSync, log.NewMessageSet(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if typ := cat.TableSchema(&dbx.Table{Schema: "metadb_test", Table: "reading"})["value"]; typ != "text" {
+		t.Errorf("column type %q; want text", typ)
+	}
+	for id, want := range map[int]string{1: "7", 2: "true", 3: "42"} {
+		var got string
+		q := "SELECT value FROM metadb_test.reading WHERE id=$1"
+		if err := dp.QueryRow(ctx, q, id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("id %d: got %q; want %q", id, got, want)
+		}
+	}
+}
+
+// The database tests and benchmarks write to a local PostgreSQL database named
+// by the environment variable METADB_TEST_DB, which should be an empty database
+// created for this purpose.  The connection is configured using the standard
+// variables PGHOST, PGPORT, PGUSER, and PGPASSWORD.
+
+func testCatalog(b testing.TB) (*catalog.Catalog, *pgxpool.Pool) {
+	name := os.Getenv("METADB_TEST_DB")
+	if name == "" {
+		b.Skip("METADB_TEST_DB not set")
+	}
+	getenv := func(key, def string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return def
+	}
+	db := &dbx.DB{
+		Host:     getenv("PGHOST", "localhost"),
+		Port:     getenv("PGPORT", "5432"),
+		User:     getenv("PGUSER", "postgres"),
+		Password: os.Getenv("PGPASSWORD"),
+		DBName:   name,
+		SSLMode:  getenv("PGSSLMODE", "disable"),
+	}
+	db.SuperUser = db.User
+	db.SuperPassword = db.Password
+	dp, err := dbx.NewPool(context.Background(), db.ConnString(db.User, db.Password))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(dp.Close)
+	cat, err := catalog.Initialize(db, dp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return cat, dp
+}
+
+func benchCommandGraph(start, n int, name string) *command.CommandGraph {
+	cmdgraph := command.NewCommandGraph()
+	for i := start; i < start+n; i++ {
+		cmd := testMergeCommand(i, name)
+		cmd.SchemaName = "metadb_bench"
+		cmdgraph.Commands.PushBack(cmd)
+	}
+	return cmdgraph
+}
+
+const benchBatchSize = 1000
+
+func benchExec(b *testing.B, insert bool, name string) {
+	var start int
+	cat, dp := testCatalog(b)
+	dedup := log.NewMessageSet()
+	ctx := context.Background()
+	// Create the table and initial rows.
+	if err := execCommandGraph(ctx, cat, benchCommandGraph(1, benchBatchSize, "a"), dp, "bench", dsync.NoSync, dedup, 4); err != nil {
+		b.Fatal(err)
+	}
+	if insert {
+		// Start after any rows written by a previous run.
+		q := "SELECT max(id) FROM metadb_bench.patron__"
+		if err := dp.QueryRow(ctx, q).Scan(&start); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := 1
+		if insert {
+			s = start + 1 + i*benchBatchSize
+		}
+		n := name
+		if name != "a" {
+			n = name + strconv.Itoa(i)
+		}
+		if err := execCommandGraph(ctx, cat, benchCommandGraph(s, benchBatchSize, n), dp, "bench", dsync.NoSync, dedup, 4); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*benchBatchSize), "ns/record")
+}
+
+// BenchmarkExecUnchanged measures records that are identical to the current
+// rows, as during a resnapshot.
+func BenchmarkExecUnchanged(b *testing.B) {
+	benchExec(b, false, "a")
+}
+
+// BenchmarkExecUpdate measures records that replace current rows.
+func BenchmarkExecUpdate(b *testing.B) {
+	benchExec(b, false, "b")
+}
+
+// BenchmarkExecInsert measures new records.
+func BenchmarkExecInsert(b *testing.B) {
+	benchExec(b, true, "a")
+}
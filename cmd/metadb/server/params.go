@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/metadb-project/metadb/cmd/metadb/command"
+)
+
+// maxParams is the maximum number of parameters in a statement, which is
+// limited by the PostgreSQL protocol.
+const maxParams = 65535
+
+// params collects the arguments for the parameters of a statement.
+type params struct {
+	args []any
+}
+
+// add appends an argument and returns its placeholder.
+func (p *params) add(v any) string {
+	p.args = append(p.args, v)
+	return "$" + strconv.Itoa(len(p.args))
+}
+
+// addColumn appends the data in a column and returns its placeholder, cast to
+// the column's type in the database so that values in a VALUES list have the
+// same types as the table columns they are compared with.  If the column is
+// not in types, the type of the data is used.
+func (p *params) addColumn(c *command.CommandColumn, types map[string]string) (string, error) {
+	v, err := sqlValue(c.SQLData, c.DType, types[c.Name])
+	if err != nil {
+		return "", fmt.Errorf("column %q: %v", c.Name, err)
+	}
+	t, ok := types[c.Name]
+	if !ok {
+		t = command.DataTypeToSQL(c.DType, c.DTypeSize)
+	}
+	return p.add(v) + "::" + t, nil
+}
+
+// sqlValue returns column data as an argument for a parameter.  Integer, float,
+// and boolean data are converted to the corresponding Go types, and other data
+// are passed as strings in the text format of the data type, which the database
+// converts to the type of the column.  The data are also passed as a string if
+// the column in the database, of type coltype, has a type that the Go value
+// cannot be encoded as, for example if an integer column has been changed to
+// text, or if the data cannot be converted.  An empty coltype means that the
+// column type is the type of the data.
+func sqlValue(sqldata *string, dtype command.DataType, coltype string) (any, error) {
+	if sqldata == nil {
+		return nil, nil
+	}
+	s := *sqldata
+	switch dtype {
+	case command.IntegerType:
+		if !columnTypeIn(coltype, "smallint", "integer", "bigint", "real", "double precision", "numeric") {
+			break
+		}
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+	case command.FloatType:
+		if !columnTypeIn(coltype, "real", "double precision", "numeric") {
+			break
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	case command.BooleanType:
+		if !columnTypeIn(coltype, "boolean") {
+			break
+		}
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	case command.TextType, command.JSONType, command.NumericType, command.UUIDType, command.DateType,
+		command.TimeType, command.TimetzType, command.TimestampType, command.TimestamptzType:
+	default:
+		return nil, fmt.Errorf("unknown data type: %s", dtype)
+	}
+	return s, nil
+}
+
+// columnTypeIn returns true if coltype is empty or one of types.
+func columnTypeIn(coltype string, types ...string) bool {
+	if coltype == "" {
+		return true
+	}
+	for _, t := range types {
+		if coltype == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,446 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+)
+
+// pgStatusInterval is the maximum time between status updates sent to the
+// source database, which must be less than wal_sender_timeout.
+const pgStatusInterval = 10 * time.Second
+
+var slotNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// pgoutputSource reads change events directly from a PostgreSQL database
+// using logical replication with the "pgoutput" plugin.  If the replication
+// slot does not exist, it is created and the existing data in the published
+// tables are read as a snapshot before streaming begins.
+type pgoutputSource struct {
+	connString  string
+	slot        string
+	publication string
+	// conn is the replication connection.
+	conn      *pgconn.PgConn
+	decoder   *change.PgoutputDecoder
+	sourceLog *log.SourceLog
+	// pending holds change events decoded but not yet returned by Read.
+	pending []*change.Event
+	// snapshot is the initial snapshot, if it is being read.
+	snapshot *pgSnapshot
+	// streaming is true after replication has started.
+	streaming bool
+	// flushLSN is the position up to which changes have been processed,
+	// and which is reported to the source database.
+	flushLSN   uint64
+	statusTime time.Time
+}
+
+// pgRuntimeParams are set in connections to the source database, so that
+// values are written in the text formats expected by the decoder.
+var pgRuntimeParams = map[string]string{
+	"DateStyle":        "ISO",
+	"TimeZone":         "UTC",
+	"application_name": "metadb",
+}
+
+func newPgoutputSource(spr *sproc) (*pgoutputSource, error) {
+	if !slotNameRegexp.MatchString(spr.source.Slot) {
+		return nil, fmt.Errorf("invalid replication slot name %q", spr.source.Slot)
+	}
+	config, err := pgconn.ParseConfig(spr.source.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("parsing connection string: %v", err)
+	}
+	for k, v := range pgRuntimeParams {
+		config.RuntimeParams[k] = v
+	}
+	config.RuntimeParams["replication"] = "database"
+	log.Debug("connecting to source %q", spr.source.Name)
+	conn, err := pgconn.ConnectConfig(context.TODO(), config)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to source database: %v", err)
+	}
+	s := &pgoutputSource{
+		connString:  spr.source.Connection,
+		slot:        spr.source.Slot,
+		publication: spr.source.Publication,
+		conn:        conn,
+		decoder:     change.NewPgoutputDecoder(config.Database),
+		sourceLog:   spr.sourceLog,
+	}
+	exists, err := s.slotExists()
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if exists {
+		err = s.startReplication()
+	} else {
+		err = s.createSlot()
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *pgoutputSource) slotExists() (bool, error) {
+	q := "SELECT 1 FROM pg_catalog.pg_replication_slots WHERE slot_name = '" + s.slot + "'"
+	results, err := s.conn.Exec(context.TODO(), q).ReadAll()
+	if err != nil {
+		return false, fmt.Errorf("reading replication slots: %v", err)
+	}
+	return len(results) == 1 && len(results[0].Rows) > 0, nil
+}
+
+// createSlot creates the replication slot and begins reading a snapshot of
+// the published tables, consistent with the start of the slot.
+func (s *pgoutputSource) createSlot() error {
+	log.Info("creating replication slot %q", s.slot)
+	q := "CREATE_REPLICATION_SLOT " + s.slot + " LOGICAL pgoutput EXPORT_SNAPSHOT"
+	results, err := s.conn.Exec(context.TODO(), q).ReadAll()
+	if err != nil {
+		return fmt.Errorf("creating replication slot %q: %v", s.slot, err)
+	}
+	if len(results) != 1 || len(results[0].Rows) != 1 || len(results[0].Rows[0]) < 3 {
+		return fmt.Errorf("creating replication slot %q: unexpected result", s.slot)
+	}
+	snapshotName := string(results[0].Rows[0][2])
+	if s.snapshot, err = newPgSnapshot(s.connString, snapshotName, s.publication); err != nil {
+		return fmt.Errorf("reading snapshot: %v", err)
+	}
+	return nil
+}
+
+func (s *pgoutputSource) startReplication() error {
+	q := "START_REPLICATION SLOT " + s.slot + " LOGICAL 0/0 (proto_version '1', publication_names '" +
+		strings.ReplaceAll(s.publication, "'", "''") + "')"
+	s.conn.Frontend().Send(&pgproto3.Query{String: q})
+	if err := s.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("starting replication: %v", err)
+	}
+	for {
+		msg, err := s.conn.ReceiveMessage(context.TODO())
+		if err != nil {
+			return fmt.Errorf("starting replication: %v", err)
+		}
+		switch m := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			s.streaming = true
+			s.statusTime = time.Now()
+			log.Debug("streaming from replication slot %q", s.slot)
+			return nil
+		case *pgproto3.ErrorResponse:
+			return fmt.Errorf("starting replication: %s", m.Message)
+		case *pgproto3.NoticeResponse:
+			log.Info("source database: %s", m.Message)
+		}
+	}
+}
+
+func (s *pgoutputSource) Read(timeout time.Duration) (*change.Event, error) {
+	deadline := time.Now().Add(timeout)
+	for len(s.pending) == 0 {
+		if s.snapshot != nil {
+			ce, err := s.snapshot.read()
+			if err != nil {
+				return nil, fmt.Errorf("reading snapshot: %v", err)
+			}
+			if ce != nil {
+				logChangeEvent(s.sourceLog, ce)
+				return ce, nil
+			}
+			// The snapshot is complete.
+			s.snapshot = nil
+			if err = s.startReplication(); err != nil {
+				return nil, err
+			}
+		}
+		if time.Since(s.statusTime) >= pgStatusInterval {
+			if err := s.sendStatus(); err != nil {
+				return nil, err
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return nil, nil
+		}
+		ctx, cancel := context.WithDeadline(context.TODO(), deadline)
+		msg, err := s.conn.ReceiveMessage(ctx)
+		cancel()
+		if err != nil {
+			if pgconn.Timeout(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("receiving replication message: %v", err)
+		}
+		switch m := msg.(type) {
+		case *pgproto3.CopyData:
+			if err = s.receive(m.Data); err != nil {
+				return nil, err
+			}
+		case *pgproto3.ErrorResponse:
+			return nil, fmt.Errorf("replication: %s", m.Message)
+		case *pgproto3.NoticeResponse:
+			log.Info("source database: %s", m.Message)
+		default:
+			return nil, fmt.Errorf("replication: unexpected message %T", msg)
+		}
+	}
+	ce := s.pending[0]
+	s.pending = s.pending[1:]
+	logChangeEvent(s.sourceLog, ce)
+	return ce, nil
+}
+
+// Idle waits without reading the replication stream, which is held back by the
+// source database.  Status updates continue to be sent so that the source
+// database does not close the connection.
+func (s *pgoutputSource) Idle(timeout time.Duration) error {
+	if time.Since(s.statusTime) >= pgStatusInterval {
+		if err := s.sendStatus(); err != nil {
+			return err
+		}
+	}
+	time.Sleep(timeout)
+	return nil
+}
+
+// receive processes a message within the replication stream.
+func (s *pgoutputSource) receive(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("replication: empty message")
+	}
+	switch data[0] {
+	case 'k': // Primary keepalive
+		if len(data) < 18 {
+			return fmt.Errorf("replication: invalid keepalive message")
+		}
+		if data[17] != 0 {
+			return s.sendStatus()
+		}
+		return nil
+	case 'w': // XLogData
+		if len(data) < 25 {
+			return fmt.Errorf("replication: invalid XLogData message")
+		}
+		events, err := s.decoder.Decode(data[25:])
+		if err != nil {
+			return err
+		}
+		s.pending = append(s.pending, events...)
+		return nil
+	default:
+		return fmt.Errorf("replication: unknown message type %q", data[0])
+	}
+}
+
+// Commit reports to the source database that all transactions read so far
+// have been processed, which allows the database to remove the corresponding
+// WAL.  An incomplete transaction will be read again from its beginning after
+// a restart.
+func (s *pgoutputSource) Commit() error {
+	if !s.streaming {
+		return nil
+	}
+	s.flushLSN = s.decoder.CommitLSN
+	return s.sendStatus()
+}
+
+// sendStatus sends a standby status update reporting the flushed position.
+func (s *pgoutputSource) sendStatus() error {
+	if !s.streaming {
+		return nil
+	}
+	buf := make([]byte, 34)
+	buf[0] = 'r'
+	binary.BigEndian.PutUint64(buf[1:], s.flushLSN)  // written
+	binary.BigEndian.PutUint64(buf[9:], s.flushLSN)  // flushed
+	binary.BigEndian.PutUint64(buf[17:], s.flushLSN) // applied
+	binary.BigEndian.PutUint64(buf[25:], uint64(time.Since(postgresEpoch).Microseconds()))
+	s.conn.Frontend().Send(&pgproto3.CopyData{Data: buf})
+	if err := s.conn.Frontend().Flush(); err != nil {
+		return fmt.Errorf("sending replication status: %v", err)
+	}
+	s.statusTime = time.Now()
+	return nil
+}
+
+// Close closes the connections to the source database.  If the snapshot has
+// not been completely read, the replication slot is dropped so that the
+// snapshot will be read again.
+func (s *pgoutputSource) Close() error {
+	if s.snapshot != nil {
+		s.snapshot.close()
+		q := "DROP_REPLICATION_SLOT " + s.slot
+		if _, err := s.conn.Exec(context.TODO(), q).ReadAll(); err != nil {
+			log.Warning("dropping replication slot %q: %v", s.slot, err)
+		}
+	}
+	return s.conn.Close(context.TODO())
+}
+
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// pgSnapshot reads the rows of published tables within an exported snapshot.
+type pgSnapshot struct {
+	conn   *pgx.Conn
+	tx     pgx.Tx
+	dbname string
+	tables []*change.Relation
+	// rel and rows refer to the table currently being read.
+	rel  *change.Relation
+	rows pgx.Rows
+	time time.Time
+}
+
+func newPgSnapshot(connString, snapshotName, publication string) (*pgSnapshot, error) {
+	config, err := pgx.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range pgRuntimeParams {
+		config.RuntimeParams[k] = v
+	}
+	conn, err := pgx.ConnectConfig(context.TODO(), config)
+	if err != nil {
+		return nil, err
+	}
+	sn := &pgSnapshot{conn: conn, dbname: config.Database, time: time.Now()}
+	if err = sn.begin(snapshotName, publication); err != nil {
+		sn.close()
+		return nil, err
+	}
+	return sn, nil
+}
+
+func (sn *pgSnapshot) begin(snapshotName, publication string) error {
+	var err error
+	opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	if sn.tx, err = sn.conn.BeginTx(context.TODO(), opts); err != nil {
+		return err
+	}
+	q := "SET TRANSACTION SNAPSHOT '" + strings.ReplaceAll(snapshotName, "'", "''") + "'"
+	if _, err = sn.tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "SELECT schemaname, tablename FROM pg_catalog.pg_publication_tables WHERE pubname = $1 " +
+		"ORDER BY schemaname, tablename"
+	rows, err := sn.tx.Query(context.TODO(), q, publication)
+	if err != nil {
+		return err
+	}
+	var tables []dbx.Table
+	for rows.Next() {
+		var t dbx.Table
+		if err = rows.Scan(&t.Schema, &t.Table); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		log.Warning("publication %q does not contain any tables", publication)
+	}
+	for _, t := range tables {
+		rel, err := sn.readRelation(t.Schema, t.Table)
+		if err != nil {
+			return err
+		}
+		sn.tables = append(sn.tables, rel)
+	}
+	return nil
+}
+
+// readRelation reads the columns and primary key of a table.
+func (sn *pgSnapshot) readRelation(schema, table string) (*change.Relation, error) {
+	q := "SELECT a.attname, a.atttypid, i.indrelid IS NOT NULL " +
+		"FROM pg_catalog.pg_attribute a " +
+		"LEFT JOIN pg_catalog.pg_index i ON i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY(i.indkey) " +
+		"WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = '' " +
+		"ORDER BY a.attnum"
+	rows, err := sn.tx.Query(context.TODO(), q, pgx.Identifier{schema, table}.Sanitize())
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s.%s: %v", schema, table, err)
+	}
+	defer rows.Close()
+	rel := &change.Relation{Namespace: schema, Name: table}
+	for rows.Next() {
+		var col change.RelationColumn
+		if err = rows.Scan(&col.Name, &col.TypeOID, &col.Key); err != nil {
+			return nil, fmt.Errorf("reading columns of %s.%s: %v", schema, table, err)
+		}
+		rel.Columns = append(rel.Columns, col)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading columns of %s.%s: %v", schema, table, err)
+	}
+	return rel, nil
+}
+
+// read returns the next row of the snapshot as a change event, or nil after
+// the last row.
+func (sn *pgSnapshot) read() (*change.Event, error) {
+	for {
+		if sn.rows == nil {
+			if len(sn.tables) == 0 {
+				err := sn.tx.Commit(context.TODO())
+				sn.close()
+				log.Info("finished reading snapshot")
+				return nil, err
+			}
+			sn.rel = sn.tables[0]
+			sn.tables = sn.tables[1:]
+			log.Debug("reading snapshot of %s.%s", sn.rel.Namespace, sn.rel.Name)
+			cols := make([]string, len(sn.rel.Columns))
+			for i, c := range sn.rel.Columns {
+				cols[i] = pgx.Identifier{c.Name}.Sanitize() + "::text"
+			}
+			q := "SELECT " + strings.Join(cols, ", ") + " FROM " +
+				pgx.Identifier{sn.rel.Namespace, sn.rel.Name}.Sanitize()
+			var err error
+			if sn.rows, err = sn.tx.Query(context.TODO(), q); err != nil {
+				return nil, err
+			}
+		}
+		if sn.rows.Next() {
+			raw := sn.rows.RawValues()
+			values := make([]change.Value, len(raw))
+			for i, r := range raw {
+				if r != nil {
+					s := string(r)
+					values[i].Text = &s
+				}
+			}
+			return change.NewRowEvent(sn.rel, "r", values, sn.dbname, sn.time, true)
+		}
+		sn.rows.Close()
+		if err := sn.rows.Err(); err != nil {
+			return nil, err
+		}
+		sn.rows = nil
+	}
+}
+
+func (sn *pgSnapshot) close() {
+	if sn.rows != nil {
+		sn.rows.Close()
+		sn.rows = nil
+	}
+	_ = sn.conn.Close(context.TODO())
+}
@@ -1,23 +1,21 @@
 package server
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
-	"github.com/jackc/pgx/v5"
 	"github.com/metadb-project/metadb/cmd/internal/status"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
-	"github.com/metadb-project/metadb/cmd/metadb/change"
 	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
+	"github.com/metadb-project/metadb/cmd/metadb/jsonx"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 	"github.com/metadb-project/metadb/cmd/metadb/process"
 	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
@@ -25,32 +23,187 @@ import (
 	"golang.org/x/net/context"
 )
 
+// sourceCheckInterval is the time between checks for data sources that have
+// been created, altered, or dropped.
+const sourceCheckInterval = 5 * time.Second
+
+// statsWriteInterval is the minimum time between writes of data source
+// statistics to the database.
+const statsWriteInterval = 15 * time.Second
+
+// pauseCheckInterval is the time between checks of whether a paused data
+// source has been resumed.
+const pauseCheckInterval = 2 * time.Second
+
+// pollLoopHandle refers to the poll loop of a running data source.
+type pollLoopHandle struct {
+	source *sysdb.SourceConnector
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop stops the poll loop and waits for it to finish.
+func (h *pollLoopHandle) stop() {
+	h.cancel()
+	<-h.done
+}
+
 func goPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server) {
 	if svr.opt.NoKafkaCommit {
 		log.Info("Kafka commits disabled")
 	}
-	// For now, we support only one source
-	spr, err := waitForConfig(svr)
-	if err != nil {
+	var err error
+	// Set up source log
+	var sourceLog *log.SourceLog
+	if svr.opt.LogSource != "" {
+		if sourceLog, err = log.NewSourceLog(svr.opt.LogSource); err != nil {
+			log.Fatal("%s", err)
+			os.Exit(1)
+		}
+	}
+	// set command.ReshareTenants
+	if command.ReshareTenants, err = catalog.Origins(svr.db); err != nil {
 		log.Fatal("%s", err)
 		os.Exit(1)
 	}
 
-	err = logSyncMode(svr.dp, spr.source.Name)
-	if err != nil {
-		log.Fatal("%s", err)
-		os.Exit(1)
+	if svr.opt.SourceFilename != "" {
+		spr, err := waitForConfig(svr)
+		if err != nil {
+			log.Fatal("%s", err)
+			os.Exit(1)
+		}
+		spr.sourceLog = sourceLog
+		updateUserPerms(svr, cat)
+		runPollLoop(ctx, cat, svr, spr)
+		return
+	}
+
+	// Each enabled data source has its own poll loop, which is restarted
+	// if the data source is altered and stopped if it is dropped.
+	running := make(map[string]*pollLoopHandle)
+	for {
+		// User permissions are updated for the tables of all data
+		// sources together.
+		updateUserPerms(svr, cat)
+		sources, err := sysdb.ReadSourceConnectors(svr.db)
+		if err != nil {
+			log.Error("reading data sources: %v", err)
+		} else {
+			updatePollLoops(ctx, cat, svr, sourceLog, running, sources)
+		}
+		select {
+		case <-ctx.Done():
+			for _, h := range running {
+				h.stop()
+			}
+			return
+		case <-time.After(sourceCheckInterval):
+		}
 	}
+}
 
-	folio, err := isFolioModulePresent(svr.db)
+// updateUserPerms applies user authorizations that have changed, if any.
+func updateUserPerms(svr *server, cat *catalog.Catalog) {
+	pending, err := sysdb.UserPermsPending(svr.dp)
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	if !pending {
+		return
+	}
+	dc, err := svr.db.Connect()
 	if err != nil {
-		log.Error("checking for folio module: %v", err)
+		log.Error("updating user permissions: %v", err)
+		return
 	}
-	reshare, err := isReshareModulePresent(svr.db)
+	defer dbx.Close(dc)
+	dcsuper, err := svr.db.ConnectSuper()
 	if err != nil {
-		log.Error("checking for reshare module: %v", err)
+		log.Error("updating user permissions: %v", err)
+		return
 	}
-	go goMaintenance(svr.opt.Datadir, *(svr.db), svr.dp, cat, spr.source.Name, folio, reshare)
+	defer dbx.Close(dcsuper)
+	sysdb.GoUpdateUserPerms(dc, dcsuper, cat.TrackedTables())
+}
+
+// updatePollLoops starts, stops, or restarts poll loops so that each enabled
+// data source in sources has a poll loop using its current configuration.
+func updatePollLoops(ctx context.Context, cat *catalog.Catalog, svr *server, sourceLog *log.SourceLog,
+	running map[string]*pollLoopHandle, sources []*sysdb.SourceConnector) {
+	enabled := make(map[string]*sysdb.SourceConnector)
+	for _, src := range sources {
+		if src.Enable {
+			enabled[src.Name] = src
+		}
+	}
+	for name, h := range running {
+		src, ok := enabled[name]
+		switch {
+		case !ok:
+			log.Info("stopping data source %q", name)
+		case !src.SameConfig(h.source):
+			log.Info("restarting data source %q to apply configuration changes", name)
+		default:
+			continue
+		}
+		h.stop()
+		delete(running, name)
+	}
+	// Status is shown for all configured data sources.
+	list := make([]*sysdb.SourceConnector, 0, len(sources))
+	for _, src := range sources {
+		if src.Enable {
+			h, ok := running[src.Name]
+			if !ok {
+				h = startPollLoop(ctx, cat, svr, sourceLog, src)
+				running[src.Name] = h
+			}
+			src = h.source
+		}
+		list = append(list, src)
+	}
+	svr.state.mu.Lock()
+	svr.state.sources = list
+	svr.state.mu.Unlock()
+}
+
+// startPollLoop starts a poll loop for a data source.
+func startPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, sourceLog *log.SourceLog,
+	src *sysdb.SourceConnector) *pollLoopHandle {
+	src.Status.Waiting()
+	spr := &sproc{
+		source:    src,
+		databases: dbxToConnector(svr.db),
+		sourceLog: sourceLog,
+		svr:       svr,
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	h := &pollLoopHandle{source: src, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		runPollLoop(ctx, cat, svr, spr)
+	}()
+	return h
+}
+
+// runPollLoop runs the poll loop and maintenance of a data source until ctx is
+// canceled.  If the poll loop fails, it is retried after a delay.
+func runPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) {
+	if err := logSyncMode(svr.dp, spr.source.Name); err != nil {
+		log.Error("source %q: %v", spr.source.Name, err)
+	}
+
+	folio := spr.source.Module == "folio"
+	reshare := spr.source.Module == "reshare"
+	var maintenance sync.WaitGroup
+	maintenance.Add(1)
+	go func() {
+		defer maintenance.Done()
+		goMaintenance(ctx, svr.opt.Datadir, *(svr.db), svr.dp, cat, spr.source.Name, folio, reshare)
+	}()
+	defer maintenance.Wait()
 
 	for {
 		err := launchPollLoop(ctx, cat, svr, spr)
@@ -59,7 +212,13 @@ func goPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server) {
 		}
 		spr.source.Status.Error()
 		spr.databases[0].Status.Error()
-		time.Sleep(24 * time.Hour)
+		spr.source.Stats.SetError(err)
+		writeSourceStats(spr)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(24 * time.Hour):
+		}
 	}
 }
 
@@ -100,31 +259,13 @@ func launchPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr
 }
 
 func outerPollLoop(ctx context.Context, cat *catalog.Catalog, svr *server, spr *sproc) error {
-	var err error
-	// Set up source log
-	if svr.opt.LogSource != "" {
-		if spr.sourceLog, err = log.NewSourceLog(svr.opt.LogSource); err != nil {
-			return err
-		}
-	}
-
-	//// TMP
-	// set command.FolioTenant
-	/*	var folioTenant string
-		if folioTenant, err = catalog.FolioTenant(svr.db); err != nil {
-			return err
+	log.Debug("starting stream processor for source %q", spr.source.Name)
+	if err := pollLoop(ctx, cat, spr); err != nil {
+		if ctx.Err() != nil {
+			// The error was caused by stopping the data source.
+			log.Debug("source %q: %v", spr.source.Name, err)
+			return nil
 		}
-		command.FolioTenant = folioTenant
-	*/
-	// set command.ReshareTenants
-	command.ReshareTenants, err = catalog.Origins(svr.db)
-	if err != nil {
-		return err
-	}
-	////
-
-	log.Debug("starting stream processor")
-	if err = pollLoop(ctx, cat, spr); err != nil {
 		//log.Error("%s", err)
 		return err
 	}
@@ -160,10 +301,7 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 	if err != nil {
 		return err
 	}
-	dcsuper, err := spr.svr.db.ConnectSuper()
-	if err != nil {
-		return err
-	}
+	defer dbx.Close(dc)
 	//////////////////////////////////////////////////////////////////////////////
 	spr.databases[0].Status.Active()
 	//spr.db = append(spr.db, db)
@@ -177,18 +315,6 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 			return fmt.Errorf("caching schema: %s", err)
 		}
 	*/
-	// Update user permissions in database
-	var waitUserPerms sync.WaitGroup
-	waitUserPerms.Add(1)
-	go func(trackedTables []dbx.Table) {
-		defer waitUserPerms.Done()
-		var dc2 *pgx.Conn
-		dc2, err = spr.svr.db.Connect()
-		if err != nil {
-			log.Error("%v", err)
-		}
-		sysdb.GoUpdateUserPerms(dc2, dcsuper, trackedTables)
-	}(cat.AllTables(spr.source.Name))
 	// Cache users
 	/*	users, err := cache.NewUsers(db)
 		if err != nil {
@@ -201,76 +327,106 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 		log.Error("unable to read sync mode: %v", err)
 	}
 
-	// Source file
-	var sourceFile *os.File
-	var sourceFileScanner *bufio.Scanner
+	// Change source
+	var src ChangeSource
 	if spr.svr.opt.SourceFilename != "" {
-		if sourceFile, err = os.Open(spr.svr.opt.SourceFilename); err != nil {
+		if src, err = newFileSource(spr.svr.opt.SourceFilename, false, "", nil, spr.sourceLog); err != nil {
 			return err
 		}
-		defer func(sourceFile *os.File) {
-			_ = sourceFile.Close()
-		}(sourceFile)
-		sourceFileScanner = bufio.NewScanner(sourceFile)
-		sourceFileScanner.Buffer(make([]byte, 0, 10000000), 10000000)
-	}
-	// Kafka source
-	var consumer *kafka.Consumer
-	if sourceFileScanner == nil {
-		spr.schemaPassFilter, err = util.CompileRegexps(spr.source.SchemaPassFilter)
-		if err != nil {
+	} else {
+		opts := &spr.sourceOptions
+		if opts.SchemaPassFilter, err = util.CompileRegexps(spr.source.SchemaPassFilter); err != nil {
 			return err
 		}
-		spr.schemaStopFilter, err = util.CompileRegexps(spr.source.SchemaStopFilter)
-		if err != nil {
+		if opts.SchemaStopFilter, err = util.CompileRegexps(spr.source.SchemaStopFilter); err != nil {
 			return err
 		}
-		spr.tableStopFilter, err = util.CompileRegexps(spr.source.TableStopFilter)
-		if err != nil {
+		if opts.TablePassFilter, err = util.CompileRegexps(spr.source.TablePassFilter); err != nil {
 			return err
 		}
-		var brokers = spr.source.Brokers
-		var topics = spr.source.Topics
-		var group = spr.source.Group
-		log.Debug("connecting to %q, topics %q", brokers, topics)
-		log.Debug("connecting to source %q", spr.source.Name)
-		var config = &kafka.ConfigMap{
-			"auto.offset.reset":    "earliest",
-			"bootstrap.servers":    brokers,
-			"enable.auto.commit":   false,
-			"group.id":             group,
-			"max.poll.interval.ms": spr.svr.db.MaxPollInterval,
-			"security.protocol":    spr.source.Security,
-		}
-		consumer, err = kafka.NewConsumer(config)
-		if err != nil {
-			spr.source.Status.Error()
+		if opts.TableStopFilter, err = util.CompileRegexps(spr.source.TableStopFilter); err != nil {
 			return err
 		}
-		defer func(consumer *kafka.Consumer) {
-			_ = consumer.Close()
-		}(consumer)
-		//err = consumer.SubscribeTopics([]string{"^" + topicPrefix + "[.].*"}, nil)
-		err = consumer.SubscribeTopics(topics, nil)
+		if opts.ColumnPassFilter, err = util.CompileColumnFilters(spr.source.ColumnPassFilter); err != nil {
+			return err
+		}
+		if opts.ColumnStopFilter, err = util.CompileColumnFilters(spr.source.ColumnStopFilter); err != nil {
+			return err
+		}
+		if opts.SchemaRewrite, err = util.CompileRewriteRules(spr.source.SchemaRewrite); err != nil {
+			return err
+		}
+		if opts.TableRewrite, err = util.CompileRewriteRules(spr.source.TableRewrite); err != nil {
+			return err
+		}
+		opts.TrimSchemaPrefix = spr.source.TrimSchemaPrefix
+		opts.AddSchemaPrefix = spr.source.AddSchemaPrefix
+		switch spr.source.Type {
+		case "postgresql":
+			src, err = newPgoutputSource(spr)
+		case "file":
+			src, err = newFileSource(spr.source.Path, true, spr.source.Name, spr.svr.dp, spr.sourceLog)
+		default:
+			src, err = newKafkaSource(spr)
+		}
 		if err != nil {
 			spr.source.Status.Error()
 			return err
 		}
 		spr.source.Status.Active()
 	}
-	waitUserPerms.Wait()
+	defer func(src ChangeSource) {
+		_ = src.Close()
+	}(src)
 	// dedup keeps track of "primary key not defined" and similar errors
 	// that have been logged, in order to reduce duplication of the error
 	// messages.
 	dedup := log.NewMessageSet()
+	// infer keeps statistics on JSON data used to choose the data types of
+	// columns in transformed tables.
+	infer := jsonx.NewTypeInference(jsonx.DefaultDetectors, jsonx.DefaultInferenceThreshold)
+	// dl records change events that cannot be parsed or written.
+	dl := &deadLetters{dq: spr.svr.dp, source: spr.source.Name, policy: spr.source.DeadLetter,
+		stats: spr.source.Stats}
 	var firstEvent = true
+	var statsWritten time.Time
 	for {
+		// Stop if the data source has been altered or dropped.
+		if ctx.Err() != nil {
+			log.Debug("stopping stream processor for source %q", spr.source.Name)
+			return nil
+		}
+
+		// Pause.  The data read in the previous iteration have been
+		// written and the read position committed, so the source can
+		// idle here until it is resumed.
+		paused, err := catalog.SourcePaused(spr.svr.dp, spr.source.Name)
+		if err != nil {
+			return err
+		}
+		if err = pauseSource(spr, src, paused); err != nil {
+			return err
+		}
+		if paused {
+			continue
+		}
+
+		// Replay dead letters
+		if err = replayDeadLetters(ctx, cat, spr, syncMode, dedup, infer); err != nil {
+			return fmt.Errorf("replaying dead letters: %v", err)
+		}
+
+		// Reset offsets
+		if err = resetKafkaOffsets(spr, src); err != nil {
+			return fmt.Errorf("resetting offsets: %v", err)
+		}
+
 		cmdgraph := command.NewCommandGraph()
+		start := time.Now()
 
 		// Parse
-		eventReadCount, err := parseChangeEvents(cat, dedup, consumer, cmdgraph, spr.schemaPassFilter,
-			spr.schemaStopFilter, spr.tableStopFilter, spr.source.TrimSchemaPrefix,
-			spr.source.AddSchemaPrefix, sourceFileScanner, spr.sourceLog, spr.svr.db.CheckpointSegmentSize)
+		eventReadCount, err := parseChangeEvents(ctx, cat, dedup, dl, src, spr.source.Name, &spr.source.LastSeen,
+			cmdgraph, &spr.sourceOptions, spr.svr.db.CheckpointSegmentSize)
 		if err != nil {
 			return fmt.Errorf("parser: %v", err)
 		}
@@ -280,30 +436,29 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 		}
 
 		// Rewrite
-		if err = rewriteCommandGraph(cmdgraph, spr.svr.opt.RewriteJSON); err != nil {
+		if err = rewriteCommandGraph(cat, cmdgraph, spr.svr.dp, spr.svr.db.JSONDepth, infer); err != nil {
 			return fmt.Errorf("rewriter: %s", err)
 		}
 
+		// Mask
+		if err = maskCommandGraph(cmdgraph, spr.svr.dp, dedup); err != nil {
+			return fmt.Errorf("masking: %s", err)
+		}
+
 		// Execute
-		if err = execCommandGraph(ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, syncMode, dedup); err != nil {
+		err = dl.exec(ctx, cmdgraph, func(cmdgraph *command.CommandGraph) error {
+			return execCommandGraph(ctx, cat, cmdgraph, spr.svr.dp, spr.source.Name, syncMode, dedup,
+				spr.svr.db.ApplyWorkers)
+		})
+		if err != nil {
 			return fmt.Errorf("executor: %s", err)
 		}
 
-		if eventReadCount > 0 && sourceFileScanner == nil && !spr.svr.opt.NoKafkaCommit {
-			_, err = consumer.Commit()
-			if err != nil {
-				e := err.(kafka.Error)
-				if e.IsFatal() {
-					//return fmt.Errorf("Kafka commit: %v", e)
-					log.Warning("Kafka commit: %v", e)
-				} else {
-					switch e.Code() {
-					case kafka.ErrNoOffset:
-						log.Debug("Kafka commit: %v", e)
-					default:
-						log.Info("Kafka commit: %v", e)
-					}
-				}
+		// All data changes have been committed by the executor, so the
+		// read position can be committed.
+		if eventReadCount > 0 {
+			if err = src.Commit(); err != nil {
+				return fmt.Errorf("commit: %v", err)
 			}
 		}
 
@@ -311,81 +466,131 @@ func pollLoop(ctx context.Context, cat *catalog.Catalog, spr *sproc) error {
 			log.Debug("checkpoint: events=%d, commands=%d", eventReadCount, cmdgraph.Commands.Len())
 		}
 
+		// Statistics
+		var lastEventTime string
+		if e := cmdgraph.Commands.Back(); e != nil {
+			lastEventTime = e.Value.(*command.Command).SourceTimestamp
+		}
+		spr.source.Stats.SetEvents(eventReadCount, time.Since(start).Seconds(), lastEventTime)
+		if time.Since(statsWritten) >= statsWriteInterval {
+			writeSourceStats(spr)
+			statsWritten = time.Now()
+		}
+
 		// Check if resync snapshot may have completed.
-		if syncMode != dsync.NoSync && spr.source.Status.Get() == status.ActiveStatus && cat.HoursSinceLastSnapshotRecord() > 3.0 {
+		if syncMode != dsync.NoSync && spr.source.Status.Get() == status.ActiveStatus && cat.HoursSinceLastSnapshotRecord(spr.source.Name) > 3.0 {
 			msg := fmt.Sprintf("source %q snapshot complete (deadline exceeded); consider running \"metadb endsync\"",
 				spr.source.Name)
 			if dedup.Insert(msg) {
 				log.Info("%s", msg)
 			}
-			cat.ResetLastSnapshotRecord() // Sync timer.
+			cat.ResetLastSnapshotRecord(spr.source.Name) // Sync timer.
 		}
 	}
 }
 
-func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *kafka.Consumer, cmdgraph *command.CommandGraph, schemaPassFilter, schemaStopFilter, tableStopFilter []*regexp.Regexp, trimSchemaPrefix, addSchemaPrefix string, sourceFileScanner *bufio.Scanner, sourceLog *log.SourceLog, checkpointSegmentSize int) (int, error) {
-	kafkaPollTimeout := 100     // Poll timeout in milliseconds.
-	pollTimeoutCountLimit := 20 // Maximum allowable number of consecutive poll timeouts.
-	pollLoopTimeout := 120.0    // Overall pool loop timeout in seconds.
+// pauseSource updates the status of a data source when it is paused or
+// resumed.  While the data source is paused, src is left idle for
+// pauseCheckInterval instead of being read.
+func pauseSource(spr *sproc, src ChangeSource, paused bool) error {
+	if !paused {
+		if spr.source.Status.Get() == status.PausedStatus {
+			log.Info("source %q: resumed", spr.source.Name)
+			spr.source.Status.Active()
+			writeSourceStats(spr)
+		}
+		return nil
+	}
+	if spr.source.Status.Get() != status.PausedStatus {
+		log.Info("source %q: paused", spr.source.Name)
+		spr.source.Status.Paused()
+		spr.source.Stats.SetEvents(0, 1, "")
+		writeSourceStats(spr)
+	}
+	if err := src.Idle(pauseCheckInterval); err != nil {
+		return fmt.Errorf("idle: %v", err)
+	}
+	return nil
+}
+
+// writeSourceStats records the status and statistics of a data source in the
+// database.  Errors are logged, because the statistics are not essential.
+func writeSourceStats(spr *sproc) {
+	if spr.source.Name == "" {
+		return
+	}
+	err := catalog.WriteSourceStats(spr.svr.dp, spr.source.Name, spr.source.Status.GetString(), spr.source.Stats.Get())
+	if err != nil {
+		log.Warning("%v", err)
+	}
+}
+
+func parseChangeEvents(ctx context.Context, cat *catalog.Catalog, dedup *log.MessageSet, dl *deadLetters, src ChangeSource,
+	source string, lastSeen *status.Timestamp, cmdgraph *command.CommandGraph, opts *command.SourceOptions, checkpointSegmentSize int) (int, error) {
+	pollTimeout := 100 * time.Millisecond // Poll timeout.
+	pollTimeoutCountLimit := 20           // Maximum allowable number of consecutive poll timeouts.
+	pollLoopTimeout := 120.0              // Overall pool loop timeout in seconds.
 	snapshot := false
 	var eventReadCount int
 	pollTimeoutCount := 0
 	startTime := time.Now()
 	for x := 0; x < checkpointSegmentSize; x++ {
 		// Catch the possibility of many poll timeouts between messages, because each
-		// poll timeouts takes kafkaPollTimeout ms.  This also provides an overall timeout
+		// poll timeouts takes pollTimeout.  This also provides an overall timeout
 		// for the poll loop.
 		if time.Since(startTime).Seconds() >= pollLoopTimeout {
 			log.Trace("poll timeout")
 			break
 		}
-		var err error
-		var msg *kafka.Message
-		if sourceFileScanner == nil {
-			if msg, err = readChangeEvent(consumer, sourceLog, kafkaPollTimeout); err != nil {
-				return 0, fmt.Errorf("reading message from Kafka: %v", err)
-			}
-			if msg == nil { // Poll timeout is indicated by the nil return.
-				pollTimeoutCount++
-				if pollTimeoutCount >= pollTimeoutCountLimit {
-					break // Prevent processing of a small batch from being delayed.
-				} else {
-					continue
-				}
-			} else {
-				pollTimeoutCount = 0 // We are only interested in consecutive timeouts.
-			}
+		if ctx.Err() != nil {
+			break
 		}
-		eventReadCount++
-
-		var ce *change.Event
-		if sourceFileScanner != nil {
-			if ce, err = readChangeEventFromFile(sourceFileScanner, sourceLog); err != nil {
-				return 0, fmt.Errorf("reading change event from file: %v", err)
-			}
-			if ce == nil && cmdgraph.Commands.Len() == 0 {
+		ce, err := src.Read(pollTimeout)
+		if err == io.EOF {
+			if cmdgraph.Commands.Len() == 0 {
 				log.Info("finished processing source file")
 				log.Info("shutting down")
 				process.SetStop()
-				break
 			}
-		} else {
-			ce, err = change.NewEvent(msg)
-			if err != nil {
-				log.Error("%s", err)
-				ce = nil
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if ce == nil { // Poll timeout is indicated by the nil return.
+			pollTimeoutCount++
+			if pollTimeoutCount >= pollTimeoutCountLimit {
+				break // Prevent processing of a small batch from being delayed.
+			} else {
+				continue
 			}
+		} else {
+			pollTimeoutCount = 0 // We are only interested in consecutive timeouts.
 		}
+		eventReadCount++
+		lastSeen.Set(time.Now())
 
-		c, snap, err := command.NewCommand(dedup, ce, schemaPassFilter, schemaStopFilter, tableStopFilter,
-			trimSchemaPrefix, addSchemaPrefix)
+		c, snap, err := command.NewCommand(dedup, ce, opts)
 		if err != nil {
 			log.Debug("%v", *ce)
-			return 0, fmt.Errorf("parsing command: %v", err)
+			if err = dl.record(ce, 1, fmt.Errorf("parsing command: %v", err)); err != nil {
+				return 0, err
+			}
+			continue
 		}
 		if c == nil {
 			continue
 		}
+		c.Offset = ce.Offset
+		c.Event = ce
+		switch c.Op {
+		case command.HeartbeatOp:
+			log.Trace("heartbeat: %s", c.SourceTimestamp)
+			continue
+		case command.SchemaChangeOp:
+			logSchemaChange(cat, c)
+			continue
+		}
 		if snap {
 			snapshot = true
 		}
@@ -393,57 +598,38 @@ func parseChangeEvents(cat *catalog.Catalog, dedup *log.MessageSet, consumer *ka
 	}
 	log.Trace("read %d events", cmdgraph.Commands.Len())
 	if snapshot {
-		cat.ResetLastSnapshotRecord()
+		cat.ResetLastSnapshotRecord(source)
 	}
 	return eventReadCount, nil
 }
 
-func readChangeEventFromFile(sourceFileScanner *bufio.Scanner, sourceLog *log.SourceLog) (*change.Event, error) {
-	var err error
-	var ok bool
-	var header, key, value string
-	if ok = sourceFileScanner.Scan(); !ok {
-		if sourceFileScanner.Err() == nil {
-			return nil, nil
-		} else {
-			return nil, err
-		}
-	}
-	header = sourceFileScanner.Text()
-	if header != "#" {
-		return nil, fmt.Errorf("header not found")
-	}
-	if ok = sourceFileScanner.Scan(); !ok {
-		if sourceFileScanner.Err() == nil {
-			return nil, fmt.Errorf("incomplete read")
-		} else {
-			return nil, err
+// logSchemaChange logs the effect of a schema change in the source.  Tables and
+// columns that are dropped or renamed in the source are retained in Metadb,
+// because they may contain historical data.
+func logSchemaChange(cat *catalog.Catalog, c *command.Command) {
+	for _, tc := range c.TableChanges {
+		table := &dbx.Table{Schema: tc.SchemaName, Table: tc.TableName}
+		if !cat.TableExists(table) {
+			continue
 		}
-	}
-	key = sourceFileScanner.Text()
-	if ok = sourceFileScanner.Scan(); !ok {
-		if sourceFileScanner.Err() == nil {
-			return nil, fmt.Errorf("incomplete read")
-		} else {
-			return nil, err
+		switch tc.Type {
+		case "DROP":
+			log.Info("source schema change: table %q dropped in source", table)
+		case "ALTER":
+			columns := make(map[string]bool)
+			for _, col := range tc.Columns {
+				columns[col] = true
+			}
+			for _, col := range cat.TableColumns(table) {
+				if !columns[col] && !strings.HasPrefix(col, "__") {
+					log.Info("source schema change: table %q: column %q no longer present in source", table, col)
+				}
+			}
 		}
 	}
-	value = sourceFileScanner.Text()
-	if sourceLog != nil {
-		sourceLog.Log("#")
-		sourceLog.Log(key)
-		sourceLog.Log(value)
-	}
-	var ce *change.Event
-	var msg = &kafka.Message{
-		Value: []byte(value),
-		Key:   []byte(key),
-	}
-	if ce, err = change.NewEvent(msg); err != nil {
-		log.Error("%s", err)
-		ce = nil
+	if c.DDL != "" {
+		log.Debug("source schema change: %s", c.DDL)
 	}
-	return ce, nil
 }
 
 func readChangeEvent(consumer *kafka.Consumer, sourceLog *log.SourceLog, kafkaPollTimeout int) (*kafka.Message, error) {
@@ -511,13 +697,12 @@ func logTraceCommand(c *command.Command) {
 	log.Trace("%s", b.String())
 }
 
+// waitForConfig waits until a data source has been enabled, for reading from a
+// source file.
 func waitForConfig(svr *server) (*sproc, error) {
 	var databases = dbxToConnector(svr.db)
-	var sources []*sysdb.SourceConnector
-	var ready bool
-	var err error
 	for {
-		sources, ready, err = waitForConfigSource(svr)
+		_, ready, err := waitForConfigSource(svr)
 		if err != nil {
 			return nil, err
 		}
@@ -525,14 +710,9 @@ func waitForConfig(svr *server) (*sproc, error) {
 			break
 		}
 	}
-	var src *sysdb.SourceConnector
-	if svr.opt.SourceFilename == "" {
-		src = sources[0]
-	} else {
-		src = &sysdb.SourceConnector{}
-	}
+	// The source file is read in place of the configured data sources.
 	var spr = &sproc{
-		source:    src,
+		source:    &sysdb.SourceConnector{Stats: new(sysdb.SourceStats)},
 		databases: databases,
 		svr:       svr,
 	}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/metadb-project/metadb/cmd/internal/status"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// fakeSource is a ChangeSource that counts the calls made to it.
+type fakeSource struct {
+	reads, commits, idles int
+	idleTimeout           time.Duration
+}
+
+func (s *fakeSource) Read(timeout time.Duration) (*change.Event, error) {
+	s.reads++
+	return nil, nil
+}
+
+func (s *fakeSource) Commit() error {
+	s.commits++
+	return nil
+}
+
+func (s *fakeSource) Idle(timeout time.Duration) error {
+	s.idles++
+	s.idleTimeout = timeout
+	return nil
+}
+
+func (s *fakeSource) Close() error {
+	return nil
+}
+
+func TestPauseSource(t *testing.T) {
+	// A data source with no name is not written to the database.
+	spr := &sproc{source: &sysdb.SourceConnector{Stats: new(sysdb.SourceStats)}}
+	spr.source.Status.Active()
+	src := &fakeSource{}
+	for i := 0; i < 3; i++ {
+		if err := pauseSource(spr, src, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if src.idles != 3 || src.idleTimeout != pauseCheckInterval {
+		t.Errorf("paused: Idle called %d times with timeout %v; want 3 times with %v", src.idles,
+			src.idleTimeout, pauseCheckInterval)
+	}
+	if src.reads != 0 || src.commits != 0 {
+		t.Errorf("paused: Read called %d times, Commit %d times; want 0", src.reads, src.commits)
+	}
+	if st := spr.source.Status.Get(); st != status.PausedStatus {
+		t.Errorf("paused: status %s; want paused", spr.source.Status.GetString())
+	}
+
+	if err := pauseSource(spr, src, false); err != nil {
+		t.Fatal(err)
+	}
+	if src.idles != 3 || src.reads != 0 || src.commits != 0 {
+		t.Errorf("resumed: got %d idles, %d reads, %d commits; want 3, 0, 0", src.idles, src.reads, src.commits)
+	}
+	if st := spr.source.Status.Get(); st != status.ActiveStatus {
+		t.Errorf("resumed: status %s; want active", spr.source.Status.GetString())
+	}
+}
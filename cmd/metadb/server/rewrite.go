@@ -3,29 +3,50 @@ package server
 import (
 	"container/list"
 	"fmt"
+
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
 	"github.com/metadb-project/metadb/cmd/metadb/command"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/jsonx"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
 )
 
-func rewriteCommandGraph(cmdgraph *command.CommandGraph, rewriteJSON bool) error {
+// rewriteCommandGraph transforms JSON data in the commands, using the JSON
+// transforms defined in the catalog.  The transforms are read for each batch so
+// that changes made with CREATE/DROP JSON TRANSFORM take effect without
+// restarting the server.  Data types of the extracted columns are chosen by
+// infer after all of the commands have been rewritten.
+func rewriteCommandGraph(cat *catalog.Catalog, cmdgraph *command.CommandGraph, dq dbx.Queryable, jsonDepth int, infer *jsonx.TypeInference) error {
+	if cmdgraph.Commands.Len() == 0 {
+		return nil
+	}
+	transforms, err := catalog.ReadJSONTransforms(dq)
+	if err != nil {
+		return err
+	}
+	tset := jsonx.NewTransformSet(transforms)
 	for e := cmdgraph.Commands.Front(); e != nil; e = e.Next() {
 		// Rewrite command
-		if err := rewriteCommand(e, rewriteJSON); err != nil {
+		if err := rewriteCommand(e, tset, jsonDepth, infer); err != nil {
 			log.Debug("%v", *(e.Value.(*command.Command)))
 			return fmt.Errorf("%v", err)
 		}
 	}
+	if err := infer.ResolveTypes(cat.Column); err != nil {
+		return fmt.Errorf("inferring json data types: %s", err)
+	}
 	return nil
 }
 
-func rewriteCommand(cmde *list.Element, rewriteJSON bool) error {
+func rewriteCommand(cmde *list.Element, tset *jsonx.TransformSet, jsonDepth int, infer *jsonx.TypeInference) error {
 	// Rewrite JSON objects.
-	columns := cmde.Value.(*command.Command).Column
+	cmd := cmde.Value.(*command.Command)
+	table := dbx.Table{Schema: cmd.SchemaName, Table: cmd.TableName}
+	columns := cmd.Column
 	for i := range columns {
 		col := columns[i]
-		if rewriteJSON && col.DType == command.JSONType {
-			if err := jsonx.RewriteJSON(cmde, &col); err != nil {
+		if col.DType == command.JSONType {
+			if err := jsonx.RewriteJSON(cmde, &col, tset.Lookup(table, col.Name), jsonDepth, infer); err != nil {
 				return fmt.Errorf("rewriting json data: %s", err)
 			}
 		}
@@ -2,12 +2,12 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"math"
 	"os"
 	"os/signal"
-	"regexp"
 	"runtime/debug"
 	"strings"
 	"sync"
@@ -17,6 +17,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/dsync"
 	"github.com/metadb-project/metadb/cmd/metadb/libpq"
@@ -49,15 +50,20 @@ type serverstate struct {
 	sources   []*sysdb.SourceConnector
 }
 
+// sourceList returns the configured data sources with their status.
+func (s *serverstate) sourceList() []*sysdb.SourceConnector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sources
+}
+
 // sproc stores state for a single poll loop.
 type sproc struct {
-	schemaPassFilter []*regexp.Regexp
-	schemaStopFilter []*regexp.Regexp
-	tableStopFilter  []*regexp.Regexp
-	source           *sysdb.SourceConnector
-	databases        []*sysdb.DatabaseConnector
-	sourceLog        *log.SourceLog
-	svr              *server
+	sourceOptions command.SourceOptions
+	source        *sysdb.SourceConnector
+	databases     []*sysdb.DatabaseConnector
+	sourceLog     *log.SourceLog
+	svr           *server
 }
 
 func Start(opt *option.Server) error {
@@ -90,6 +96,9 @@ func loggingServer(svr *server) error {
 	if err != nil {
 		return fmt.Errorf("reading configuration file: %v", err)
 	}
+	if svr.db.SecretKey, err = util.ReadSecretKey(svr.opt.Datadir); err != nil {
+		return err
+	}
 
 	svr.dp, err = dbx.NewPool(context.TODO(), svr.db.ConnString(svr.db.User, svr.db.Password))
 	if err != nil {
@@ -181,7 +190,11 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 
 	go goCreateFunctions(*(svr.db))
 
-	go libpq.Listen(svr.opt.Listen, svr.opt.Port, svr.db, &svr.state.sources)
+	tlsConfig, err := loadTLSConfig(svr.opt)
+	if err != nil {
+		return err
+	}
+	go libpq.Listen(svr.opt.Listen, svr.opt.Port, tlsConfig, svr.db, svr.state.sourceList)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -212,50 +225,32 @@ func mainServer(svr *server, cat *catalog.Catalog) error {
 	return nil
 }
 
-func isFolioModulePresent(db *dbx.DB) (bool, error) {
-	dc, err := db.Connect()
-	if err != nil {
-		return false, fmt.Errorf("connecting to database: %v", err)
-	}
-	defer dbx.Close(dc)
-	q := "SELECT 1 FROM metadb.source WHERE module='folio' LIMIT 1"
-	var n int32
-	err = dc.QueryRow(context.TODO(), q).Scan(&n)
-	switch {
-	case errors.Is(err, pgx.ErrNoRows):
-		return false, nil
-	case err != nil:
-		return false, fmt.Errorf("selecting module: %v", err)
-	default:
-		return true, nil
+// loadTLSConfig returns the TLS configuration for client connections, or nil if
+// no server certificate has been specified.
+func loadTLSConfig(opt *option.Server) (*tls.Config, error) {
+	if opt.TLSCert == "" || opt.NoTLS {
+		return nil, nil
 	}
-}
-
-func isReshareModulePresent(db *dbx.DB) (bool, error) {
-	dc, err := db.Connect()
+	cert, err := tls.LoadX509KeyPair(opt.TLSCert, opt.TLSKey)
 	if err != nil {
-		return false, fmt.Errorf("connecting to database: %v", err)
-	}
-	defer dbx.Close(dc)
-	q := "SELECT 1 FROM metadb.source WHERE module='reshare' LIMIT 1"
-	var n int32
-	err = dc.QueryRow(context.TODO(), q).Scan(&n)
-	switch {
-	case errors.Is(err, pgx.ErrNoRows):
-		return false, nil
-	case err != nil:
-		return false, fmt.Errorf("selecting module: %v", err)
-	default:
-		return true, nil
+		return nil, fmt.Errorf("loading server certificate: %v", err)
 	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
 }
 
-func goMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool) {
+// goMaintenance runs the scheduled maintenance of a data source until ctx is
+// canceled.
+func goMaintenance(ctx context.Context, datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool) {
 	for {
 		//stat := dp.Stat()
 		//log.Info("connection statistics: AcquireCount=%v AcquireDuration=%v AcquiredConns=%v CanceledAcquireCount=%v ConstructingConns=%v EmptyAcquireCount=%v IdleConns=%v MaxConns=%v MaxIdleDestroyCount=%v MaxLifetimeDestroyCount=%v NewConnsCount=%v TotalConns=%v",
 		//	stat.AcquireCount(), stat.AcquireDuration(), stat.AcquiredConns(), stat.CanceledAcquireCount(), stat.ConstructingConns(), stat.EmptyAcquireCount(), stat.IdleConns(), stat.MaxConns(), stat.MaxIdleDestroyCount(), stat.MaxLifetimeDestroyCount(), stat.NewConnsCount(), stat.TotalConns())
-		time.Sleep(5 * time.Minute)
+		if !sleepContext(ctx, 5*time.Minute) {
+			return
+		}
 		syncMode, err := dsync.ReadSyncMode(dp, source)
 		if err != nil {
 			log.Error("unable to read sync mode: %v", err)
@@ -268,14 +263,27 @@ func goMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Cat
 		if err := checkTimeDailyMaintenance(datadir, db, dp, cat, source, folio, reshare, syncMode); err != nil {
 			log.Error("%v", err)
 		}
-		time.Sleep(55 * time.Minute)
+		if !sleepContext(ctx, 55*time.Minute) {
+			return
+		}
+	}
+}
+
+// sleepContext pauses for duration d or until ctx is canceled.  It returns
+// false if ctx was canceled.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
 
 func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat *catalog.Catalog, source string, folio, reshare bool, syncMode dsync.Mode) error {
 	var overdue bool
-	q := "SELECT CURRENT_TIMESTAMP > next_maintenance_time FROM metadb.maintenance"
-	err := dp.QueryRow(context.TODO(), q).Scan(&overdue)
+	q := "SELECT CURRENT_TIMESTAMP > next_maintenance_time FROM metadb.source WHERE name=$1"
+	err := dp.QueryRow(context.TODO(), q, source).Scan(&overdue)
 	switch {
 	case errors.Is(err, pgx.ErrNoRows):
 		fallthrough
@@ -287,7 +295,7 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 		}
 	}
 
-	log.Debug("starting maintenance")
+	log.Debug("starting maintenance for source %q", source)
 
 	if folio && syncMode == dsync.NoSync {
 		tries := 0
@@ -349,10 +357,11 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 	}
 
 	// Schedule next maintenance
-	q = "UPDATE metadb.maintenance " +
+	q = "UPDATE metadb.source " +
 		"SET next_maintenance_time = next_maintenance_time +" +
-		" make_interval(0, 0, 0, (EXTRACT(DAY FROM (CURRENT_TIMESTAMP - next_maintenance_time)) + 1)::integer)"
-	if _, err = dp.Exec(context.TODO(), q); err != nil {
+		" make_interval(0, 0, 0, (EXTRACT(DAY FROM (CURRENT_TIMESTAMP - next_maintenance_time)) + 1)::integer)" +
+		" WHERE name=$1"
+	if _, err = dp.Exec(context.TODO(), q, source); err != nil {
 		return fmt.Errorf("error updating maintenance time: %v", err)
 	}
 
@@ -360,7 +369,7 @@ func checkTimeDailyMaintenance(datadir string, db dbx.DB, dp *pgxpool.Pool, cat
 	// 	return err
 	// }
 
-	log.Debug("completed maintenance")
+	log.Debug("completed maintenance for source %q", source)
 	return nil
 }
 
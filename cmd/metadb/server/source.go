@@ -0,0 +1,434 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/metadb-project/metadb/cmd/metadb/catalog"
+	"github.com/metadb-project/metadb/cmd/metadb/change"
+	"github.com/metadb-project/metadb/cmd/metadb/dbx"
+	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
+)
+
+// ChangeSource is a stream of change events read from a data source.
+type ChangeSource interface {
+	// Read returns the next change event, or nil if no event is available
+	// before the timeout expires.  It returns io.EOF if the source has no
+	// more events.
+	Read(timeout time.Duration) (*change.Event, error)
+	// Commit records that all change events read so far have been
+	// processed, so that they will not be read again after a restart.
+	Commit() error
+	// Idle waits for the timeout to expire without reading change events,
+	// while keeping the connection to the source alive.  Events that are
+	// not read are returned by later calls to Read.
+	Idle(timeout time.Duration) error
+	// Close releases resources held by the source.
+	Close() error
+}
+
+// kafkaSource reads Debezium change events from Kafka topics.  The position
+// in each topic partition is recorded in the database, by the executor
+// together with the data and by Commit, and the consumer seeks to the recorded
+// positions when partitions are assigned to it.
+type kafkaSource struct {
+	consumer  *kafka.Consumer
+	sourceLog *log.SourceLog
+	noCommit  bool
+	// sourceName and dq are used to record the read positions in the
+	// database.
+	sourceName string
+	dq         dbx.Queryable
+	// offsets contains the offset of the next event to be read in each
+	// topic partition.
+	offsets map[change.TopicPartition]int64
+	// avro decodes Avro-serialized messages, if a schema registry is
+	// configured.
+	avro *change.AvroDecoder
+	// stats records the committed offsets and high watermarks.
+	stats *sysdb.SourceStats
+	// paused is true if consumption has been paused by Idle.
+	paused bool
+}
+
+func newKafkaSource(spr *sproc) (*kafkaSource, error) {
+	var brokers = spr.source.Brokers
+	var topics = spr.source.Topics
+	var group = spr.source.Group
+	log.Debug("connecting to %q, topics %q", brokers, topics)
+	log.Debug("connecting to source %q", spr.source.Name)
+	var config = &kafka.ConfigMap{
+		"auto.offset.reset":    "earliest",
+		"bootstrap.servers":    brokers,
+		"enable.auto.commit":   false,
+		"group.id":             group,
+		"max.poll.interval.ms": spr.svr.db.MaxPollInterval,
+		"security.protocol":    spr.source.Security,
+	}
+	// Properties set by options such as "kafka.sasl.username".  The values
+	// may be secret and are not logged.
+	for name, value := range spr.source.KafkaOptions {
+		if err := config.SetKey(name, value); err != nil {
+			return nil, fmt.Errorf("setting Kafka option %q: %v", sysdb.KafkaOptionPrefix+name, err)
+		}
+	}
+	var avro *change.AvroDecoder
+	if spr.source.SchemaRegistry != "" {
+		registry, err := change.NewSchemaRegistry(spr.source.SchemaRegistry)
+		if err != nil {
+			return nil, err
+		}
+		avro = change.NewAvroDecoder(registry)
+	}
+	consumer, err := kafka.NewConsumer(config)
+	if err != nil {
+		return nil, err
+	}
+	s := &kafkaSource{
+		consumer:   consumer,
+		sourceLog:  spr.sourceLog,
+		noCommit:   spr.svr.opt.NoKafkaCommit,
+		sourceName: spr.source.Name,
+		dq:         spr.svr.dp,
+		offsets:    make(map[change.TopicPartition]int64),
+		avro:       avro,
+		stats:      spr.source.Stats,
+	}
+	var rebalance kafka.RebalanceCb
+	if !s.noCommit {
+		rebalance = s.rebalance
+	}
+	//err = consumer.SubscribeTopics([]string{"^" + topicPrefix + "[.].*"}, nil)
+	if err = consumer.SubscribeTopics(topics, rebalance); err != nil {
+		_ = consumer.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// rebalance seeks to the recorded positions when topic partitions are assigned
+// to the consumer.  Partitions that have no recorded position start at the
+// offset committed for the consumer group.
+func (s *kafkaSource) rebalance(c *kafka.Consumer, ev kafka.Event) error {
+	e, ok := ev.(kafka.AssignedPartitions)
+	if !ok {
+		return nil
+	}
+	offsets, err := catalog.ReadKafkaOffsets(s.dq, s.sourceName)
+	if err != nil {
+		// Offsets are committed to Kafka only after they have been
+		// recorded in the database, so the committed offsets may only
+		// cause events to be read again.
+		log.Error("%v", err)
+		return err
+	}
+	partitions := make([]kafka.TopicPartition, len(e.Partitions))
+	for i, p := range e.Partitions {
+		partitions[i] = p
+		if p.Topic == nil {
+			continue
+		}
+		if offset, ok := offsets[change.TopicPartition{Topic: *p.Topic, Partition: p.Partition}]; ok {
+			partitions[i].Offset = kafka.Offset(offset)
+			log.Debug("source %q: resuming topic %q partition %d at offset %d", s.sourceName, *p.Topic, p.Partition, offset)
+		}
+	}
+	if c.GetRebalanceProtocol() == "COOPERATIVE" {
+		return c.IncrementalAssign(partitions)
+	}
+	return c.Assign(partitions)
+}
+
+func (s *kafkaSource) Read(timeout time.Duration) (*change.Event, error) {
+	if s.paused {
+		assigned, err := s.consumer.Assignment()
+		if err != nil {
+			return nil, fmt.Errorf("reading partition assignment: %v", err)
+		}
+		if err = s.consumer.Resume(assigned); err != nil {
+			return nil, fmt.Errorf("resuming consumer: %v", err)
+		}
+		s.paused = false
+	}
+	msg, err := readChangeEvent(s.consumer, s.sourceLog, int(timeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("reading message from Kafka: %v", err)
+	}
+	if msg == nil { // Poll timeout is indicated by the nil return.
+		return nil, nil
+	}
+	var ce *change.Event
+	if s.avro != nil {
+		ce, err = s.avro.NewEvent(msg)
+	} else {
+		ce, err = change.NewEvent(msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ce.Offset != nil {
+		s.offsets[ce.Offset.TopicPartition] = ce.Offset.Offset + 1
+	}
+	if s.noCommit {
+		// Positions are not recorded, so that the events will be read
+		// again after a restart.
+		ce.Offset = nil
+	}
+	return ce, nil
+}
+
+// Commit records the positions after the last events read, and then commits
+// the offsets to Kafka.  The executor has already recorded the positions of
+// events that changed data; this also records events that were skipped.
+func (s *kafkaSource) Commit() error {
+	if s.noCommit {
+		s.updateStats()
+		return nil
+	}
+	if err := catalog.WriteKafkaOffsets(s.dq, s.sourceName, s.offsets); err != nil {
+		return err
+	}
+	s.updateStats()
+	if _, err := s.consumer.Commit(); err != nil {
+		e := err.(kafka.Error)
+		if e.IsFatal() {
+			//return fmt.Errorf("Kafka commit: %v", e)
+			log.Warning("Kafka commit: %v", e)
+		} else {
+			switch e.Code() {
+			case kafka.ErrNoOffset:
+				log.Debug("Kafka commit: %v", e)
+			default:
+				log.Info("Kafka commit: %v", e)
+			}
+		}
+	}
+	return nil
+}
+
+// Idle pauses consumption of the assigned partitions and polls the consumer
+// until the timeout expires, so that it remains a member of the consumer
+// group.  Consumption is resumed by the next call to Read.
+func (s *kafkaSource) Idle(timeout time.Duration) error {
+	// Partitions assigned since the last call are paused as well.
+	assigned, err := s.consumer.Assignment()
+	if err != nil {
+		return fmt.Errorf("reading partition assignment: %v", err)
+	}
+	if err = s.consumer.Pause(assigned); err != nil {
+		return fmt.Errorf("pausing consumer: %v", err)
+	}
+	s.paused = true
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		msg, err := readChangeEvent(s.consumer, nil, int(time.Until(deadline).Milliseconds()))
+		if err != nil {
+			return fmt.Errorf("reading message from Kafka: %v", err)
+		}
+		if msg == nil {
+			continue
+		}
+		// The message was fetched before its partition was paused.
+		// Seek back so that it will be read after consumption resumes.
+		if err = s.consumer.Seek(msg.TopicPartition, int(kafkaQueryTimeout.Milliseconds())); err != nil {
+			return fmt.Errorf("seeking topic %q partition %d to offset %d: %v", *msg.TopicPartition.Topic,
+				msg.TopicPartition.Partition, msg.TopicPartition.Offset, err)
+		}
+	}
+	return nil
+}
+
+// updateStats records the positions after the last events read, with the
+// high watermarks last fetched by the consumer.
+func (s *kafkaSource) updateStats() {
+	for tp, offset := range s.offsets {
+		topic := tp.Topic
+		_, high, err := s.consumer.GetWatermarkOffsets(topic, tp.Partition)
+		if err != nil || high < 0 {
+			// The high watermark has not been fetched.
+			high = -1
+		}
+		s.stats.SetPartition(sysdb.PartitionStats{
+			Topic:         topic,
+			Partition:     tp.Partition,
+			Committed:     offset,
+			HighWatermark: high,
+		})
+	}
+}
+
+// kafkaQueryTimeout is the time allowed for queries to the Kafka brokers that
+// look up offsets and seek the consumer.
+const kafkaQueryTimeout = 10 * time.Second
+
+// kafkaOffsetResetExpiry is the time after which a request to reset offsets
+// is discarded, if no partitions of the requested topics have been assigned to
+// the consumer.
+const kafkaOffsetResetExpiry = 10 * time.Minute
+
+// resetKafkaOffsets carries out pending requests to reset the offsets of a
+// Kafka data source.  A request that fails is logged and discarded.  Requests
+// remain pending until partitions of the requested topics have been assigned
+// to the consumer, or until they expire.
+func resetKafkaOffsets(spr *sproc, src ChangeSource) error {
+	ks, ok := src.(*kafkaSource)
+	if !ok {
+		return nil
+	}
+	resets, err := catalog.ReadKafkaOffsetResets(spr.svr.dp, spr.source.Name)
+	if err != nil {
+		return err
+	}
+	for _, r := range resets {
+		done, err := ks.resetOffsets(r)
+		switch {
+		case err != nil:
+			err = fmt.Errorf("source %q: resetting offsets: %v", spr.source.Name, err)
+			log.Error("%v", err)
+			spr.source.Stats.SetError(err)
+		case !done && time.Since(r.Requested) < kafkaOffsetResetExpiry:
+			continue
+		case !done:
+			err = fmt.Errorf("source %q: resetting offsets: no partitions of topic %q are assigned; "+
+				"request discarded", spr.source.Name, r.Topic)
+			if r.Topic == "" {
+				err = fmt.Errorf("source %q: resetting offsets: no partitions are assigned; request discarded",
+					spr.source.Name)
+			}
+			log.Warning("%v", err)
+			spr.source.Stats.SetError(err)
+		}
+		if err = catalog.DeleteKafkaOffsetReset(spr.svr.dp, r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetOffsets seeks the consumer to the position given by a reset request,
+// in the assigned partitions of the requested topic, or of all topics if no
+// topic is given.  Unless offsets are not being committed, the new positions
+// are recorded in the database and committed to Kafka, so that they are kept
+// after a rebalance or restart.  It returns false if no matching partitions
+// are assigned.
+func (s *kafkaSource) resetOffsets(r *catalog.KafkaOffsetReset) (bool, error) {
+	assigned, err := s.consumer.Assignment()
+	if err != nil {
+		return false, fmt.Errorf("reading partition assignment: %v", err)
+	}
+	var partitions []kafka.TopicPartition
+	for _, p := range assigned {
+		if p.Topic != nil && (r.Topic == "" || *p.Topic == r.Topic) {
+			partitions = append(partitions, kafka.TopicPartition{Topic: p.Topic, Partition: p.Partition})
+		}
+	}
+	if len(partitions) == 0 {
+		return false, nil
+	}
+	timeoutMs := int(kafkaQueryTimeout.Milliseconds())
+	// For a timestamp, look up the earliest offset in each partition whose
+	// timestamp is equal to or later than it.
+	times := make(map[change.TopicPartition]int64)
+	if r.Position == "timestamp" {
+		query := make([]kafka.TopicPartition, len(partitions))
+		for i, p := range partitions {
+			query[i] = kafka.TopicPartition{Topic: p.Topic, Partition: p.Partition,
+				Offset: kafka.Offset(r.Time.UnixMilli())}
+		}
+		found, err := s.consumer.OffsetsForTimes(query, timeoutMs)
+		if err != nil {
+			return false, fmt.Errorf("looking up offsets for time %s: %v", r.Time.Format(time.RFC3339), err)
+		}
+		for _, p := range found {
+			if p.Topic != nil {
+				times[change.TopicPartition{Topic: *p.Topic, Partition: p.Partition}] = int64(p.Offset)
+			}
+		}
+	}
+	offsets := make(map[change.TopicPartition]int64)
+	for i, p := range partitions {
+		tp := change.TopicPartition{Topic: *p.Topic, Partition: p.Partition}
+		low, high, err := s.consumer.QueryWatermarkOffsets(tp.Topic, tp.Partition, timeoutMs)
+		if err != nil {
+			return false, fmt.Errorf("reading watermarks of topic %q partition %d: %v", tp.Topic, tp.Partition, err)
+		}
+		t, ok := times[tp]
+		offset, err := resetOffsetPosition(r.Position, low, high, t, ok)
+		if err != nil {
+			return false, err
+		}
+		partitions[i].Offset = kafka.Offset(offset)
+		if err = s.consumer.Seek(partitions[i], timeoutMs); err != nil {
+			return false, fmt.Errorf("seeking topic %q partition %d to offset %d: %v", tp.Topic, tp.Partition,
+				offset, err)
+		}
+		previous, ok := s.offsets[tp]
+		if ok {
+			log.Info("source %q: reset topic %q partition %d from offset %d to %d", s.sourceName, tp.Topic,
+				tp.Partition, previous, offset)
+		} else {
+			log.Info("source %q: reset topic %q partition %d to offset %d", s.sourceName, tp.Topic,
+				tp.Partition, offset)
+		}
+		s.offsets[tp] = offset
+		offsets[tp] = offset
+	}
+	if !s.noCommit {
+		if err := catalog.WriteKafkaOffsets(s.dq, s.sourceName, offsets); err != nil {
+			return false, err
+		}
+		if _, err := s.consumer.CommitOffsets(partitions); err != nil {
+			log.Warning("Kafka commit: %v", err)
+		}
+	}
+	s.updateStats()
+	return true, nil
+}
+
+// resetOffsetPosition returns the offset that a partition is reset to, given
+// its low and high watermarks.  For a timestamp, t is the offset found for the
+// timestamp, if found is true; if there are no events at or after the
+// timestamp, the high watermark is used.
+func resetOffsetPosition(position string, low, high, t int64, found bool) (int64, error) {
+	switch position {
+	case "earliest":
+		return low, nil
+	case "latest":
+		return high, nil
+	case "timestamp":
+		if !found || t < 0 {
+			return high, nil
+		}
+		return t, nil
+	default:
+		return 0, fmt.Errorf("unknown position %q", position)
+	}
+}
+
+func (s *kafkaSource) Close() error {
+	return s.consumer.Close()
+}
+
+// logChangeEvent writes a change event to the source log in the same form as
+// a Kafka message, so that the log can be read back with --sourcefile.
+func logChangeEvent(sourceLog *log.SourceLog, ce *change.Event) {
+	if sourceLog == nil {
+		return
+	}
+	key, err := json.Marshal(ce.Key)
+	if err != nil {
+		log.Warning("source log: %v", err)
+		return
+	}
+	value, err := json.Marshal(ce.Value)
+	if err != nil {
+		log.Warning("source log: %v", err)
+		return
+	}
+	sourceLog.Log("#")
+	sourceLog.Log(string(key))
+	sourceLog.Log(string(value))
+}
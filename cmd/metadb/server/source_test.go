@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestResetOffsetPosition(t *testing.T) {
+	cases := []struct {
+		position string
+		t        int64
+		found    bool
+		want     int64
+	}{
+		{"earliest", 0, false, 10},
+		{"latest", 0, false, 50},
+		{"timestamp", 25, true, 25},
+		{"timestamp", 10, true, 10},
+		// No events at or after the timestamp.
+		{"timestamp", -1, true, 50},
+		{"timestamp", 0, false, 50},
+	}
+	for _, c := range cases {
+		got, err := resetOffsetPosition(c.position, 10, 50, c.t, c.found)
+		if err != nil {
+			t.Errorf("resetOffsetPosition(%q, %d, %v): %v", c.position, c.t, c.found, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("resetOffsetPosition(%q, %d, %v) = %d; want %d", c.position, c.t, c.found, got, c.want)
+		}
+	}
+	if _, err := resetOffsetPosition("beginning", 10, 50, 0, false); err == nil {
+		t.Errorf("resetOffsetPosition(\"beginning\"): got success; want error")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/command"
 	"github.com/metadb-project/metadb/cmd/metadb/dbx"
 	"github.com/metadb-project/metadb/cmd/metadb/log"
+	"github.com/metadb-project/metadb/cmd/metadb/sysdb"
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
@@ -24,7 +25,7 @@ func SQLFunc(datadir string, cat *catalog.Catalog, db dbx.DB, url, ref, path, sc
 		return err
 	}
 	defer dbx.Close(dc)
-	users, err := catalog.AllUsers(dc)
+	users, err := sysdb.AllTablesUsers(dc)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,50 @@
+package sysdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DeadLetterPolicy determines what happens when a change event from a data
+// source cannot be parsed or written to the database.  In all cases the event
+// is recorded as a dead letter.
+type DeadLetterPolicy struct {
+	// Skip is true if processing continues with the next event, or false
+	// if the data source halts.
+	Skip bool
+	// Retries is the number of times that writing a batch of events is
+	// retried before the policy is applied.
+	Retries int
+}
+
+// ParseDeadLetterPolicy parses the value of the deadletter option:  "halt",
+// "skip", or "retry N".  The default is "halt".
+func ParseDeadLetterPolicy(s string) (DeadLetterPolicy, error) {
+	f := strings.Fields(strings.ToLower(s))
+	switch {
+	case len(f) == 0, len(f) == 1 && f[0] == "halt":
+		return DeadLetterPolicy{}, nil
+	case len(f) == 1 && f[0] == "skip":
+		return DeadLetterPolicy{Skip: true}, nil
+	case len(f) == 2 && f[0] == "retry":
+		n, err := strconv.Atoi(f[1])
+		if err != nil || n < 1 {
+			return DeadLetterPolicy{}, fmt.Errorf("invalid number of retries in dead letter policy %q", s)
+		}
+		return DeadLetterPolicy{Retries: n}, nil
+	default:
+		return DeadLetterPolicy{}, fmt.Errorf("invalid dead letter policy %q", s)
+	}
+}
+
+func (p DeadLetterPolicy) String() string {
+	switch {
+	case p.Skip:
+		return "skip"
+	case p.Retries > 0:
+		return "retry " + strconv.Itoa(p.Retries)
+	default:
+		return "halt"
+	}
+}
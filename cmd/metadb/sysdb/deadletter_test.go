@@ -0,0 +1,30 @@
+package sysdb
+
+import "testing"
+
+func TestParseDeadLetterPolicy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want DeadLetterPolicy
+	}{
+		{"", DeadLetterPolicy{}},
+		{"halt", DeadLetterPolicy{}},
+		{"SKIP", DeadLetterPolicy{Skip: true}},
+		{"retry 3", DeadLetterPolicy{Retries: 3}},
+	}
+	for _, tt := range tests {
+		got, err := ParseDeadLetterPolicy(tt.s)
+		if err != nil {
+			t.Errorf("ParseDeadLetterPolicy(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDeadLetterPolicy(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+	for _, s := range []string{"retry", "retry 0", "retry x", "skip 1", "ignore"} {
+		if _, err := ParseDeadLetterPolicy(s); err == nil {
+			t.Errorf("ParseDeadLetterPolicy(%q): expected error", s)
+		}
+	}
+}
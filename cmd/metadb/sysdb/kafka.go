@@ -0,0 +1,76 @@
+package sysdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KafkaOptionPrefix is the prefix of data source options that set properties
+// of the Kafka consumer.  For example, the option "kafka.sasl.username" sets
+// the librdkafka property "sasl.username".
+const KafkaOptionPrefix = "kafka."
+
+// kafkaProperties lists the librdkafka consumer properties that may be set
+// using data source options, and whether their values are secret.  Properties
+// that Metadb sets itself, such as "group.id", are not included.
+var kafkaProperties = map[string]bool{
+	// Authentication
+	"sasl.mechanism":                      false,
+	"sasl.username":                       false,
+	"sasl.password":                       true,
+	"sasl.oauthbearer.method":             false,
+	"sasl.oauthbearer.client.id":          false,
+	"sasl.oauthbearer.client.secret":      true,
+	"sasl.oauthbearer.scope":              false,
+	"sasl.oauthbearer.token.endpoint.url": false,
+	// TLS
+	"ssl.ca.location":                       false,
+	"ssl.ca.pem":                            false,
+	"ssl.certificate.location":              false,
+	"ssl.certificate.pem":                   false,
+	"ssl.key.location":                      false,
+	"ssl.key.pem":                           true,
+	"ssl.key.password":                      true,
+	"ssl.endpoint.identification.algorithm": false,
+	// Tuning
+	"client.id":                     false,
+	"fetch.min.bytes":               false,
+	"fetch.max.bytes":               false,
+	"fetch.wait.max.ms":             false,
+	"max.partition.fetch.bytes":     false,
+	"queued.min.messages":           false,
+	"queued.max.messages.kbytes":    false,
+	"session.timeout.ms":            false,
+	"heartbeat.interval.ms":         false,
+	"socket.timeout.ms":             false,
+	"partition.assignment.strategy": false,
+}
+
+// ParseKafkaOption returns the Kafka consumer property set by a data source
+// option beginning with KafkaOptionPrefix, and whether its value is secret.
+func ParseKafkaOption(name string) (string, bool, error) {
+	property := strings.TrimPrefix(strings.ToLower(name), KafkaOptionPrefix)
+	secret, ok := kafkaProperties[property]
+	if !ok {
+		return "", false, fmt.Errorf("invalid Kafka option %q", name)
+	}
+	return property, secret, nil
+}
+
+// IsKafkaOption returns true if name is a data source option that sets a Kafka
+// consumer property.
+func IsKafkaOption(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), KafkaOptionPrefix)
+}
+
+// KafkaOptionNames returns the names of the data source options that set
+// Kafka consumer properties, in sorted order.
+func KafkaOptionNames() []string {
+	names := make([]string, 0, len(kafkaProperties))
+	for p := range kafkaProperties {
+		names = append(names, KafkaOptionPrefix+p)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,36 @@
+package sysdb
+
+import "testing"
+
+func TestParseKafkaOption(t *testing.T) {
+	cases := []struct {
+		name     string
+		property string
+		secret   bool
+		ok       bool
+	}{
+		{"kafka.sasl.username", "sasl.username", false, true},
+		{"kafka.sasl.password", "sasl.password", true, true},
+		{"KAFKA.SSL.CA.LOCATION", "ssl.ca.location", false, true},
+		{"kafka.fetch.max.bytes", "fetch.max.bytes", false, true},
+		{"kafka.group.id", "", false, false},
+		{"kafka.bootstrap.servers", "", false, false},
+		{"kafka.", "", false, false},
+	}
+	for _, c := range cases {
+		property, secret, err := ParseKafkaOption(c.name)
+		if (err == nil) != c.ok || property != c.property || secret != c.secret {
+			t.Errorf("ParseKafkaOption(%q) = %q, %v, %v; want %q, %v, ok=%v",
+				c.name, property, secret, err, c.property, c.secret, c.ok)
+		}
+	}
+}
+
+func TestIsKafkaOption(t *testing.T) {
+	if !IsKafkaOption("Kafka.sasl.mechanism") {
+		t.Errorf("IsKafkaOption(\"Kafka.sasl.mechanism\") = false; want true")
+	}
+	if IsKafkaOption("brokers") {
+		t.Errorf("IsKafkaOption(\"brokers\") = true; want false")
+	}
+}
@@ -2,6 +2,7 @@ package sysdb
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
@@ -22,7 +23,10 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 		"SELECT name,enable,coalesce(brokers,''),coalesce(security,''),coalesce(topics,''),"+
 		"coalesce(consumergroup,''),coalesce(schemapassfilter,''),coalesce(schemastopfilter,''),"+
 		"coalesce(tablestopfilter,''),coalesce(trimschemaprefix,''),coalesce(addschemaprefix,''),"+
-		"coalesce(module,'') FROM metadb.source")
+		"coalesce(module,''),type,coalesce(connection,''),coalesce(publication,''),"+
+		"coalesce(slot,''),coalesce(path,''),coalesce(schemaregistry,''),"+
+		"coalesce(schemarewrite,''),coalesce(tablerewrite,''),coalesce(tablepassfilter,''),"+
+		"coalesce(columnpassfilter,''),coalesce(columnstopfilter,''),coalesce(deadletter,'') FROM metadb.source")
 	if err != nil {
 		return nil, err
 	}
@@ -39,11 +43,20 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 		var trimschemaprefix string
 		var addschemaprefix string
 		var module string
+		var srctype, connection, publication, slot, path, schemaregistry string
+		var schemarewrite, tablerewrite string
+		var tablepassfilter, columnpassfilter, columnstopfilter string
+		var deadletter string
 		if err := rows.Scan(&name, &enable, &brokers, &security, &topics, &consumergroup, &schemapassfilter,
 			&schemastopfilter, &tablestopfilter, &trimschemaprefix, &addschemaprefix,
-			&module); err != nil {
+			&module, &srctype, &connection, &publication, &slot, &path, &schemaregistry,
+			&schemarewrite, &tablerewrite, &tablepassfilter, &columnpassfilter, &columnstopfilter, &deadletter); err != nil {
 			return nil, err
 		}
+		policy, err := ParseDeadLetterPolicy(deadletter)
+		if err != nil {
+			return nil, fmt.Errorf("data source %q: %v", name, err)
+		}
 		if security == "" {
 			security = "ssl"
 		}
@@ -56,14 +69,64 @@ func ReadSourceConnectors(db *dbx.DB) ([]*SourceConnector, error) {
 			Group:            consumergroup,
 			SchemaPassFilter: util.SplitList(schemapassfilter),
 			SchemaStopFilter: util.SplitList(schemastopfilter),
+			TablePassFilter:  util.SplitList(tablepassfilter),
 			TableStopFilter:  util.SplitList(tablestopfilter),
+			ColumnPassFilter: util.SplitList(columnpassfilter),
+			ColumnStopFilter: util.SplitList(columnstopfilter),
 			TrimSchemaPrefix: trimschemaprefix,
 			AddSchemaPrefix:  addschemaprefix,
+			SchemaRewrite:    util.SplitRewriteRules(schemarewrite),
+			TableRewrite:     util.SplitRewriteRules(tablerewrite),
 			Module:           module,
+			Type:             srctype,
+			Connection:       connection,
+			Publication:      publication,
+			Slot:             slot,
+			Path:             path,
+			SchemaRegistry:   schemaregistry,
+			DeadLetter:       policy,
+			Stats:            new(SourceStats),
 		})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if err = readKafkaOptions(dbc, db.SecretKey, src); err != nil {
+		return nil, err
+	}
 	return src, nil
 }
+
+// readKafkaOptions reads the Kafka consumer properties of data sources,
+// decrypting secret values with key.
+func readKafkaOptions(dbc *pgx.Conn, key []byte, sources []*SourceConnector) error {
+	rows, err := dbc.Query(context.TODO(), "SELECT source_name, name, value, secret FROM metadb.kafka_option")
+	if err != nil {
+		return fmt.Errorf("reading Kafka options: %v", err)
+	}
+	defer rows.Close()
+	options := make(map[string]map[string]string)
+	for rows.Next() {
+		var source, name, value string
+		var secret bool
+		if err = rows.Scan(&source, &name, &value, &secret); err != nil {
+			return fmt.Errorf("reading Kafka options: %v", err)
+		}
+		if secret {
+			if value, err = util.DecryptSecret(key, value); err != nil {
+				return fmt.Errorf("data source %q: option %q: %v", source, KafkaOptionPrefix+name, err)
+			}
+		}
+		if options[source] == nil {
+			options[source] = make(map[string]string)
+		}
+		options[source][name] = value
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("reading Kafka options: %v", err)
+	}
+	for _, s := range sources {
+		s.KafkaOptions = options[s.Name]
+	}
+	return nil
+}
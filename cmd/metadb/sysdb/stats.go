@@ -0,0 +1,121 @@
+package sysdb
+
+import (
+	"sort"
+	"sync"
+)
+
+// SourceStats contains statistics on the progress of a data source.  It can
+// be updated and read concurrently.
+type SourceStats struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]PartitionStats
+	// eventsPerSecond is the rate of change events read in the most
+	// recent batch.
+	eventsPerSecond float64
+	// lastEventTime is the source timestamp of the last change event
+	// read.
+	lastEventTime string
+	lastError     string
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// PartitionStats describes the position of a data source in a Kafka topic
+// partition.
+type PartitionStats struct {
+	Topic     string
+	Partition int32
+	// Committed is the offset of the next message to be read after the
+	// last commit.
+	Committed int64
+	// HighWatermark is the offset following the last message in the
+	// partition, or -1 if it is not known.
+	HighWatermark int64
+}
+
+// Lag returns the number of messages in the partition that have not been
+// committed, or -1 if it is not known.
+func (p PartitionStats) Lag() int64 {
+	if p.HighWatermark < 0 || p.Committed < 0 {
+		return -1
+	}
+	return max(p.HighWatermark-p.Committed, 0)
+}
+
+// Stats is a copy of the statistics in SourceStats.
+type Stats struct {
+	// Partitions is sorted by topic and partition.
+	Partitions      []PartitionStats
+	EventsPerSecond float64
+	LastEventTime   string
+	LastError       string
+}
+
+// Lag returns the total lag of the partitions, or -1 if it is not known for
+// any partition.
+func (s Stats) Lag() int64 {
+	var lag int64 = -1
+	for _, p := range s.Partitions {
+		if l := p.Lag(); l >= 0 {
+			lag = max(lag, 0) + l
+		}
+	}
+	return lag
+}
+
+// SetPartition records the position in a topic partition.
+func (s *SourceStats) SetPartition(p PartitionStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.partitions == nil {
+		s.partitions = make(map[partitionKey]PartitionStats)
+	}
+	s.partitions[partitionKey{topic: p.Topic, partition: p.Partition}] = p
+}
+
+// SetEvents records that n change events were read in seconds, and the source
+// timestamp of the last event, if any.
+func (s *SourceStats) SetEvents(n int, seconds float64, lastEventTime string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seconds > 0 {
+		s.eventsPerSecond = float64(n) / seconds
+	}
+	if lastEventTime != "" {
+		s.lastEventTime = lastEventTime
+	}
+}
+
+// SetError records the last error that occurred in the data source.
+func (s *SourceStats) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+}
+
+// Get returns a copy of the statistics.
+func (s *SourceStats) Get() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{
+		Partitions:      make([]PartitionStats, 0, len(s.partitions)),
+		EventsPerSecond: s.eventsPerSecond,
+		LastEventTime:   s.lastEventTime,
+		LastError:       s.lastError,
+	}
+	for _, p := range s.partitions {
+		st.Partitions = append(st.Partitions, p)
+	}
+	sort.Slice(st.Partitions, func(i, j int) bool {
+		a, b := st.Partitions[i], st.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return st
+}
@@ -0,0 +1,45 @@
+package sysdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSourceStats(t *testing.T) {
+	var s SourceStats
+	if lag := s.Get().Lag(); lag != -1 {
+		t.Errorf("Lag() with no partitions = %d; want -1", lag)
+	}
+	s.SetPartition(PartitionStats{Topic: "b", Partition: 0, Committed: 5, HighWatermark: 8})
+	s.SetPartition(PartitionStats{Topic: "a", Partition: 1, Committed: 10, HighWatermark: 10})
+	s.SetPartition(PartitionStats{Topic: "a", Partition: 0, Committed: 3, HighWatermark: -1})
+	s.SetPartition(PartitionStats{Topic: "b", Partition: 0, Committed: 6, HighWatermark: 9})
+	s.SetEvents(50, 2, "2024-01-01 00:00:00Z")
+	s.SetEvents(0, 2, "")
+	s.SetError(errors.New("failed"))
+	st := s.Get()
+	want := []PartitionStats{
+		{Topic: "a", Partition: 0, Committed: 3, HighWatermark: -1},
+		{Topic: "a", Partition: 1, Committed: 10, HighWatermark: 10},
+		{Topic: "b", Partition: 0, Committed: 6, HighWatermark: 9},
+	}
+	if !reflect.DeepEqual(st.Partitions, want) {
+		t.Errorf("Partitions = %v; want %v", st.Partitions, want)
+	}
+	if lag := st.Partitions[0].Lag(); lag != -1 {
+		t.Errorf("Lag() with unknown high watermark = %d; want -1", lag)
+	}
+	if lag := st.Lag(); lag != 3 {
+		t.Errorf("Lag() = %d; want 3", lag)
+	}
+	if st.EventsPerSecond != 0 {
+		t.Errorf("EventsPerSecond = %v; want 0", st.EventsPerSecond)
+	}
+	if st.LastEventTime != "2024-01-01 00:00:00Z" {
+		t.Errorf("LastEventTime = %q; want the time of the last event read", st.LastEventTime)
+	}
+	if st.LastError != "failed" {
+		t.Errorf("LastError = %q; want %q", st.LastError, "failed")
+	}
+}
@@ -1,6 +1,8 @@
 package sysdb
 
 import (
+	"reflect"
+
 	"github.com/metadb-project/metadb/cmd/internal/status"
 )
 
@@ -31,11 +33,43 @@ type SourceConnector struct {
 	Group            string
 	SchemaPassFilter []string
 	SchemaStopFilter []string
+	TablePassFilter  []string
 	TableStopFilter  []string
+	// ColumnPassFilter and ColumnStopFilter are column filters written in
+	// the form table=column.
+	ColumnPassFilter []string
+	ColumnStopFilter []string
 	TrimSchemaPrefix string
 	AddSchemaPrefix  string
-	Module           string
-	Status           status.Status
+	// SchemaRewrite and TableRewrite are rewrite rules applied to schema
+	// and table names.
+	SchemaRewrite []string
+	TableRewrite  []string
+	Module        string
+	// Type is the kind of data source:  "kafka", "postgresql", or "file".
+	Type string
+	// Connection, Publication, and Slot configure a PostgreSQL logical
+	// replication source.
+	Connection  string
+	Publication string
+	Slot        string
+	// Path is the file or directory read by a file source.
+	Path string
+	// SchemaRegistry is the URL of a schema registry used to decode
+	// Avro-serialized messages.
+	SchemaRegistry string
+	// DeadLetter is the policy for change events that cannot be parsed
+	// or written to the database.
+	DeadLetter DeadLetterPolicy
+	// KafkaOptions contains Kafka consumer properties set using options
+	// beginning with KafkaOptionPrefix.
+	KafkaOptions map[string]string
+	Status       status.Status
+	// Stats contains statistics on the progress of the data source.
+	Stats *SourceStats
+	// LastSeen is the time when a message, including a heartbeat, was
+	// last received from the source.
+	LastSeen status.Timestamp
 }
 
 //var sysMu dsync.Mutex
@@ -347,3 +381,13 @@ type SourceConnector struct {
 //		return dbversion, nil
 //	}
 //}
+
+// SameConfig reports whether s and t have the same configuration, ignoring
+// their status.
+func (s *SourceConnector) SameConfig(t *SourceConnector) bool {
+	a, b := *s, *t
+	a.Status, b.Status = 0, 0
+	a.LastSeen, b.LastSeen = 0, 0
+	a.Stats, b.Stats = nil, nil
+	return reflect.DeepEqual(a, b)
+}
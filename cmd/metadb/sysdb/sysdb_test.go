@@ -0,0 +1,27 @@
+package sysdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSourceConnectorSameConfig(t *testing.T) {
+	a := &SourceConnector{Name: "sensor", Brokers: "kafka:29092", Topics: []string{"^metadb_sensor_1[.].*"}}
+	b := &SourceConnector{Name: "sensor", Brokers: "kafka:29092", Topics: []string{"^metadb_sensor_1[.].*"}}
+	b.Status.Active()
+	b.LastSeen.Set(time.Now())
+	b.Stats = new(SourceStats)
+	b.Stats.SetEvents(10, 1, "2024-01-01 00:00:00Z")
+	if !a.SameConfig(b) {
+		t.Errorf("SameConfig() = false for sources differing only in status")
+	}
+	b.Topics = []string{"^metadb_sensor_2[.].*"}
+	if a.SameConfig(b) {
+		t.Errorf("SameConfig() = true for sources with different topics")
+	}
+	b.Topics = a.Topics
+	b.DeadLetter = DeadLetterPolicy{Skip: true}
+	if a.SameConfig(b) {
+		t.Errorf("SameConfig() = true for sources with different dead letter policies")
+	}
+}
@@ -2,6 +2,7 @@ package sysdb
 
 import (
 	"context"
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -11,6 +12,19 @@ import (
 	"github.com/metadb-project/metadb/cmd/metadb/util"
 )
 
+// UserPermsPending returns true if there are user authorizations that have
+// not yet been applied by GoUpdateUserPerms.
+func UserPermsPending(dq dbx.Queryable) (bool, error) {
+	var pending bool
+	q := "SELECT EXISTS(SELECT 1 FROM metadb.auth WHERE NOT dbupdated)"
+	if err := dq.QueryRow(context.TODO(), q).Scan(&pending); err != nil {
+		return false, fmt.Errorf("reading user authorizations: %v", err)
+	}
+	return pending, nil
+}
+
+// GoUpdateUserPerms applies the user authorizations that have changed to the
+// given tables, which should include the tables of all data sources.
 func GoUpdateUserPerms(dc, dcsuper *pgx.Conn, trackedTables []dbx.Table) {
 	//adb, err := sqlx.Open("postgresql", &dsn)
 	//if err != nil {
@@ -23,71 +37,110 @@ func GoUpdateUserPerms(dc, dcsuper *pgx.Conn, trackedTables []dbx.Table) {
 		log.Error("updating user permissions: reading users: %v", err)
 		return
 	}
+	// Main tables are handled together with their current tables, which are
+	// matched against the user's table patterns.
 	tables := make([]dbx.Table, len(trackedTables))
 	copy(tables, trackedTables)
-	for _, t := range trackedTables {
-		tables = append(tables, t.Main())
-	}
 	tables = append(tables, dbx.Table{Schema: "metadb", Table: "log"})
 	tables = append(tables, dbx.Table{Schema: "metadb", Table: "table_update"})
 	tables = append(tables, dbx.Table{Schema: "metadb", Table: "base_table"})
 	tables = append(tables, dbx.Table{Schema: "folio_source_record", Table: "marc__t"})
 	for u, re := range users {
+		// schemas records whether any table has been granted in each
+		// schema.
+		schemas := make(map[string]bool)
 		for _, t := range tables {
 			//t := sqlx.Table{Schema: oldt.Schema, Table: oldt.Table}
-			if re.String == "" {
+			if re.String != "" && util.UserPerm(re, &t) {
+				// Grant if regex matches
+				_, _ = dcsuper.Exec(context.TODO(), "GRANT USAGE ON SCHEMA "+t.Schema+" TO "+u)
+				_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON "+t.SQL()+" TO "+u)
+				_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON "+t.MainSQL()+" TO "+u)
+				//_, _ = adb.Exec(nil, "GRANT SELECT ON "+adb.HistoryTableSQL(&t)+" TO "+u)
+				schemas[t.Schema] = true
+			} else {
 				// Revoke
-				//_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA \""+t.Schema+"\" FROM "+u)
 				_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.SQL()+" FROM "+u)
 				_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.MainSQL()+" FROM "+u)
 				//_, _ = adb.Exec(nil, "REVOKE SELECT ON "+adb.HistoryTableSQL(&t)+" FROM "+u)
-			} else {
-				// Grant if regex matches
-				if util.UserPerm(re, &t) {
-					_, _ = dcsuper.Exec(context.TODO(), "GRANT USAGE ON SCHEMA "+t.Schema+" TO "+u)
-					_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON "+t.SQL()+" TO "+u)
-					_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON "+t.MainSQL()+" TO "+u)
-					//_, _ = adb.Exec(nil, "GRANT SELECT ON "+adb.HistoryTableSQL(&t)+" TO "+u)
-				} else {
-					_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.SQL()+" FROM "+u)
-					_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON "+t.MainSQL()+" FROM "+u)
-					//_, _ = adb.Exec(nil, "REVOKE SELECT ON "+adb.HistoryTableSQL(&t)+" FROM "+u)
+				if _, ok := schemas[t.Schema]; !ok {
+					schemas[t.Schema] = false
 				}
 			}
-
+		}
+		// Revoke usage on schemas in which no tables are authorized,
+		// except for the metadb schema which is available to all users.
+		for schema, granted := range schemas {
+			if !granted && schema != "metadb" {
+				_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA \""+schema+"\" FROM "+u)
+			}
 		}
 		////////
 		if re.String == "" {
 			_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA report FROM "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "REVOKE EXECUTE ON ALL FUNCTIONS IN SCHEMA report FROM "+u)
-			_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA folio_derived FROM "+u)
-			_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON ALL TABLES IN SCHEMA folio_derived FROM "+u)
-			_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA reshare_derived FROM "+u)
-			_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON ALL TABLES IN SCHEMA reshare_derived FROM "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "REVOKE EXECUTE ON FUNCTION public.metadb_version FROM "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "REVOKE EXECUTE ON FUNCTION public.ps FROM "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA public FROM "+u)
 		} else {
 			_, _ = dcsuper.Exec(context.TODO(), "GRANT USAGE ON SCHEMA report TO "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA report TO "+u)
+		}
+		// Derived tables are computed from many source tables, and are
+		// available only to users authorized for all tables.
+		if allTables(re) {
 			_, _ = dcsuper.Exec(context.TODO(), "GRANT USAGE ON SCHEMA folio_derived TO "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON ALL TABLES IN SCHEMA folio_derived TO "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "GRANT USAGE ON SCHEMA reshare_derived TO "+u)
 			_, _ = dcsuper.Exec(context.TODO(), "GRANT SELECT ON ALL TABLES IN SCHEMA reshare_derived TO "+u)
+		} else {
+			_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA folio_derived FROM "+u)
+			_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON ALL TABLES IN SCHEMA folio_derived FROM "+u)
+			_, _ = dcsuper.Exec(context.TODO(), "REVOKE USAGE ON SCHEMA reshare_derived FROM "+u)
+			_, _ = dcsuper.Exec(context.TODO(), "REVOKE SELECT ON ALL TABLES IN SCHEMA reshare_derived FROM "+u)
 		}
 		////////
+		// Only the authorization that was applied is marked as
+		// updated, in case it has been changed in the meantime.
+		q := "UPDATE metadb.auth SET dbupdated=TRUE WHERE username=$1 AND tables=$2"
+		if _, err := dc.Exec(context.TODO(), q, u, re.String); err != nil {
+			log.Error("updating user authorizations: %v", err)
+			return
+		}
 	}
-	if _, err := dc.Exec(context.TODO(), "UPDATE metadb.auth SET dbupdated=TRUE"); err != nil {
-		log.Error("updating user authorizations: %v", err)
-		return
-	}
-	if _, err := dc.Exec(context.TODO(), "DELETE FROM metadb.auth WHERE tables=''"); err != nil {
+	if _, err := dc.Exec(context.TODO(), "DELETE FROM metadb.auth WHERE tables='' AND dbupdated"); err != nil {
 		log.Error("cleaning up user authorizations: %v", err)
 		return
 	}
 	log.Trace("updated user permissions")
 }
 
+// AllTablesUsers returns the users that are authorized for all tables and
+// therefore have access to derived tables.
+func AllTablesUsers(dq dbx.Queryable) ([]string, error) {
+	users, err := userRead(dq, false)
+	if err != nil {
+		return nil, fmt.Errorf("reading user authorizations: %v", err)
+	}
+	all := make([]string, 0)
+	for u, re := range users {
+		if allTables(re) {
+			all = append(all, u)
+		}
+	}
+	return all, nil
+}
+
+// allTables returns true if a regex list authorizes all tables.
+func allTables(relist *util.RegexList) bool {
+	for _, s := range strings.Split(relist.String, ",") {
+		if s == ".*" {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 func ListUser(rq *api.UserListRequest) (*api.UserListResponse, error) {
 	sysMu.Lock()
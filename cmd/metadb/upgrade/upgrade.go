@@ -412,6 +412,22 @@ var updbList = []updbFunc{
 	updb22,
 	updb23,
 	updb24,
+	updb25,
+	updb26,
+	updb27,
+	updb28,
+	updb29,
+	updb30,
+	updb31,
+	updb32,
+	updb33,
+	updb34,
+	updb35,
+	updb36,
+	updb37,
+	updb38,
+	updb39,
+	updb40,
 }
 
 func updb8(opt *dbopt) error {
@@ -1680,6 +1696,624 @@ func updb24(opt *dbopt) error {
 	return nil
 }
 
+func updb25(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Create table of user roles.
+	q := "CREATE TABLE metadb.user_role (" +
+		"username text PRIMARY KEY, " +
+		"role text NOT NULL CHECK (role IN ('admin', 'operator', 'readonly')))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 25); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb26(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add source type and logical replication options.
+	q := "ALTER TABLE metadb.source " +
+		"ADD COLUMN type text NOT NULL DEFAULT 'kafka', " +
+		"ADD COLUMN connection text, " +
+		"ADD COLUMN publication text, " +
+		"ADD COLUMN slot text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 26); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb27(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add file source path and offsets.
+	q := "ALTER TABLE metadb.source ADD COLUMN path text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "CREATE TABLE metadb.file_offset (" +
+		"source_name text PRIMARY KEY, " +
+		"file_name text NOT NULL, " +
+		"file_offset bigint NOT NULL)"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 27); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb28(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add schema registry option.
+	q := "ALTER TABLE metadb.source ADD COLUMN schemaregistry text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 28); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb29(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add rewrite rules, and preserve the schema name rewriting that was
+	// previously built in.
+	q := "ALTER TABLE metadb.source ADD COLUMN schemarewrite text, ADD COLUMN tablerewrite text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "UPDATE metadb.source SET schemarewrite = " +
+		"'s/^uchicago_//,s/^lu_//,s/^dbz_//,s/^reports_dev_//,s/^mod_//,s/_storage$//,s/_mod_/_/'"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 29); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb30(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add table and column filters.
+	q := "ALTER TABLE metadb.source ADD COLUMN tablepassfilter text, " +
+		"ADD COLUMN columnpassfilter text, ADD COLUMN columnstopfilter text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 30); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb31(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add masking policies.
+	q := "CREATE TABLE metadb.masking_policy (" +
+		"name text PRIMARY KEY, " +
+		"schema_name text NOT NULL, " +
+		"table_name text NOT NULL, " +
+		"column_name text NOT NULL, " +
+		"method text NOT NULL, " +
+		"length integer, " +
+		"UNIQUE (schema_name, table_name, column_name))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "CREATE TABLE metadb.masking_key (key bytea NOT NULL)"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	if err = catalog.InitMaskingKey(tx); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 31); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb32(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add JSON transforms.
+	q := "CREATE TABLE metadb.json_transform (" +
+		"name text PRIMARY KEY, " +
+		"schema_name text NOT NULL, " +
+		"table_name text NOT NULL, " +
+		"column_name text NOT NULL, " +
+		"method text NOT NULL, " +
+		"target_table text, " +
+		"depth integer, " +
+		"paths text, " +
+		"UNIQUE (schema_name, table_name, column_name))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Retain the previous behavior of not transforming some FOLIO tables.
+	if err = catalog.InitJSONTransforms(tx); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 32); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb33(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add Kafka offsets.
+	q := "CREATE TABLE metadb.kafka_offset (" +
+		"source_name text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"partition integer NOT NULL, " +
+		"next_offset bigint NOT NULL, " +
+		"PRIMARY KEY (source_name, topic, partition))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 33); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb34(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add dead letters and the dead letter policy option.
+	q := "CREATE TABLE metadb.dead_letter (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"topic text, " +
+		"partition integer, " +
+		"message_offset bigint, " +
+		"message_key text, " +
+		"message_value text, " +
+		"error text NOT NULL, " +
+		"attempts integer NOT NULL, " +
+		"created timestamptz NOT NULL DEFAULT now(), " +
+		"replay boolean NOT NULL DEFAULT FALSE, " +
+		"UNIQUE (source_name, topic, partition, message_offset))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "ALTER TABLE metadb.source ADD COLUMN deadletter text"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 34); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb35(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Move the maintenance schedule to each data source.
+	q := "ALTER TABLE metadb.source ADD COLUMN next_maintenance_time timestamptz NOT NULL " +
+		"DEFAULT CURRENT_DATE::timestamptz + INTERVAL '1 day' + INTERVAL '3 hours'"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "UPDATE metadb.source SET next_maintenance_time = m.next_maintenance_time " +
+		"FROM metadb.maintenance AS m WHERE m.next_maintenance_time IS NOT NULL"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "DROP TABLE metadb.maintenance"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 35); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb36(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add Kafka consumer options.
+	q := "CREATE TABLE metadb.kafka_option (" +
+		"source_name text NOT NULL, " +
+		"name text NOT NULL, " +
+		"value text NOT NULL, " +
+		"secret boolean NOT NULL, " +
+		"PRIMARY KEY (source_name, name))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 36); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb37(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add data source status and lag.
+	q := "CREATE TABLE metadb.source_status (" +
+		"source_name text PRIMARY KEY, " +
+		"status text NOT NULL, " +
+		"events_per_second real, " +
+		"last_event_time timestamptz, " +
+		"last_error text, " +
+		"updated timestamptz NOT NULL)"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "CREATE TABLE metadb.kafka_partition_status (" +
+		"source_name text NOT NULL, " +
+		"topic text NOT NULL, " +
+		"partition integer NOT NULL, " +
+		"committed_offset bigint NOT NULL, " +
+		"high_watermark bigint, " +
+		"updated timestamptz NOT NULL, " +
+		"PRIMARY KEY (source_name, topic, partition))"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	q = "CREATE VIEW metadb.source_lag AS " +
+		"SELECT s.source_name, " +
+		"p.topic, " +
+		"p.partition, " +
+		"p.committed_offset, " +
+		"p.high_watermark, " +
+		"CASE WHEN p.high_watermark IS NOT NULL " +
+		"THEN greatest(p.high_watermark - p.committed_offset, 0) END AS lag, " +
+		"s.status, " +
+		"s.events_per_second, " +
+		"s.last_event_time, " +
+		"s.last_error, " +
+		"greatest(s.updated, p.updated) AS updated " +
+		"FROM metadb.source_status AS s " +
+		"LEFT JOIN metadb.kafka_partition_status AS p ON s.source_name = p.source_name"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 37); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb38(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add requests to reset Kafka offsets.
+	q := "CREATE TABLE metadb.kafka_offset_reset (" +
+		"id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY, " +
+		"source_name text NOT NULL, " +
+		"topic text, " +
+		"position text NOT NULL, " +
+		"reset_time timestamptz, " +
+		"requested timestamptz NOT NULL DEFAULT now())"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 38); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb39(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Add paused state of data sources.
+	q := "ALTER TABLE metadb.source ADD COLUMN paused boolean NOT NULL DEFAULT FALSE"
+	if _, err = tx.Exec(context.TODO(), q); err != nil {
+		return err
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 39); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func updb40(opt *dbopt) error {
+	// Open database
+	dc, err := opt.DB.Connect()
+	if err != nil {
+		return err
+	}
+	defer dbx.Close(dc)
+
+	// begin transaction
+	tx, err := dc.Begin(context.TODO())
+	if err != nil {
+		return err
+	}
+	defer dbx.Rollback(tx)
+	// Encrypt secret Kafka options with a key stored in the data directory.
+	key, err := util.ReadSecretKey(opt.Datadir)
+	if err != nil {
+		return err
+	}
+	type option struct {
+		source, name, value string
+	}
+	var options []option
+	rows, err := tx.Query(context.TODO(), "SELECT source_name, name, value FROM metadb.kafka_option WHERE secret")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var o option
+		if err = rows.Scan(&o.source, &o.name, &o.value); err != nil {
+			rows.Close()
+			return err
+		}
+		options = append(options, o)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for _, o := range options {
+		value, err := util.EncryptSecret(key, o.value)
+		if err != nil {
+			return err
+		}
+		q := "UPDATE metadb.kafka_option SET value=$3 WHERE source_name=$1 AND name=$2"
+		if _, err = tx.Exec(context.TODO(), q, o.source, o.name, value); err != nil {
+			return err
+		}
+	}
+	// Write new version number
+	if err = metadata.WriteDatabaseVersion(tx, 40); err != nil {
+		return err
+	}
+	if err = tx.Commit(context.TODO()); err != nil {
+		return err
+	}
+	return nil
+}
+
 //func toPostgresArray(slice []string) string {
 //	var b strings.Builder
 //	b.WriteString("ARRAY[")
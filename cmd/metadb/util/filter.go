@@ -0,0 +1,72 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ColumnFilter matches columns of tables.  It is written in the form
+// table=column, where table is a regular expression matching the schema and
+// table name (schema.table) and column is a regular expression matching the
+// column name.  Alternatively column may be a path to a key within a JSON
+// column, written as names separated by "." (column.key), which matches only
+// that key.
+type ColumnFilter struct {
+	Table  *regexp.Regexp
+	Column *regexp.Regexp
+	// Path is the path to a key within a JSON column, or nil if the filter
+	// matches the whole column.
+	Path []string
+}
+
+// columnPathRegexp matches a path to a key within a JSON column.
+var columnPathRegexp = regexp.MustCompile(`^\w+(\.\w+)+$`)
+
+func CompileColumnFilters(strs []string) ([]*ColumnFilter, error) {
+	var filters []*ColumnFilter
+	for _, s := range strs {
+		t, c, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("compiling column filter %s: expected table=column", s)
+		}
+		table, err := regexp.Compile(t)
+		if err != nil {
+			return nil, fmt.Errorf("compiling column filter %s: %v", s, err)
+		}
+		var path []string
+		if columnPathRegexp.MatchString(c) {
+			names := strings.Split(c, ".")
+			c = "^" + names[0] + "$"
+			path = names[1:]
+		}
+		column, err := regexp.Compile(c)
+		if err != nil {
+			return nil, fmt.Errorf("compiling column filter %s: %v", s, err)
+		}
+		filters = append(filters, &ColumnFilter{Table: table, Column: column, Path: path})
+	}
+	return filters, nil
+}
+
+// TableColumnFilters returns the column filters that apply to a table.
+func TableColumnFilters(filters []*ColumnFilter, schemaTable string) []*ColumnFilter {
+	var res []*ColumnFilter
+	for _, f := range filters {
+		if f.Table.MatchString(schemaTable) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// MatchColumnFilters returns true if a column name matches any of the filters
+// that match whole columns.
+func MatchColumnFilters(filters []*ColumnFilter, column string) bool {
+	for _, f := range filters {
+		if f.Path == nil && f.Column.MatchString(column) {
+			return true
+		}
+	}
+	return false
+}
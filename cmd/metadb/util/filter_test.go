@@ -0,0 +1,49 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestCompileColumnFilters(t *testing.T) {
+	filters, err := CompileColumnFilters([]string{`^a\.b$=^c$`, `^a\.=^(d|e)$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(TableColumnFilters(filters, "a.b")); n != 2 {
+		t.Errorf("a.b: got %d filters; want 2", n)
+	}
+	if n := len(TableColumnFilters(filters, "a.x")); n != 1 {
+		t.Errorf("a.x: got %d filters; want 1", n)
+	}
+	if n := len(TableColumnFilters(filters, "x.b")); n != 0 {
+		t.Errorf("x.b: got %d filters; want 0", n)
+	}
+	for _, s := range []string{"a.b", "(=c", "a=("} {
+		if _, err = CompileColumnFilters([]string{s}); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestCompileColumnFiltersPath(t *testing.T) {
+	filters, err := CompileColumnFilters([]string{`\.users$=jsonb.personal.email`, `\.users$=^jsonb$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := filters[0]
+	if !f.Column.MatchString("jsonb") || f.Column.MatchString("jsonb2") {
+		t.Errorf("path filter column: got %s", f.Column)
+	}
+	if len(f.Path) != 2 || f.Path[0] != "personal" || f.Path[1] != "email" {
+		t.Errorf("path filter: got path %v; want [personal email]", f.Path)
+	}
+	if filters[1].Path != nil {
+		t.Errorf("column filter: got path %v; want nil", filters[1].Path)
+	}
+	if !MatchColumnFilters(filters, "jsonb") {
+		t.Errorf("jsonb: got no match; want match")
+	}
+	if MatchColumnFilters(filters[:1], "jsonb") {
+		t.Errorf("jsonb: path filter matches whole column")
+	}
+}
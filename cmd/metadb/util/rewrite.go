@@ -0,0 +1,113 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// RewriteRule is a substitution written in the form s/pattern/replacement/,
+// where pattern is a regular expression and replacement may refer to
+// submatches as $1, $2, etc.  Only the first match is replaced unless the
+// rule ends with the flag "g".  Any character may be used as the delimiter in
+// place of "/".
+type RewriteRule struct {
+	re          *regexp.Regexp
+	replacement string
+	global      bool
+}
+
+// SplitRewriteRules splits a comma-separated list of rewrite rules.  A comma
+// within the pattern or replacement of a rule does not end the rule.
+func SplitRewriteRules(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	var rules []string
+	for {
+		n := rewriteRuleLen(list)
+		i := strings.IndexByte(list[n:], ',')
+		if i < 0 {
+			return append(rules, strings.TrimSpace(list))
+		}
+		rules = append(rules, strings.TrimSpace(list[:n+i]))
+		list = list[n+i+1:]
+	}
+}
+
+// rewriteRuleLen returns the length of the prefix of s up to and including the
+// last delimiter of a rewrite rule, or 0 if s does not begin with a rule.
+func rewriteRuleLen(s string) int {
+	t := strings.TrimLeftFunc(s, unicode.IsSpace)
+	if len(t) < 2 || t[0] != 's' {
+		return 0
+	}
+	delim := t[1]
+	var n int
+	for i := 2; i < len(t); i++ {
+		if t[i] == delim {
+			n++
+			if n == 2 {
+				return len(s) - len(t) + i + 1
+			}
+		}
+	}
+	return 0
+}
+
+func CompileRewriteRules(strs []string) ([]*RewriteRule, error) {
+	var rules []*RewriteRule
+	for _, s := range strs {
+		r, err := compileRewriteRule(s)
+		if err != nil {
+			return nil, fmt.Errorf("compiling rewrite rule %s: %v", s, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func compileRewriteRule(s string) (*RewriteRule, error) {
+	if len(s) < 2 || s[0] != 's' {
+		return nil, fmt.Errorf("expected s/pattern/replacement/")
+	}
+	delim := s[1:2]
+	sp := strings.Split(s[2:], delim)
+	if len(sp) != 3 {
+		return nil, fmt.Errorf("expected s%spattern%sreplacement%s", delim, delim, delim)
+	}
+	var global bool
+	switch sp[2] {
+	case "":
+	case "g":
+		global = true
+	default:
+		return nil, fmt.Errorf("unknown flag %q", sp[2])
+	}
+	re, err := regexp.Compile(sp[0])
+	if err != nil {
+		return nil, err
+	}
+	return &RewriteRule{re: re, replacement: sp[1], global: global}, nil
+}
+
+// Rewrite applies the rules to s in order.
+func Rewrite(rules []*RewriteRule, s string) string {
+	for _, r := range rules {
+		if r.global {
+			s = r.re.ReplaceAllString(s, r.replacement)
+			continue
+		}
+		m := r.re.FindStringSubmatchIndex(s)
+		if m == nil {
+			continue
+		}
+		var b []byte
+		b = append(b, s[:m[0]]...)
+		b = r.re.ExpandString(b, r.replacement, s, m)
+		b = append(b, s[m[1]:]...)
+		s = string(b)
+	}
+	return s
+}
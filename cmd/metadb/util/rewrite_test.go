@@ -0,0 +1,68 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+var rewriteTests = []struct {
+	rules []string
+	in    string
+	out   string
+}{
+	{nil, "folio_users", "folio_users"},
+	{[]string{"s/^uchicago_//"}, "uchicago_mod_users", "mod_users"},
+	{[]string{"s/^uchicago_//", "s/^mod_//", "s/_storage$//"}, "uchicago_mod_users_storage", "users"},
+	{[]string{"s/_mod_/_/"}, "a_mod_b_mod_c", "a_b_mod_c"},
+	{[]string{"s/_mod_/_/g"}, "a_mod_b_mod_c", "a_b_c"},
+	{[]string{"s/^(.*)_v([0-9]+)$/${1}_version_$2/"}, "loan_v2", "loan_version_2"},
+	{[]string{"s|^a/b|c|"}, "a/bd", "cd"},
+}
+
+func TestRewrite(t *testing.T) {
+	for _, tt := range rewriteTests {
+		rules, err := CompileRewriteRules(tt.rules)
+		if err != nil {
+			t.Errorf("%v: %v", tt.rules, err)
+			continue
+		}
+		if got := Rewrite(rules, tt.in); got != tt.out {
+			t.Errorf("%v: %q: got %q; want %q", tt.rules, tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestCompileRewriteRulesInvalid(t *testing.T) {
+	for _, s := range []string{"", "s", "x/a/b/", "s/a/b", "s/a/b/x", "s/(/b/"} {
+		if _, err := CompileRewriteRules([]string{s}); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestSplitRewriteRules(t *testing.T) {
+	cases := []struct {
+		list  string
+		rules []string
+	}{
+		{"", []string{}},
+		{"s/^mod_//", []string{"s/^mod_//"}},
+		{"s/^mod_//, s/_storage$//g", []string{"s/^mod_//", "s/_storage$//g"}},
+		{"s/_v[0-9]{1,3}$//,s/^mod_//", []string{"s/_v[0-9]{1,3}$//", "s/^mod_//"}},
+		{"s/^mod_//,s/a,b/c,d/", []string{"s/^mod_//", "s/a,b/c,d/"}},
+		{"s,a,b,g,s/c/d/", []string{"s,a,b,g", "s/c/d/"}},
+		{"x,s/a/b/", []string{"x", "s/a/b/"}},
+	}
+	for _, c := range cases {
+		if got := SplitRewriteRules(c.list); !reflect.DeepEqual(got, c.rules) {
+			t.Errorf("%q: got %q; want %q", c.list, got, c.rules)
+		}
+	}
+	rules, err := CompileRewriteRules(SplitRewriteRules("s/_v[0-9]{1,3}$//,s/^mod_//"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Rewrite(rules, "mod_loan_v12"); got != "loan" {
+		t.Errorf("got %q; want %q", got, "loan")
+	}
+}
@@ -0,0 +1,87 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretKeyFileName returns the name of the file containing the key used to
+// encrypt secret configuration values stored in the database.  The key is
+// kept in the data directory rather than in the database, so that the
+// encrypted values cannot be read with access to the database alone.
+func SecretKeyFileName(datadir string) string {
+	return filepath.Join(datadir, "secret.key")
+}
+
+// ReadSecretKey returns the key used to encrypt secret configuration values.
+// If the key file does not exist, a new key is generated and written to it.
+func ReadSecretKey(datadir string) ([]byte, error) {
+	filename := SecretKeyFileName(datadir)
+	b, err := os.ReadFile(filename)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return nil, fmt.Errorf("generating secret key: %v", err)
+		}
+		if err = os.WriteFile(filename, []byte(hex.EncodeToString(key)+"\n"), ModePermRW); err != nil {
+			return nil, fmt.Errorf("writing secret key: %v", err)
+		}
+		return key, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading secret key: %v", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("reading secret key: invalid key in %s", filename)
+	}
+	return key, nil
+}
+
+// EncryptSecret encrypts a value using AES-GCM and returns it encoded as
+// base64.
+func EncryptSecret(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("encrypting secret: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// DecryptSecret decrypts a value encrypted by EncryptSecret.
+func DecryptSecret(key []byte, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(b) < gcm.NonceSize() {
+		return "", fmt.Errorf("decrypting secret: invalid value")
+	}
+	plaintext, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting secret: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secret key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSecretKey(t *testing.T) {
+	datadir := t.TempDir()
+	key, err := ReadSecretKey(datadir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(SecretKeyFileName(datadir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != ModePermRW {
+		t.Errorf("key file mode: got %v; want %v", fi.Mode().Perm(), os.FileMode(ModePermRW))
+	}
+	key2, err := ReadSecretKey(datadir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, key2) {
+		t.Errorf("key read again differs from generated key")
+	}
+}
+
+func TestEncryptSecret(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	enc, err := EncryptSecret(key, "zpR5tK8wqN3v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc == "zpR5tK8wqN3v" {
+		t.Errorf("value not encrypted")
+	}
+	dec, err := DecryptSecret(key, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec != "zpR5tK8wqN3v" {
+		t.Errorf("got %q; want %q", dec, "zpR5tK8wqN3v")
+	}
+	if _, err = DecryptSecret(bytes.Repeat([]byte{8}, 32), enc); err == nil {
+		t.Errorf("decrypting with a different key: expected error")
+	}
+}
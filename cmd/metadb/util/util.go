@@ -13,7 +13,7 @@ import (
 	"gopkg.in/ini.v1"
 )
 
-const DatabaseVersion = 24
+const DatabaseVersion = 40
 
 // MetadbVersion is defined at build time via -ldflags.
 var MetadbVersion = "(unknown version)"
@@ -70,6 +70,22 @@ func MatchRegexps(res []*regexp.Regexp, s string) bool {
 	return false
 }
 
+// MatchTopic returns true if a Kafka topic is included in a list of topics to
+// subscribe to.  As in a Kafka subscription, an entry beginning with "^" is a
+// regular expression, and other entries are topic names.
+func MatchTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if strings.HasPrefix(t, "^") {
+			if re, err := regexp.Compile(t); err == nil && re.MatchString(topic) {
+				return true
+			}
+		} else if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
 func CompileRegexps(strs []string) ([]*regexp.Regexp, error) {
 	var res []*regexp.Regexp
 	for _, s := range strs {
@@ -236,6 +252,24 @@ func ReadConfigDatabase(datadir string) (*dbx.DB, error) {
 		}
 	}
 
+	jsonDepth := 3
+	v = s.Key("json_depth").String()
+	if v != "" {
+		jsonDepth, err = strconv.Atoi(v)
+		if err != nil || jsonDepth < 1 {
+			return nil, fmt.Errorf("reading json_depth: parsing %q: invalid syntax", v)
+		}
+	}
+
+	applyWorkers := 4
+	v = s.Key("apply_workers").String()
+	if v != "" {
+		applyWorkers, err = strconv.Atoi(v)
+		if err != nil || applyWorkers < 1 {
+			return nil, fmt.Errorf("reading apply_workers: parsing %q: invalid syntax", v)
+		}
+	}
+
 	return &dbx.DB{
 		Host:                  s.Key("host").String(),
 		Port:                  s.Key("port").String(),
@@ -247,6 +281,8 @@ func ReadConfigDatabase(datadir string) (*dbx.DB, error) {
 		SSLMode:               s.Key("sslmode").String(),
 		CheckpointSegmentSize: checkpointSegmentSize,
 		MaxPollInterval:       maxPollInterval,
+		JSONDepth:             jsonDepth,
+		ApplyWorkers:          applyWorkers,
 	}, nil
 }
 
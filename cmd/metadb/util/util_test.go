@@ -0,0 +1,27 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	topics := []string{"^metadb_sensor_1[.].*", "patron"}
+	cases := []struct {
+		topic string
+		want  bool
+	}{
+		{"metadb_sensor_1.public.patron", true},
+		{"metadb_sensor_2.public.patron", false},
+		{"patron", true},
+		{"patron2", false},
+		{"^metadb_sensor_1[.].*", false},
+	}
+	for _, c := range cases {
+		if got := MatchTopic(topics, c.topic); got != c.want {
+			t.Errorf("MatchTopic(%q) = %v; want %v", c.topic, got, c.want)
+		}
+	}
+	if MatchTopic(nil, "patron") {
+		t.Errorf("MatchTopic(nil): got match; want no match")
+	}
+}